@@ -0,0 +1,17 @@
+// Package api embeds the machine-readable API contracts: the OpenAPI
+// document of the HTTP API and the AsyncAPI document of the chat WebSocket.
+package api
+
+import _ "embed"
+
+//go:generate go run ../internal/openapi/gen -spec openapi.json -package apiclient -out ../internal/apiclient/client.gen.go
+
+// OpenAPI is the OpenAPI 3.1 document served at /openapi.json.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// AsyncAPI is the AsyncAPI 3.0 document of the chat protocol.
+//
+//go:embed asyncapi.yaml
+var AsyncAPI []byte
@@ -0,0 +1,14 @@
+// Command matchmaker runs any combination of the services in one process.
+// With the default MODULES it is the modular monolith; with e.g. MODULES=user
+// it behaves like the standalone user service.
+package main
+
+import (
+	"matchmaker/internal/app"
+	"matchmaker/internal/logging"
+)
+
+func main() {
+	logging.Init()
+	app.Run()
+}
@@ -0,0 +1,830 @@
+// Code generated by internal/openapi/gen from api/openapi.json; DO NOT EDIT.
+
+// Package apiclient is a Go client for the Matchmaker HTTP API.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Analysis is the Analysis schema.
+type Analysis struct {
+	AlgorithmVersion string `json:"algorithmVersion"`
+	AnalysisID       string `json:"analysisId"`
+	// Ashtakoota factors; empty for the legacy algorithm.
+	Breakdown []Koota   `json:"breakdown"`
+	CreatedAt time.Time `json:"createdAt"`
+	// SHA-256 of both report keys; birth details are not stored.
+	InputHash string `json:"inputHash"`
+	// Keys of the two reports, person A first.
+	ReportKeys []string `json:"reportKeys"`
+	// Percentage of the maximum score.
+	Score int64 `json:"score"`
+}
+
+// AnalysisPage is the AnalysisPage schema.
+type AnalysisPage struct {
+	Items  []Analysis `json:"items"`
+	Limit  int64      `json:"limit"`
+	Offset int64      `json:"offset"`
+	Total  int64      `json:"total"`
+}
+
+// AnalysisRequest is the AnalysisRequest schema.
+type AnalysisRequest struct {
+	PersonA BirthDetails `json:"personA"`
+	PersonB BirthDetails `json:"personB"`
+}
+
+// AnalysisWebhook is the AnalysisWebhook schema.
+type AnalysisWebhook struct {
+	CreatedAt time.Time `json:"createdAt"`
+	// Key of the HMAC-SHA256 signatures of deliveries; only returned when the webhook is registered.
+	Secret string `json:"secret,omitempty"`
+	URL    string `json:"url"`
+}
+
+// BatchCandidate is the BatchCandidate schema.
+type BatchCandidate struct {
+	// A label for the candidate, echoed in the ranking.
+	Name   string       `json:"name,omitempty"`
+	Person BirthDetails `json:"person"`
+}
+
+// BatchMatch is the BatchMatch schema.
+type BatchMatch struct {
+	Analysis Analysis `json:"analysis,omitempty"`
+	// Why the candidate could not be analysed.
+	Error string `json:"error,omitempty"`
+	// Position of the candidate in the request.
+	Index int64  `json:"index"`
+	Name  string `json:"name,omitempty"`
+	// Position by score, best first; absent for failed candidates.
+	Rank int64 `json:"rank,omitempty"`
+}
+
+// BatchRequest is the BatchRequest schema.
+type BatchRequest struct {
+	// At most MATCH_BATCH_MAX_CANDIDATES (50 by default) candidates.
+	Candidates []BatchCandidate `json:"candidates"`
+	Subject    BirthDetails     `json:"subject"`
+}
+
+// BatchResult is the BatchResult schema.
+type BatchResult struct {
+	Failed    int64        `json:"failed"`
+	Matches   []BatchMatch `json:"matches"`
+	Succeeded int64        `json:"succeeded"`
+}
+
+// BirthDetail is the BirthDetail schema.
+type BirthDetail struct {
+	CreatedAt time.Time  `json:"CreatedAt,omitempty"`
+	DOB       time.Time  `json:"DOB,omitempty"`
+	DeletedAt *time.Time `json:"DeletedAt,omitempty"`
+	ID        int64      `json:"ID,omitempty"`
+	Latitude  float64    `json:"Latitude,omitempty"`
+	Longitude float64    `json:"Longitude,omitempty"`
+	TOB       string     `json:"TOB,omitempty"`
+	UpdatedAt time.Time  `json:"UpdatedAt,omitempty"`
+	UserID    int64      `json:"UserID,omitempty"`
+}
+
+// BirthDetails is the BirthDetails schema.
+type BirthDetails struct {
+	// Date of birth, e.g. 1990-01-01.
+	DOB string  `json:"dob"`
+	Lat float64 `json:"lat,omitempty"`
+	Lon float64 `json:"lon,omitempty"`
+	// Time of birth, e.g. 12:00:00.
+	TOB string `json:"tob"`
+}
+
+// ChatSession is the ChatSession schema.
+type ChatSession struct {
+	// The analysis the conversation is about, if any.
+	AnalysisID   string    `json:"analysisId,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	MessageCount int64     `json:"messageCount"`
+	SessionID    string    `json:"sessionId"`
+	Title        string    `json:"title"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// ChatSessionPage is the ChatSessionPage schema.
+type ChatSessionPage struct {
+	Items  []ChatSession `json:"items"`
+	Limit  int64         `json:"limit"`
+	Offset int64         `json:"offset"`
+	Total  int64         `json:"total"`
+}
+
+// CreateUserRequest is the CreateUserRequest schema.
+type CreateUserRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// CreateUserResponse is the CreateUserResponse schema.
+type CreateUserResponse struct {
+	ID int64 `json:"id"`
+}
+
+// Error is the Error schema.
+type Error struct {
+	Code    ErrorCode    `json:"code"`
+	Details []FieldError `json:"details,omitempty"`
+	// Human-readable message.
+	Error     string `json:"error"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// ErrorCode is the ErrorCode schema.
+type ErrorCode string
+
+const (
+	ErrorCodeInvalidRequest      ErrorCode = "invalid_request"
+	ErrorCodeValidationFailed    ErrorCode = "validation_failed"
+	ErrorCodeUnauthenticated     ErrorCode = "unauthenticated"
+	ErrorCodeForbidden           ErrorCode = "forbidden"
+	ErrorCodeNotFound            ErrorCode = "not_found"
+	ErrorCodeMethodNotAllowed    ErrorCode = "method_not_allowed"
+	ErrorCodeConflict            ErrorCode = "conflict"
+	ErrorCodeRateLimited         ErrorCode = "rate_limited"
+	ErrorCodeContentBlocked      ErrorCode = "content_blocked"
+	ErrorCodeInternal            ErrorCode = "internal"
+	ErrorCodeUpstreamError       ErrorCode = "upstream_error"
+	ErrorCodeUpstreamUnavailable ErrorCode = "upstream_unavailable"
+	ErrorCodeTimeout             ErrorCode = "timeout"
+)
+
+// FieldError is the FieldError schema.
+type FieldError struct {
+	Code    string `json:"code"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Health is the Health schema.
+type Health struct {
+	Checks map[string]string `json:"checks,omitempty"`
+	Status string            `json:"status"`
+}
+
+// JobStatus is the JobStatus schema.
+type JobStatus struct {
+	Analysis  Analysis  `json:"analysis,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Why the job failed.
+	Error     string      `json:"error,omitempty"`
+	JobID     string      `json:"jobId"`
+	Kind      string      `json:"kind"`
+	Result    BatchResult `json:"result,omitempty"`
+	Status    string      `json:"status"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+// Koota is the Koota schema.
+type Koota struct {
+	// What the koota measures and how favourable its points are, in the language of the request.
+	Explanation string `json:"explanation,omitempty"`
+	// Name of the koota in the language of the request.
+	Label  string  `json:"label,omitempty"`
+	Max    float64 `json:"max"`
+	Name   string  `json:"name"`
+	Points float64 `json:"points"`
+}
+
+// ModerationEvent is the ModerationEvent schema.
+type ModerationEvent struct {
+	Action     string              `json:"action"`
+	AnalysisID string              `json:"analysisId,omitempty"`
+	CreatedAt  time.Time           `json:"createdAt"`
+	Direction  string              `json:"direction"`
+	Findings   []ModerationFinding `json:"findings"`
+	ID         string              `json:"id"`
+	// The user message, or the message an answer replied to.
+	MessageID string           `json:"messageId,omitempty"`
+	Review    ModerationReview `json:"review,omitempty"`
+	Status    string           `json:"status"`
+	// The moderated text with personal data redacted.
+	Text   string `json:"text"`
+	UserID int64  `json:"userId"`
+}
+
+// ModerationFinding is the ModerationFinding schema.
+type ModerationFinding struct {
+	Action   string `json:"action"`
+	Category string `json:"category,omitempty"`
+	// The rule that matched, or external for the moderation service.
+	Rule string `json:"rule"`
+}
+
+// ModerationPage is the ModerationPage schema.
+type ModerationPage struct {
+	Items  []ModerationEvent `json:"items"`
+	Limit  int64             `json:"limit"`
+	Offset int64             `json:"offset"`
+	Total  int64             `json:"total"`
+}
+
+// ModerationReview is the ModerationReview schema.
+type ModerationReview struct {
+	At          time.Time `json:"at"`
+	ModeratorID int64     `json:"moderatorId"`
+	Note        string    `json:"note,omitempty"`
+}
+
+// PeriodUsage is the PeriodUsage schema.
+type PeriodUsage struct {
+	CompletionTokens int64 `json:"completionTokens"`
+	// The plan's token quota for the period; 0 is unlimited.
+	Limit    int64 `json:"limit"`
+	Messages int64 `json:"messages"`
+	// The UTC day (2026-10-19) or month (2026-10).
+	Period       string    `json:"period"`
+	PromptTokens int64     `json:"promptTokens"`
+	ResetsAt     time.Time `json:"resetsAt"`
+	// Prompt and completion tokens, which the quota limits.
+	Tokens int64 `json:"tokens"`
+}
+
+// Pong is the Pong schema.
+type Pong struct {
+	Message string `json:"message"`
+}
+
+// Problem is the Problem schema.
+type Problem struct {
+	Code      ErrorCode    `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+	Status    int64        `json:"status"`
+	Title     string       `json:"title"`
+	Type      string       `json:"type"`
+}
+
+// ProfileUpdate is the ProfileUpdate schema.
+type ProfileUpdate struct {
+	Gender string `json:"gender,omitempty"`
+	// Preferred language. A new one comes back in a refreshed token.
+	Locale   string `json:"locale,omitempty"`
+	Location string `json:"location,omitempty"`
+	PhotoURL string `json:"photoURL,omitempty"`
+}
+
+// PromptPreview is the PromptPreview schema.
+type PromptPreview struct {
+	Prompt  string `json:"prompt"`
+	Version string `json:"version"`
+}
+
+// PromptPreviewRequest is the PromptPreviewRequest schema.
+type PromptPreviewRequest struct {
+	// An analysis of userId to render the prompt about.
+	AnalysisID string `json:"analysisId,omitempty"`
+	Locale     string `json:"locale,omitempty"`
+	Persona    string `json:"persona,omitempty"`
+	// Defaults to the caller.
+	UserID int64 `json:"userId,omitempty"`
+	// Template version; defaults to the one assigned to userId.
+	Version string `json:"version,omitempty"`
+}
+
+// Report: Engine-specific report document.
+type Report = json.RawMessage
+
+// ReviewRequest is the ReviewRequest schema.
+type ReviewRequest struct {
+	Decision string `json:"decision"`
+	Note     string `json:"note,omitempty"`
+}
+
+// TokenResponse is the TokenResponse schema.
+type TokenResponse struct {
+	Token string `json:"token"`
+}
+
+// TranscriptExport is the TranscriptExport schema.
+type TranscriptExport struct {
+	Messages []TranscriptMessage `json:"messages"`
+	Session  ChatSession         `json:"session"`
+}
+
+// TranscriptMessage is the TranscriptMessage schema.
+type TranscriptMessage struct {
+	At time.Time `json:"at"`
+	// Tokens an answer cost.
+	CompletionTokens int64  `json:"completionTokens,omitempty"`
+	Content          string `json:"content"`
+	// Tokens the prompt of an answer cost.
+	PromptTokens int64 `json:"promptTokens,omitempty"`
+	// Version of the prompt template an answer was generated with.
+	PromptVersion string `json:"promptVersion,omitempty"`
+	Role          string `json:"role"`
+	Seq           int64  `json:"seq"`
+}
+
+// TranscriptPage is the TranscriptPage schema.
+type TranscriptPage struct {
+	Items   []TranscriptMessage `json:"items"`
+	Limit   int64               `json:"limit"`
+	Offset  int64               `json:"offset"`
+	Session ChatSession         `json:"session"`
+	Total   int64               `json:"total"`
+}
+
+// UsageReport is the UsageReport schema.
+type UsageReport struct {
+	Daily   PeriodUsage `json:"daily"`
+	Monthly PeriodUsage `json:"monthly"`
+	Plan    string      `json:"plan"`
+}
+
+// User is the User schema.
+type User struct {
+	BirthDetail BirthDetail `json:"BirthDetail,omitempty"`
+	CreatedAt   time.Time   `json:"CreatedAt,omitempty"`
+	DeletedAt   *time.Time  `json:"DeletedAt,omitempty"`
+	Email       string      `json:"Email"`
+	Gender      string      `json:"Gender,omitempty"`
+	ID          int64       `json:"ID"`
+	// Preferred language; empty when the user has not chosen one.
+	Locale   string `json:"Locale,omitempty"`
+	Location string `json:"Location,omitempty"`
+	PhotoURL string `json:"PhotoURL,omitempty"`
+	// The chat plan whose quotas apply to the user.
+	Plan      string    `json:"Plan,omitempty"`
+	UpdatedAt time.Time `json:"UpdatedAt,omitempty"`
+}
+
+// WebhookRequest is the WebhookRequest schema.
+type WebhookRequest struct {
+	// An http or https URL.
+	URL string `json:"url"`
+}
+
+// Client calls the Matchmaker API.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Token, when set, is sent as a bearer token.
+	Token string
+}
+
+// NewClient returns a Client for the API at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), HTTPClient: http.DefaultClient}
+}
+
+// APIError is an error response from the API.
+type APIError struct {
+	StatusCode int
+	Body       Error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("status %d: %s: %s", e.StatusCode, e.Body.Code, e.Body.Error)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(data, &apiErr.Body) != nil || apiErr.Body.Code == "" {
+			apiErr.Body.Error = strings.TrimSpace(string(data))
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// PreviewPrompt calls POST /api/v1/admin/prompts/preview. Render the chat system prompt for a template version, user, analysis, locale and persona. Requires the admin role.
+func (c *Client) PreviewPrompt(ctx context.Context, body PromptPreviewRequest) (*PromptPreview, error) {
+	q := url.Values{}
+	var out PromptPreview
+	if err := c.do(ctx, "POST", "/api/v1/admin/prompts/preview", q, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListAnalysesParams holds the query parameters of ListAnalyses.
+type ListAnalysesParams struct {
+	Mine   string
+	Offset string
+	Limit  string
+}
+
+// ListAnalyses calls GET /api/v1/analysis. List the caller's analyses, newest first.
+func (c *Client) ListAnalyses(ctx context.Context, params ListAnalysesParams) (*AnalysisPage, error) {
+	q := url.Values{}
+	if params.Mine != "" {
+		q.Set("mine", params.Mine)
+	}
+	if params.Offset != "" {
+		q.Set("offset", params.Offset)
+	}
+	if params.Limit != "" {
+		q.Set("limit", params.Limit)
+	}
+	var out AnalysisPage
+	if err := c.do(ctx, "GET", "/api/v1/analysis", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateAnalysisParams holds the query parameters of CreateAnalysis.
+type CreateAnalysisParams struct {
+	Async string
+}
+
+// CreateAnalysis calls POST /api/v1/analysis. Score the compatibility of two people.
+func (c *Client) CreateAnalysis(ctx context.Context, params CreateAnalysisParams, body AnalysisRequest) (*Analysis, error) {
+	q := url.Values{}
+	if params.Async != "" {
+		q.Set("async", params.Async)
+	}
+	var out Analysis
+	if err := c.do(ctx, "POST", "/api/v1/analysis", q, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateBatchAnalysisParams holds the query parameters of CreateBatchAnalysis.
+type CreateBatchAnalysisParams struct {
+	Async string
+}
+
+// CreateBatchAnalysis calls POST /api/v1/analysis/batch. Rank candidates by their compatibility with one subject. Large batches, and any batch when async is true, run as a job.
+func (c *Client) CreateBatchAnalysis(ctx context.Context, params CreateBatchAnalysisParams, body BatchRequest) (*BatchResult, error) {
+	q := url.Values{}
+	if params.Async != "" {
+		q.Set("async", params.Async)
+	}
+	var out BatchResult
+	if err := c.do(ctx, "POST", "/api/v1/analysis/batch", q, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAnalysisJob calls GET /api/v1/analysis/jobs/{id}. Fetch the state of one of the caller's analysis jobs.
+func (c *Client) GetAnalysisJob(ctx context.Context, id string) (*JobStatus, error) {
+	q := url.Values{}
+	var out JobStatus
+	if err := c.do(ctx, "GET", strings.ReplaceAll("/api/v1/analysis/jobs/{id}", "{id}", url.PathEscape(id)), q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAnalysisWebhook calls GET /api/v1/analysis/webhook. Fetch the caller's webhook, without its secret.
+func (c *Client) GetAnalysisWebhook(ctx context.Context) (*AnalysisWebhook, error) {
+	q := url.Values{}
+	var out AnalysisWebhook
+	if err := c.do(ctx, "GET", "/api/v1/analysis/webhook", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PutAnalysisWebhook calls PUT /api/v1/analysis/webhook. Register the URL to which the caller's finished analysis jobs are posted, replacing any registered before. Deliveries are signed with the secret returned here, and only here.
+func (c *Client) PutAnalysisWebhook(ctx context.Context, body WebhookRequest) (*AnalysisWebhook, error) {
+	q := url.Values{}
+	var out AnalysisWebhook
+	if err := c.do(ctx, "PUT", "/api/v1/analysis/webhook", q, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAnalysisWebhook calls DELETE /api/v1/analysis/webhook. Stop posting the caller's finished analysis jobs.
+func (c *Client) DeleteAnalysisWebhook(ctx context.Context) error {
+	q := url.Values{}
+	return c.do(ctx, "DELETE", "/api/v1/analysis/webhook", q, nil, nil)
+}
+
+// GetAnalysis calls GET /api/v1/analysis/{id}. Fetch one of the caller's analyses.
+func (c *Client) GetAnalysis(ctx context.Context, id string) (*Analysis, error) {
+	q := url.Values{}
+	var out Analysis
+	if err := c.do(ctx, "GET", strings.ReplaceAll("/api/v1/analysis/{id}", "{id}", url.PathEscape(id)), q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAnalysis calls DELETE /api/v1/analysis/{id}. Delete one of the caller's analyses.
+func (c *Client) DeleteAnalysis(ctx context.Context, id string) error {
+	q := url.Values{}
+	return c.do(ctx, "DELETE", strings.ReplaceAll("/api/v1/analysis/{id}", "{id}", url.PathEscape(id)), q, nil, nil)
+}
+
+// GoogleCallbackParams holds the query parameters of GoogleCallback.
+type GoogleCallbackParams struct {
+	Code string
+}
+
+// GoogleCallback calls GET /api/v1/auth/google/callback. Exchange a Google authorization code for a Matchmaker JWT.
+func (c *Client) GoogleCallback(ctx context.Context, params GoogleCallbackParams) (*TokenResponse, error) {
+	q := url.Values{}
+	if params.Code != "" {
+		q.Set("code", params.Code)
+	}
+	var out TokenResponse
+	if err := c.do(ctx, "GET", "/api/v1/auth/google/callback", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListChatSessionsParams holds the query parameters of ListChatSessions.
+type ListChatSessionsParams struct {
+	Offset string
+	Limit  string
+}
+
+// ListChatSessions calls GET /api/v1/chat/sessions. List the caller's chat sessions, most recently active first.
+func (c *Client) ListChatSessions(ctx context.Context, params ListChatSessionsParams) (*ChatSessionPage, error) {
+	q := url.Values{}
+	if params.Offset != "" {
+		q.Set("offset", params.Offset)
+	}
+	if params.Limit != "" {
+		q.Set("limit", params.Limit)
+	}
+	var out ChatSessionPage
+	if err := c.do(ctx, "GET", "/api/v1/chat/sessions", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteChatSession calls DELETE /api/v1/chat/sessions/{id}. Delete one of the caller's chat sessions; the assistant forgets the conversation too.
+func (c *Client) DeleteChatSession(ctx context.Context, id string) error {
+	q := url.Values{}
+	return c.do(ctx, "DELETE", strings.ReplaceAll("/api/v1/chat/sessions/{id}", "{id}", url.PathEscape(id)), q, nil, nil)
+}
+
+// ExportChatSessionParams holds the query parameters of ExportChatSession.
+type ExportChatSessionParams struct {
+	Format string
+}
+
+// ExportChatSession calls GET /api/v1/chat/sessions/{id}/export. Download the whole transcript of one of the caller's chat sessions.
+func (c *Client) ExportChatSession(ctx context.Context, id string, params ExportChatSessionParams) (*TranscriptExport, error) {
+	q := url.Values{}
+	if params.Format != "" {
+		q.Set("format", params.Format)
+	}
+	var out TranscriptExport
+	if err := c.do(ctx, "GET", strings.ReplaceAll("/api/v1/chat/sessions/{id}/export", "{id}", url.PathEscape(id)), q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetChatTranscriptParams holds the query parameters of GetChatTranscript.
+type GetChatTranscriptParams struct {
+	Offset string
+	Limit  string
+}
+
+// GetChatTranscript calls GET /api/v1/chat/sessions/{id}/messages. Fetch a page of the messages of one of the caller's chat sessions, oldest first.
+func (c *Client) GetChatTranscript(ctx context.Context, id string, params GetChatTranscriptParams) (*TranscriptPage, error) {
+	q := url.Values{}
+	if params.Offset != "" {
+		q.Set("offset", params.Offset)
+	}
+	if params.Limit != "" {
+		q.Set("limit", params.Limit)
+	}
+	var out TranscriptPage
+	if err := c.do(ctx, "GET", strings.ReplaceAll("/api/v1/chat/sessions/{id}/messages", "{id}", url.PathEscape(id)), q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListModerationEventsParams holds the query parameters of ListModerationEvents.
+type ListModerationEventsParams struct {
+	Status string
+	UserID string
+	Offset string
+	Limit  string
+}
+
+// ListModerationEvents calls GET /api/v1/moderation/events. List chat moderation events, newest first. Requires the moderator role.
+func (c *Client) ListModerationEvents(ctx context.Context, params ListModerationEventsParams) (*ModerationPage, error) {
+	q := url.Values{}
+	if params.Status != "" {
+		q.Set("status", params.Status)
+	}
+	if params.UserID != "" {
+		q.Set("userId", params.UserID)
+	}
+	if params.Offset != "" {
+		q.Set("offset", params.Offset)
+	}
+	if params.Limit != "" {
+		q.Set("limit", params.Limit)
+	}
+	var out ModerationPage
+	if err := c.do(ctx, "GET", "/api/v1/moderation/events", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ReviewModerationEvent calls POST /api/v1/moderation/events/{id}/review. Uphold or dismiss a pending moderation event. Requires the moderator role.
+func (c *Client) ReviewModerationEvent(ctx context.Context, id string, body ReviewRequest) (*ModerationEvent, error) {
+	q := url.Values{}
+	var out ModerationEvent
+	if err := c.do(ctx, "POST", strings.ReplaceAll("/api/v1/moderation/events/{id}/review", "{id}", url.PathEscape(id)), q, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetUsage calls GET /api/v1/usage. Return the caller's chat plan and the tokens they spent today and this month (UTC).
+func (c *Client) GetUsage(ctx context.Context) (*UsageReport, error) {
+	q := url.Values{}
+	var out UsageReport
+	if err := c.do(ctx, "GET", "/api/v1/usage", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetMe calls GET /api/v1/users/me. Return the caller's profile.
+func (c *Client) GetMe(ctx context.Context) (*User, error) {
+	q := url.Values{}
+	var out User
+	if err := c.do(ctx, "GET", "/api/v1/users/me", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateMe calls PUT /api/v1/users/me. Update the caller's profile. Empty fields are left unchanged.
+func (c *Client) UpdateMe(ctx context.Context, body ProfileUpdate) (*User, error) {
+	q := url.Values{}
+	var out User
+	if err := c.do(ctx, "PUT", "/api/v1/users/me", q, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Liveness calls GET /healthz. Liveness probe.
+func (c *Client) Liveness(ctx context.Context) (*Health, error) {
+	q := url.Values{}
+	var out Health
+	if err := c.do(ctx, "GET", "/healthz", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RunAnalysisParams holds the query parameters of RunAnalysis.
+type RunAnalysisParams struct {
+	UserID string
+}
+
+// RunAnalysis calls POST /internal/v1/analyses. Score the compatibility of two people and store the analysis for a user. Internal; called by the chat service.
+func (c *Client) RunAnalysis(ctx context.Context, params RunAnalysisParams, body AnalysisRequest) (*Analysis, error) {
+	q := url.Values{}
+	if params.UserID != "" {
+		q.Set("userId", params.UserID)
+	}
+	var out Analysis
+	if err := c.do(ctx, "POST", "/internal/v1/analyses", q, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LoadAnalysisParams holds the query parameters of LoadAnalysis.
+type LoadAnalysisParams struct {
+	UserID string
+}
+
+// LoadAnalysis calls GET /internal/v1/analyses/{id}. Fetch an analysis on behalf of a user. Internal; called by the chat service.
+func (c *Client) LoadAnalysis(ctx context.Context, id string, params LoadAnalysisParams) (*Analysis, error) {
+	q := url.Values{}
+	if params.UserID != "" {
+		q.Set("userId", params.UserID)
+	}
+	var out Analysis
+	if err := c.do(ctx, "GET", strings.ReplaceAll("/internal/v1/analyses/{id}", "{id}", url.PathEscape(id)), q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateReport calls POST /internal/v1/reports. Return the astrology report for a birth chart. Internal; called by the match service.
+func (c *Client) CreateReport(ctx context.Context, body BirthDetails) (*Report, error) {
+	q := url.Values{}
+	var out Report
+	if err := c.do(ctx, "POST", "/internal/v1/reports", q, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LoadReport calls GET /internal/v1/reports/{key}. Return a cached report by the key recorded with an analysis. Internal; called by the chat service.
+func (c *Client) LoadReport(ctx context.Context, key string) (*Report, error) {
+	q := url.Values{}
+	var out Report
+	if err := c.do(ctx, "GET", strings.ReplaceAll("/internal/v1/reports/{key}", "{key}", url.PathEscape(key)), q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateUser calls POST /internal/v1/users. Find or create a user by email. Internal; called by the auth service.
+func (c *Client) CreateUser(ctx context.Context, body CreateUserRequest) (*CreateUserResponse, error) {
+	q := url.Values{}
+	var out CreateUserResponse
+	if err := c.do(ctx, "POST", "/internal/v1/users", q, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LoadUser calls GET /internal/v1/users/{id}. Return a user's profile. Internal; called by the chat service.
+func (c *Client) LoadUser(ctx context.Context, id string) (*User, error) {
+	q := url.Values{}
+	var out User
+	if err := c.do(ctx, "GET", strings.ReplaceAll("/internal/v1/users/{id}", "{id}", url.PathEscape(id)), q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Ping calls GET /ping. Check that the service is up.
+func (c *Client) Ping(ctx context.Context) (*Pong, error) {
+	q := url.Values{}
+	var out Pong
+	if err := c.do(ctx, "GET", "/ping", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Readiness calls GET /readyz. Readiness probe; checks the dependencies of the enabled modules.
+func (c *Client) Readiness(ctx context.Context) (*Health, error) {
+	q := url.Values{}
+	var out Health
+	if err := c.do(ctx, "GET", "/readyz", q, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
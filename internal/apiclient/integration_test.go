@@ -0,0 +1,171 @@
+package apiclient_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+
+	"matchmaker/internal/apiclient"
+	"matchmaker/internal/app"
+	"matchmaker/internal/config"
+	"matchmaker/internal/health"
+	"matchmaker/internal/logging"
+	"matchmaker/internal/openapi"
+)
+
+// newServer runs the user, report and match modules in-process through
+// internal/app, with in-memory stores.
+func newServer(t *testing.T) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	logging.Init()
+	health.Reset()
+	t.Cleanup(health.Reset)
+	engine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"planets":["sun","moon"]}`))
+	}))
+	t.Cleanup(engine.Close)
+	t.Setenv("POSTGRES_URL", "postgres://db.invalid/matchmaker")
+	t.Setenv("MONGO_URL", "mongodb://db.invalid/matchmaker")
+	t.Setenv("REDIS_URL", "redis://db.invalid:6379")
+	t.Setenv("ASTROLOGY_ENGINE_URL", engine.URL)
+
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Modules = []string{app.User, app.Report, app.Match}
+	a, err := app.New(cfg, app.MemoryStores())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := logging.NewGinEngine()
+	if err := a.Mount(r); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, fn := range a.ShutdownHooks() {
+			fn()
+		}
+		a.Close()
+	})
+
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing := doc.Undocumented(r.Routes()); len(missing) > 0 {
+		t.Fatalf("routes missing from api/openapi.json: %v", missing)
+	}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func token(t *testing.T, userID int64) string {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": userID}).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestAPI(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+	c := apiclient.NewClient(srv.URL)
+
+	if pong, err := c.Ping(ctx); err != nil || pong.Message != "pong" {
+		t.Fatalf("ping: %+v %v", pong, err)
+	}
+
+	created, err := c.CreateUser(ctx, apiclient.CreateUserRequest{Email: "a@b.com", Name: "Alice"})
+	if err != nil || created.ID == 0 {
+		t.Fatalf("create user: %+v %v", created, err)
+	}
+
+	c.Token = token(t, created.ID)
+	loc := "LA"
+	if u, err := c.UpdateMe(ctx, apiclient.ProfileUpdate{Location: loc}); err != nil || u.Location != loc {
+		t.Fatalf("update me: %+v %v", u, err)
+	}
+	me, err := c.GetMe(ctx)
+	if err != nil || me.Email != "a@b.com" || me.Location != loc {
+		t.Fatalf("get me: %+v %v", me, err)
+	}
+
+	a := apiclient.BirthDetails{DOB: "1990-01-01", TOB: "12:00:00", Lat: 40.71, Lon: -74}
+	b := apiclient.BirthDetails{DOB: "1992-02-02", TOB: "06:30:00", Lat: 34.05, Lon: -118.24}
+	res, err := c.CreateAnalysis(ctx, apiclient.CreateAnalysisParams{}, apiclient.AnalysisRequest{PersonA: a, PersonB: b})
+	if err != nil || res.Score == 0 || res.AnalysisID == "" || len(res.ReportKeys) != 2 {
+		t.Fatalf("analysis: %+v %v", res, err)
+	}
+	if got, err := c.GetAnalysis(ctx, res.AnalysisID); err != nil || got.InputHash != res.InputHash {
+		t.Fatalf("get analysis: %+v %v", got, err)
+	}
+	if page, err := c.ListAnalyses(ctx, apiclient.ListAnalysesParams{Mine: "true"}); err != nil || page.Total != 1 || page.Items[0].AnalysisID != res.AnalysisID {
+		t.Fatalf("list analyses: %+v %v", page, err)
+	}
+	if err := c.DeleteAnalysis(ctx, res.AnalysisID); err != nil {
+		t.Fatalf("delete analysis: %v", err)
+	}
+	batch, err := c.CreateBatchAnalysis(ctx, apiclient.CreateBatchAnalysisParams{}, apiclient.BatchRequest{
+		Subject:    a,
+		Candidates: []apiclient.BatchCandidate{{Name: "b", Person: b}, {Name: "a", Person: a}},
+	})
+	if err != nil || batch.Succeeded != 2 || batch.Matches[0].Rank != 1 || batch.Matches[0].Analysis.Score < batch.Matches[1].Analysis.Score {
+		t.Fatalf("batch analysis: %+v %v", batch, err)
+	}
+	var apiErr *apiclient.APIError
+	if _, err := c.GetAnalysisJob(ctx, "missing"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing job: %v", err)
+	}
+	if hook, err := c.PutAnalysisWebhook(ctx, apiclient.WebhookRequest{URL: "https://203.0.113.7/hook"}); err != nil || hook.Secret == "" {
+		t.Fatalf("register webhook: %+v %v", hook, err)
+	}
+	if hook, err := c.GetAnalysisWebhook(ctx); err != nil || hook.URL != "https://203.0.113.7/hook" || hook.Secret != "" {
+		t.Fatalf("get webhook: %+v %v", hook, err)
+	}
+	if err := c.DeleteAnalysisWebhook(ctx); err != nil {
+		t.Fatalf("delete webhook: %v", err)
+	}
+	if rep, err := c.CreateReport(ctx, a); err != nil || len(*rep) == 0 {
+		t.Fatalf("report: %v", err)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+	c := apiclient.NewClient(srv.URL)
+
+	_, err := c.CreateAnalysis(ctx, apiclient.CreateAnalysisParams{}, apiclient.AnalysisRequest{PersonA: apiclient.BirthDetails{Lat: 100}})
+	var apiErr *apiclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Body.Code != apiclient.ErrorCodeValidationFailed {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	fields := map[string]bool{}
+	for _, d := range apiErr.Body.Details {
+		fields[d.Field] = true
+	}
+	for _, f := range []string{"personA.dob", "personA.tob", "personA.lat", "personB.dob", "personB.tob"} {
+		if !fields[f] {
+			t.Errorf("missing detail for %s in %+v", f, apiErr.Body.Details)
+		}
+	}
+
+	if _, err := c.ListAnalyses(ctx, apiclient.ListAnalysesParams{Limit: "500"}); !errors.As(err, &apiErr) || apiErr.Body.Code != apiclient.ErrorCodeValidationFailed {
+		t.Fatalf("expected limit to be validated, got %v", err)
+	}
+	if _, err := c.GetMe(ctx); !errors.As(err, &apiErr) || apiErr.Body.Code != apiclient.ErrorCodeUnauthenticated {
+		t.Fatalf("expected unauthenticated, got %v", err)
+	}
+	c.Token = token(t, 42)
+	if _, err := c.GetMe(ctx); !errors.As(err, &apiErr) || apiErr.Body.Code != apiclient.ErrorCodeNotFound || apiErr.Body.RequestID == "" {
+		t.Fatalf("expected not found with request id, got %v %+v", err, apiErr)
+	}
+}
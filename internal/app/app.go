@@ -0,0 +1,704 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+
+	"matchmaker/internal/clients"
+	"matchmaker/internal/config"
+	"matchmaker/internal/database"
+	"matchmaker/internal/handlers"
+	"matchmaker/internal/health"
+	"matchmaker/internal/llm"
+	"matchmaker/internal/logging"
+	"matchmaker/internal/metering"
+	"matchmaker/internal/metrics"
+	"matchmaker/internal/models"
+	"matchmaker/internal/moderation"
+	"matchmaker/internal/openapi"
+	"matchmaker/internal/prompts"
+	"matchmaker/internal/server"
+	"matchmaker/internal/store"
+)
+
+// Module names accepted by New and the MODULES setting.
+const (
+	Auth    = "auth"
+	User    = "user"
+	Report  = "report"
+	Match   = "match"
+	Chat    = "chat"
+	Gateway = "gateway"
+)
+
+var knownModules = []string{Auth, User, Report, Match, Chat, Gateway}
+
+// App mounts a set of service modules on one Gin engine. Modules running in
+// the same process call each other directly; the rest are reached over HTTP,
+// so the same code serves both the monolith and the individual services.
+type App struct {
+	cfg        *config.Config
+	enabled    map[string]bool
+	redis      *redis.Client
+	postgres   *gorm.DB
+	mongo      *mongo.Database
+	memory     bool
+	onShutdown []func()
+	closers    []namedCloser
+}
+
+type namedCloser struct {
+	name  string
+	close func() error
+}
+
+// Option changes how an App mounts its modules.
+type Option func(*App)
+
+// MemoryStores keeps the data of the user, report and match modules in
+// memory, ignoring the databases in the config. It is meant for tests that
+// run those modules in-process.
+func MemoryStores() Option {
+	return func(a *App) { a.memory = true }
+}
+
+// internalCallers lists, for each module serving /internal/v1 routes, the
+// modules that call them.
+var internalCallers = map[string][]string{
+	User:   {Auth, Chat},
+	Report: {Match, Chat},
+	Match:  {Chat},
+}
+
+// New returns an App running the modules listed in cfg.Modules. The config
+// sections of those modules are validated. A module another service calls
+// over /internal/v1 can only run beside the gateway together with its
+// callers.
+func New(cfg *config.Config, opts ...Option) (*App, error) {
+	a := &App{cfg: cfg, enabled: map[string]bool{}}
+	for _, opt := range opts {
+		opt(a)
+	}
+	for _, m := range cfg.Modules {
+		known := false
+		for _, k := range knownModules {
+			if m == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown module %q", m)
+		}
+		a.enabled[m] = true
+	}
+	if len(a.enabled) == 0 {
+		return nil, fmt.Errorf("no modules enabled")
+	}
+	if a.has(Gateway) {
+		for _, m := range knownModules {
+			if !a.has(m) {
+				continue
+			}
+			for _, caller := range internalCallers[m] {
+				if !a.has(caller) {
+					return nil, fmt.Errorf("module %q serves /internal/v1 routes that %s calls, which are not served beside the gateway: run %s without the gateway or run %s in the same process", m, caller, m, caller)
+				}
+			}
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Modules returns the enabled module names in a stable order.
+func (a *App) Modules() []string {
+	var out []string
+	for _, k := range knownModules {
+		if a.enabled[k] {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// ShutdownHooks returns the functions to pass to server.Run.
+func (a *App) ShutdownHooks() []func() {
+	return a.onShutdown
+}
+
+// Close releases the database clients opened by Mount, most recent first.
+func (a *App) Close() {
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		c := a.closers[i]
+		if err := c.close(); err != nil {
+			logging.Log.WithError(err).Warnf("failed to close %s", c.name)
+		}
+	}
+	a.closers = nil
+}
+
+func (a *App) onClose(name string, fn func() error) {
+	a.closers = append(a.closers, namedCloser{name: name, close: fn})
+}
+
+func (a *App) has(m string) bool {
+	return a.enabled[m]
+}
+
+// Mount connects the dependencies of every enabled module, registers their
+// readiness checks and routes them on r. Each request is tagged with its
+// locale, and requests to documented routes are validated against the
+// OpenAPI document. When the gateway module is
+// enabled, it serves the API documents, /api/v1 routes require a verified
+// JWT and routes of modules that are not enabled are proxied to their
+// services. The /internal/v1 routes other services call are not
+// authenticated, so they are only mounted when the gateway is not: New
+// makes sure every caller of a module running beside the gateway runs in
+// the same process and calls it in-process.
+func (a *App) Mount(r *gin.Engine) error {
+	doc, err := openapi.Load()
+	if err != nil {
+		return err
+	}
+	r.Use(handlers.Locale())
+	r.Use(doc.Validator())
+	r.GET("/ping", handlers.Ping)
+
+	var gw *handlers.Gateway
+	api := r.Group("/api/v1")
+	internal := r.Group("/internal/v1")
+	if a.has(Gateway) {
+		internal = nil
+		cfg := &a.cfg.Gateway
+		gw, err = handlers.NewGateway(cfg.AuthServiceURL, cfg.UserServiceURL, cfg.MatchServiceURL, cfg.ChatServiceURL, cfg.JWTPrivateKey, cfg.Workers)
+		if err != nil {
+			return err
+		}
+		r.GET("/openapi.json", openapi.Handler)
+		r.GET("/asyncapi.yaml", openapi.AsyncAPIHandler)
+		api.Use(gw.JWTMiddleware())
+		remote := map[string]string{
+			Auth:  cfg.AuthServiceURL,
+			User:  cfg.UserServiceURL,
+			Match: cfg.MatchServiceURL,
+			Chat:  cfg.ChatServiceURL,
+		}
+		for m, u := range remote {
+			if !a.has(m) {
+				health.Register(m, health.HTTPCheck(u+"/healthz"))
+			}
+		}
+	}
+	authed := api.Group("", handlers.RequireUserID())
+
+	users, err := a.mountUser(api, authed, internal, gw)
+	if err != nil {
+		return err
+	}
+	a.mountAuth(r, gw, users)
+	reports, err := a.mountReport(internal)
+	if err != nil {
+		return err
+	}
+	analysis, err := a.mountMatch(api, authed, internal, gw, reports)
+	if err != nil {
+		return err
+	}
+	return a.mountChat(api, authed, gw, analysis, reports, users)
+}
+
+// mountAuth registers users through local, the in-process user module, when
+// it is enabled.
+func (a *App) mountAuth(r *gin.Engine, gw *handlers.Gateway, local *handlers.Users) {
+	if !a.has(Auth) {
+		if gw != nil {
+			r.Any("/api/v1/auth/*proxyPath", gw.AuthHandler())
+		}
+		return
+	}
+	cfg := &a.cfg.Auth
+	var users handlers.UserRegistrar = local
+	if local == nil {
+		users = clients.NewUserClient(cfg.UserServiceURL, a.clientOptions())
+		health.Register("user", health.HTTPCheck(cfg.UserServiceURL+"/healthz"))
+	}
+	auth := handlers.NewAuth(cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.GoogleRedirectURL, cfg.JWTPrivateKey, users, map[string][]string{
+		handlers.RoleModerator: cfg.ModeratorEmails,
+		handlers.RoleAdmin:     cfg.AdminEmails,
+	})
+	r.GET("/api/v1/auth/google/login", auth.GoogleLogin)
+	r.GET("/api/v1/auth/google/callback", auth.GoogleCallback)
+}
+
+func (a *App) mountUser(api, authed, internal *gin.RouterGroup, gw *handlers.Gateway) (*handlers.Users, error) {
+	if !a.has(User) {
+		if gw != nil {
+			api.Any("/users/*path", gw.RefreshLocale(), gw.UserHandler())
+		}
+		return nil, nil
+	}
+	var repo store.UserRepository = store.NewMemoryUserRepository()
+	if !a.memory {
+		db, err := a.initPostgres(a.cfg.User.PostgresURL)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.AutoMigrate(&models.User{}, &models.BirthDetail{}); err != nil {
+			return nil, fmt.Errorf("auto-migrate failed: %w", err)
+		}
+		repo = store.NewGormUserRepository(db)
+	}
+
+	users := handlers.NewUsers(repo)
+	if internal != nil {
+		internal.POST("/users", users.Create)
+		internal.GET("/users/:id", users.InternalGet)
+	}
+	authed.GET("/users/me", users.GetMe)
+	if gw != nil {
+		authed.PUT("/users/me", gw.RefreshLocale(), users.UpdateMe)
+	} else {
+		authed.PUT("/users/me", users.UpdateMe)
+	}
+	return users, nil
+}
+
+func (a *App) mountReport(internal *gin.RouterGroup) (*handlers.Reports, error) {
+	if !a.has(Report) {
+		return nil, nil
+	}
+	cfg := &a.cfg.Report
+	var cache, persistent store.ReportStore = store.NewMemoryReportStore(), store.NewMemoryReportStore()
+	if !a.memory {
+		rdb, err := a.initRedis(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		mongoDB, err := a.initMongo(cfg.MongoURL)
+		if err != nil {
+			return nil, err
+		}
+		cache = store.NewRedisReportStore(rdb, time.Hour)
+		persistent = store.NewMongoReportStore(mongoDB)
+	}
+
+	reports := handlers.NewReports(cache, persistent, cfg.AstrologyEngineURL, cfg.AstrologyEngineAPIKey)
+	if internal != nil {
+		internal.POST("/reports", reports.Create)
+		internal.GET("/reports/:key", reports.Get)
+	}
+	return reports, nil
+}
+
+// mountMatch serves analyses from local, the in-process report module, when
+// it is enabled. Analyses are stored in MongoDB when it is configured.
+func (a *App) mountMatch(api, authed, internal *gin.RouterGroup, gw *handlers.Gateway, local *handlers.Reports) (*handlers.Analysis, error) {
+	if !a.has(Match) {
+		if gw != nil {
+			api.Any("/analysis", gw.MatchHandler())
+			api.Any("/analysis/*path", gw.MatchHandler())
+		}
+		return nil, nil
+	}
+	cfg := &a.cfg.Match
+	var reports handlers.ReportFetcher = local
+	if local == nil {
+		reports = clients.NewReportClient(cfg.ReportServiceURL, a.clientOptions())
+		health.Register("report", health.HTTPCheck(cfg.ReportServiceURL+"/healthz"))
+	}
+	var analyses store.AnalysisStore = store.NewMemoryAnalysisStore()
+	if cfg.MongoURL != "" && !a.memory {
+		mongoDB, err := a.initMongo(cfg.MongoURL)
+		if err != nil {
+			return nil, err
+		}
+		s := store.NewMongoAnalysisStore(mongoDB)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.EnsureIndexes(ctx); err != nil {
+			return nil, fmt.Errorf("analysis index creation failed: %w", err)
+		}
+		analyses = s
+	} else if !a.memory {
+		logging.Log.Warn("MONGO_URL not set; analyses are kept in memory")
+	}
+	retries := cfg.WebhookMaxRetries
+	if retries == 0 {
+		retries = -1
+	}
+	opts := handlers.AnalysisOptions{
+		BatchMaxCandidates:  cfg.BatchMaxCandidates,
+		BatchConcurrency:    cfg.BatchConcurrency,
+		BatchSyncLimit:      cfg.BatchSyncLimit,
+		JobTimeout:          cfg.JobTimeout,
+		WebhookTimeout:      cfg.WebhookTimeout,
+		WebhookMaxRetries:   retries,
+		WebhookAllowPrivate: cfg.WebhookAllowPrivate,
+	}
+	if cfg.RedisURL != "" && !a.memory {
+		rdb, err := a.initRedis(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		opts.Jobs = store.NewRedisAnalysisJobStore(rdb, cfg.JobTTL)
+		opts.Queue = store.NewRedisAnalysisJobQueue(rdb)
+		opts.Webhooks = store.NewRedisAnalysisWebhookStore(rdb)
+	} else {
+		if !a.memory {
+			logging.Log.Warn("REDIS_URL not set; analysis jobs and webhooks are kept in memory")
+		}
+		if cfg.Workers <= 0 {
+			return nil, fmt.Errorf("analysis jobs would never run: MATCH_WORKERS is %d and REDIS_URL is not set", cfg.Workers)
+		}
+	}
+	analysis := handlers.NewAnalysis(reports, analyses, opts)
+	ctx, stop := context.WithCancel(context.Background())
+	a.onShutdown = append(a.onShutdown, stop)
+	server.Go(func() { analysis.Work(ctx, cfg.Workers) })
+	api.POST("/analysis", handlers.OptionalUserID(), analysis.Create)
+	authed.POST("/analysis/batch", analysis.Batch)
+	authed.GET("/analysis/jobs/:id", analysis.Job)
+	authed.GET("/analysis/jobs/:id/events", analysis.JobEvents)
+	authed.PUT("/analysis/webhook", analysis.PutWebhook)
+	authed.GET("/analysis/webhook", analysis.GetWebhook)
+	authed.DELETE("/analysis/webhook", analysis.DeleteWebhook)
+	authed.GET("/analysis", analysis.List)
+	authed.GET("/analysis/:id", analysis.Get)
+	authed.DELETE("/analysis/:id", analysis.Delete)
+	if internal != nil {
+		internal.GET("/analyses/:id", analysis.InternalGet)
+		internal.POST("/analyses", analysis.InternalCreate)
+	}
+	return analysis, nil
+}
+
+// mountChat loads analyses, reports and profiles from localAnalysis,
+// localReports and localUsers, the in-process match, report and user
+// modules, when they are enabled.
+func (a *App) mountChat(api, authed *gin.RouterGroup, gw *handlers.Gateway, localAnalysis *handlers.Analysis, localReports *handlers.Reports, localUsers *handlers.Users) error {
+	if !a.has(Chat) {
+		if gw != nil {
+			api.Any("/chat", gw.ChatHandler())
+			api.Any("/chat/*path", gw.ChatHandler())
+			api.Any("/usage", gw.ChatHandler())
+			api.Any("/moderation/*path", gw.ChatHandler())
+			api.Any("/admin/prompts/*path", gw.ChatHandler())
+		}
+		return nil
+	}
+	cfg := &a.cfg.Chat
+	rdb, err := a.initRedis(cfg.RedisURL)
+	if err != nil {
+		return err
+	}
+	var analyses interface {
+		handlers.AnalysisLoader
+		handlers.AnalysisRunner
+	} = localAnalysis
+	if localAnalysis == nil {
+		analyses = clients.NewMatchClient(cfg.MatchServiceURL, a.clientOptions())
+		health.Register("match", health.HTTPCheck(cfg.MatchServiceURL+"/healthz"))
+	}
+	var reports interface {
+		handlers.ReportLoader
+		handlers.ReportFetcher
+	} = localReports
+	if localReports == nil {
+		reports = clients.NewReportClient(cfg.ReportServiceURL, a.clientOptions())
+		health.Register("report", health.HTTPCheck(cfg.ReportServiceURL+"/healthz"))
+	}
+	var tools *handlers.ChatTools
+	if cfg.Tools {
+		var users handlers.UserLoader = localUsers
+		if localUsers == nil {
+			users = clients.NewUserClient(cfg.UserServiceURL, a.clientOptions())
+			health.Register("user", health.HTTPCheck(cfg.UserServiceURL+"/healthz"))
+		}
+		tools = handlers.NewChatTools(reports, analyses, users)
+	}
+	provider, err := a.initLLM()
+	if err != nil {
+		return err
+	}
+	var transcripts store.ChatTranscriptStore = store.NewMemoryChatTranscripts()
+	var events store.ModerationStore = store.NewMemoryModerationStore()
+	if cfg.MongoURL != "" {
+		mongoDB, err := a.initMongo(cfg.MongoURL)
+		if err != nil {
+			return err
+		}
+		s := store.NewMongoChatTranscripts(mongoDB)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.EnsureIndexes(ctx); err != nil {
+			return fmt.Errorf("chat transcript index creation failed: %w", err)
+		}
+		transcripts = s
+		ms := store.NewMongoModerationStore(mongoDB)
+		if err := ms.EnsureIndexes(ctx); err != nil {
+			return fmt.Errorf("moderation event index creation failed: %w", err)
+		}
+		events = ms
+	} else {
+		logging.Log.Warn("MONGO_URL not set; chat transcripts and moderation events are kept in memory")
+	}
+	moderator, err := a.initModerator()
+	if err != nil {
+		return err
+	}
+	mod := handlers.NewModeration(moderator, events)
+	templates := prompts.Default()
+	if cfg.PromptsFile != "" {
+		if templates, err = prompts.Load(cfg.PromptsFile); err != nil {
+			return fmt.Errorf("prompt templates: %w", err)
+		}
+	}
+	promptSet, err := prompts.New(templates, cfg.Persona)
+	if err != nil {
+		return err
+	}
+	meter, err := a.initMeter(rdb)
+	if err != nil {
+		return err
+	}
+	bus := store.NewRedisChatBus(rdb)
+	a.onClose("chat bus", bus.Close)
+	chat := handlers.NewChat(store.NewRedisChatHistory(rdb), transcripts, bus, provider, analyses, reports, handlers.ChatOptions{
+		ContextTokens:   cfg.ContextTokens,
+		HistoryTTL:      cfg.HistoryTTL,
+		AllowedOrigins:  cfg.AllowedOrigins,
+		MaxMessageBytes: cfg.MaxMessageBytes,
+		PingInterval:    cfg.PingInterval,
+		PongTimeout:     cfg.PongTimeout,
+		WriteTimeout:    cfg.WriteTimeout,
+		MaxConnections:  cfg.MaxConnections,
+		SendBuffer:      cfg.SendBuffer,
+		SlowConsumer:    cfg.SlowConsumer,
+		Prompts:         promptSet,
+		Tools:           tools,
+		Meter:           meter,
+		Moderation:      mod,
+	})
+	authed.GET("/chat", chat.Connect)
+	authed.GET("/chat/sessions", chat.ListSessions)
+	authed.GET("/chat/sessions/:id/messages", chat.Transcript)
+	authed.GET("/chat/sessions/:id/export", chat.Export)
+	authed.DELETE("/chat/sessions/:id", chat.DeleteSession)
+	authed.GET("/usage", chat.Usage)
+	moderators := authed.Group("/moderation", handlers.RequireRole(handlers.RoleModerator))
+	moderators.GET("/events", mod.List)
+	moderators.POST("/events/:id/review", mod.Review)
+	authed.POST("/admin/prompts/preview", handlers.RequireRole(handlers.RoleAdmin), chat.PreviewPrompt)
+	a.onShutdown = append(a.onShutdown, chat.Drain)
+	return nil
+}
+
+// initLLM returns the provider of chat completions, which retries the
+// configured one and falls back to the fallback provider or model.
+func (a *App) initLLM() (llm.LLMProvider, error) {
+	cfg := &a.cfg.Chat
+	primary, err := llm.New(cfg.LLMProvider, cfg.LLMAPIURL, cfg.LLMAPIKey, cfg.LLMModel)
+	if err != nil {
+		return nil, err
+	}
+	var fallback llm.LLMProvider
+	switch {
+	case cfg.LLMFallbackProvider != "":
+		key := cfg.LLMFallbackAPIKey
+		if key == "" {
+			key = cfg.LLMAPIKey
+		}
+		if fallback, err = llm.New(cfg.LLMFallbackProvider, cfg.LLMFallbackAPIURL, key, cfg.LLMFallbackModel); err != nil {
+			return nil, err
+		}
+	case cfg.LLMFallbackModel != "":
+		if fallback, err = llm.New(cfg.LLMProvider, cfg.LLMAPIURL, cfg.LLMAPIKey, cfg.LLMFallbackModel); err != nil {
+			return nil, err
+		}
+	}
+	retries := cfg.LLMMaxRetries
+	if retries == 0 {
+		retries = -1
+	}
+	return llm.NewResilient(primary, fallback, llm.Options{
+		Timeout:           cfg.LLMTimeout,
+		FirstTokenTimeout: cfg.LLMFirstTokenTimeout,
+		MaxRetries:        retries,
+		Backoff:           cfg.LLMRetryBackoff,
+	}), nil
+}
+
+// initModerator returns the moderator of chat messages and answers, applying
+// the configured rules file, the personal data detectors and the external
+// service.
+func (a *App) initModerator() (*moderation.Moderator, error) {
+	cfg := &a.cfg.Chat
+	var rules []moderation.Rule
+	if cfg.ModerationRulesFile != "" {
+		var err error
+		if rules, err = moderation.LoadRules(cfg.ModerationRulesFile); err != nil {
+			return nil, fmt.Errorf("moderation rules: %w", err)
+		}
+	}
+	if pii := strings.ToLower(cfg.ModerationPII); pii != "off" {
+		rules = append(rules, moderation.PhoneRule(pii), moderation.EmailRule(pii))
+	}
+	var external *moderation.External
+	if cfg.ModerationURL != "" {
+		external = moderation.NewExternal(cfg.ModerationURL, cfg.ModerationAPIKey, cfg.ModerationTimeout)
+	}
+	return moderation.New(rules, external)
+}
+
+// initMeter returns the meter of chat usage, which counts usage in rdb and
+// saves it to PostgreSQL when it is configured. Counters are flushed in the
+// background until shutdown.
+func (a *App) initMeter(rdb *redis.Client) (*metering.Meter, error) {
+	cfg := &a.cfg.Chat
+	plans, err := metering.ParsePlans(cfg.Plans)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := plans[cfg.DefaultPlan]; !ok {
+		return nil, fmt.Errorf("default chat plan %q is not one of the plans", cfg.DefaultPlan)
+	}
+	var records store.UsageStore = store.NewMemoryUsageStore()
+	var users metering.PlanSource
+	if cfg.PostgresURL != "" {
+		db, err := a.initPostgres(cfg.PostgresURL)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.AutoMigrate(&models.UsageRecord{}); err != nil {
+			return nil, fmt.Errorf("auto-migrate failed: %w", err)
+		}
+		records = store.NewGormUsageStore(db)
+		users = store.NewGormUserRepository(db)
+	} else {
+		logging.Log.Warn("POSTGRES_URL not set; chat usage is kept in Redis only and every user is on the default plan")
+	}
+	meter := metering.New(store.NewRedisUsageCounters(rdb), records, users, plans, cfg.DefaultPlan)
+	ctx, stop := context.WithCancel(context.Background())
+	a.onShutdown = append(a.onShutdown, stop)
+	server.Go(func() { meter.Run(ctx, cfg.UsageFlushInterval) })
+	return meter, nil
+}
+
+// clientOptions returns the settings for clients of remote modules.
+func (a *App) clientOptions() clients.Options {
+	cfg := &a.cfg.Clients
+	retries := cfg.MaxRetries
+	if retries == 0 {
+		retries = -1
+	}
+	return clients.Options{Timeout: cfg.Timeout, MaxRetries: retries, Backoff: cfg.Backoff}
+}
+
+// initRedis connects to Redis once; the report and chat modules share the
+// client.
+func (a *App) initRedis(url string) (*redis.Client, error) {
+	if a.redis != nil {
+		return a.redis, nil
+	}
+	client, err := database.InitRedis(url)
+	if err != nil {
+		return nil, fmt.Errorf("redis initialization failed: %w", err)
+	}
+	a.onClose("redis", client.Close)
+	health.Register("redis", database.RedisCheck(client))
+	a.redis = client
+	return client, nil
+}
+
+// initPostgres connects to PostgreSQL once; the user and chat modules share
+// the pool.
+func (a *App) initPostgres(url string) (*gorm.DB, error) {
+	if a.postgres != nil {
+		return a.postgres, nil
+	}
+	db, err := database.Init(url)
+	if err != nil {
+		return nil, fmt.Errorf("database initialization failed: %w", err)
+	}
+	a.onClose("postgres", func() error { return database.ClosePostgres(db) })
+	if sqlDB, err := db.DB(); err == nil {
+		if err := metrics.RegisterDBStats(sqlDB, "postgres"); err != nil {
+			logging.Log.WithError(err).Warn("failed to register db pool metrics")
+		}
+	}
+	health.Register("postgres", database.PostgresCheck(db))
+	a.postgres = db
+	return db, nil
+}
+
+// initMongo connects to MongoDB once; the report and match modules share the
+// client.
+func (a *App) initMongo(url string) (*mongo.Database, error) {
+	if a.mongo != nil {
+		return a.mongo, nil
+	}
+	db, err := database.InitMongo(url)
+	if err != nil {
+		return nil, fmt.Errorf("mongodb initialization failed: %w", err)
+	}
+	a.onClose("mongodb", func() error { return database.CloseMongo(db) })
+	health.Register("mongodb", database.MongoCheck(db))
+	a.mongo = db
+	return db, nil
+}
+
+// Run loads the config named by the command-line flags, then serves the
+// given modules (or the configured MODULES when none are given) until the
+// process is signalled to stop, and finally closes the database clients.
+// With --print-config it prints the redacted config and returns. Logging must
+// be initialized by the caller.
+func Run(modules ...string) {
+	flags, err := config.ParseFlags(os.Args[1:])
+	if err != nil {
+		logging.Log.Fatal(err)
+	}
+	cfg, err := config.Load(flags.File)
+	if err != nil {
+		logging.Log.Fatal(err)
+	}
+	if len(modules) > 0 {
+		cfg.Modules = modules
+	}
+	if flags.Print {
+		out, err := cfg.Redacted()
+		if err != nil {
+			logging.Log.Fatal(err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+	if err := logging.Configure(cfg.Log.Format, cfg.Log.Level); err != nil {
+		logging.Log.Fatal(err)
+	}
+
+	a, err := New(cfg)
+	if err != nil {
+		logging.Log.Fatal(err)
+	}
+	r := logging.NewGinEngine()
+	if err := a.Mount(r); err != nil {
+		logging.Log.Fatal(err)
+	}
+	defer a.Close()
+	logging.Log.WithField("modules", a.Modules()).Info("modules mounted")
+
+	if err := server.Run(r, &cfg.Server, a.ShutdownHooks()...); err != nil {
+		logging.Log.WithError(err).Error("server stopped with error")
+	}
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/config"
+	"matchmaker/internal/health"
+	"matchmaker/internal/logging"
+)
+
+func routes(r *gin.Engine) map[string]bool {
+	out := map[string]bool{}
+	for _, rt := range r.Routes() {
+		out[rt.Method+" "+rt.Path] = true
+	}
+	return out
+}
+
+// mount mounts modules with in-memory stores and the config of the
+// environment.
+func mount(t *testing.T, modules ...string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	logging.Init()
+	health.Reset()
+	t.Cleanup(health.Reset)
+	key, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_PRIVATE_KEY", string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})))
+	t.Setenv("POSTGRES_URL", "postgres://db.invalid/matchmaker")
+	t.Setenv("MONGO_URL", "mongodb://db.invalid/matchmaker")
+	t.Setenv("REDIS_URL", "redis://db.invalid:6379")
+	t.Setenv("ASTROLOGY_ENGINE_URL", "http://engine.invalid")
+
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Modules = modules
+	a, err := New(cfg, MemoryStores())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	if err := a.Mount(r); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, fn := range a.ShutdownHooks() {
+			fn()
+		}
+		a.Close()
+	})
+	return r
+}
+
+func TestNewRejectsUnknownModule(t *testing.T) {
+	if _, err := New(&config.Config{Modules: []string{"billing"}}); err == nil {
+		t.Fatal("expected error for unknown module")
+	}
+	if _, err := New(&config.Config{}); err == nil {
+		t.Fatal("expected error for empty module list")
+	}
+}
+
+func TestNewRejectsModulesCalledFromElsewhereBesideGateway(t *testing.T) {
+	for _, modules := range [][]string{
+		{Gateway, Match},
+		{Gateway, Report, Match},
+		{Gateway, User, Report, Match, Chat},
+	} {
+		if _, err := New(&config.Config{Modules: modules}); err == nil || !strings.Contains(err.Error(), "/internal/v1") {
+			t.Errorf("%v: got %v, want an error about /internal/v1 callers", modules, err)
+		}
+	}
+}
+
+func TestMountGatewayProxiesRemoteModules(t *testing.T) {
+	t.Setenv("GOOGLE_OAUTH_CLIENT_ID", "client")
+	t.Setenv("GOOGLE_OAUTH_CLIENT_SECRET", "secret")
+	r := mount(t, Gateway, Auth)
+	got := routes(r)
+	for _, want := range []string{
+		"GET /api/v1/users/*path",
+		"GET /api/v1/chat",
+		"GET /api/v1/chat/*path",
+		"DELETE /api/v1/chat/*path",
+		"GET /api/v1/usage",
+		"GET /api/v1/moderation/*path",
+		"POST /api/v1/moderation/*path",
+		"POST /api/v1/admin/prompts/*path",
+		"POST /api/v1/analysis",
+		"GET /api/v1/analysis",
+		"GET /api/v1/analysis/*path",
+		"DELETE /api/v1/analysis/*path",
+		"GET /api/v1/auth/google/login",
+	} {
+		if !got[want] {
+			t.Errorf("missing route %s", want)
+		}
+	}
+	if got["GET /api/v1/auth/*proxyPath"] {
+		t.Error("auth should be served locally, not proxied")
+	}
+	for rt := range got {
+		if strings.Contains(rt, " /internal/v1/") {
+			t.Errorf("%s served beside the gateway", rt)
+		}
+	}
+}
+
+func TestMountInternalRoutes(t *testing.T) {
+	internal := []string{
+		"POST /internal/v1/users",
+		"GET /internal/v1/users/:id",
+		"POST /internal/v1/reports",
+		"GET /internal/v1/reports/:key",
+		"POST /internal/v1/analyses",
+		"GET /internal/v1/analyses/:id",
+	}
+	got := routes(mount(t, User, Report, Match))
+	for _, rt := range internal {
+		if !got[rt] {
+			t.Errorf("missing route %s", rt)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// AuthClient calls the auth service.
+type AuthClient struct {
+	base
+}
+
+// NewAuthClient returns a client for the auth service at baseURL.
+func NewAuthClient(baseURL string, opts Options) *AuthClient {
+	return &AuthClient{newBase("auth", baseURL, opts)}
+}
+
+// LoginURL calls GET /api/v1/auth/google/login and returns the Google consent
+// URL it redirects to.
+func (c *AuthClient) LoginURL(ctx context.Context) (string, error) {
+	resp, _, err := c.do(ctx, call{method: http.MethodGet, path: "/api/v1/auth/google/login", idempotent: true, noRedirect: true})
+	if err != nil {
+		return "", err
+	}
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", fmt.Errorf("auth service status %d: missing redirect", resp.StatusCode)
+	}
+	return loc, nil
+}
+
+// Exchange calls GET /api/v1/auth/google/callback with an authorization code
+// and returns the issued JWT. Codes are single-use, so the call is never
+// retried.
+func (c *AuthClient) Exchange(ctx context.Context, code string) (string, error) {
+	_, body, err := c.do(ctx, call{method: http.MethodGet, path: "/api/v1/auth/google/callback?code=" + url.QueryEscape(code)})
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := decode(c.service, body, &out); err != nil {
+		return "", err
+	}
+	return out.Token, nil
+}
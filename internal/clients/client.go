@@ -0,0 +1,266 @@
+// Package clients provides typed clients for the internal APIs of the user,
+// report, match and auth services. Every call takes a context, is bounded by
+// a per-attempt timeout, forwards the request ID and a W3C traceparent
+// header, and decodes the {"error": ...} envelope into an *APIError.
+// Idempotent calls are retried with jittered exponential backoff.
+package clients
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/logging"
+)
+
+// Options configures a client. Zero fields take the defaults below.
+type Options struct {
+	// Timeout bounds each attempt. Default 10s.
+	Timeout time.Duration
+	// MaxRetries is the number of extra attempts for idempotent calls.
+	// Default 2; a negative value disables retries.
+	MaxRetries int
+	// Backoff is the delay before the first retry; it doubles on each
+	// further retry, up to MaxBackoff. Default 100ms.
+	Backoff time.Duration
+	// MaxBackoff caps the retry delay. Default 2s.
+	MaxBackoff time.Duration
+	// HTTPClient sends the requests. Default: a client that forwards
+	// request IDs.
+	HTTPClient *http.Client
+}
+
+func (o Options) withDefaults() Options {
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 2
+	} else if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 100 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 2 * time.Second
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = logging.NewHTTPClient()
+	}
+	return o
+}
+
+// APIError is a non-2xx response from a service.
+type APIError struct {
+	Service    string
+	StatusCode int
+	// Code is the envelope's error code, or the default code for the status
+	// when the response is not an envelope.
+	Code httputil.Code
+	// Message is the "error" field of the response envelope, or the raw
+	// body when the response is not an envelope.
+	Message string
+	Details []httputil.FieldError
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s service status %d: %s", e.Service, e.StatusCode, e.Message)
+}
+
+// ErrorCode returns the envelope code of err if it wraps an *APIError, or "".
+func ErrorCode(err error) httputil.Code {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// StatusCode returns the HTTP status of err if it wraps an *APIError, or 0.
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// base holds what every typed client shares.
+type base struct {
+	service string
+	baseURL string
+	opts    Options
+}
+
+func newBase(service, baseURL string, opts Options) base {
+	return base{service: service, baseURL: strings.TrimRight(baseURL, "/"), opts: opts.withDefaults()}
+}
+
+// call describes one API call.
+type call struct {
+	method string
+	path   string
+	token  string
+	body   interface{}
+	// idempotent calls are retried on network errors and retryable statuses.
+	idempotent bool
+	// noRedirect returns 3xx responses instead of following them.
+	noRedirect bool
+}
+
+// do sends c and returns the response with its body read. Non-2xx and
+// non-3xx responses become *APIError.
+func (b *base) do(ctx context.Context, c call) (*http.Response, []byte, error) {
+	var payload []byte
+	if c.body != nil {
+		var err error
+		if payload, err = json.Marshal(c.body); err != nil {
+			return nil, nil, err
+		}
+	}
+	attempts := 1
+	if c.idempotent {
+		attempts += b.opts.MaxRetries
+	}
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if err := sleep(ctx, b.backoff(i)); err != nil {
+				return nil, nil, lastErr
+			}
+			logging.FromContext(ctx).WithError(lastErr).WithField("attempt", i+1).Warnf("retrying %s service call", b.service)
+		}
+		resp, body, err := b.attempt(ctx, c, payload)
+		if err == nil {
+			return resp, body, nil
+		}
+		lastErr = err
+		if !retryable(ctx, err) {
+			break
+		}
+	}
+	return nil, nil, lastErr
+}
+
+func (b *base) attempt(ctx context.Context, c call, payload []byte) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.opts.Timeout)
+	defer cancel()
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.method, b.baseURL+c.path, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	req.Header.Set("traceparent", traceparent(ctx))
+
+	client := b.opts.HTTPClient
+	if c.noRedirect {
+		cp := *client
+		cp.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		client = &cp
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, nil, b.decodeError(resp.StatusCode, data)
+	}
+	return resp, data, nil
+}
+
+func (b *base) decodeError(status int, data []byte) *APIError {
+	apiErr := &APIError{Service: b.service, StatusCode: status}
+	if env, ok := httputil.Decode(status, data); ok {
+		apiErr.Code, apiErr.Message, apiErr.Details = env.Code, env.Message, env.Details
+	} else {
+		apiErr.Code, apiErr.Message = httputil.CodeForStatus(status), strings.TrimSpace(string(data))
+	}
+	return apiErr
+}
+
+// backoff returns the delay before retry n (n >= 1): exponential with full
+// jitter in [d/2, d).
+func (b *base) backoff(n int) time.Duration {
+	d := b.opts.Backoff << (n - 1)
+	if d > b.opts.MaxBackoff || d <= 0 {
+		d = b.opts.MaxBackoff
+	}
+	half := d / 2
+	return half + time.Duration(mrand.Int63n(int64(d-half)+1))
+}
+
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// traceparent builds a W3C trace context header. The trace ID is the request
+// ID when it is 32 hex characters, as generated by logging.RequestID, so the
+// trace and the logs of a request share an ID.
+func traceparent(ctx context.Context) string {
+	traceID := strings.ToLower(logging.RequestIDFromContext(ctx))
+	if _, err := hex.DecodeString(traceID); err != nil || len(traceID) != 32 {
+		traceID = randomHex(16)
+	}
+	return "00-" + traceID + "-" + randomHex(8) + "-01"
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func decode(service string, data []byte, out interface{}) error {
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid %s service response: %w", service, err)
+	}
+	return nil
+}
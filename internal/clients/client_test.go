@@ -0,0 +1,197 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/logging"
+)
+
+func TestMain(m *testing.M) {
+	logging.Init()
+	os.Exit(m.Run())
+}
+
+var fast = Options{Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+func TestReportClientRetriesAndForwardsTrace(t *testing.T) {
+	t.Parallel()
+	const reqID = "0123456789abcdef0123456789abcdef"
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(logging.RequestIDHeader) != reqID {
+			t.Errorf("request id not forwarded: %q", r.Header.Get(logging.RequestIDHeader))
+		}
+		if tp := r.Header.Get("traceparent"); !strings.HasPrefix(tp, "00-"+reqID+"-") {
+			t.Errorf("unexpected traceparent %q", tp)
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"report":true}`))
+	}))
+	defer srv.Close()
+
+	c := NewReportClient(srv.URL, fast)
+	ctx := logging.WithRequestID(context.Background(), reqID)
+	got, err := c.FetchReport(ctx, BirthDetails{DOB: "2000-01-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"report":true}` || calls != 3 {
+		t.Fatalf("got %s after %d calls", got, calls)
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid request"})
+	}))
+	defer srv.Close()
+
+	_, err := NewReportClient(srv.URL, fast).FetchReport(context.Background(), BirthDetails{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 || apiErr.Message != "invalid request" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("client errors must not be retried, got %d calls", calls)
+	}
+}
+
+func TestNonIdempotentNotRetried(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("upstream down"))
+	}))
+	defer srv.Close()
+
+	_, err := NewAuthClient(srv.URL, fast).Exchange(context.Background(), "code")
+	if StatusCode(err) != http.StatusBadGateway || !strings.Contains(err.Error(), "upstream down") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	opts := fast
+	opts.Timeout = 20 * time.Millisecond
+	opts.MaxRetries = -1
+	start := time.Now()
+	if _, err := NewMatchClient(srv.URL, opts).CreateAnalysis(context.Background(), "", AnalysisRequest{}); err == nil {
+		t.Fatal("expected timeout")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("timeout not applied")
+	}
+}
+
+func TestUserClient(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/internal/v1/users":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":7}`))
+		case r.URL.Path == "/api/v1/users/me" && r.Header.Get("Authorization") == "Bearer tok":
+			w.Write([]byte(`{"ID":7,"Email":"a@b.com","Location":"LA"}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid token"}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := NewUserClient(srv.URL, fast)
+	id, created, err := c.CreateUser(context.Background(), "a@b.com", "A")
+	if err != nil || id != 7 || !created {
+		t.Fatalf("create: %d %v %v", id, created, err)
+	}
+	u, err := c.GetMe(context.Background(), "tok")
+	if err != nil || u.Location != "LA" {
+		t.Fatalf("get me: %+v %v", u, err)
+	}
+	if _, err := c.GetMe(context.Background(), "bad"); StatusCode(err) != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %v", err)
+	}
+}
+
+func TestLoadAnalysisAndReport(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/internal/v1/analyses/a1" && r.URL.Query().Get("userId") == "7":
+			w.Write([]byte(`{"analysisId":"a1","score":78,"reportKeys":["ka","kb"]}`))
+		case r.URL.Path == "/internal/v1/reports/ka":
+			w.Write([]byte(`{"moon":{}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/internal/v1/analyses" && r.URL.Query().Get("userId") == "7":
+			w.Write([]byte(`{"analysisId":"a2","score":64}`))
+		case r.URL.Path == "/internal/v1/users/7":
+			w.Write([]byte(`{"ID":7,"Email":"u@x.com"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not found","code":"not_found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	m := NewMatchClient(srv.URL, fast)
+	a, err := m.LoadAnalysis(context.Background(), 7, "a1")
+	if err != nil || a.Score != 78 || a.ReportKeys[1] != "kb" {
+		t.Fatalf("load analysis: %+v %v", a, err)
+	}
+	if _, err := m.LoadAnalysis(context.Background(), 8, "a1"); ErrorCode(err) != httputil.CodeNotFound {
+		t.Fatalf("expected not_found, got %v", err)
+	}
+	if a, err := m.RunAnalysis(context.Background(), 7, AnalysisRequest{}); err != nil || a.ID != "a2" || a.Score != 64 {
+		t.Fatalf("run analysis: %+v %v", a, err)
+	}
+	if u, err := NewUserClient(srv.URL, fast).LoadUser(context.Background(), 7); err != nil || u.Email != "u@x.com" {
+		t.Fatalf("load user: %+v %v", u, err)
+	}
+	r, err := NewReportClient(srv.URL, fast).LoadReport(context.Background(), "ka")
+	if err != nil || string(r) != `{"moon":{}}` {
+		t.Fatalf("load report: %s %v", r, err)
+	}
+}
+
+func TestAuthLoginURL(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://accounts.example.com/o/oauth2", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	u, err := NewAuthClient(srv.URL, fast).LoginURL(context.Background())
+	if err != nil || u != "https://accounts.example.com/o/oauth2" {
+		t.Fatalf("got %q, %v", u, err)
+	}
+}
@@ -0,0 +1,187 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/models"
+)
+
+// FakeReports is an in-memory report service for tests. FetchReport returns
+// Err when set, otherwise Reports[bd] or Default. LoadReport returns
+// ByKey[key] or a not_found error.
+type FakeReports struct {
+	Reports map[BirthDetails][]byte
+	ByKey   map[string][]byte
+	Default []byte
+	Err     error
+
+	mu    sync.Mutex
+	calls int
+}
+
+// FetchReport implements the report service's FetchReport.
+func (f *FakeReports) FetchReport(ctx context.Context, bd BirthDetails) ([]byte, error) {
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if r, ok := f.Reports[bd]; ok {
+		return r, nil
+	}
+	return f.Default, nil
+}
+
+// LoadReport implements the report service's LoadReport.
+func (f *FakeReports) LoadReport(ctx context.Context, key string) ([]byte, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if r, ok := f.ByKey[key]; ok {
+		return r, nil
+	}
+	return nil, notFound("report", "report not found")
+}
+
+// Calls returns the number of FetchReport calls.
+func (f *FakeReports) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// FakeUsers is an in-memory user service for tests. It assigns IDs in
+// registration order, or fails every call with Err when it is set.
+// LoadUser serves the registered users and Profiles, by ID.
+type FakeUsers struct {
+	Profiles map[uint]*models.User
+	Err      error
+
+	mu    sync.Mutex
+	users map[string]*models.User
+}
+
+// RegisterUser implements the user service's RegisterUser.
+func (f *FakeUsers) RegisterUser(ctx context.Context, email, name string) (uint, error) {
+	id, _, err := f.CreateUser(ctx, email, name)
+	return id, err
+}
+
+// CreateUser implements the user service's CreateUser.
+func (f *FakeUsers) CreateUser(ctx context.Context, email, name string) (uint, bool, error) {
+	if f.Err != nil {
+		return 0, false, f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.users == nil {
+		f.users = map[string]*models.User{}
+	}
+	if u, ok := f.users[email]; ok {
+		return u.ID, false, nil
+	}
+	u := &models.User{Email: email}
+	u.ID = uint(len(f.users) + 1)
+	f.users[email] = u
+	return u.ID, true, nil
+}
+
+// LoadUser implements the user service's LoadUser.
+func (f *FakeUsers) LoadUser(ctx context.Context, id uint) (*models.User, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if u, ok := f.Profiles[id]; ok {
+		r := *u
+		return &r, nil
+	}
+	for _, u := range f.users {
+		if u.ID == id {
+			r := *u
+			return &r, nil
+		}
+	}
+	return nil, notFound("user", "user not found")
+}
+
+// FakeMatch is an in-memory match service for tests that returns Result, or
+// Err when set. LoadAnalysis serves Analyses to their owners; RunAnalysis
+// returns Result owned by the caller and records it in Analyses.
+type FakeMatch struct {
+	Result   AnalysisResult
+	Analyses map[string]*AnalysisResult
+	Err      error
+
+	mu sync.Mutex
+}
+
+// LoadAnalysis implements the match service's LoadAnalysis.
+func (f *FakeMatch) LoadAnalysis(ctx context.Context, userID uint, id string) (*AnalysisResult, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a, ok := f.Analyses[id]
+	if !ok || a.UserID != userID {
+		return nil, notFound("match", "analysis not found")
+	}
+	r := *a
+	return &r, nil
+}
+
+// RunAnalysis implements the match service's RunAnalysis.
+func (f *FakeMatch) RunAnalysis(ctx context.Context, userID uint, req AnalysisRequest) (*AnalysisResult, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := f.Result
+	r.UserID = userID
+	if f.Analyses == nil {
+		f.Analyses = map[string]*AnalysisResult{}
+	}
+	stored := r
+	f.Analyses[r.ID] = &stored
+	return &r, nil
+}
+
+// CreateAnalysis implements the match service's CreateAnalysis.
+func (f *FakeMatch) CreateAnalysis(ctx context.Context, token string, req AnalysisRequest) (*AnalysisResult, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	r := f.Result
+	return &r, nil
+}
+
+// FakeAuth is an in-memory auth service for tests. Exchange returns Token for
+// any code except "", which fails like the real service.
+type FakeAuth struct {
+	URL   string
+	Token string
+}
+
+// LoginURL implements the auth service's LoginURL.
+func (f *FakeAuth) LoginURL(ctx context.Context) (string, error) {
+	return f.URL, nil
+}
+
+// Exchange implements the auth service's Exchange.
+func (f *FakeAuth) Exchange(ctx context.Context, code string) (string, error) {
+	if code == "" {
+		return "", &APIError{Service: "auth", StatusCode: http.StatusBadRequest, Code: httputil.CodeValidationFailed, Message: "missing code"}
+	}
+	return f.Token, nil
+}
+
+func notFound(service, message string) *APIError {
+	return &APIError{Service: service, StatusCode: http.StatusNotFound, Code: httputil.CodeNotFound, Message: message}
+}
@@ -0,0 +1,75 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"matchmaker/internal/models"
+)
+
+// AnalysisRequest is the payload of a compatibility analysis.
+type AnalysisRequest struct {
+	PersonA BirthDetails `json:"personA"`
+	PersonB BirthDetails `json:"personB"`
+}
+
+// AnalysisResult is the outcome of a compatibility analysis.
+type AnalysisResult = models.Analysis
+
+// MatchClient calls the match service.
+type MatchClient struct {
+	base
+}
+
+// NewMatchClient returns a client for the match service at baseURL.
+func NewMatchClient(baseURL string, opts Options) *MatchClient {
+	return &MatchClient{newBase("match", baseURL, opts)}
+}
+
+// CreateAnalysis calls POST /api/v1/analysis as the user owning token, which
+// may be empty when the match service is reached without the gateway. The
+// score is a pure function of the input, so the call is retried; a retry
+// after a lost response stores a second copy of the analysis.
+func (c *MatchClient) CreateAnalysis(ctx context.Context, token string, req AnalysisRequest) (*AnalysisResult, error) {
+	_, body, err := c.do(ctx, call{method: http.MethodPost, path: "/api/v1/analysis", token: token, body: req, idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	var out AnalysisResult
+	if err := decode(c.service, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RunAnalysis calls POST /internal/v1/analyses and returns the analysis
+// stored for userID. Like CreateAnalysis, the call is retried.
+func (c *MatchClient) RunAnalysis(ctx context.Context, userID uint, req AnalysisRequest) (*AnalysisResult, error) {
+	path := fmt.Sprintf("/internal/v1/analyses?userId=%d", userID)
+	_, body, err := c.do(ctx, call{method: http.MethodPost, path: path, body: req, idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	var out AnalysisResult
+	if err := decode(c.service, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LoadAnalysis calls GET /internal/v1/analyses/{id} and returns the analysis
+// when it belongs to userID.
+func (c *MatchClient) LoadAnalysis(ctx context.Context, userID uint, id string) (*AnalysisResult, error) {
+	path := fmt.Sprintf("/internal/v1/analyses/%s?userId=%d", url.PathEscape(id), userID)
+	_, body, err := c.do(ctx, call{method: http.MethodGet, path: path, idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	var out AnalysisResult
+	if err := decode(c.service, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
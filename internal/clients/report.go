@@ -0,0 +1,55 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// BirthDetails identify the chart a report is computed for. The binding tags
+// are enforced by the services that accept them.
+type BirthDetails struct {
+	DOB string  `json:"dob" binding:"required"`
+	TOB string  `json:"tob" binding:"required"`
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// ReportClient calls the report service.
+type ReportClient struct {
+	base
+}
+
+// NewReportClient returns a client for the report service at baseURL.
+func NewReportClient(baseURL string, opts Options) *ReportClient {
+	return &ReportClient{newBase("report", baseURL, opts)}
+}
+
+// FetchReport calls POST /internal/v1/reports and returns the raw report.
+// Reports are cached lookups, so the call is retried.
+func (c *ReportClient) FetchReport(ctx context.Context, bd BirthDetails) ([]byte, error) {
+	_, body, err := c.do(ctx, call{method: http.MethodPost, path: "/internal/v1/reports", body: bd, idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	var raw json.RawMessage
+	if err := decode(c.service, body, &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// LoadReport calls GET /internal/v1/reports/{key} and returns the cached
+// report recorded with an analysis.
+func (c *ReportClient) LoadReport(ctx context.Context, key string) ([]byte, error) {
+	_, body, err := c.do(ctx, call{method: http.MethodGet, path: "/internal/v1/reports/" + url.PathEscape(key), idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	var raw json.RawMessage
+	if err := decode(c.service, body, &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
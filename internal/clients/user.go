@@ -0,0 +1,98 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"matchmaker/internal/models"
+)
+
+// ProfileUpdate holds the profile fields a user may change. Empty fields are
+// left unchanged.
+type ProfileUpdate struct {
+	Gender   string `json:"gender,omitempty"`
+	Location string `json:"location,omitempty"`
+	PhotoURL string `json:"photoURL,omitempty"`
+	Locale   string `json:"locale,omitempty"`
+}
+
+// UserClient calls the user service.
+type UserClient struct {
+	base
+}
+
+// NewUserClient returns a client for the user service at baseURL.
+func NewUserClient(baseURL string, opts Options) *UserClient {
+	return &UserClient{newBase("user", baseURL, opts)}
+}
+
+// CreateUser calls POST /internal/v1/users. It finds or creates the user by
+// email, so it is safe to retry; created reports whether a new user was
+// inserted.
+func (c *UserClient) CreateUser(ctx context.Context, email, name string) (id uint, created bool, err error) {
+	resp, body, err := c.do(ctx, call{
+		method:     http.MethodPost,
+		path:       "/internal/v1/users",
+		body:       map[string]string{"email": email, "name": name},
+		idempotent: true,
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	var out struct {
+		ID uint `json:"id"`
+	}
+	if err := decode(c.service, body, &out); err != nil {
+		return 0, false, err
+	}
+	return out.ID, resp.StatusCode == http.StatusCreated, nil
+}
+
+// RegisterUser returns the ID of the user with email, creating it if needed.
+// It lets the auth service register users remotely.
+func (c *UserClient) RegisterUser(ctx context.Context, email, name string) (uint, error) {
+	id, _, err := c.CreateUser(ctx, email, name)
+	return id, err
+}
+
+// LoadUser calls GET /internal/v1/users/{id} and returns the user's
+// profile.
+func (c *UserClient) LoadUser(ctx context.Context, id uint) (*models.User, error) {
+	_, body, err := c.do(ctx, call{method: http.MethodGet, path: fmt.Sprintf("/internal/v1/users/%d", id), idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := decode(c.service, body, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetMe calls GET /api/v1/users/me as the user owning token.
+func (c *UserClient) GetMe(ctx context.Context, token string) (*models.User, error) {
+	_, body, err := c.do(ctx, call{method: http.MethodGet, path: "/api/v1/users/me", token: token, idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := decode(c.service, body, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateMe calls PUT /api/v1/users/me as the user owning token. Setting the
+// same fields twice has the same effect, so the call is retried.
+func (c *UserClient) UpdateMe(ctx context.Context, token string, update ProfileUpdate) (*models.User, error) {
+	_, body, err := c.do(ctx, call{method: http.MethodPut, path: "/api/v1/users/me", token: token, body: update, idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := decode(c.service, body, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
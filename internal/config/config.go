@@ -1,161 +1,191 @@
 package config
 
 import (
-	"fmt"
-	"os"
-	"strings"
+	"strconv"
+	"time"
 )
 
-func getenv(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
-	}
-	return def
+// Config is the configuration of every module. Each field is filled, in
+// increasing precedence, from its default tag, the YAML config file, the
+// environment variable named by its env tag, and the file named by
+// <env>_FILE (for secrets mounted from Kubernetes Secrets). Fields tagged
+// required must be non-empty and fields tagged secret are masked by Redacted.
+// Only the sections of enabled modules are validated.
+type Config struct {
+	Modules []string `yaml:"modules" env:"MODULES" default:"auth,user,report,match,chat,gateway"`
+	Server  Server   `yaml:"server"`
+	Log     Log      `yaml:"log"`
+	Clients Clients  `yaml:"clients"`
+	Auth    Auth     `yaml:"auth"`
+	User    User     `yaml:"user"`
+	Report  Report   `yaml:"report"`
+	Match   Match    `yaml:"match"`
+	Chat    Chat     `yaml:"chat"`
+	Gateway Gateway  `yaml:"gateway"`
 }
 
-func require(key string) (string, error) {
-	v := os.Getenv(key)
-	if v == "" {
-		return "", fmt.Errorf("missing %s", key)
-	}
-	return v, nil
+// Server holds HTTP server settings shared by every service. On shutdown the
+// server keeps accepting connections for DrainDelay after it stops reporting
+// ready, so that load balancers see the failing probe before it goes away.
+type Server struct {
+	Port              int           `yaml:"port" env:"PORT" default:"8080" validate:"min=1"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT" default:"10s"`
+	ReadTimeout       time.Duration `yaml:"readTimeout" env:"HTTP_READ_TIMEOUT" default:"30s"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout" env:"HTTP_WRITE_TIMEOUT" default:"2m"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout" env:"HTTP_IDLE_TIMEOUT" default:"2m"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" default:"30s"`
+	DrainDelay        time.Duration `yaml:"drainDelay" env:"SHUTDOWN_DRAIN_DELAY" default:"5s"`
 }
 
-// Auth holds configuration for the auth service.
-type Auth struct {
-	GoogleClientID     string
-	GoogleClientSecret string
-	GoogleRedirectURL  string
-	JWTPrivateKey      string
-	UserServiceURL     string
+// Addr returns the listen address.
+func (s *Server) Addr() string {
+	return ":" + strconv.Itoa(s.Port)
 }
 
-// LoadAuth reads environment variables and validates required fields.
-func LoadAuth() (*Auth, error) {
-	var missing []string
-	cfg := &Auth{
-		GoogleClientID:     os.Getenv("GOOGLE_OAUTH_CLIENT_ID"),
-		GoogleClientSecret: os.Getenv("GOOGLE_OAUTH_CLIENT_SECRET"),
-		GoogleRedirectURL:  getenv("GOOGLE_OAUTH_REDIRECT_URL", "http://localhost:8081/api/v1/auth/google/callback"),
-		JWTPrivateKey:      os.Getenv("JWT_PRIVATE_KEY"),
-		UserServiceURL:     getenv("USER_SERVICE_URL", "http://localhost:8084"),
-	}
-	if cfg.GoogleClientID == "" {
-		missing = append(missing, "GOOGLE_OAUTH_CLIENT_ID")
-	}
-	if cfg.GoogleClientSecret == "" {
-		missing = append(missing, "GOOGLE_OAUTH_CLIENT_SECRET")
-	}
-	if cfg.JWTPrivateKey == "" {
-		missing = append(missing, "JWT_PRIVATE_KEY")
-	}
-	if len(missing) > 0 {
-		return nil, fmt.Errorf("missing env vars: %s", strings.Join(missing, ", "))
-	}
-	return cfg, nil
+// Log holds logger settings.
+type Log struct {
+	Format string `yaml:"format" env:"LOG_FORMAT" default:"json" validate:"oneof=json|text"`
+	Level  string `yaml:"level" env:"LOG_LEVEL" default:"info" validate:"oneof=trace|debug|info|warn|warning|error|fatal|panic"`
 }
 
-// User holds configuration for the user service.
-type User struct {
-	PostgresURL string
+// Clients holds settings for calls between services.
+type Clients struct {
+	Timeout    time.Duration `yaml:"timeout" env:"CLIENT_TIMEOUT" default:"10s"`
+	MaxRetries int           `yaml:"maxRetries" env:"CLIENT_MAX_RETRIES" default:"2" validate:"min=0"`
+	Backoff    time.Duration `yaml:"backoff" env:"CLIENT_RETRY_BACKOFF" default:"100ms"`
 }
 
-// LoadUser loads the configuration for the user service.
-func LoadUser() (*User, error) {
-	dsn, err := require("POSTGRES_URL")
-	if err != nil {
-		return nil, err
-	}
-	return &User{PostgresURL: dsn}, nil
+// Auth holds configuration for the auth service. Users signing in with one
+// of ModeratorEmails may review chat moderation events; those signing in
+// with one of AdminEmails may manage the service, such as previewing chat
+// prompts.
+type Auth struct {
+	GoogleClientID     string   `yaml:"googleClientID" env:"GOOGLE_OAUTH_CLIENT_ID" required:"true"`
+	GoogleClientSecret string   `yaml:"googleClientSecret" env:"GOOGLE_OAUTH_CLIENT_SECRET" required:"true" secret:"true"`
+	GoogleRedirectURL  string   `yaml:"googleRedirectURL" env:"GOOGLE_OAUTH_REDIRECT_URL" default:"http://localhost:8081/api/v1/auth/google/callback" validate:"url"`
+	JWTPrivateKey      string   `yaml:"jwtPrivateKey" env:"JWT_PRIVATE_KEY" required:"true" secret:"true"`
+	UserServiceURL     string   `yaml:"userServiceURL" env:"USER_SERVICE_URL" default:"http://localhost:8084" validate:"url"`
+	ModeratorEmails    []string `yaml:"moderatorEmails" env:"AUTH_MODERATOR_EMAILS"`
+	AdminEmails        []string `yaml:"adminEmails" env:"AUTH_ADMIN_EMAILS"`
 }
 
-// Report holds configuration for the astrology report service.
-type Report struct {
-	MongoURL              string
-	RedisURL              string
-	AstrologyEngineURL    string
-	AstrologyEngineAPIKey string
+// User holds configuration for the user service.
+type User struct {
+	PostgresURL string `yaml:"postgresURL" env:"POSTGRES_URL" required:"true" secret:"true"`
 }
 
-// LoadReport reads config for the report service.
-func LoadReport() (*Report, error) {
-	var missing []string
-	cfg := &Report{
-		MongoURL:              os.Getenv("MONGO_URL"),
-		RedisURL:              os.Getenv("REDIS_URL"),
-		AstrologyEngineURL:    os.Getenv("ASTROLOGY_ENGINE_URL"),
-		AstrologyEngineAPIKey: os.Getenv("ASTROLOGY_ENGINE_API_KEY"),
-	}
-	if cfg.MongoURL == "" {
-		missing = append(missing, "MONGO_URL")
-	}
-	if cfg.RedisURL == "" {
-		missing = append(missing, "REDIS_URL")
-	}
-	if cfg.AstrologyEngineURL == "" {
-		missing = append(missing, "ASTROLOGY_ENGINE_URL")
-	}
-	if len(missing) > 0 {
-		return nil, fmt.Errorf("missing env vars: %s", strings.Join(missing, ", "))
-	}
-	return cfg, nil
+// Report holds configuration for the astrology report service.
+type Report struct {
+	MongoURL              string `yaml:"mongoURL" env:"MONGO_URL" required:"true" secret:"true"`
+	RedisURL              string `yaml:"redisURL" env:"REDIS_URL" required:"true" secret:"true"`
+	AstrologyEngineURL    string `yaml:"astrologyEngineURL" env:"ASTROLOGY_ENGINE_URL" required:"true" validate:"url"`
+	AstrologyEngineAPIKey string `yaml:"astrologyEngineAPIKey" env:"ASTROLOGY_ENGINE_API_KEY" secret:"true"`
 }
 
-// Match holds configuration for the match analysis service.
+// Match holds configuration for the match analysis service. Without
+// MongoURL analyses are kept in memory and lost on restart. A batch ranks
+// at most BatchMaxCandidates candidates, fetching BatchConcurrency reports
+// at a time; batches of more than BatchSyncLimit candidates run as jobs,
+// as do analyses requested with async. Jobs are run by Workers workers per
+// replica, time out after JobTimeout and are kept for JobTTL. Jobs, their
+// queue and webhooks are kept in RedisURL, where every replica can run and
+// report them, or in memory without it. Webhook deliveries time out after
+// WebhookTimeout and are retried WebhookMaxRetries times. Webhooks may only
+// point to private and local addresses with WebhookAllowPrivate.
 type Match struct {
-	ReportServiceURL string
-}
-
-// LoadMatch returns config for the match service.
-func LoadMatch() (*Match, error) {
-	return &Match{
-		ReportServiceURL: getenv("REPORT_SERVICE_URL", "http://localhost:8082"),
-	}, nil
+	ReportServiceURL    string        `yaml:"reportServiceURL" env:"REPORT_SERVICE_URL" default:"http://localhost:8082" validate:"url"`
+	MongoURL            string        `yaml:"mongoURL" env:"MONGO_URL" secret:"true"`
+	RedisURL            string        `yaml:"redisURL" env:"REDIS_URL" secret:"true"`
+	BatchMaxCandidates  int           `yaml:"batchMaxCandidates" env:"MATCH_BATCH_MAX_CANDIDATES" default:"50" validate:"min=1"`
+	BatchConcurrency    int           `yaml:"batchConcurrency" env:"MATCH_BATCH_CONCURRENCY" default:"4" validate:"min=1"`
+	BatchSyncLimit      int           `yaml:"batchSyncLimit" env:"MATCH_BATCH_SYNC_LIMIT" default:"10" validate:"min=1"`
+	JobTimeout          time.Duration `yaml:"jobTimeout" env:"MATCH_JOB_TIMEOUT" default:"5m"`
+	JobTTL              time.Duration `yaml:"jobTTL" env:"MATCH_JOB_TTL" default:"24h"`
+	Workers             int           `yaml:"workers" env:"MATCH_WORKERS" default:"4"`
+	WebhookTimeout      time.Duration `yaml:"webhookTimeout" env:"MATCH_WEBHOOK_TIMEOUT" default:"5s"`
+	WebhookMaxRetries   int           `yaml:"webhookMaxRetries" env:"MATCH_WEBHOOK_MAX_RETRIES" default:"3"`
+	WebhookAllowPrivate bool          `yaml:"webhookAllowPrivate" env:"MATCH_WEBHOOK_ALLOW_PRIVATE"`
 }
 
-// Chat holds configuration for the chat service.
+// Chat holds configuration for the chat service. LLMAPIURL and LLMModel
+// default to the provider's public endpoint and a small model; LLMAPIKey is
+// required except with ollama. A
+// completion must start within LLMFirstTokenTimeout and finish within
+// LLMTimeout; until it starts, failed calls are retried LLMMaxRetries
+// times after LLMRetryBackoff, doubling, and then sent to the fallback:
+// LLMFallbackProvider, or the same provider when only LLMFallbackModel is
+// set, with LLMAPIKey when LLMFallbackAPIKey is empty.
+// ContextTokens bounds the conversation memory sent with each question;
+// older turns are summarized to stay within it. HistoryTTL is how long an
+// idle conversation is remembered. Without MongoURL transcripts are kept in
+// memory and lost on restart. AllowedOrigins lists the web origins whose
+// pages may open chat sockets ("*" for any); when empty only the chat's own
+// host may. Clients are pinged every PingInterval and dropped after
+// PongTimeout of silence. MaxConnections bounds each user's open sockets.
+// SlowConsumer picks what happens to clients that cannot keep up once
+// SendBuffer frames wait for them: coalesce merges waiting answer chunks,
+// close disconnects them so they resume after reconnecting. Plans lists
+// the chat plans as name:daily/monthly token quotas, 0 meaning unlimited;
+// users whose plan is not listed get DefaultPlan. Usage is counted in
+// Redis and saved to PostgresURL every UsageFlushInterval; without it,
+// usage is only kept in Redis and every user gets DefaultPlan.
+// Messages and answers are moderated with the rules in
+// ModerationRulesFile; ModerationPII is the action on phone numbers and
+// email addresses (off, flag, redact or block). ModerationURL, when set,
+// is an external moderation service consulted within ModerationTimeout.
+// Moderation events are kept in MongoURL, or in memory without it. The
+// system prompt is rendered from the templates in PromptsFile, or the
+// built-in one, for the assistant playing Persona. With Tools the model
+// may fetch reports, run analyses and read the user's profile while
+// answering; profiles come from UserServiceURL.
 type Chat struct {
-	RedisURL  string
-	LLMAPIURL string
-	LLMAPIKey string
-}
-
-// LoadChat loads config for the chat service.
-func LoadChat() (*Chat, error) {
-	if os.Getenv("REDIS_URL") == "" {
-		return nil, fmt.Errorf("missing REDIS_URL")
-	}
-	cfg := &Chat{
-		RedisURL:  os.Getenv("REDIS_URL"),
-		LLMAPIURL: getenv("LLM_API_URL", "https://example.com/api/chat"),
-		LLMAPIKey: os.Getenv("LLM_API_KEY"),
-	}
-	if cfg.LLMAPIKey == "" {
-		return nil, fmt.Errorf("missing LLM_API_KEY")
-	}
-	return cfg, nil
+	RedisURL             string        `yaml:"redisURL" env:"REDIS_URL" required:"true" secret:"true"`
+	LLMProvider          string        `yaml:"llmProvider" env:"LLM_PROVIDER" default:"openai" validate:"oneof=openai|anthropic|ollama"`
+	LLMAPIURL            string        `yaml:"llmAPIURL" env:"LLM_API_URL" validate:"url"`
+	LLMAPIKey            string        `yaml:"llmAPIKey" env:"LLM_API_KEY" secret:"true"`
+	LLMModel             string        `yaml:"llmModel" env:"LLM_MODEL"`
+	LLMTimeout           time.Duration `yaml:"llmTimeout" env:"LLM_TIMEOUT" default:"2m"`
+	LLMFirstTokenTimeout time.Duration `yaml:"llmFirstTokenTimeout" env:"LLM_FIRST_TOKEN_TIMEOUT" default:"20s"`
+	LLMMaxRetries        int           `yaml:"llmMaxRetries" env:"LLM_MAX_RETRIES" default:"2" validate:"min=0"`
+	LLMRetryBackoff      time.Duration `yaml:"llmRetryBackoff" env:"LLM_RETRY_BACKOFF" default:"250ms"`
+	LLMFallbackProvider  string        `yaml:"llmFallbackProvider" env:"LLM_FALLBACK_PROVIDER" validate:"oneof=openai|anthropic|ollama"`
+	LLMFallbackAPIURL    string        `yaml:"llmFallbackAPIURL" env:"LLM_FALLBACK_API_URL" validate:"url"`
+	LLMFallbackAPIKey    string        `yaml:"llmFallbackAPIKey" env:"LLM_FALLBACK_API_KEY" secret:"true"`
+	LLMFallbackModel     string        `yaml:"llmFallbackModel" env:"LLM_FALLBACK_MODEL"`
+	ContextTokens        int           `yaml:"contextTokens" env:"CHAT_CONTEXT_TOKENS" default:"3000" validate:"min=200"`
+	HistoryTTL           time.Duration `yaml:"historyTTL" env:"CHAT_HISTORY_TTL" default:"720h"`
+	MatchServiceURL      string        `yaml:"matchServiceURL" env:"MATCH_SERVICE_URL" default:"http://localhost:8083" validate:"url"`
+	ReportServiceURL     string        `yaml:"reportServiceURL" env:"REPORT_SERVICE_URL" default:"http://localhost:8082" validate:"url"`
+	UserServiceURL       string        `yaml:"userServiceURL" env:"USER_SERVICE_URL" default:"http://localhost:8084" validate:"url"`
+	MongoURL             string        `yaml:"mongoURL" env:"MONGO_URL" secret:"true"`
+	AllowedOrigins       []string      `yaml:"allowedOrigins" env:"CHAT_ALLOWED_ORIGINS"`
+	MaxMessageBytes      int           `yaml:"maxMessageBytes" env:"CHAT_MAX_MESSAGE_BYTES" default:"16384" validate:"min=256"`
+	PingInterval         time.Duration `yaml:"pingInterval" env:"CHAT_PING_INTERVAL" default:"30s"`
+	PongTimeout          time.Duration `yaml:"pongTimeout" env:"CHAT_PONG_TIMEOUT" default:"60s"`
+	WriteTimeout         time.Duration `yaml:"writeTimeout" env:"CHAT_WRITE_TIMEOUT" default:"10s"`
+	MaxConnections       int           `yaml:"maxConnections" env:"CHAT_MAX_CONNECTIONS_PER_USER" default:"5" validate:"min=1"`
+	SendBuffer           int           `yaml:"sendBuffer" env:"CHAT_SEND_BUFFER" default:"256" validate:"min=1"`
+	SlowConsumer         string        `yaml:"slowConsumer" env:"CHAT_SLOW_CONSUMER" default:"coalesce" validate:"oneof=coalesce|close"`
+	PostgresURL          string        `yaml:"postgresURL" env:"POSTGRES_URL" secret:"true"`
+	Plans                []string      `yaml:"plans" env:"CHAT_PLANS" default:"free:20000/200000,pro:200000/4000000,unlimited:0/0"`
+	DefaultPlan          string        `yaml:"defaultPlan" env:"CHAT_DEFAULT_PLAN" default:"free"`
+	UsageFlushInterval   time.Duration `yaml:"usageFlushInterval" env:"CHAT_USAGE_FLUSH_INTERVAL" default:"1m"`
+	ModerationRulesFile  string        `yaml:"moderationRulesFile" env:"CHAT_MODERATION_RULES_FILE"`
+	ModerationPII        string        `yaml:"moderationPII" env:"CHAT_MODERATION_PII" default:"redact" validate:"oneof=off|flag|redact|block"`
+	ModerationURL        string        `yaml:"moderationURL" env:"CHAT_MODERATION_URL" validate:"url"`
+	ModerationAPIKey     string        `yaml:"moderationAPIKey" env:"CHAT_MODERATION_API_KEY" secret:"true"`
+	ModerationTimeout    time.Duration `yaml:"moderationTimeout" env:"CHAT_MODERATION_TIMEOUT" default:"2s"`
+	PromptsFile          string        `yaml:"promptsFile" env:"CHAT_PROMPTS_FILE"`
+	Persona              string        `yaml:"persona" env:"CHAT_PERSONA"`
+	Tools                bool          `yaml:"tools" env:"CHAT_TOOLS" default:"true"`
 }
 
 // Gateway holds configuration for the API gateway.
 type Gateway struct {
-	AuthServiceURL  string
-	UserServiceURL  string
-	MatchServiceURL string
-	ChatServiceURL  string
-	JWTPrivateKey   string
-}
-
-// LoadGateway loads configuration for the gateway service.
-func LoadGateway() (*Gateway, error) {
-	key, err := require("JWT_PRIVATE_KEY")
-	if err != nil {
-		return nil, err
-	}
-	return &Gateway{
-		AuthServiceURL:  getenv("AUTH_SERVICE_URL", "http://localhost:8081"),
-		UserServiceURL:  getenv("USER_SERVICE_URL", "http://localhost:8084"),
-		MatchServiceURL: getenv("MATCH_SERVICE_URL", "http://localhost:8083"),
-		ChatServiceURL:  getenv("CHAT_SERVICE_URL", "http://localhost:8082"),
-		JWTPrivateKey:   key,
-	}, nil
+	AuthServiceURL  string `yaml:"authServiceURL" env:"AUTH_SERVICE_URL" default:"http://localhost:8081" validate:"url"`
+	UserServiceURL  string `yaml:"userServiceURL" env:"USER_SERVICE_URL" default:"http://localhost:8084" validate:"url"`
+	MatchServiceURL string `yaml:"matchServiceURL" env:"MATCH_SERVICE_URL" default:"http://localhost:8083" validate:"url"`
+	ChatServiceURL  string `yaml:"chatServiceURL" env:"CHAT_SERVICE_URL" default:"http://localhost:8082" validate:"url"`
+	JWTPrivateKey   string `yaml:"jwtPrivateKey" env:"JWT_PRIVATE_KEY" required:"true" secret:"true"`
+	Workers         int    `yaml:"workers" env:"GATEWAY_WORKERS" default:"8" validate:"min=1"`
 }
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	os.WriteFile(file, []byte(`
+server:
+  port: 9000
+  shutdownTimeout: 5s
+chat:
+  llmAPIURL: https://llm.example.com/v1
+  redisURL: redis://from-file:6379
+`), 0o600)
+	secret := filepath.Join(dir, "llm-key")
+	os.WriteFile(secret, []byte("s3cret\n"), 0o600)
+
+	t.Setenv("REDIS_URL", "redis://from-env:6379")
+	t.Setenv("LLM_API_KEY_FILE", secret)
+
+	cfg, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9000 || cfg.Server.ShutdownTimeout != 5*time.Second {
+		t.Fatalf("file values not applied: %+v", cfg.Server)
+	}
+	if cfg.Server.ReadTimeout != 30*time.Second {
+		t.Fatalf("default not applied: %v", cfg.Server.ReadTimeout)
+	}
+	if cfg.Chat.LLMAPIURL != "https://llm.example.com/v1" {
+		t.Fatalf("file value lost: %s", cfg.Chat.LLMAPIURL)
+	}
+	if cfg.Chat.RedisURL != "redis://from-env:6379" {
+		t.Fatalf("env should override file, got %s", cfg.Chat.RedisURL)
+	}
+	if cfg.Chat.LLMAPIKey != "s3cret" {
+		t.Fatalf("secret file not applied, got %q", cfg.Chat.LLMAPIKey)
+	}
+
+	cfg.Modules = []string{"chat"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := cfg.Redacted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "s3cret") || strings.Contains(string(out), "from-env") {
+		t.Fatalf("secrets leaked in dump:\n%s", out)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Setenv("LLM_API_URL", "not a url")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Modules = []string{"match"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("match has no required fields: %v", err)
+	}
+
+	cfg.Modules = []string{"chat"}
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"chat.redisURL (REDIS_URL) is required", "chat.llmAPIKey (LLM_API_KEY) is required", "chat.llmAPIURL (LLM_API_URL) must be an absolute URL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q missing %q", err, want)
+		}
+	}
+
+	// Ollama needs no key, unless another provider is the fallback.
+	cfg.Chat.RedisURL = "redis://localhost:6379"
+	cfg.Chat.LLMAPIURL = "http://localhost:11434"
+	cfg.Chat.LLMProvider = "ollama"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("ollama without a key: %v", err)
+	}
+	cfg.Chat.LLMFallbackProvider = "anthropic"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "chat.llmFallbackAPIKey (LLM_FALLBACK_API_KEY) is required") {
+		t.Fatalf("expected a fallback key error, got %v", err)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(file, []byte("chat:\n  llmUrl: x\n"), 0o600)
+	if _, err := Load(file); err == nil {
+		t.Fatal("expected error for misspelled key")
+	}
+}
@@ -0,0 +1,279 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[REDACTED]"
+
+// Flags are the command-line flags shared by every binary.
+type Flags struct {
+	// File is the YAML config file; it defaults to $CONFIG_FILE.
+	File string
+	// Print requests a redacted dump of the effective config instead of
+	// starting the server.
+	Print bool
+}
+
+// ParseFlags parses --config and --print-config from args.
+func ParseFlags(args []string) (*Flags, error) {
+	f := &Flags{}
+	fs := flag.NewFlagSet("matchmaker", flag.ContinueOnError)
+	fs.StringVar(&f.File, "config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	fs.BoolVar(&f.Print, "print-config", false, "print the effective config with secrets redacted and exit")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Load builds a Config from defaults, the YAML file at path (skipped when
+// empty), environment variables and *_FILE secret files. It does not check
+// required fields; call Validate once the enabled modules are known.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	root := reflect.ValueOf(cfg).Elem()
+	if err := walk(root, "", applyDefault); err != nil {
+		return nil, err
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config file: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	}
+	if err := walk(root, "", applyEnv); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks required fields and validate rules for the server, log and
+// clients settings and for the section of every module listed in Modules.
+func (c *Config) Validate() error {
+	enabled := map[string]bool{"server": true, "log": true, "clients": true}
+	for _, m := range c.Modules {
+		enabled[m] = true
+	}
+	var problems []string
+	root := reflect.ValueOf(c).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		sf := root.Type().Field(i)
+		name := yamlName(sf)
+		if sf.Type.Kind() != reflect.Struct || !enabled[name] {
+			continue
+		}
+		walk(root.Field(i), name, func(f field) error {
+			if msg := check(f); msg != "" {
+				problems = append(problems, msg)
+			}
+			return nil
+		})
+	}
+	if enabled["chat"] {
+		problems = append(problems, c.Chat.problems()...)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Redacted returns the config as YAML with every non-empty secret masked.
+func (c *Config) Redacted() ([]byte, error) {
+	cp := *c
+	walk(reflect.ValueOf(&cp).Elem(), "", func(f field) error {
+		if f.tag.Get("secret") == "true" && f.value.Kind() == reflect.String && f.value.String() != "" {
+			f.value.SetString(redacted)
+		}
+		return nil
+	})
+	return yaml.Marshal(&cp)
+}
+
+type field struct {
+	value reflect.Value
+	tag   reflect.StructTag
+	path  string
+}
+
+// walk calls fn for every leaf field of the struct v, descending into
+// nested structs.
+func walk(v reflect.Value, prefix string, fn func(field) error) error {
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		path := yamlName(sf)
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			if err := walk(fv, path, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(field{value: fv, tag: sf.Tag, path: path}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func yamlName(sf reflect.StructField) string {
+	if name := strings.Split(sf.Tag.Get("yaml"), ",")[0]; name != "" {
+		return name
+	}
+	return strings.ToLower(sf.Name)
+}
+
+func applyDefault(f field) error {
+	def, ok := f.tag.Lookup("default")
+	if !ok {
+		return nil
+	}
+	if err := set(f.value, def); err != nil {
+		return fmt.Errorf("default for %s: %w", f.path, err)
+	}
+	return nil
+}
+
+func applyEnv(f field) error {
+	key := f.tag.Get("env")
+	if key == "" {
+		return nil
+	}
+	if v := os.Getenv(key); v != "" {
+		if err := set(f.value, v); err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	if p := os.Getenv(key + "_FILE"); p != "" {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("read %s_FILE: %w", key, err)
+		}
+		if err := set(f.value, strings.TrimRight(string(data), "\r\n")); err != nil {
+			return fmt.Errorf("invalid %s_FILE: %w", key, err)
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses s into v according to v's type.
+func set(v reflect.Value, s string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
+
+// keyedProviders are the LLM providers that need an API key.
+var keyedProviders = map[string]bool{"openai": true, "anthropic": true}
+
+// problems describes what the chat settings lack beyond single fields: an
+// API key for providers that need one.
+func (c *Chat) problems() []string {
+	var out []string
+	if keyedProviders[strings.ToLower(c.LLMProvider)] && c.LLMAPIKey == "" {
+		out = append(out, "chat.llmAPIKey (LLM_API_KEY) is required with chat.llmProvider "+c.LLMProvider)
+	}
+	fallback := c.LLMFallbackProvider
+	if fallback == "" && c.LLMFallbackModel != "" {
+		fallback = c.LLMProvider
+	}
+	if keyedProviders[strings.ToLower(fallback)] && c.LLMFallbackAPIKey == "" && c.LLMAPIKey == "" {
+		out = append(out, "chat.llmFallbackAPIKey (LLM_FALLBACK_API_KEY) is required with chat.llmFallbackProvider "+fallback)
+	}
+	return out
+}
+
+// check returns a description of why f is invalid, or "".
+func check(f field) string {
+	name := f.path
+	if env := f.tag.Get("env"); env != "" {
+		name += " (" + env + ")"
+	}
+	if f.tag.Get("required") == "true" && f.value.IsZero() {
+		return name + " is required"
+	}
+	rule := f.tag.Get("validate")
+	if rule == "" || f.value.IsZero() {
+		return ""
+	}
+	kind, arg, _ := strings.Cut(rule, "=")
+	switch kind {
+	case "url":
+		u, err := url.Parse(f.value.String())
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return name + " must be an absolute URL"
+		}
+	case "min":
+		min, _ := strconv.ParseInt(arg, 10, 64)
+		if f.value.Int() < min {
+			return fmt.Sprintf("%s must be at least %d", name, min)
+		}
+	case "oneof":
+		for _, opt := range strings.Split(arg, "|") {
+			if strings.EqualFold(f.value.String(), opt) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%s must be one of %s", name, strings.ReplaceAll(arg, "|", ", "))
+	}
+	return ""
+}
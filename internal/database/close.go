@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+
+	"matchmaker/internal/health"
+)
+
+// PostgresCheck returns a readiness check that pings db.
+func PostgresCheck(db *gorm.DB) health.Check {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// RedisCheck returns a readiness check that pings client.
+func RedisCheck(client *redis.Client) health.Check {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}
+}
+
+// MongoCheck returns a readiness check that pings the client of db.
+func MongoCheck(db *mongo.Database) health.Check {
+	return func(ctx context.Context) error {
+		return db.Client().Ping(ctx, nil)
+	}
+}
+
+// ClosePostgres closes the connection pool of db.
+func ClosePostgres(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// CloseMongo disconnects the client of db.
+func CloseMongo(db *mongo.Database) error {
+	return db.Client().Disconnect(context.Background())
+}
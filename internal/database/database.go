@@ -1,27 +1,34 @@
 package database
 
 import (
-	"os"
+	"log"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 
 	"matchmaker/internal/logging"
 )
 
-var DB *gorm.DB
-
-// Init opens a GORM connection using POSTGRES_URL. On success it sets DB.
-func Init() (*gorm.DB, error) {
-	dsn := os.Getenv("POSTGRES_URL")
-	if dsn == "" {
-		logging.Log.Warn("POSTGRES_URL not set")
-	}
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// Init opens a GORM connection to the Postgres DSN.
+func Init(dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: gormLogger()})
 	if err != nil {
 		logging.Log.WithError(err).Error("failed to connect to postgres")
 		return nil, err
 	}
-	DB = db
 	return db, nil
 }
+
+// gormLogger routes GORM output through Log. Queries are logged with
+// placeholders rather than bound values so profile data never reaches logs.
+func gormLogger() logger.Interface {
+	return logger.New(log.New(logging.Log.WriterLevel(logrus.WarnLevel), "", 0), logger.Config{
+		SlowThreshold:             200 * time.Millisecond,
+		LogLevel:                  logger.Warn,
+		IgnoreRecordNotFoundError: true,
+		ParameterizedQueries:      true,
+	})
+}
@@ -2,7 +2,6 @@ package database
 
 import (
 	"context"
-	"os"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -10,19 +9,12 @@ import (
 	"matchmaker/internal/logging"
 )
 
-var Mongo *mongo.Database
-
-// InitMongo connects to MongoDB using MONGO_URL.
-func InitMongo() (*mongo.Database, error) {
-	uri := os.Getenv("MONGO_URL")
-	if uri == "" {
-		logging.Log.Warn("MONGO_URL not set")
-	}
+// InitMongo connects to MongoDB at uri and returns the "astrology" database.
+func InitMongo(uri string) (*mongo.Database, error) {
 	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
 	if err != nil {
 		logging.Log.WithError(err).Error("failed to connect to mongodb")
 		return nil, err
 	}
-	Mongo = client.Database("astrology")
-	return Mongo, nil
+	return client.Database("astrology"), nil
 }
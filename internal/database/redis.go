@@ -2,21 +2,14 @@ package database
 
 import (
 	"context"
-	"os"
 
 	"github.com/redis/go-redis/v9"
 
 	"matchmaker/internal/logging"
 )
 
-var Redis *redis.Client
-
-// InitRedis connects to Redis using REDIS_URL.
-func InitRedis() (*redis.Client, error) {
-	url := os.Getenv("REDIS_URL")
-	if url == "" {
-		logging.Log.Warn("REDIS_URL not set")
-	}
+// InitRedis connects to Redis at url.
+func InitRedis(url string) (*redis.Client, error) {
 	opts, err := redis.ParseURL(url)
 	if err != nil {
 		logging.Log.WithError(err).Error("invalid redis url")
@@ -27,6 +20,5 @@ func InitRedis() (*redis.Client, error) {
 		logging.Log.WithError(err).Error("failed to connect to redis")
 		return nil, err
 	}
-	Redis = client
 	return client, nil
 }
@@ -1,44 +1,245 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
-	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/clients"
 	"matchmaker/internal/httputil"
+	"matchmaker/internal/i18n"
 	"matchmaker/internal/logging"
+	"matchmaker/internal/models"
+	"matchmaker/internal/store"
 )
 
 // AnalysisRequest represents the payload for compatibility analysis.
-type AnalysisRequest struct {
-	PersonA BirthDetails `json:"personA"`
-	PersonB BirthDetails `json:"personB"`
+type AnalysisRequest = clients.AnalysisRequest
+
+// AnalysisPage is one page of a user's analyses, newest first.
+type AnalysisPage struct {
+	Items  []models.Analysis `json:"items"`
+	Total  int64             `json:"total"`
+	Offset int               `json:"offset"`
+	Limit  int               `json:"limit"`
+}
+
+// Page sizes of list endpoints.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageParams returns the offset and limit query parameters, clamped to
+// sensible values.
+func pageParams(c *gin.Context) (offset, limit int) {
+	offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || limit > maxPageSize {
+		limit = defaultPageSize
+	}
+	return offset, limit
+}
+
+// AnalysisOptions tunes the batch analyses and background jobs of the match
+// service. Zero fields use the defaults below.
+type AnalysisOptions struct {
+	// Jobs keeps the jobs run in the background and Queue hands them to
+	// the workers started by Work. Nil ones keep them in memory, where only
+	// the replica that queued a job can run and report it.
+	Jobs  store.AnalysisJobStore
+	Queue store.AnalysisJobQueue
+	// Webhooks keeps the URLs to which users want finished jobs posted;
+	// nil keeps them in memory.
+	Webhooks store.AnalysisWebhookStore
+	// BatchMaxCandidates bounds the candidates of one batch.
+	BatchMaxCandidates int
+	// BatchConcurrency bounds the reports a batch fetches at once.
+	BatchConcurrency int
+	// BatchSyncLimit is the largest batch answered in the request; larger
+	// ones run as jobs.
+	BatchSyncLimit int
+	// JobTimeout bounds running one job.
+	JobTimeout time.Duration
+	// JobEventInterval is how often a job's event stream checks for a new
+	// status.
+	JobEventInterval time.Duration
+	// WebhookTimeout bounds one webhook delivery. Failed deliveries are
+	// retried WebhookMaxRetries times, none when it is negative, after
+	// WebhookBackoff, doubling.
+	WebhookTimeout    time.Duration
+	WebhookMaxRetries int
+	WebhookBackoff    time.Duration
+	// WebhookAllowPrivate lets webhooks point to loopback, link-local and
+	// private addresses, which are refused by default so that users cannot
+	// make the service call hosts on its own network.
+	WebhookAllowPrivate bool
+}
+
+// Defaults of AnalysisOptions.
+const (
+	DefaultBatchMaxCandidates = 50
+	DefaultBatchConcurrency   = 4
+	DefaultBatchSyncLimit     = 10
+	DefaultJobTimeout         = 5 * time.Minute
+	DefaultJobEventInterval   = 500 * time.Millisecond
+	DefaultWebhookTimeout     = 5 * time.Second
+	DefaultWebhookMaxRetries  = 3
+	DefaultWebhookBackoff     = time.Second
+)
+
+func (o AnalysisOptions) withDefaults() AnalysisOptions {
+	if o.Jobs == nil {
+		o.Jobs = store.NewMemoryAnalysisJobStore()
+	}
+	if o.Queue == nil {
+		o.Queue = store.NewMemoryAnalysisJobQueue()
+	}
+	if o.Webhooks == nil {
+		o.Webhooks = store.NewMemoryAnalysisWebhookStore()
+	}
+	if o.BatchMaxCandidates <= 0 {
+		o.BatchMaxCandidates = DefaultBatchMaxCandidates
+	}
+	if o.BatchConcurrency <= 0 {
+		o.BatchConcurrency = DefaultBatchConcurrency
+	}
+	if o.BatchSyncLimit <= 0 {
+		o.BatchSyncLimit = DefaultBatchSyncLimit
+	}
+	if o.JobTimeout <= 0 {
+		o.JobTimeout = DefaultJobTimeout
+	}
+	if o.JobEventInterval <= 0 {
+		o.JobEventInterval = DefaultJobEventInterval
+	}
+	if o.WebhookTimeout <= 0 {
+		o.WebhookTimeout = DefaultWebhookTimeout
+	}
+	if o.WebhookMaxRetries < 0 {
+		o.WebhookMaxRetries = 0
+	} else if o.WebhookMaxRetries == 0 {
+		o.WebhookMaxRetries = DefaultWebhookMaxRetries
+	}
+	if o.WebhookBackoff <= 0 {
+		o.WebhookBackoff = DefaultWebhookBackoff
+	}
+	return o
+}
+
+// Analysis serves the match analysis API.
+type Analysis struct {
+	reports  ReportFetcher
+	analyses store.AnalysisStore
+	opts     AnalysisOptions
+	hooks    *http.Client
+}
+
+// NewAnalysis returns an Analysis that loads reports through reports and
+// keeps the analyses it computes in analyses.
+func NewAnalysis(reports ReportFetcher, analyses store.AnalysisStore, opts AnalysisOptions) *Analysis {
+	opts = opts.withDefaults()
+	return &Analysis{
+		reports:  reports,
+		analyses: analyses,
+		opts:     opts,
+		hooks:    webhookClient(opts.WebhookTimeout, opts.WebhookAllowPrivate),
+	}
 }
 
-// CreateAnalysis handles POST /api/v1/analysis.
-func CreateAnalysis(c *gin.Context) {
+// Create handles POST /api/v1/analysis[?async=true]. The analysis is
+// stored for the calling user; anonymous callers get a result that is not
+// stored, as nobody could fetch it again. With async set, signed-in callers get 202 and a job to poll
+// at /api/v1/analysis/jobs/{id} instead.
+func (a *Analysis) Create(c *gin.Context) {
+	if async, _ := strconv.ParseBool(c.Query("async")); async {
+		userID := c.GetUint("user_id")
+		if userID == 0 {
+			httputil.Fail(c, httputil.CodeUnauthenticated, "missing bearer token")
+			return
+		}
+		var req AnalysisRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			httputil.BindError(c, err)
+			return
+		}
+		a.enqueue(c, userID, models.JobAnalysis, req)
+		return
+	}
+	a.create(c, c.GetUint("user_id"))
+}
+
+// InternalCreate handles POST /internal/v1/analyses?userId=, the call the
+// chat service makes on behalf of a user.
+func (a *Analysis) InternalCreate(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Query("userId"), 10, 64)
+	if err != nil || userID == 0 {
+		httputil.Fail(c, httputil.CodeInvalidRequest, "invalid userId")
+		return
+	}
+	a.create(c, uint(userID))
+}
+
+// create analyses the request body and stores the result for userID, unless
+// the caller is anonymous.
+func (a *Analysis) create(c *gin.Context, userID uint) {
 	start := time.Now()
-	logging.Log.Info("analysis request started")
+	logging.FromContext(c).Info("analysis request started")
+	defer func() {
+		logging.FromContext(c).WithField("latency", time.Since(start)).Info("analysis request finished")
+	}()
 
 	var req AnalysisRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		logging.Log.WithError(err).Warn("invalid analysis payload")
-		httputil.JSONError(c, http.StatusBadRequest, "invalid request")
+		logging.FromContext(c).WithError(err).Warn("invalid analysis payload")
+		httputil.BindError(c, err)
+		return
+	}
+	analysis, err := a.analyze(c.Request.Context(), userID, req)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to fetch report")
+		httputil.Fail(c, httputil.CodeUpstream, "report service error")
+		return
+	}
+	if userID == 0 {
+		c.JSON(http.StatusOK, localized(analysis, i18n.RequestLocale(c.Request)))
 		return
 	}
+	if err := a.analyses.Create(c.Request.Context(), analysis); err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to store analysis")
+		httputil.Fail(c, httputil.CodeInternal, "failed to store analysis")
+		return
+	}
+	c.JSON(http.StatusOK, localized(analysis, i18n.RequestLocale(c.Request)))
+}
 
-	reportURL := os.Getenv("REPORT_SERVICE_URL")
-	if reportURL == "" {
-		reportURL = "http://localhost:8082"
+// RunAnalysis analyses req and stores the result for userID. It implements
+// AnalysisRunner so the chat module can use it in-process.
+func (a *Analysis) RunAnalysis(ctx context.Context, userID uint, req AnalysisRequest) (*models.Analysis, error) {
+	analysis, err := a.analyze(ctx, userID, req)
+	if err != nil {
+		return nil, err
 	}
-	endpoint := reportURL + "/internal/v1/reports"
+	if err := a.analyses.Create(ctx, analysis); err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
 
+// analyze fetches the reports of both people and scores them, failing
+// with the report service's error.
+func (a *Analysis) analyze(ctx context.Context, userID uint, req AnalysisRequest) (*models.Analysis, error) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 	reports := make([][]byte, 2)
@@ -46,58 +247,139 @@ func CreateAnalysis(c *gin.Context) {
 
 	fetch := func(idx int, bd BirthDetails) {
 		defer wg.Done()
-		body, err := json.Marshal(bd)
-		if err != nil {
-			errs[idx] = err
-			return
-		}
-		resp, err := http.Post(endpoint, "application/json", bytes.NewReader(body))
-		if err != nil {
-			errs[idx] = err
-			return
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			b, _ := io.ReadAll(resp.Body)
-			errs[idx] = fmt.Errorf("report service status %d: %s", resp.StatusCode, string(b))
-			return
-		}
-		data, err := io.ReadAll(resp.Body)
-		if err != nil {
-			errs[idx] = err
-			return
-		}
-		reports[idx] = data
+		reports[idx], errs[idx] = a.reports.FetchReport(ctx, bd)
 	}
 
 	go fetch(0, req.PersonA)
 	go fetch(1, req.PersonB)
 	wg.Wait()
 
-	for _, err := range errs {
-		if err != nil {
-			logging.Log.WithError(err).Error("failed to fetch report")
-			httputil.JSONError(c, http.StatusBadGateway, "report service error")
-			logging.Log.WithField("latency", time.Since(start)).Info("analysis request finished")
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return newAnalysis(userID, req.PersonA, req.PersonB, reports[0], reports[1]), nil
+}
+
+// newAnalysis scores the reports of a and b for userID.
+func newAnalysis(userID uint, a, b BirthDetails, repA, repB []byte) *models.Analysis {
+	result := calculateCompatibility(repA, repB)
+	keys := [2]string{reportKey(a), reportKey(b)}
+	inputHash := sha256.Sum256([]byte(keys[0] + ":" + keys[1]))
+	return &models.Analysis{
+		ID:               newID(),
+		UserID:           userID,
+		InputHash:        hex.EncodeToString(inputHash[:]),
+		ReportKeys:       keys,
+		Score:            result.Score,
+		Breakdown:        result.Breakdown,
+		AlgorithmVersion: result.AlgorithmVersion,
+		CreatedAt:        time.Now().UTC(),
+	}
+}
+
+// Get handles GET /api/v1/analysis/:id. Analyses of other users are
+// reported as not found. The kootas of the analyses this and Create and
+// List return are labelled and explained in the language of the request.
+func (a *Analysis) Get(c *gin.Context) {
+	analysis, ok := a.owned(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, localized(analysis, i18n.RequestLocale(c.Request)))
+}
+
+// List handles GET /api/v1/analysis?mine=true&offset=&limit=. Only the
+// caller's own analyses can be listed.
+func (a *Analysis) List(c *gin.Context) {
+	if mine := c.Query("mine"); mine != "" {
+		if own, err := strconv.ParseBool(mine); err == nil && !own {
+			httputil.Fail(c, httputil.CodeForbidden, "only your own analyses can be listed")
 			return
 		}
 	}
+	offset, limit := pageParams(c)
+	items, total, err := a.analyses.ListByUser(c.Request.Context(), c.GetUint("user_id"), offset, limit)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to list analyses")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	locale := i18n.RequestLocale(c.Request)
+	for i := range items {
+		items[i] = *localized(&items[i], locale)
+	}
+	c.JSON(http.StatusOK, AnalysisPage{Items: items, Total: total, Offset: offset, Limit: limit})
+}
+
+// Delete handles DELETE /api/v1/analysis/:id.
+func (a *Analysis) Delete(c *gin.Context) {
+	analysis, ok := a.owned(c)
+	if !ok {
+		return
+	}
+	if err := a.analyses.Delete(c.Request.Context(), analysis.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+		logging.FromContext(c).WithError(err).Error("failed to delete analysis")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
 
-	result := calculateCompatibility(reports[0], reports[1])
-	c.JSON(http.StatusOK, result)
+// InternalGet handles GET /internal/v1/analyses/:id?userId=, the call the
+// chat service makes on behalf of a user.
+func (a *Analysis) InternalGet(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Query("userId"), 10, 64)
+	if err != nil {
+		httputil.Fail(c, httputil.CodeInvalidRequest, "invalid userId")
+		return
+	}
+	analysis, err := a.LoadAnalysis(c.Request.Context(), uint(userID), c.Param("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		httputil.Fail(c, httputil.CodeNotFound, "analysis not found")
+		return
+	}
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to fetch analysis")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	c.JSON(http.StatusOK, analysis)
+}
 
-	logging.Log.WithField("latency", time.Since(start)).Info("analysis request finished")
+// LoadAnalysis returns the analysis with id when it belongs to userID, or
+// store.ErrNotFound. It implements AnalysisLoader so the chat module can use
+// it in-process.
+func (a *Analysis) LoadAnalysis(ctx context.Context, userID uint, id string) (*models.Analysis, error) {
+	analysis, err := a.analyses.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if analysis.UserID == 0 || analysis.UserID != userID {
+		return nil, store.ErrNotFound
+	}
+	return analysis, nil
 }
 
-// calculateCompatibility computes a simple compatibility score from two reports.
-func calculateCompatibility(repA, repB []byte) map[string]interface{} {
-	diff := len(repA) - len(repB)
-	if diff < 0 {
-		diff = -diff
+// owned loads the analysis named by the id path parameter when it belongs
+// to the caller, writing an error response otherwise.
+func (a *Analysis) owned(c *gin.Context) (*models.Analysis, bool) {
+	analysis, err := a.LoadAnalysis(c.Request.Context(), c.GetUint("user_id"), c.Param("id"))
+	if errors.Is(err, store.ErrNotFound) {
+		httputil.Fail(c, httputil.CodeNotFound, "analysis not found")
+		return nil, false
 	}
-	score := 100 - diff%100
-	if score < 0 {
-		score = 0
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to fetch analysis")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return nil, false
 	}
-	return map[string]interface{}{"score": score}
+	return analysis, true
+}
+
+// newID returns a random identifier for analyses and chat messages.
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
@@ -2,52 +2,231 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
-	"matchmaker/internal/logging"
+	"github.com/golang-jwt/jwt/v4"
+
+	"matchmaker/internal/clients"
+	"matchmaker/internal/i18n"
+	"matchmaker/internal/models"
+	"matchmaker/internal/store"
 )
 
+const analysisBody = `{"personA":{"dob":"2000","tob":"12:00:00","lat":1,"lon":2},"personB":{"dob":"2001","tob":"12:00:00","lat":1,"lon":2}}`
+
 func TestCreateAnalysis(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	logging.Init()
+	t.Parallel()
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`{"report":true}`))
 	}))
 	defer srv.Close()
-	os.Setenv("REPORT_SERVICE_URL", srv.URL)
+	a := NewAnalysis(clients.NewReportClient(srv.URL, clients.Options{}), store.NewMemoryAnalysisStore(), AnalysisOptions{})
 
-	body := `{"personA":{"dob":"2000","tob":"12:00:00","lat":1,"lon":2},"personB":{"dob":"2001","tob":"12:00:00","lat":1,"lon":2}}`
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(analysisBody))
 	c.Request.Header.Set("Content-Type", "application/json")
-	CreateAnalysis(c)
+	a.Create(c)
 	if w.Code != http.StatusOK {
 		t.Fatalf("expected 200 got %d", w.Code)
 	}
-	var resp map[string]int
+	var resp models.Analysis
 	json.Unmarshal(w.Body.Bytes(), &resp)
-	if resp["score"] == 0 {
-		t.Fatalf("missing score")
+	if resp.Score == 0 || resp.ID == "" || resp.AlgorithmVersion != LegacyAlgorithm {
+		t.Fatalf("unexpected analysis %s", w.Body.String())
 	}
 
 	// failure when report service returns error
-	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(500)
-	}))
-	defer bad.Close()
-	os.Setenv("REPORT_SERVICE_URL", bad.URL)
+	a = NewAnalysis(&clients.FakeReports{Err: &clients.APIError{Service: "report", StatusCode: 500, Message: "engine error"}}, store.NewMemoryAnalysisStore(), AnalysisOptions{})
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
-	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(analysisBody))
 	c.Request.Header.Set("Content-Type", "application/json")
-	CreateAnalysis(c)
+	a.Create(c)
 	if w.Code != http.StatusBadGateway {
 		t.Fatalf("expected 502 got %d", w.Code)
 	}
 }
+
+func TestAnalysisAccess(t *testing.T) {
+	t.Parallel()
+	analyses := store.NewMemoryAnalysisStore()
+	a := NewAnalysis(&clients.FakeReports{Default: []byte(`{"moon":{"nakshatra":1,"rashi":1}}`)}, analyses, AnalysisOptions{})
+	r := gin.New()
+	r.POST("/analysis", OptionalUserID(), a.Create)
+	authed := r.Group("", RequireUserID())
+	authed.GET("/analysis", a.List)
+	authed.GET("/analysis/:id", a.Get)
+	authed.DELETE("/analysis/:id", a.Delete)
+	r.GET("/internal/v1/analyses/:id", a.InternalGet)
+	r.POST("/internal/v1/analyses", a.InternalCreate)
+
+	request := func(method, path string, userID uint, body string) *http.Request {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if userID != 0 {
+			tok, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": userID}).SignedString([]byte("k"))
+			req.Header.Set("Authorization", "Bearer "+tok)
+		}
+		return req
+	}
+	do := func(method, path string, userID uint, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request(method, path, userID, body))
+		return w
+	}
+
+	w := do("POST", "/analysis", 1, analysisBody)
+	var created models.Analysis
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != http.StatusOK || created.ID == "" || len(created.Breakdown) != 8 || created.AlgorithmVersion != AshtakootaAlgorithm {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	if created.ReportKeys[0] == "" || created.InputHash == "" {
+		t.Fatalf("inputs not recorded: %+v", created)
+	}
+	if k := created.Breakdown[0]; k.Label != "Varna" || k.Explanation != "Varna compares the spiritual development of the partners. This factor is fully favourable." {
+		t.Fatalf("koota not explained: %+v", k)
+	}
+
+	// Kootas are labelled and explained in the language of the request.
+	req := request("GET", "/analysis?mine=true", 1, "")
+	req.Header.Set("Accept-Language", "hi-IN,en;q=0.8")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var hindi AnalysisPage
+	json.Unmarshal(w.Body.Bytes(), &hindi)
+	if len(hindi.Items) != 1 || len(hindi.Items[0].Breakdown) != 8 {
+		t.Fatalf("list in hindi: %s", w.Body.String())
+	}
+	if k := hindi.Items[0].Breakdown[7]; k.Name != KootaNadi || k.Label != "नाड़ी" || !strings.HasSuffix(k.Explanation, "यह कारक प्रतिकूल है।") {
+		t.Fatalf("nadi in hindi: %+v", k)
+	}
+	anon := do("POST", "/analysis", 0, analysisBody)
+	var anonymous models.Analysis
+	json.Unmarshal(anon.Body.Bytes(), &anonymous)
+	if anon.Code != http.StatusOK || anonymous.ID == "" {
+		t.Fatalf("anonymous create: %d %s", anon.Code, anon.Body.String())
+	}
+	// Nobody could fetch an anonymous analysis, so it is not kept.
+	if _, err := analyses.Get(context.Background(), anonymous.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("anonymous analysis stored: %v", err)
+	}
+
+	if w := do("GET", "/analysis/"+created.ID, 1, ""); w.Code != http.StatusOK {
+		t.Fatalf("owner get: %d", w.Code)
+	}
+	for _, id := range []string{created.ID, anonymous.ID, "missing"} {
+		if w := do("GET", "/analysis/"+id, 2, ""); w.Code != http.StatusNotFound {
+			t.Fatalf("get %s as other user: %d", id, w.Code)
+		}
+	}
+	if w := do("DELETE", "/analysis/"+created.ID, 2, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("delete as other user: %d", w.Code)
+	}
+
+	for uid, want := range map[uint]int64{1: 1, 2: 0} {
+		w := do("GET", "/analysis?mine=true", uid, "")
+		var page AnalysisPage
+		json.Unmarshal(w.Body.Bytes(), &page)
+		if w.Code != http.StatusOK || page.Total != want || len(page.Items) != int(want) || page.Limit != defaultPageSize {
+			t.Fatalf("list for %d: %d %s", uid, w.Code, w.Body.String())
+		}
+	}
+	if w := do("GET", "/analysis?mine=false", 1, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 listing others, got %d", w.Code)
+	}
+
+	for query, want := range map[string]int{"?userId=1": http.StatusOK, "?userId=2": http.StatusNotFound, "": http.StatusBadRequest} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/internal/v1/analyses/"+created.ID+query, nil))
+		if w.Code != want {
+			t.Fatalf("internal get %q: expected %d got %d", query, want, w.Code)
+		}
+	}
+
+	// The chat service runs analyses for users.
+	w = do("POST", "/internal/v1/analyses?userId=2", 0, analysisBody)
+	var run models.Analysis
+	json.Unmarshal(w.Body.Bytes(), &run)
+	if w.Code != http.StatusOK || run.ID == "" || run.Score != created.Score {
+		t.Fatalf("internal create: %d %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/analysis/"+run.ID, 2, ""); w.Code != http.StatusOK {
+		t.Fatalf("analysis run for user 2 not theirs: %d", w.Code)
+	}
+	for _, query := range []string{"", "?userId=0", "?userId=x"} {
+		if w := do("POST", "/internal/v1/analyses"+query, 0, analysisBody); w.Code != http.StatusBadRequest {
+			t.Fatalf("internal create %q: %d", query, w.Code)
+		}
+	}
+
+	if w := do("DELETE", "/analysis/"+created.ID, 1, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("owner delete: %d", w.Code)
+	}
+	if w := do("GET", "/analysis/"+created.ID, 1, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("deleted analysis still served: %d", w.Code)
+	}
+}
+
+func TestKootaTranslations(t *testing.T) {
+	t.Parallel()
+	for _, l := range i18n.Supported() {
+		if l == i18n.Default {
+			continue
+		}
+		for name, text := range kootaText {
+			for _, msg := range []string{text.label, text.about, verdictFull, verdictPartial, verdictNone} {
+				if i18n.T(l, msg) == msg {
+					t.Errorf("%s: %s: %q not translated", l, name, msg)
+				}
+			}
+		}
+	}
+}
+
+func TestCalculateCompatibility(t *testing.T) {
+	t.Parallel()
+	moon := func(nakshatra, rashi int) []byte {
+		return []byte(fmt.Sprintf(`{"moon":{"nakshatra":%d,"rashi":%d}}`, nakshatra, rashi))
+	}
+	points := func(c compatibility) map[string]float64 {
+		out := map[string]float64{}
+		for _, k := range c.Breakdown {
+			out[k.Name] = k.Points
+		}
+		return out
+	}
+
+	// Same nakshatra: everything matches except nadi.
+	same := calculateCompatibility(moon(1, 1), moon(1, 1))
+	if same.Score != 78 || points(same)[KootaNadi] != 0 || points(same)[KootaGana] != 6 {
+		t.Fatalf("same nakshatra: %+v", same)
+	}
+
+	// Ashwini and Bharani differ in nadi, gana and yoni.
+	c := calculateCompatibility(moon(1, 1), moon(2, 1))
+	p := points(c)
+	if c.Score != 92 || p[KootaNadi] != 8 || p[KootaGana] != 5 || p[KootaYoni] != 2 || p[KootaTara] != 3 {
+		t.Fatalf("ashwini/bharani: %+v", c)
+	}
+
+	// Aries and Taurus moons fall 2/12 apart and their lords are not friends.
+	c = calculateCompatibility(moon(1, 1), moon(4, 2))
+	p = points(c)
+	if p[KootaBhakoot] != 0 || p[KootaGrahaMaitri] != 3 {
+		t.Fatalf("aries/taurus: %+v", c)
+	}
+
+	if c := calculateCompatibility([]byte(`{"moon":{"nakshatra":30,"rashi":1}}`), moon(1, 1)); c.AlgorithmVersion != LegacyAlgorithm {
+		t.Fatalf("invalid moon should use the legacy algorithm: %+v", c)
+	}
+}
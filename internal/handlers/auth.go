@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/i18n"
+	"matchmaker/internal/logging"
+)
+
+// Auth serves the Google OAuth login flow and issues internal JWTs.
+type Auth struct {
+	oauth *oauth2.Config
+	key   *rsa.PrivateKey
+	users UserRegistrar
+	// grants holds the roles beyond RoleUser of users, by lower-cased email.
+	grants map[string][]string
+
+	// userInfoURL is the Google userinfo endpoint; tests point it at a fake.
+	userInfoURL string
+}
+
+const googleUserInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
+
+// NewAuth constructs an Auth from Google OAuth credentials and a PEM-encoded
+// RSA key. An unparseable key is logged and leaves token signing disabled.
+// roles lists, by role, the emails of the users granted it besides RoleUser.
+func NewAuth(clientID, clientSecret, redirectURL, pemKey string, users UserRegistrar, roles map[string][]string) *Auth {
+	a := &Auth{
+		oauth: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes: []string{
+				"https://www.googleapis.com/auth/userinfo.email",
+				"https://www.googleapis.com/auth/userinfo.profile",
+			},
+			Endpoint: google.Endpoint,
+		},
+		users:       users,
+		grants:      map[string][]string{},
+		userInfoURL: googleUserInfoURL,
+	}
+	for role, emails := range roles {
+		for _, email := range emails {
+			email = strings.ToLower(strings.TrimSpace(email))
+			a.grants[email] = append(a.grants[email], role)
+		}
+	}
+	if pemKey != "" {
+		block, _ := pem.Decode([]byte(pemKey))
+		if block != nil {
+			if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+				a.key = key
+			} else {
+				logging.Log.WithError(err).Error("failed to parse RSA private key")
+			}
+		}
+	}
+	return a
+}
+
+// GoogleLogin handles GET /api/v1/auth/google/login.
+func (a *Auth) GoogleLogin(c *gin.Context) {
+	if a.oauth == nil {
+		logging.FromContext(c).Error("oauth config not initialized")
+		httputil.Fail(c, httputil.CodeInternal, "internal error")
+		return
+	}
+	url := a.oauth.AuthCodeURL("state", oauth2.AccessTypeOffline)
+	logging.FromContext(c).WithField("url", url).Info("redirecting to google oauth")
+	c.Redirect(http.StatusFound, url)
+}
+
+// GoogleCallback handles GET /api/v1/auth/google/callback.
+func (a *Auth) GoogleCallback(c *gin.Context) {
+	code := c.Query("code")
+	if code == "" {
+		logging.FromContext(c).Warn("missing code in callback")
+		httputil.WriteError(c, &httputil.Error{
+			Status:  http.StatusBadRequest,
+			Code:    httputil.CodeValidationFailed,
+			Message: "missing code",
+			Details: []httputil.FieldError{{Field: "code", Code: "required", Message: "is required"}},
+		})
+		return
+	}
+
+	ctx := context.Background()
+	tok, err := a.oauth.Exchange(ctx, code)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("token exchange failed")
+		httputil.Fail(c, httputil.CodeInvalidRequest, "token exchange failed")
+		return
+	}
+
+	userInfoURL := a.userInfoURL
+	if userInfoURL == "" {
+		userInfoURL = googleUserInfoURL
+	}
+	resp, err := a.oauth.Client(ctx, tok).Get(userInfoURL)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to fetch user info")
+		httputil.Fail(c, httputil.CodeUpstream, "failed to fetch user info")
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logging.FromContext(c).WithField("status", resp.StatusCode).Error("google userinfo returned non-200")
+		httputil.Fail(c, httputil.CodeUpstream, "google userinfo failed")
+		return
+	}
+
+	var gUser struct {
+		Email string `json:"email"`
+		Name  string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&gUser); err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to decode user info")
+		httputil.Fail(c, httputil.CodeUpstream, "invalid user info")
+		return
+	}
+
+	userID, err := a.users.RegisterUser(c.Request.Context(), gUser.Email, gUser.Name)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("user service request failed")
+		httputil.Fail(c, httputil.CodeUpstream, "user service error")
+		return
+	}
+
+	if a.key == nil {
+		logging.FromContext(c).Error("jwt private key not configured")
+		httputil.Fail(c, httputil.CodeInternal, "internal error")
+		return
+	}
+
+	roles := append([]string{RoleUser}, a.grants[strings.ToLower(gUser.Email)]...)
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"email":   gUser.Email,
+		"roles":   roles,
+		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		"iat":     time.Now().Unix(),
+	}
+	// The preferred locale rides in the token so that every service can
+	// answer in it; a user who cannot be read signs in without one.
+	if user, err := a.users.LoadUser(c.Request.Context(), userID); err != nil {
+		logging.FromContext(c).WithError(err).Warn("failed to load user preferences")
+	} else if locale, ok := i18n.Match(user.Locale); ok {
+		claims["locale"] = locale
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	signed, err := token.SignedString(a.key)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to sign jwt")
+		httputil.Fail(c, httputil.CodeInternal, "internal error")
+		return
+	}
+
+	logging.FromContext(c).WithField("user_id", userID).Info("authentication successful")
+	c.JSON(http.StatusOK, gin.H{"token": signed})
+}
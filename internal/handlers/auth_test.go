@@ -1,4 +1,4 @@
-package main
+package handlers
 
 import (
 	"bytes"
@@ -12,25 +12,20 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/oauth2"
-	"matchmaker/internal/logging"
-)
-
-type roundTripFunc func(*http.Request) (*http.Response, error)
 
-func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
-	return f(r)
-}
+	"matchmaker/internal/clients"
+	"matchmaker/internal/i18n"
+)
 
 func TestGoogleLogin(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	logging.Init()
+	t.Parallel()
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest("GET", "/login", nil)
 
-	// when oauthConfig is nil
-	oauthConfig = nil
-	googleLoginHandler(c)
+	// when oauth config is nil
+	a := &Auth{}
+	a.GoogleLogin(c)
 	if w.Code != http.StatusInternalServerError {
 		t.Fatalf("expected 500, got %d", w.Code)
 	}
@@ -38,11 +33,11 @@ func TestGoogleLogin(t *testing.T) {
 	// success case
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	defer srv.Close()
-	oauthConfig = &oauth2.Config{ClientID: "id", ClientSecret: "sec", Endpoint: oauth2.Endpoint{AuthURL: srv.URL + "/auth"}, RedirectURL: "http://example.com"}
+	a.oauth = &oauth2.Config{ClientID: "id", ClientSecret: "sec", Endpoint: oauth2.Endpoint{AuthURL: srv.URL + "/auth"}, RedirectURL: "http://example.com"}
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest("GET", "/login", nil)
-	googleLoginHandler(c)
+	a.GoogleLogin(c)
 	if w.Code != http.StatusFound {
 		t.Fatalf("expected 302, got %d", w.Code)
 	}
@@ -53,14 +48,13 @@ func TestGoogleLogin(t *testing.T) {
 }
 
 func TestGoogleCallback(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	logging.Init()
+	t.Parallel()
 
 	// missing code
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest("GET", "/callback", nil)
-	googleCallbackHandler(c)
+	(&Auth{}).GoogleCallback(c)
 	if w.Code != http.StatusBadRequest {
 		t.Fatalf("expected 400, got %d", w.Code)
 	}
@@ -71,47 +65,50 @@ func TestGoogleCallback(t *testing.T) {
 		case "/token":
 			w.Header().Set("Content-Type", "application/json")
 			w.Write([]byte(`{"access_token":"tok","token_type":"Bearer"}`))
+		case "/userinfo":
+			if r.Header.Get("Authorization") != "Bearer tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"email":"a@b.com","name":"Alice"}`))
 		default:
 			http.NotFound(w, r)
 		}
 	}))
 	defer oauthSrv.Close()
 
-	oldTransport := http.DefaultTransport
-	http.DefaultTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
-		if strings.Contains(req.URL.Host, "googleapis.com") {
-			rec := httptest.NewRecorder()
-			rec.Header().Set("Content-Type", "application/json")
-			rec.WriteString(`{"email":"a@b.com","name":"Alice"}`)
-			return rec.Result(), nil
-		}
-		return oldTransport.RoundTrip(req)
-	})
-	defer func() { http.DefaultTransport = oldTransport }()
-
 	userSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"ID":1,"Email":"a@b.com","Locale":"te"}`))
+			return
+		}
 		w.Write([]byte(`{"id":1}`))
 	}))
 	defer userSrv.Close()
 
-	oauthConfig = &oauth2.Config{
-		ClientID:     "id",
-		ClientSecret: "sec",
-		RedirectURL:  "http://example.com",
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  oauthSrv.URL + "/auth",
-			TokenURL: oauthSrv.URL + "/token",
+	key, _ := rsa.GenerateKey(rand.Reader, 512)
+	a := &Auth{
+		oauth: &oauth2.Config{
+			ClientID:     "id",
+			ClientSecret: "sec",
+			RedirectURL:  "http://example.com",
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  oauthSrv.URL + "/auth",
+				TokenURL: oauthSrv.URL + "/token",
+			},
 		},
+		key:         key,
+		users:       clients.NewUserClient(userSrv.URL, clients.Options{}),
+		grants:      map[string][]string{"a@b.com": {RoleModerator}},
+		userInfoURL: oauthSrv.URL + "/userinfo",
 	}
-	userServiceURL = userSrv.URL
-	key, _ := rsa.GenerateKey(rand.Reader, 512)
-	jwtPrivateKey = key
 
 	w = httptest.NewRecorder()
 	c, _ = gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest("GET", "/callback?code=abc", nil)
-	googleCallbackHandler(c)
+	a.GoogleCallback(c)
 	if w.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d", w.Code)
 	}
@@ -119,4 +116,28 @@ func TestGoogleCallback(t *testing.T) {
 	if err := json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&resp); err != nil || resp.Token == "" {
 		t.Fatalf("expected token, err=%v", err)
 	}
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Request.Header.Set("Authorization", "Bearer "+resp.Token)
+	if id, roles, err := bearerClaims(c); err != nil || id != 1 || len(roles) != 2 || roles[1] != RoleModerator {
+		t.Fatalf("unexpected claims %d %v %v", id, roles, err)
+	}
+
+	// The token carries the user's preferred locale, which wins over the
+	// browser's.
+	var locale string
+	r := gin.New()
+	r.GET("/", Locale(), func(c *gin.Context) { locale = i18n.RequestLocale(c.Request) })
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.Token)
+	req.Header.Set("Accept-Language", "hi")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if locale != "te" {
+		t.Fatalf("expected the profile's locale, got %q", locale)
+	}
+	req.Header.Del("Authorization")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if locale != "hi" {
+		t.Fatalf("expected the browser's locale, got %q", locale)
+	}
 }
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/i18n"
+	"matchmaker/internal/logging"
+	"matchmaker/internal/models"
+)
+
+// BatchCandidate is one person ranked against the subject of a batch.
+type BatchCandidate struct {
+	// Name is the caller's label for the candidate, echoed in the result.
+	Name   string       `json:"name,omitempty" binding:"max=100"`
+	Person BirthDetails `json:"person" binding:"required"`
+}
+
+// BatchRequest is the payload of a batch analysis: one subject and the
+// candidates to rank against them.
+type BatchRequest struct {
+	Subject    BirthDetails     `json:"subject" binding:"required"`
+	Candidates []BatchCandidate `json:"candidates" binding:"required,min=1,dive"`
+}
+
+// BatchMatch is the analysis of one candidate of a batch, or the reason it
+// could not be analysed. Index is the candidate's position in the request
+// and Rank its position by score, starting at 1; failed candidates have no
+// rank.
+type BatchMatch struct {
+	Rank     int              `json:"rank,omitempty"`
+	Index    int              `json:"index"`
+	Name     string           `json:"name,omitempty"`
+	Analysis *models.Analysis `json:"analysis,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// BatchResult ranks the candidates of a batch by score, best first, with
+// the candidates that failed last.
+type BatchResult struct {
+	Matches   []BatchMatch `json:"matches"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+}
+
+// localized returns a copy of r with its analyses and errors in locale.
+func (r *BatchResult) localized(locale string) *BatchResult {
+	out := *r
+	out.Matches = make([]BatchMatch, len(r.Matches))
+	for i, m := range r.Matches {
+		if m.Analysis != nil {
+			m.Analysis = localized(m.Analysis, locale)
+		}
+		if m.Error != "" {
+			m.Error = i18n.T(locale, m.Error)
+		}
+		out.Matches[i] = m
+	}
+	return &out
+}
+
+// Batch handles POST /api/v1/analysis/batch[?async=true]. The analyses of
+// the candidates are stored for the caller like those Create makes. Batches
+// of more than BatchSyncLimit candidates, or any batch when async is set,
+// are answered with 202 and a job to poll at /api/v1/analysis/jobs/{id};
+// smaller ones are answered with the ranking itself.
+func (a *Analysis) Batch(c *gin.Context) {
+	var req BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httputil.BindError(c, err)
+		return
+	}
+	if len(req.Candidates) > a.opts.BatchMaxCandidates {
+		e := httputil.New(httputil.CodeValidationFailed, "invalid request")
+		e.Details = []httputil.FieldError{{Field: "candidates", Code: "invalid", Message: "has too many items"}}
+		httputil.WriteError(c, e)
+		return
+	}
+	async, _ := strconv.ParseBool(c.Query("async"))
+	userID := c.GetUint("user_id")
+	if async || len(req.Candidates) > a.opts.BatchSyncLimit {
+		a.enqueue(c, userID, models.JobBatch, req)
+		return
+	}
+	result, err := a.batch(c.Request.Context(), userID, req)
+	if err != nil {
+		logging.FromContext(c).WithError(err).WithField("candidates", len(req.Candidates)).Error("batch analysis failed")
+		httputil.WriteError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result.localized(i18n.RequestLocale(c.Request)))
+}
+
+// batch fetches the reports of req, at most BatchConcurrency at a time and
+// each distinct person once, and ranks the candidates against the subject,
+// storing their analyses for userID. Candidates whose report cannot be
+// fetched are reported as failed; the batch itself fails only when the
+// subject's report, or every candidate's, cannot be.
+func (a *Analysis) batch(ctx context.Context, userID uint, req BatchRequest) (*BatchResult, *httputil.Error) {
+	subject, err := a.reports.FetchReport(ctx, req.Subject)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("failed to fetch subject report")
+		return nil, httputil.New(httputil.CodeUpstream, "report service error")
+	}
+
+	// Candidates sharing birth details share a fetch.
+	people := map[string]int{}
+	var order []BirthDetails
+	slots := make([]int, len(req.Candidates))
+	for i, cand := range req.Candidates {
+		key := reportKey(cand.Person)
+		slot, ok := people[key]
+		if !ok {
+			slot = len(order)
+			people[key] = slot
+			order = append(order, cand.Person)
+		}
+		slots[i] = slot
+	}
+	reports := make([][]byte, len(order))
+	errs := make([]error, len(order))
+	sem := make(chan struct{}, a.opts.BatchConcurrency)
+	var wg sync.WaitGroup
+	for i, bd := range order {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			reports[i], errs[i] = a.reports.FetchReport(ctx, bd)
+		}()
+	}
+	wg.Wait()
+
+	result := &BatchResult{Matches: make([]BatchMatch, len(req.Candidates))}
+	for i, cand := range req.Candidates {
+		m := BatchMatch{Index: i, Name: cand.Name}
+		if err := errs[slots[i]]; err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("index", i).Warn("failed to fetch candidate report")
+			m.Error = "report service error"
+		} else {
+			analysis := newAnalysis(userID, req.Subject, cand.Person, subject, reports[slots[i]])
+			if err := a.analyses.Create(ctx, analysis); err != nil {
+				logging.FromContext(ctx).WithError(err).WithField("index", i).Error("failed to store analysis")
+				m.Error = "failed to store analysis"
+			} else {
+				m.Analysis = analysis
+			}
+		}
+		if m.Error != "" {
+			result.Failed++
+		} else {
+			result.Succeeded++
+		}
+		result.Matches[i] = m
+	}
+	if result.Succeeded == 0 {
+		return nil, httputil.New(httputil.CodeUpstream, "report service error")
+	}
+
+	sort.SliceStable(result.Matches, func(i, j int) bool {
+		mi, mj := result.Matches[i], result.Matches[j]
+		if (mi.Analysis == nil) != (mj.Analysis == nil) {
+			return mi.Analysis != nil
+		}
+		return mi.Analysis != nil && mi.Analysis.Score > mj.Analysis.Score
+	})
+	for i := range result.Matches[:result.Succeeded] {
+		result.Matches[i].Rank = i + 1
+	}
+	return result, nil
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+
+	"matchmaker/internal/models"
+	"matchmaker/internal/store"
+)
+
+// batchReports serves moon positions by date of birth, failing for dates
+// it does not know, and records how many fetches ran at once.
+type batchReports struct {
+	moons map[string][2]int
+	delay time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	calls    int
+}
+
+func (f *batchReports) FetchReport(ctx context.Context, bd BirthDetails) ([]byte, error) {
+	f.mu.Lock()
+	f.calls++
+	f.inFlight++
+	f.peak = max(f.peak, f.inFlight)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+	time.Sleep(f.delay)
+	m, ok := f.moons[bd.DOB]
+	if !ok {
+		return nil, errors.New("engine error")
+	}
+	return []byte(fmt.Sprintf(`{"moon":{"nakshatra":%d,"rashi":%d}}`, m[0], m[1])), nil
+}
+
+func batchBody(subject string, candidates ...string) string {
+	var cands []string
+	for _, dob := range candidates {
+		cands = append(cands, fmt.Sprintf(`{"name":"c%s","person":{"dob":%q,"tob":"12:00:00"}}`, dob, dob))
+	}
+	return fmt.Sprintf(`{"subject":{"dob":%q,"tob":"12:00:00"},"candidates":[%s]}`, subject, strings.Join(cands, ","))
+}
+
+// batchRouter mounts the analysis routes that run jobs as the match service
+// does.
+func batchRouter(a *Analysis) *gin.Engine {
+	r := gin.New()
+	api := r.Group("/api/v1")
+	api.POST("/analysis", OptionalUserID(), a.Create)
+	authed := api.Group("", RequireUserID())
+	authed.POST("/analysis/batch", a.Batch)
+	authed.GET("/analysis/jobs/:id", a.Job)
+	authed.GET("/analysis/jobs/:id/events", a.JobEvents)
+	authed.PUT("/analysis/webhook", a.PutWebhook)
+	authed.GET("/analysis/webhook", a.GetWebhook)
+	authed.DELETE("/analysis/webhook", a.DeleteWebhook)
+	return r
+}
+
+// batchRequest sends a request to r as userID, or anonymously when it is 0.
+func batchRequest(r http.Handler, method, path string, userID uint, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		tok, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": userID}).SignedString([]byte("k"))
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBatchRanking(t *testing.T) {
+	t.Parallel()
+	reports := &batchReports{
+		moons: map[string][2]int{"s": {1, 1}, "a": {1, 1}, "b": {14, 7}, "c": {5, 2}},
+		delay: 10 * time.Millisecond,
+	}
+	analyses := store.NewMemoryAnalysisStore()
+	a := NewAnalysis(reports, analyses, AnalysisOptions{BatchConcurrency: 2})
+	r := batchRouter(a)
+
+	// "x" has no report; the second "c" shares the first one's fetch.
+	dobs := []string{"a", "x", "b", "c", "c"}
+	w := batchRequest(r, "POST", "/api/v1/analysis/batch", 1, batchBody("s", dobs...))
+	var result BatchResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Succeeded != 4 || result.Failed != 1 || len(result.Matches) != 5 {
+		t.Fatalf("batch: %d %s", w.Code, w.Body.String())
+	}
+	for i, m := range result.Matches[:4] {
+		if m.Rank != i+1 || m.Analysis == nil || m.Name != "c"+dobs[m.Index] {
+			t.Fatalf("match %d: %+v", i, m)
+		}
+		if i > 0 && m.Analysis.Score > result.Matches[i-1].Analysis.Score {
+			t.Fatalf("not ranked by score: %s", w.Body.String())
+		}
+		if m.Analysis.Breakdown[0].Label == "" {
+			t.Fatalf("analysis not localized: %+v", m.Analysis)
+		}
+	}
+	if last := result.Matches[4]; last.Index != 1 || last.Rank != 0 || last.Analysis != nil || last.Error != "report service error" {
+		t.Fatalf("failed candidate: %+v", last)
+	}
+	if reports.calls != 5 || reports.peak > 2 {
+		t.Fatalf("%d fetches, %d at once", reports.calls, reports.peak)
+	}
+	if _, total, _ := analyses.ListByUser(context.Background(), 1, 0, 10); total != 4 {
+		t.Fatalf("%d analyses stored", total)
+	}
+
+	tooMany := make([]string, DefaultBatchMaxCandidates+1)
+	for i := range tooMany {
+		tooMany[i] = "a"
+	}
+	for name, tc := range map[string]struct {
+		body string
+		want int
+	}{
+		"subject fails":     {batchBody("x", "a"), http.StatusBadGateway},
+		"every one fails":   {batchBody("s", "x", "y"), http.StatusBadGateway},
+		"no candidates":     {batchBody("s"), http.StatusBadRequest},
+		"too many":          {batchBody("s", tooMany...), http.StatusBadRequest},
+		"missing candidate": {`{"subject":{"dob":"s","tob":"12:00:00"},"candidates":[{"name":"n"}]}`, http.StatusBadRequest},
+	} {
+		if w := batchRequest(r, "POST", "/api/v1/analysis/batch", 1, tc.body); w.Code != tc.want {
+			t.Errorf("%s: expected %d got %d %s", name, tc.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestBatchJob(t *testing.T) {
+	t.Parallel()
+	reports := &batchReports{moons: map[string][2]int{"s": {1, 1}, "a": {1, 1}, "b": {14, 7}}}
+	jobs := store.NewMemoryAnalysisJobStore()
+	a := NewAnalysis(reports, store.NewMemoryAnalysisStore(), AnalysisOptions{Jobs: jobs, BatchSyncLimit: 2})
+	r := batchRouter(a)
+	ctx, stop := context.WithCancel(context.Background())
+	t.Cleanup(stop)
+	go a.Work(ctx, 2)
+
+	// Batches over the sync limit, and any with async=true, run as jobs.
+	for _, tc := range []struct {
+		path, body, status string
+	}{
+		{"/api/v1/analysis/batch", batchBody("s", "a", "b", "x"), models.JobSucceeded},
+		{"/api/v1/analysis/batch?async=true", batchBody("s", "a"), models.JobSucceeded},
+		{"/api/v1/analysis/batch?async=true", batchBody("x", "a"), models.JobFailed},
+	} {
+		w := batchRequest(r, "POST", tc.path, 1, tc.body)
+		var queued JobStatus
+		json.Unmarshal(w.Body.Bytes(), &queued)
+		if w.Code != http.StatusAccepted || queued.JobID == "" || queued.Kind != models.JobBatch || queued.Status != models.JobQueued {
+			t.Fatalf("%s: %d %s", tc.path, w.Code, w.Body.String())
+		}
+		loc := w.Header().Get("Location")
+		if loc != "/api/v1/analysis/jobs/"+queued.JobID {
+			t.Fatalf("location %q", loc)
+		}
+
+		var job JobStatus
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			w = batchRequest(r, "GET", loc, 1, "")
+			json.Unmarshal(w.Body.Bytes(), &job)
+			if w.Code != http.StatusOK {
+				t.Fatalf("poll: %d %s", w.Code, w.Body.String())
+			}
+			if job.Status == models.JobSucceeded || job.Status == models.JobFailed || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if job.Status != tc.status {
+			t.Fatalf("job: %s", w.Body.String())
+		}
+		switch tc.status {
+		case models.JobSucceeded:
+			if job.Result == nil || job.Result.Matches[0].Rank != 1 || job.Result.Matches[0].Analysis.Breakdown[0].Label == "" {
+				t.Fatalf("job result: %s", w.Body.String())
+			}
+		case models.JobFailed:
+			if job.Result != nil || job.Error != "report service error" {
+				t.Fatalf("failed job: %s", w.Body.String())
+			}
+		}
+
+		// Jobs are only shown to the user who started them.
+		if w := batchRequest(r, "GET", loc, 2, ""); w.Code != http.StatusNotFound {
+			t.Fatalf("job of another user: %d", w.Code)
+		}
+	}
+	if w := batchRequest(r, "GET", "/api/v1/analysis/jobs/missing", 1, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("missing job: %d", w.Code)
+	}
+}
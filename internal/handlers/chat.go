@@ -1,113 +1,789 @@
 package handlers
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
-	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	"github.com/redis/go-redis/v9"
 
-	"matchmaker/internal/database"
+	"matchmaker/internal/clients"
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/i18n"
+	"matchmaker/internal/llm"
 	"matchmaker/internal/logging"
+	"matchmaker/internal/metrics"
+	"matchmaker/internal/models"
+	"matchmaker/internal/moderation"
+	"matchmaker/internal/prompts"
+	"matchmaker/internal/server"
+	"matchmaker/internal/store"
 )
 
-var wsUpgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+// ChatOptions tunes the chat service. Zero fields use the defaults below.
+type ChatOptions struct {
+	// ContextTokens is the budget for the summary and past turns sent with
+	// each question. Older turns are folded into the summary once the
+	// conversation outgrows it.
+	ContextTokens int
+	// HistoryTTL is how long an idle conversation is kept.
+	HistoryTTL time.Duration
 
-// Chat handles GET /api/v1/chat and streams LLM responses over WebSocket.
-func Chat(c *gin.Context) {
-	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		logging.Log.WithError(err).Warn("websocket upgrade failed")
+	// AllowedOrigins lists the origins, such as https://app.example.com,
+	// whose pages may open chat sockets; "*" allows any. When empty, only
+	// pages served from the chat's own host may. Clients that send no
+	// Origin, which browsers always do, are not restricted.
+	AllowedOrigins []string
+	// MaxMessageBytes bounds the messages clients send; larger ones close
+	// the socket.
+	MaxMessageBytes int
+	// PingInterval is how often clients are pinged. A client that answers
+	// nothing, not even a pong, for PongTimeout is disconnected.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	// WriteTimeout bounds writing one message to a client.
+	WriteTimeout time.Duration
+	// MaxConnections bounds the sockets a user may have open at once,
+	// across replicas.
+	MaxConnections int
+	// SendBuffer is how many frames may wait to be written to a v1 client.
+	SendBuffer int
+	// SlowConsumer is what happens to a v1 client that cannot keep up:
+	// SlowConsumerCoalesce merges the assistant_delta frames waiting for
+	// it, and disconnects it only when the buffer still fills up, while
+	// SlowConsumerClose disconnects it as soon as the buffer is full.
+	// Disconnected clients are closed with 1013 (try again later) and
+	// resume where they left off after reconnecting.
+	SlowConsumer string
+	// Prompts renders the system prompt of each question; users are
+	// assigned one of its templates. The built-in template is used when
+	// it is nil.
+	Prompts *prompts.Set
+	// Tools are offered to the model while it answers; nil offers none.
+	Tools *ChatTools
+	// Meter holds users to their quotas and counts their usage; nil leaves
+	// chats unmetered.
+	Meter UsageMeter
+	// Moderation screens messages and answers; nil leaves them
+	// unmoderated.
+	Moderation *Moderation
+}
+
+// Slow consumer policies of ChatOptions.
+const (
+	SlowConsumerCoalesce = "coalesce"
+	SlowConsumerClose    = "close"
+)
+
+// Defaults of ChatOptions.
+const (
+	DefaultContextTokens   = 3000
+	DefaultHistoryTTL      = 30 * 24 * time.Hour
+	DefaultMaxMessageBytes = 16 << 10
+	DefaultPingInterval    = 30 * time.Second
+	DefaultPongTimeout     = time.Minute
+	DefaultWriteTimeout    = 10 * time.Second
+	DefaultMaxConnections  = 5
+	DefaultSendBuffer      = 256
+)
+
+func (o ChatOptions) withDefaults() ChatOptions {
+	if o.ContextTokens <= 0 {
+		o.ContextTokens = DefaultContextTokens
+	}
+	if o.HistoryTTL <= 0 {
+		o.HistoryTTL = DefaultHistoryTTL
+	}
+	if o.MaxMessageBytes <= 0 {
+		o.MaxMessageBytes = DefaultMaxMessageBytes
+	}
+	if o.PingInterval <= 0 {
+		o.PingInterval = DefaultPingInterval
+	}
+	if o.PongTimeout <= 0 {
+		o.PongTimeout = DefaultPongTimeout
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = DefaultWriteTimeout
+	}
+	if o.MaxConnections <= 0 {
+		o.MaxConnections = DefaultMaxConnections
+	}
+	if o.SendBuffer <= 0 {
+		o.SendBuffer = DefaultSendBuffer
+	}
+	if o.SlowConsumer == "" {
+		o.SlowConsumer = SlowConsumerCoalesce
+	}
+	if o.Prompts == nil {
+		o.Prompts = defaultPrompts
+	}
+	return o
+}
+
+// Chat serves the AI chat WebSocket.
+type Chat struct {
+	history     store.ChatHistoryStore
+	transcripts store.ChatTranscriptStore
+	bus         store.ChatBus
+	llm         llm.LLMProvider
+	analyses    AnalysisLoader
+	reports     ReportLoader
+	opts        ChatOptions
+	upgrader    websocket.Upgrader
+
+	// mu guards conns and draining, which track open sockets so they can be
+	// drained on shutdown, and compacting, the conversations being
+	// summarized.
+	mu         sync.Mutex
+	conns      map[*websocket.Conn]struct{}
+	draining   bool
+	compacting map[string]bool
+}
+
+// NewChat returns a Chat that remembers conversations in history, keeps
+// their full transcripts in transcripts, shares them with the other
+// replicas over bus and streams completions from provider. Chats about an
+// analysis load it from analyses and its reports from reports.
+func NewChat(history store.ChatHistoryStore, transcripts store.ChatTranscriptStore, bus store.ChatBus, provider llm.LLMProvider, analyses AnalysisLoader, reports ReportLoader, opts ChatOptions) *Chat {
+	h := &Chat{
+		history:     history,
+		transcripts: transcripts,
+		bus:         bus,
+		llm:         provider,
+		analyses:    analyses,
+		reports:     reports,
+		opts:        opts.withDefaults(),
+		conns:       map[*websocket.Conn]struct{}{},
+		compacting:  map[string]bool{},
+	}
+	h.upgrader = websocket.Upgrader{
+		CheckOrigin:  h.checkOrigin,
+		Subprotocols: []string{ChatProtocolV1, ChatProtocolLegacy},
+	}
+	return h
+}
+
+// chatSession is the state of one chat socket.
+type chatSession struct {
+	userID     uint
+	analysisID string
+	// locale is the language to answer in, negotiated at the handshake.
+	locale string
+	// analysis grounds the conversation in the analysis; it is nil for
+	// chats not about one.
+	analysis *prompts.Analysis
+}
+
+// key names sess's conversation on the bus.
+func (sess *chatSession) key() string {
+	return fmt.Sprintf("%d:%s", sess.userID, sess.analysisID)
+}
+
+// Drain stops all chat sessions from reading further messages and closes
+// them with "going away" so clients reconnect to another replica, where
+// they resume from their last frame. Answers in progress are finished.
+// It is meant to be passed to server.Run as a shutdown hook.
+func (h *Chat) Drain() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.draining = true
+	for conn := range h.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+}
+
+func (h *Chat) isDraining() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.draining
+}
+
+// Connect handles GET /api/v1/chat and streams LLM responses over WebSocket.
+// With ?analysisId= the conversation is about that analysis of the caller:
+// its breakdown and both reports are given to the model, and the history is
+// kept apart from the user's other conversations. With ?lastSeq= a
+// ChatProtocolV1 client resumes after the last frame it received.
+func (h *Chat) Connect(c *gin.Context) {
+	if !h.checkOrigin(c.Request) {
+		httputil.Fail(c, httputil.CodeForbidden, "origin not allowed")
 		return
 	}
 	uid := c.GetUint("user_id")
-	logging.Log.WithField("user_id", uid).Info("websocket connected")
+	sess := &chatSession{userID: uid, locale: i18n.RequestLocale(c.Request)}
+	var lastSeq uint64
+	resume := c.Query("lastSeq") != ""
+	if resume {
+		n, err := strconv.ParseUint(c.Query("lastSeq"), 10, 64)
+		if err != nil {
+			e := httputil.New(httputil.CodeValidationFailed, "invalid request")
+			e.Details = []httputil.FieldError{{Field: "lastSeq", Code: "invalid", Message: "must be a non-negative integer"}}
+			httputil.WriteError(c, e)
+			return
+		}
+		lastSeq = n
+	}
+	if id := c.Query("analysisId"); id != "" {
+		analysis, err := h.analysisContext(c.Request.Context(), uid, id)
+		if isNotFound(err) {
+			httputil.Fail(c, httputil.CodeNotFound, "analysis not found")
+			return
+		}
+		if err != nil {
+			logging.FromContext(c).WithError(err).Error("failed to load analysis")
+			httputil.Fail(c, httputil.CodeUpstream, "match service error")
+			return
+		}
+		sess.analysisID, sess.analysis = id, analysis
+	}
+	release, err := h.bus.Acquire(c.Request.Context(), fmt.Sprintf("conns:%d", uid), h.opts.MaxConnections, connSlotTTL)
+	if errors.Is(err, store.ErrLimit) {
+		httputil.Fail(c, httputil.CodeRateLimited, "too many chat connections")
+		return
+	}
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("chat bus unavailable")
+		httputil.Fail(c, httputil.CodeInternal, "chat is unavailable")
+		return
+	}
+	defer release()
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Warn("websocket upgrade failed")
+		return
+	}
+	done := server.Track()
+	h.mu.Lock()
+	h.conns[conn] = struct{}{}
+	h.mu.Unlock()
+	conn.SetReadLimit(int64(h.opts.MaxMessageBytes))
+	h.extendReadDeadline(conn)
+	conn.SetPongHandler(func(string) error {
+		h.extendReadDeadline(conn)
+		return nil
+	})
+	stopPings := h.keepAlive(conn)
+	logging.FromContext(c).WithField("user_id", uid).Info("websocket connected")
+	metrics.ChatActiveSessions.Inc()
 	defer func() {
+		stopPings()
+		h.mu.Lock()
+		delete(h.conns, conn)
+		h.mu.Unlock()
+		metrics.ChatActiveSessions.Dec()
 		conn.Close()
-		logging.Log.WithField("user_id", uid).Info("websocket disconnected")
+		done()
+		logging.FromContext(c).WithField("user_id", uid).Info("websocket disconnected")
 	}()
 
+	if conn.Subprotocol() == ChatProtocolV1 {
+		h.serveFrames(c.Request.Context(), sess, conn, lastSeq, resume)
+		return
+	}
+	h.serveLegacy(c.Request.Context(), sess, conn)
+}
+
+// serveLegacy runs a plain-text session: each text frame is a question and
+// the answer is streamed back as raw text frames. Failing to write closes
+// the socket.
+func (h *Chat) serveLegacy(ctx context.Context, sess *chatSession, conn *websocket.Conn) {
 	for {
 		_, msg, err := conn.ReadMessage()
 		if err != nil {
-			logging.Log.WithError(err).WithField("user_id", uid).Info("read loop ended")
+			h.closeIfDraining(conn)
+			logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Info("read loop ended")
 			return
 		}
-		if err := handleChatMessage(c.Request.Context(), uid, msg, conn); err != nil {
-			logging.Log.WithError(err).WithField("user_id", uid).Error("message handling failed")
+		h.extendReadDeadline(conn)
+		if err := h.handleChatMessage(ctx, sess, msg, conn); err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Error("message handling failed")
 			return
 		}
 	}
 }
 
-func handleChatMessage(ctx context.Context, uid uint, msg []byte, conn *websocket.Conn) error {
-	key := fmt.Sprintf("chat_context:%d", uid)
-	prev, err := database.Redis.Get(ctx, key).Result()
-	if err == redis.Nil {
-		prev = ""
-	} else if err != nil {
-		logging.Log.WithError(err).Error("redis get failed")
+// handleChatMessage streams the answer to msg. It waits for answers to the
+// conversation asked from other sockets to finish first. Users whose
+// message is blocked by moderation or who spent their quota are told so
+// instead, as are users whose answer failed. Only failing to write to conn
+// is returned.
+func (h *Chat) handleChatMessage(ctx context.Context, sess *chatSession, msg []byte, conn *websocket.Conn) error {
+	text, blocked := h.screen(ctx, sess, "", string(msg))
+	if blocked {
+		conn.SetWriteDeadline(time.Now().Add(h.opts.WriteTimeout))
+		return conn.WriteMessage(websocket.TextMessage, []byte(blockedNotice))
 	}
+	if q := h.checkQuota(ctx, sess); q != nil {
+		conn.SetWriteDeadline(time.Now().Add(h.opts.WriteTimeout))
+		return conn.WriteMessage(websocket.TextMessage, []byte(quotaNotice(q)))
+	}
+	unlock, err := h.waitLock(ctx, "answer:"+sess.key(), answerLockTTL, 0)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	var writeErr error
+	_, _, err = h.answer(ctx, sess, "", text, func(chunk []byte) error {
+		conn.SetWriteDeadline(time.Now().Add(h.opts.WriteTimeout))
+		writeErr = conn.WriteMessage(websocket.TextMessage, chunk)
+		return writeErr
+	})
+	if err == nil || writeErr != nil || ctx.Err() != nil {
+		return err
+	}
+	// The model failed; the socket stays open for the next question.
+	logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Error("answer failed")
+	conn.SetWriteDeadline(time.Now().Add(h.opts.WriteTimeout))
+	return conn.WriteMessage(websocket.TextMessage, []byte(failedNotice))
+}
+
+// failedNotice tells a legacy client that the model could not answer.
+const failedNotice = "The assistant could not answer. Please try again."
 
-	prompt := prev + "User: " + string(msg) + "\nAI:"
-	body := bytes.NewBuffer(nil)
-	_ = json.NewEncoder(body).Encode(map[string]interface{}{"prompt": prompt, "stream": true})
+// serveFrames runs a ChatProtocolV1 session. The socket follows the
+// conversation on the bus, from after lastSeq when resuming or from now on,
+// so it receives the answers asked from any socket of the conversation on
+// any replica. One answer is generated at a time per conversation.
+func (h *Chat) serveFrames(ctx context.Context, sess *chatSession, conn *websocket.Conn, lastSeq uint64, resume bool) {
+	fc := newFrameConn(conn, h.opts)
+	defer fc.close()
+	key := sess.key()
+	last, err := h.bus.Last(ctx, key)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Error("chat bus unavailable")
+		fc.sendError("", httputil.CodeInternal, "chat is unavailable")
+		return
+	}
+	// A conversation whose log expired counts from 1 again.
+	if !resume || lastSeq > last {
+		lastSeq = last
+	}
+	subCtx, unsubscribe := context.WithCancel(ctx)
+	defer unsubscribe()
+	events, err := h.bus.Subscribe(subCtx, key, lastSeq)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Error("chat bus unavailable")
+		fc.sendError("", httputil.CodeInternal, "chat is unavailable")
+		return
+	}
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		for ev := range events {
+			if errors.Is(fc.sendEvent(ev), errSlowConsumer) {
+				break
+			}
+		}
+		if subCtx.Err() == nil {
+			// The client fell behind; it catches up from its last frame
+			// after reconnecting.
+			logging.FromContext(ctx).WithField("user_id", sess.userID).Warn("slow chat client disconnected")
+			closeMsg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow, reconnect")
+			conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(h.opts.WriteTimeout))
+			conn.Close()
+		}
+	}()
 
-	llmURL := os.Getenv("LLM_API_URL")
-	if llmURL == "" {
-		llmURL = "https://example.com/api/chat"
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			unsubscribe()
+			<-forwarded
+			h.closeIfDraining(conn)
+			logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Info("read loop ended")
+			return
+		}
+		h.extendReadDeadline(conn)
+		var f Frame
+		if err := json.Unmarshal(data, &f); err != nil {
+			fc.sendError("", httputil.CodeInvalidRequest, "malformed frame")
+			continue
+		}
+		switch f.Type {
+		case FrameUserMessage:
+			if f.ID == "" {
+				f.ID = newID()
+			}
+			if strings.TrimSpace(f.Text) == "" {
+				fc.sendError(f.ID, httputil.CodeValidationFailed, "text is required")
+				continue
+			}
+			text, blocked := h.screen(ctx, sess, f.ID, f.Text)
+			if blocked {
+				fc.sendError(f.ID, httputil.CodeContentBlocked, blockedNotice)
+				continue
+			}
+			f.Text = text
+			if q := h.checkQuota(ctx, sess); q != nil {
+				fc.send(Frame{Type: FrameQuotaExceeded, ReplyTo: f.ID, Code: httputil.CodeRateLimited, Message: q.Error(), Quota: q})
+				continue
+			}
+			err := h.startAnswer(ctx, sess, f)
+			if errors.Is(err, store.ErrLocked) {
+				fc.sendError(f.ID, httputil.CodeConflict, "an answer is already being generated")
+			} else if err != nil {
+				logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Error("failed to start answer")
+				fc.sendError(f.ID, httputil.CodeInternal, "chat is unavailable")
+			}
+		case FrameCancel:
+			if err := h.bus.Signal(ctx, key, []byte(f.ID)); err != nil {
+				logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Error("failed to cancel answer")
+			}
+		case FrameTyping:
+		default:
+			fc.sendError(f.ID, httputil.CodeInvalidRequest, "unknown frame type "+strconv.Quote(f.Type))
+		}
 	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, llmURL, body)
+// Lock durations; locks are renewed while held, so these only bound how
+// long a crashed replica keeps a conversation locked.
+const (
+	answerLockTTL = 30 * time.Second
+	memoryLockTTL = 10 * time.Second
+)
+
+// lockPoll is how often a lock held elsewhere is tried again.
+const lockPoll = 20 * time.Millisecond
+
+// waitLock takes lock name on the bus, waiting up to wait for its holder to
+// release it, or until ctx is done when wait is 0.
+func (h *Chat) waitLock(ctx context.Context, name string, ttl, wait time.Duration) (func(), error) {
+	if wait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, wait)
+		defer cancel()
+	}
+	for {
+		unlock, err := h.bus.Lock(ctx, name, ttl)
+		if !errors.Is(err, store.ErrLocked) {
+			return unlock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+}
+
+// startAnswer generates the answer to msg in the background, publishing its
+// frames to sess's conversation. The answer outlives the socket that asked
+// for it; it stops early only when a cancel frame for it is sent from any
+// socket of the conversation. startAnswer returns store.ErrLocked while
+// another answer to the conversation is being generated.
+func (h *Chat) startAnswer(ctx context.Context, sess *chatSession, msg Frame) error {
+	key := sess.key()
+	unlock, err := h.bus.Lock(ctx, "answer:"+key, answerLockTTL)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if apiKey := os.Getenv("LLM_API_KEY"); apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+apiKey)
+	genCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	signals, err := h.bus.Signals(genCtx, key)
+	if err != nil {
+		cancel()
+		unlock()
+		return err
 	}
+	go func() {
+		for id := range signals {
+			if len(id) == 0 || string(id) == msg.ID {
+				cancel()
+			}
+		}
+	}()
+	server.Go(func() {
+		defer cancel()
+		h.answerFrame(genCtx, sess, msg, unlock)
+	})
+	return nil
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// publish sends f to every socket following sess's conversation.
+func (h *Chat) publish(ctx context.Context, sess *chatSession, f Frame) error {
+	data, err := json.Marshal(f)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("llm status %d: %s", resp.StatusCode, string(b))
+	if _, err := h.bus.Publish(context.WithoutCancel(ctx), sess.key(), data); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Error("failed to publish chat frame")
+		return err
+	}
+	return nil
+}
+
+// answerFrame publishes the answer to msg as assistant_delta frames and ends
+// it with assistant_done, or an error frame when the model fails. release
+// is called before the final frame so the client may send its next message
+// as soon as it sees it.
+func (h *Chat) answerFrame(ctx context.Context, sess *chatSession, msg Frame, release func()) {
+	replyID := newID()
+	h.publish(ctx, sess, Frame{Type: FrameTyping, ReplyTo: msg.ID})
+	reply, finish, err := h.answer(ctx, sess, msg.ID, msg.Text, func(chunk []byte) error {
+		return h.publish(ctx, sess, Frame{Type: FrameAssistantDelta, ID: replyID, ReplyTo: msg.ID, Text: string(chunk)})
+	})
+	release()
+	switch {
+	case err == nil:
+		if finish == "" {
+			finish = FinishStop
+		}
+		h.publish(ctx, sess, Frame{Type: FrameAssistantDone, ID: replyID, ReplyTo: msg.ID, FinishReason: finish})
+	case ctx.Err() != nil:
+		h.publish(ctx, sess, Frame{Type: FrameAssistantDone, ID: replyID, ReplyTo: msg.ID, FinishReason: FinishCancelled})
+	default:
+		logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Error("message handling failed")
+		f := Frame{Type: FrameError, ReplyTo: msg.ID, Code: httputil.CodeUpstream, Message: "the assistant could not answer"}
+		if errors.Is(err, llm.ErrTimeout) || errors.Is(err, llm.ErrFirstTokenTimeout) {
+			f.Code, f.Message = httputil.CodeTimeout, "the assistant took too long to answer"
+		}
+		if reply != "" {
+			// Part of the answer was sent; the error names it.
+			f.ID, f.Message = replyID, "the answer was interrupted"
+		}
+		h.publish(ctx, sess, f)
+	}
+}
+
+// closeIfDraining sends "going away" when the read loop ended because the
+// server is shutting down.
+func (h *Chat) closeIfDraining(conn *websocket.Conn) {
+	if h.isDraining() {
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(h.opts.WriteTimeout))
 	}
+}
 
-	reader := bufio.NewReader(resp.Body)
-	var respBuf bytes.Buffer
+// answer sends text, user message id, to the model as the next turn of
+// sess's conversation, passing each chunk of the reply to emit, and returns
+// the reply and the reason the model stopped. The exchange is recorded when
+// the reply completes, or is cancelled after part of it was sent. Replies
+// are moderated as they stream; a blocked reply ends with FinishModerated.
+// When the chat has tools, the model's calls are run as sess's user and
+// their results sent back until it answers, for at most maxToolRounds
+// completions; only the question and the final reply are remembered.
+func (h *Chat) answer(ctx context.Context, sess *chatSession, id, text string, emit func([]byte) error) (string, string, error) {
+	mem, err := h.memory(ctx, sess)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("redis get failed")
+	}
+	tmpl := h.opts.Prompts.Assign(sess.userID)
+	system, err := h.opts.Prompts.Render(tmpl, prompts.Data{Locale: sess.locale, Analysis: sess.analysis})
+	if err != nil {
+		return "", "", err
+	}
+	req := buildRequest(system, mem, text, h.opts.ContextTokens)
+	if h.opts.Tools != nil {
+		req.Tools = chatToolDefs
+	}
+	start := time.Now()
+	stream, err := h.llm.Stream(ctx, req)
+	if err != nil {
+		return "", "", err
+	}
+	defer func() { metrics.ChatLLMDuration.Observe(time.Since(start).Seconds()) }()
+
+	var respBuf strings.Builder
+	show := func(chunk string) error {
+		if chunk == "" {
+			return nil
+		}
+		if err := emit([]byte(chunk)); err != nil {
+			return err
+		}
+		respBuf.WriteString(chunk)
+		return nil
+	}
+	var filter *moderation.Filter
+	if h.opts.Moderation != nil {
+		filter = h.opts.Moderation.moderator.Filter()
+		defer h.opts.Moderation.review(ctx, sess, id, filter)
+	}
+	blocked := false
+	// sep parts the text of a completion from that of the ones before.
+	var sep string
+	var writeErr error
+	write := func(chunk string) bool {
+		chunk, sep = sep+chunk, ""
+		if filter != nil {
+			chunk, blocked = filter.Write(chunk)
+		}
+		if writeErr = show(chunk); writeErr != nil {
+			return false
+		}
+		return !blocked
+	}
+	var finish string
+	var spent models.Usage
+	var replyTokens int
+	var streamErr error
+	used := false
+	// The completions are paid for however the answer ends, including when
+	// writing it to the client fails.
+	defer func() {
+		if used {
+			spent.Messages = 1
+			h.meterUsage(ctx, sess, spent)
+		}
+	}()
+	for round := 1; ; round++ {
+		roundText, calls, roundFinish, usage, err := receive(stream, write)
+		finish = roundFinish
+		used = used || roundText != "" || usage != nil
+		spent = spent.Add(spentOn(req, roundText, usage))
+		if usage != nil && err == nil {
+			replyTokens += usage.OutputTokens
+			metrics.ChatLLMTokens.Add(float64(usage.OutputTokens))
+		} else {
+			metrics.ChatLLMTokens.Add(float64(metrics.EstimateTokens(len(roundText))))
+		}
+		if writeErr != nil {
+			return respBuf.String(), "", writeErr
+		}
+		if err != nil {
+			streamErr = err
+			break
+		}
+		if blocked || len(calls) == 0 || h.opts.Tools == nil || round >= maxToolRounds {
+			break
+		}
+		req.Messages = append(req.Messages, llm.Message{Role: llm.RoleAssistant, Content: roundText, ToolCalls: calls})
+		for _, c := range calls {
+			req.Messages = append(req.Messages, llm.Message{Role: llm.RoleTool, Content: h.opts.Tools.call(ctx, sess.userID, c), ToolCallID: c.ID})
+		}
+		if round+1 >= maxToolRounds {
+			req.Tools = nil
+		}
+		if respBuf.Len() > 0 {
+			sep = "\n\n"
+		}
+		if stream, err = h.llm.Stream(ctx, req); err != nil {
+			streamErr = err
+			break
+		}
+	}
+	if filter != nil && !blocked {
+		var chunk string
+		chunk, blocked = filter.Flush()
+		if werr := show(chunk); werr != nil {
+			return respBuf.String(), "", werr
+		}
+	}
+	if blocked {
+		finish = FinishModerated
+	}
+	reply := respBuf.String()
+	spent.Messages = 1
+	if streamErr != nil && (ctx.Err() == nil || reply == "") {
+		return reply, "", streamErr
+	}
+
+	h.record(context.WithoutCancel(ctx), sess, text, reply, tmpl.Version, replyTokens, spent)
+	return reply, finish, streamErr
+}
+
+// receive reads stream to its end and closes it, passing the reply text to
+// write until write returns false. It returns the text, the tool calls and
+// finish reason the completion ended with, and its token usage.
+func receive(stream llm.Stream, write func(string) bool) (text string, calls []llm.ToolCall, finish string, usage *llm.Usage, err error) {
+	defer stream.Close()
+	var b strings.Builder
 	for {
-		chunk := make([]byte, 1024)
-		n, err := reader.Read(chunk)
-		if n > 0 {
-			data := chunk[:n]
-			if werr := conn.WriteMessage(websocket.TextMessage, data); werr != nil {
-				return werr
-			}
-			respBuf.Write(data)
+		ev, err := stream.Recv()
+		if err == io.EOF {
+			return b.String(), calls, finish, usage, nil
 		}
 		if err != nil {
-			if err == io.EOF {
-				break
+			return b.String(), calls, finish, usage, err
+		}
+		if ev.FinishReason != "" {
+			finish = ev.FinishReason
+		}
+		if ev.Usage != nil {
+			usage = ev.Usage
+		}
+		calls = append(calls, ev.ToolCalls...)
+		if ev.Text != "" {
+			b.WriteString(ev.Text)
+			if !write(ev.Text) {
+				return b.String(), calls, finish, usage, nil
 			}
-			return err
 		}
 	}
+}
+
+// blockedNotice answers messages blocked by moderation.
+const blockedNotice = "Your message was blocked by the content policy."
 
-	newCtx := prev + "User: " + string(msg) + "\nAI: " + respBuf.String() + "\n"
-	if err := database.Redis.Set(ctx, key, newCtx, 10*time.Minute).Err(); err != nil {
-		logging.Log.WithError(err).Error("redis set failed")
+// screen moderates user message id of sess, returning its text with
+// redactions applied, or blocked when it must not be answered.
+func (h *Chat) screen(ctx context.Context, sess *chatSession, id, text string) (string, bool) {
+	if h.opts.Moderation == nil {
+		return text, false
 	}
-	return nil
+	v := h.opts.Moderation.screen(ctx, sess, id, text)
+	return v.Text, v.Blocked()
+}
+
+// maxPromptReport bounds how much of each report goes into the prompt.
+const maxPromptReport = 8 << 10
+
+// analysisContext loads analysis id of userID and its reports for the
+// prompt. A report that cannot be loaded is left out rather than failing
+// the chat.
+func (h *Chat) analysisContext(ctx context.Context, userID uint, id string) (*prompts.Analysis, error) {
+	a, err := h.analyses.LoadAnalysis(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	var reports [2][]byte
+	for i, key := range a.ReportKeys {
+		if key == "" {
+			continue
+		}
+		r, err := h.reports.LoadReport(ctx, key)
+		if err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("key", key).Warn("report unavailable for chat")
+			continue
+		}
+		reports[i] = r
+	}
+	return promptAnalysis(a, reports), nil
+}
+
+// promptAnalysis is a with the reports of person A and person B, as
+// prompt templates see them.
+func promptAnalysis(a *models.Analysis, reports [2][]byte) *prompts.Analysis {
+	out := &prompts.Analysis{ID: a.ID, Score: a.Score}
+	var total, maxPoints float64
+	for _, k := range a.Breakdown {
+		total += k.Points
+		maxPoints += k.Max
+		out.Breakdown = append(out.Breakdown, prompts.Koota{Name: k.Name, Points: formatPoints(k.Points), Max: formatPoints(k.Max)})
+	}
+	out.Points, out.MaxPoints = formatPoints(total), formatPoints(maxPoints)
+	for i, name := range []string{"Person A", "Person B"} {
+		r := reports[i]
+		if len(r) > maxPromptReport {
+			r = r[:maxPromptReport]
+		}
+		out.Reports = append(out.Reports, prompts.Report{Person: name, Text: string(r)})
+	}
+	return out
+}
+
+func formatPoints(p float64) string {
+	return strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, store.ErrNotFound) || clients.ErrorCode(err) == httputil.CodeNotFound
 }
@@ -1,44 +1,51 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	"github.com/redis/go-redis/v9"
 
-	"matchmaker/internal/database"
-	"matchmaker/internal/logging"
+	"matchmaker/internal/clients"
+	"matchmaker/internal/llm"
+	"matchmaker/internal/models"
+	"matchmaker/internal/store"
 )
 
-func TestChat(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	logging.Init()
-	mr, _ := miniredis.Run()
-	defer mr.Close()
-	database.Redis = redis.NewClient(&redis.Options{Addr: mr.Addr()})
-
-	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("hi"))
-	}))
-	defer llm.Close()
-	os.Setenv("LLM_API_URL", llm.URL)
-	os.Setenv("LLM_API_KEY", "key")
-
+func serveChat(t *testing.T, h *Chat) string {
 	r := gin.New()
 	r.GET("/chat", func(c *gin.Context) {
 		c.Set("user_id", uint(1))
-		Chat(c)
+		h.Connect(c)
 	})
 	srv := httptest.NewServer(r)
-	defer srv.Close()
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/chat"
+}
+
+// transcript flattens a stored conversation to "role: content" lines.
+func transcript(history store.ChatHistoryStore, userID uint, analysisID string) string {
+	mem, _ := history.Get(context.Background(), userID, analysisID)
+	var b strings.Builder
+	for _, m := range mem.Messages {
+		b.WriteString(m.Role + ": " + m.Content + "\n")
+	}
+	return b.String()
+}
+
+func TestChat(t *testing.T) {
+	t.Parallel()
+	history := store.NewMemoryChatHistory()
+	client := &llm.Fake{Reply: "hi"}
+	url := serveChat(t, NewChat(history, store.NewMemoryChatTranscripts(), store.NewMemoryChatBus(), client, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{}))
 
-	url := "ws" + srv.URL[len("http"):] + "/chat"
 	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
 	if err != nil {
 		t.Fatal(err)
@@ -58,28 +65,113 @@ func TestChat(t *testing.T) {
 	}
 
 	time.Sleep(20 * time.Millisecond)
-	if v, err := mr.Get("chat_context:1"); err != nil || v == "" {
+	if transcript(history, 1, "") != "user: hello\nassistant: hi\n" {
 		t.Fatalf("context not stored")
 	}
+	if r := client.Requests(); len(r) != 1 || len(r[0].Messages) != 1 || !reflect.DeepEqual(r[0].Messages[0], llm.Message{Role: llm.RoleUser, Content: "hello"}) {
+		t.Fatalf("unexpected requests %+v", r)
+	}
+}
+
+func TestChatProviderStream(t *testing.T) {
+	t.Parallel()
+	srv := llm.NewFakeServer("Your charts agree on most kootas.")
+	t.Cleanup(srv.Close)
+	url := serveChat(t, NewChat(store.NewMemoryChatHistory(), store.NewMemoryChatTranscripts(), store.NewMemoryChatBus(), llm.NewAnthropic(srv.URL+"/v1/messages", "", ""), &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{}))
+
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	var reply string
+	for reply != srv.Reply {
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("read after %q: %v", reply, err)
+		}
+		reply += string(msg)
+	}
+	if r := srv.Requests(); len(r) != 1 || r[0].Messages[0].Content != "hello" {
+		t.Fatalf("unexpected requests %+v", r)
+	}
+}
+
+func TestChatLLMFailure(t *testing.T) {
+	t.Parallel()
+	url := serveChat(t, NewChat(store.NewMemoryChatHistory(), store.NewMemoryChatTranscripts(), store.NewMemoryChatBus(), &llm.Fake{Err: errors.New("llm down")}, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{}))
+
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	// The socket stays open for the next question.
+	for i := 0; i < 2; i++ {
+		if err := ws.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+			t.Fatal(err)
+		}
+		ws.SetReadDeadline(time.Now().Add(1 * time.Second))
+		if _, msg, err := ws.ReadMessage(); err != nil || string(msg) != failedNotice {
+			t.Fatalf("expected the failure notice, got %q %v", msg, err)
+		}
+	}
+}
+
+func TestChatAboutAnalysis(t *testing.T) {
+	t.Parallel()
+	history := store.NewMemoryChatHistory()
+	client := &llm.Fake{Reply: "Your moons share the Adi nadi."}
+	analyses := &clients.FakeMatch{Analyses: map[string]*clients.AnalysisResult{
+		"a1": {ID: "a1", UserID: 1, Score: 78, ReportKeys: [2]string{"ka", "kb"}, Breakdown: []models.Koota{
+			{Name: KootaGana, Points: 6, Max: 6},
+			{Name: KootaNadi, Points: 0, Max: 8},
+		}},
+		"other": {ID: "other", UserID: 2},
+	}}
+	reports := &clients.FakeReports{ByKey: map[string][]byte{"ka": []byte(`{"moon":{"nakshatra":1,"rashi":1}}`)}}
+	url := serveChat(t, NewChat(history, store.NewMemoryChatTranscripts(), store.NewMemoryChatBus(), client, analyses, reports, ChatOptions{}))
 
-	// failure path
-	llmFail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(500)
-	}))
-	defer llmFail.Close()
-	os.Setenv("LLM_API_URL", llmFail.URL)
+	for _, id := range []string{"missing", "other"} {
+		_, resp, err := websocket.DefaultDialer.Dial(url+"?analysisId="+id, nil)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("analysis %s: expected 404, got %v", id, err)
+		}
+	}
 
-	ws2, _, err := websocket.DefaultDialer.Dial(url, nil)
+	ws, _, err := websocket.DefaultDialer.Dial(url+"?analysisId=a1", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer ws2.Close()
-	if err := ws2.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+	defer ws.Close()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte("why is our Nadi score zero?")); err != nil {
+		t.Fatal(err)
+	}
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := ws.ReadMessage(); err != nil {
 		t.Fatal(err)
 	}
-	ws2.SetReadDeadline(time.Now().Add(1 * time.Second))
-	_, _, err = ws2.ReadMessage()
-	if err == nil {
-		t.Fatalf("expected error")
+
+	p := client.Prompts()
+	if len(p) != 1 {
+		t.Fatalf("unexpected prompts %q", p)
+	}
+	for _, want := range []string{"Overall score: 78%", "- nadi: 0 of 8", `Person A's report:
+{"moon":{"nakshatra":1,"rashi":1}}`, "Person B's report is unavailable", "why is our Nadi score zero?"} {
+		if !strings.Contains(p[0], want) {
+			t.Errorf("prompt missing %q:\n%s", want, p[0])
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if v := transcript(history, 1, "a1"); !strings.Contains(v, "Nadi") {
+		t.Fatalf("analysis conversation not stored: %q", v)
+	}
+	if v := transcript(history, 1, ""); v != "" {
+		t.Fatalf("analysis conversation leaked into the general one: %q", v)
 	}
 }
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// connSlotTTL bounds how long the connection slot of a crashed replica
+// counts against its user's MaxConnections.
+const connSlotTTL = time.Minute
+
+// checkOrigin reports whether the page that opened r, if any, may use the
+// chat.
+func (h *Chat) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(h.opts.AllowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range h.opts.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// extendReadDeadline gives the client PongTimeout more to send something,
+// unless the server is draining.
+func (h *Chat) extendReadDeadline(conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.draining {
+		conn.SetReadDeadline(time.Now())
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(h.opts.PongTimeout))
+}
+
+// keepAlive pings conn every PingInterval until stop is called.
+func (h *Chat) keepAlive(conn *websocket.Conn) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(h.opts.PingInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.opts.WriteTimeout)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"matchmaker/internal/clients"
+	"matchmaker/internal/llm"
+	"matchmaker/internal/store"
+)
+
+func newTestChat(opts ChatOptions) *Chat {
+	return NewChat(store.NewMemoryChatHistory(), store.NewMemoryChatTranscripts(), store.NewMemoryChatBus(), &llm.Fake{Reply: "hi"}, &clients.FakeMatch{}, &clients.FakeReports{}, opts)
+}
+
+func TestChatCheckOrigin(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{nil, "", true},
+		{nil, "https://chat.example.com", true},
+		{nil, "https://evil.example.com", false},
+		{[]string{"https://app.example.com/"}, "https://app.example.com", true},
+		{[]string{"https://app.example.com"}, "https://chat.example.com", false},
+		{[]string{"*"}, "https://evil.example.com", true},
+	} {
+		h := newTestChat(ChatOptions{AllowedOrigins: tc.allowed})
+		r := httptest.NewRequest(http.MethodGet, "http://chat.example.com/chat", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if got := h.checkOrigin(r); got != tc.want {
+			t.Errorf("allowed %v, origin %q: got %v", tc.allowed, tc.origin, got)
+		}
+	}
+
+	url := serveChat(t, newTestChat(ChatOptions{AllowedOrigins: []string{"https://app.example.com"}}))
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.com"}})
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for a foreign origin, got %v", err)
+	}
+	ws, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://app.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.Close()
+}
+
+func TestChatConnectionLimit(t *testing.T) {
+	t.Parallel()
+	url := serveChat(t, newTestChat(ChatOptions{MaxConnections: 1}))
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 over the limit, got %v", err)
+	}
+	ws.Close()
+
+	// The slot is freed once the server notices the socket closed.
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err == nil {
+			ws.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("slot not released: %v", err)
+		}
+	}
+}
+
+func TestChatMaxMessageBytes(t *testing.T) {
+	t.Parallel()
+	url := serveChat(t, newTestChat(ChatOptions{MaxMessageBytes: 256}))
+	ws := dialFrames(t, url)
+	ws.WriteMessage(websocket.TextMessage, make([]byte, 1024))
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := ws.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Fatalf("expected close 1009, got %v", err)
+	}
+}
+
+func TestChatKeepAlive(t *testing.T) {
+	t.Parallel()
+	url := serveChat(t, newTestChat(ChatOptions{PingInterval: 20 * time.Millisecond, PongTimeout: 100 * time.Millisecond}))
+
+	// A client that reads answers pings and stays connected.
+	ws := dialFrames(t, url)
+	pinged := make(chan struct{}, 1)
+	ws.SetPingHandler(func(data string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-pinged:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no ping")
+	}
+	select {
+	case <-closed:
+		t.Fatal("responsive client disconnected")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// A client that answers nothing is dropped.
+	silent := dialFrames(t, url)
+	time.Sleep(300 * time.Millisecond)
+	silent.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := silent.ReadMessage(); err != nil {
+			var netErr interface{ Timeout() bool }
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				t.Fatal("silent client not disconnected")
+			}
+			break
+		}
+	}
+}
+
+func TestFrameConnSlowConsumer(t *testing.T) {
+	t.Parallel()
+	delta := func(seq uint64, text string) Frame {
+		return Frame{Type: FrameAssistantDelta, ID: "r1", Seq: seq, Text: text}
+	}
+
+	// Waiting chunks of an answer are merged into one frame.
+	fc := &frameConn{limit: 2, coalesce: true, wake: make(chan struct{}, 1)}
+	fc.send(Frame{Type: FrameTyping, Seq: 1})
+	for i, text := range []string{"a", "b", "c"} {
+		if err := fc.send(delta(uint64(i+2), text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(fc.queue) != 2 || fc.queue[1].Text != "abc" || fc.queue[1].Seq != 4 {
+		t.Fatalf("deltas not coalesced: %+v", fc.queue)
+	}
+	if err := fc.send(Frame{Type: FrameAssistantDone, Seq: 5}); !errors.Is(err, errSlowConsumer) {
+		t.Fatalf("expected errSlowConsumer, got %v", err)
+	}
+
+	// Without coalescing the client is dropped as soon as the queue fills.
+	fc = &frameConn{limit: 2, wake: make(chan struct{}, 1)}
+	fc.send(delta(1, "a"))
+	fc.send(delta(2, "b"))
+	if err := fc.send(delta(3, "c")); !errors.Is(err, errSlowConsumer) {
+		t.Fatalf("expected errSlowConsumer, got %v", err)
+	}
+}
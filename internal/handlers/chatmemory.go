@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"matchmaker/internal/llm"
+	"matchmaker/internal/logging"
+	"matchmaker/internal/models"
+	"matchmaker/internal/server"
+	"matchmaker/internal/store"
+)
+
+// maxStoredMessages bounds a stored conversation when summarizing keeps
+// failing.
+const maxStoredMessages = 200
+
+// summaryTimeout bounds one summarization call.
+const summaryTimeout = time.Minute
+
+const summaryInstructions = `You keep the memory of a conversation between a user and an astrology compatibility assistant. Rewrite the summary so it also covers the new turns. Keep names, birth details, questions asked and conclusions reached; drop pleasantries. Reply with the summary only.`
+
+func messageTokens(m models.ChatMessage) int {
+	if m.Tokens > 0 {
+		return m.Tokens
+	}
+	return llm.CountTokens(m.Content)
+}
+
+// memoryTokens is the prompt size of m's summary and turns.
+func memoryTokens(m models.ChatMemory) int {
+	n := 0
+	if m.Summary != "" {
+		n = llm.CountTokens(m.Summary)
+	}
+	for _, msg := range m.Messages {
+		n += messageTokens(msg)
+	}
+	return n
+}
+
+// buildRequest returns the request for the next turn, text: the system
+// prompt followed by the conversation summary, then as many of the most
+// recent turns as fit in budget, then text.
+func buildRequest(system string, mem models.ChatMemory, text string, budget int) llm.Request {
+	budget -= llm.CountTokens(text)
+	if mem.Summary != "" {
+		system = strings.TrimPrefix(system+"\n\nSummary of the conversation so far:\n"+mem.Summary, "\n\n")
+		budget -= llm.CountTokens(mem.Summary)
+	}
+	start := len(mem.Messages)
+	for start > 0 {
+		t := messageTokens(mem.Messages[start-1])
+		if t > budget {
+			break
+		}
+		budget -= t
+		start--
+	}
+	// Providers expect the conversation to open with a user turn.
+	for start < len(mem.Messages) && mem.Messages[start].Role != llm.RoleUser {
+		start++
+	}
+	req := llm.Request{System: system}
+	for _, m := range mem.Messages[start:] {
+		req.Messages = append(req.Messages, llm.Message{Role: m.Role, Content: m.Content})
+	}
+	req.Messages = append(req.Messages, llm.Message{Role: llm.RoleUser, Content: text})
+	return req
+}
+
+// foldCount returns how many of the oldest turns of mem to fold into the
+// summary, or 0 while mem fits in budget. Enough turns are folded to bring
+// the rest under half the budget, so summarizing is not needed every turn,
+// and the rest starts with a user turn.
+func foldCount(mem models.ChatMemory, budget int) int {
+	total := memoryTokens(mem)
+	if total <= budget {
+		return 0
+	}
+	n := 0
+	for n < len(mem.Messages) && (total > budget/2 || mem.Messages[n].Role != llm.RoleUser) {
+		total -= messageTokens(mem.Messages[n])
+		n++
+	}
+	return n
+}
+
+// memory returns what is remembered of sess's conversation. When the
+// memory expired but the transcript was kept, its latest turns are
+// remembered again; failing that, the conversation starts afresh.
+func (h *Chat) memory(ctx context.Context, sess *chatSession) (models.ChatMemory, error) {
+	mem, err := h.history.Get(ctx, sess.userID, sess.analysisID)
+	if err != nil || mem.Summary != "" || len(mem.Messages) > 0 {
+		return mem, err
+	}
+	ts, err := h.transcripts.FindSession(ctx, sess.userID, sess.analysisID)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			logging.FromContext(ctx).WithError(err).Error("failed to fetch chat session")
+		}
+		return mem, nil
+	}
+	offset := int(ts.MessageCount) - maxStoredMessages
+	if offset < 0 {
+		offset = 0
+	}
+	msgs, err := h.transcripts.Messages(ctx, ts.ID, offset, 0)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("failed to load chat transcript")
+		return mem, nil
+	}
+	for _, m := range msgs {
+		mem.Messages = append(mem.Messages, models.ChatMessage{Role: m.Role, Content: m.Content, At: m.At})
+	}
+	return mem, nil
+}
+
+// memoryWait bounds waiting for another replica to update the memory of a
+// conversation.
+const memoryWait = 10 * time.Second
+
+// lockMemory takes the lock serializing updates to sess's memory across
+// replicas.
+func (h *Chat) lockMemory(ctx context.Context, sess *chatSession) (func(), error) {
+	return h.waitLock(ctx, "memory:"+sess.key(), memoryLockTTL, memoryWait)
+}
+
+// record appends an exchange to sess's conversation and its transcript,
+// and starts folding old turns into the summary when the conversation
+// outgrew the context budget.
+// replyTokens is the size of the reply as reported by the model, or 0, and
+// spent is what the exchange cost.
+func (h *Chat) record(ctx context.Context, sess *chatSession, text, reply, promptVersion string, replyTokens int, spent models.Usage) {
+	now := time.Now().UTC()
+	var mem models.ChatMemory
+	unlock, err := h.lockMemory(ctx, sess)
+	if err == nil {
+		mem, err = h.memory(ctx, sess)
+		if err == nil {
+			mem.Messages = append(mem.Messages,
+				models.ChatMessage{Role: llm.RoleUser, Content: text, At: now},
+				models.ChatMessage{Role: llm.RoleAssistant, Content: reply, Tokens: replyTokens, At: now},
+			)
+			if extra := len(mem.Messages) - maxStoredMessages; extra > 0 {
+				mem.Messages = mem.Messages[extra:]
+			}
+			err = h.history.Set(ctx, sess.userID, sess.analysisID, mem, h.opts.HistoryTTL)
+		}
+		unlock()
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("failed to update chat memory")
+	} else if foldCount(mem, h.opts.ContextTokens) > 0 {
+		h.startCompaction(ctx, sess)
+	}
+
+	_, err = h.transcripts.Append(ctx,
+		models.ChatSession{ID: newID(), UserID: sess.userID, AnalysisID: sess.analysisID, Title: sessionTitle(text)},
+		[]models.TranscriptMessage{
+			{Role: llm.RoleUser, Content: text, At: now},
+			{Role: llm.RoleAssistant, Content: reply, PromptTokens: spent.PromptTokens, CompletionTokens: spent.CompletionTokens, PromptVersion: promptVersion, At: now},
+		})
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Error("failed to save chat transcript")
+	}
+}
+
+// startCompaction summarizes sess's older turns in the background unless
+// that is already under way.
+func (h *Chat) startCompaction(ctx context.Context, sess *chatSession) {
+	key := sess.key()
+	h.mu.Lock()
+	if h.compacting[key] {
+		h.mu.Unlock()
+		return
+	}
+	h.compacting[key] = true
+	h.mu.Unlock()
+	ctx = context.WithoutCancel(ctx)
+	server.Go(func() {
+		defer func() {
+			h.mu.Lock()
+			delete(h.compacting, key)
+			h.mu.Unlock()
+		}()
+		if err := h.compact(ctx, sess); err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Warn("chat summarization failed")
+		}
+	})
+}
+
+// compact folds the oldest turns of sess's conversation into its summary.
+// The model is asked without holding the lock; the result is dropped if the
+// folded turns changed meanwhile.
+func (h *Chat) compact(ctx context.Context, sess *chatSession) error {
+	mem, err := h.history.Get(ctx, sess.userID, sess.analysisID)
+	if err != nil {
+		return err
+	}
+	n := foldCount(mem, h.opts.ContextTokens)
+	if n == 0 {
+		return nil
+	}
+	summary, err := h.summarize(ctx, mem.Summary, mem.Messages[:n])
+	if err != nil {
+		return err
+	}
+
+	unlock, err := h.lockMemory(ctx, sess)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	cur, err := h.history.Get(ctx, sess.userID, sess.analysisID)
+	if err != nil {
+		return err
+	}
+	if cur.Summary != mem.Summary || !hasPrefix(cur.Messages, mem.Messages[:n]) {
+		return nil
+	}
+	cur.Summary = summary
+	cur.Messages = append([]models.ChatMessage(nil), cur.Messages[n:]...)
+	return h.history.Set(ctx, sess.userID, sess.analysisID, cur, h.opts.HistoryTTL)
+}
+
+func hasPrefix(msgs, prefix []models.ChatMessage) bool {
+	if len(msgs) < len(prefix) {
+		return false
+	}
+	for i, m := range prefix {
+		if msgs[i].Role != m.Role || msgs[i].Content != m.Content || !msgs[i].At.Equal(m.At) {
+			return false
+		}
+	}
+	return true
+}
+
+// summarize asks the model for a summary covering summary and msgs.
+func (h *Chat) summarize(ctx context.Context, summary string, msgs []models.ChatMessage) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, summaryTimeout)
+	defer cancel()
+	var b strings.Builder
+	b.WriteString("Current summary:\n")
+	if summary == "" {
+		summary = "(none)"
+	}
+	b.WriteString(summary)
+	b.WriteString("\n\nNew turns:\n")
+	for _, m := range msgs {
+		role := "User"
+		if m.Role == llm.RoleAssistant {
+			role = "Assistant"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", role, m.Content)
+	}
+	stream, err := h.llm.Stream(ctx, llm.Request{
+		System:    summaryInstructions,
+		Messages:  []llm.Message{{Role: llm.RoleUser, Content: b.String()}},
+		MaxTokens: h.opts.ContextTokens / 4,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+	var out strings.Builder
+	for {
+		ev, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(ev.Text)
+	}
+	if strings.TrimSpace(out.String()) == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return strings.TrimSpace(out.String()), nil
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"matchmaker/internal/clients"
+	"matchmaker/internal/llm"
+	"matchmaker/internal/models"
+	"matchmaker/internal/store"
+)
+
+// turns returns n alternating user and assistant messages of about 14
+// tokens each.
+func turns(n int) []models.ChatMessage {
+	msgs := make([]models.ChatMessage, n)
+	for i := range msgs {
+		role := llm.RoleUser
+		if i%2 == 1 {
+			role = llm.RoleAssistant
+		}
+		msgs[i] = models.ChatMessage{Role: role, Content: strings.Repeat("x", 30)}
+	}
+	return msgs
+}
+
+func TestBuildRequest(t *testing.T) {
+	t.Parallel()
+	mem := models.ChatMemory{Summary: "They were born in Pune.", Messages: turns(6)}
+
+	req := buildRequest("Be kind.", mem, "and now?", 1000)
+	if req.System != "Be kind.\n\nSummary of the conversation so far:\nThey were born in Pune." {
+		t.Fatalf("unexpected system %q", req.System)
+	}
+	if len(req.Messages) != 7 || req.Messages[6].Content != "and now?" {
+		t.Fatalf("expected all turns and the question, got %+v", req.Messages)
+	}
+
+	// Only the newest turns fit, and the window opens with a user turn.
+	req = buildRequest("", mem, "and now?", 60)
+	if !strings.HasPrefix(req.System, "Summary") {
+		t.Fatalf("unexpected system %q", req.System)
+	}
+	if len(req.Messages) != 3 || req.Messages[0].Role != llm.RoleUser {
+		t.Fatalf("unexpected window %+v", req.Messages)
+	}
+}
+
+func TestFoldCount(t *testing.T) {
+	t.Parallel()
+	mem := models.ChatMemory{Messages: turns(10)} // 140 tokens
+	if n := foldCount(mem, 200); n != 0 {
+		t.Fatalf("expected nothing to fold, got %d", n)
+	}
+	n := foldCount(mem, 100)
+	if n != 8 || mem.Messages[n].Role != llm.RoleUser {
+		t.Fatalf("expected to fold 8 turns, got %d", n)
+	}
+}
+
+func TestChatSummarizesOldTurns(t *testing.T) {
+	t.Parallel()
+	history := store.NewMemoryChatHistory()
+	client := &llm.Fake{Reply: strings.Repeat("y", 60)}
+	url := serveChat(t, NewChat(history, store.NewMemoryChatTranscripts(), store.NewMemoryChatBus(), client, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{ContextTokens: 100}))
+
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	for i := 0; i < 3; i++ {
+		ws.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("q", 60)))
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := ws.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Summarizing runs in the background.
+	var mem models.ChatMemory
+	for deadline := time.Now().Add(2 * time.Second); mem.Summary == "" && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		mem, _ = history.Get(context.Background(), 1, "")
+	}
+	if mem.Summary != client.Reply {
+		t.Fatalf("expected a summary, got %+v", mem)
+	}
+	if tokens := memoryTokens(mem); tokens > 100 {
+		t.Fatalf("memory still over budget: %d tokens", tokens)
+	}
+	var summarized bool
+	for _, r := range client.Requests() {
+		if r.System == summaryInstructions && strings.Contains(r.Messages[0].Content, "New turns:\nUser: qqq") {
+			summarized = true
+		}
+	}
+	if !summarized {
+		t.Fatal("summarizer not asked")
+	}
+}
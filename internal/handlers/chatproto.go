@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/metering"
+	"matchmaker/internal/store"
+)
+
+// WebSocket subprotocols of the chat service. Clients that offer
+// ChatProtocolV1 exchange JSON frames; clients that offer nothing, or
+// ChatProtocolLegacy, keep the original plain-text protocol.
+const (
+	ChatProtocolV1     = "matchmaker.chat.v1"
+	ChatProtocolLegacy = "matchmaker.chat.legacy"
+)
+
+// Frame types of ChatProtocolV1.
+const (
+	// FrameUserMessage (client) asks a question; ID names it.
+	FrameUserMessage = "user_message"
+	// FrameTyping (server) announces that an answer to ReplyTo is being
+	// generated. Typing frames sent by clients are ignored.
+	FrameTyping = "typing"
+	// FrameAssistantDelta (server) carries the next chunk of answer ID.
+	FrameAssistantDelta = "assistant_delta"
+	// FrameAssistantDone (server) ends answer ID with FinishReason.
+	FrameAssistantDone = "assistant_done"
+	// FrameCancel (client) stops the answer to user message ID, or to the
+	// current message when ID is empty.
+	FrameCancel = "cancel"
+	// FrameError (server) reports a failure; the socket stays open.
+	FrameError = "error"
+	// FrameQuotaExceeded (server) tells the client that user message
+	// ReplyTo was not answered because the user spent the quota described
+	// by Quota. Like errors, it goes to the asking connection only.
+	FrameQuotaExceeded = "quota_exceeded"
+)
+
+// Finish reasons of FrameAssistantDone. Other reasons reported by the model
+// provider are passed through.
+const (
+	FinishStop      = "stop"
+	FinishLength    = "length"
+	FinishCancelled = "cancelled"
+	// FinishModerated ends an answer that content moderation stopped; the
+	// offending text was not sent.
+	FinishModerated = "moderated"
+)
+
+// Frame is one JSON message of ChatProtocolV1. Seq numbers the frames of a
+// conversation, starting at 1, so clients can detect gaps and resume after
+// the last one they received. Errors about a frame the client sent go to
+// that connection only and have no Seq.
+type Frame struct {
+	Type         string               `json:"type"`
+	ID           string               `json:"id,omitempty"`
+	ReplyTo      string               `json:"replyTo,omitempty"`
+	Seq          uint64               `json:"seq,omitempty"`
+	Text         string               `json:"text,omitempty"`
+	FinishReason string               `json:"finishReason,omitempty"`
+	Code         httputil.Code        `json:"code,omitempty"`
+	Message      string               `json:"message,omitempty"`
+	Quota        *metering.QuotaError `json:"quota,omitempty"`
+}
+
+// errSlowConsumer is returned by frameConn.send when the client fell too
+// far behind.
+var errSlowConsumer = errors.New("slow consumer")
+
+// frameConn queues the frames the server writes on one connection and
+// writes them in order, so a slow client holds up neither its read loop nor
+// the conversation's other sockets.
+type frameConn struct {
+	conn     *websocket.Conn
+	timeout  time.Duration
+	limit    int
+	coalesce bool
+
+	mu    sync.Mutex
+	queue []Frame
+	wake  chan struct{}
+	done  chan struct{}
+}
+
+// newFrameConn starts writing frames to conn as configured by opts.
+func newFrameConn(conn *websocket.Conn, opts ChatOptions) *frameConn {
+	fc := &frameConn{
+		conn:     conn,
+		timeout:  opts.WriteTimeout,
+		limit:    opts.SendBuffer,
+		coalesce: opts.SlowConsumer == SlowConsumerCoalesce,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go fc.run()
+	return fc
+}
+
+// send queues f. When coalescing, an assistant_delta frame is merged into
+// the previous one still waiting to be written if it belongs to the same
+// answer; the merged frame takes the later Seq. send returns
+// errSlowConsumer when the queue is full.
+func (fc *frameConn) send(f Frame) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if n := len(fc.queue); fc.coalesce && n > 0 && f.Type == FrameAssistantDelta {
+		if last := &fc.queue[n-1]; last.Type == FrameAssistantDelta && last.ID == f.ID {
+			last.Text += f.Text
+			last.Seq = f.Seq
+			return nil
+		}
+	}
+	if len(fc.queue) >= fc.limit {
+		return errSlowConsumer
+	}
+	fc.queue = append(fc.queue, f)
+	select {
+	case fc.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// run writes the queued frames until close is called. A failed write closes
+// the connection.
+func (fc *frameConn) run() {
+	for {
+		select {
+		case <-fc.done:
+			return
+		case <-fc.wake:
+		}
+		for {
+			fc.mu.Lock()
+			if len(fc.queue) == 0 {
+				fc.mu.Unlock()
+				break
+			}
+			f := fc.queue[0]
+			fc.queue = fc.queue[1:]
+			fc.mu.Unlock()
+			fc.conn.SetWriteDeadline(time.Now().Add(fc.timeout))
+			if err := fc.conn.WriteJSON(f); err != nil {
+				fc.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// close stops writing; frames still queued are dropped.
+func (fc *frameConn) close() {
+	close(fc.done)
+}
+
+// sendEvent queues the frame published as ev, numbered with its sequence
+// number.
+func (fc *frameConn) sendEvent(ev store.ChatEvent) error {
+	var f Frame
+	if err := json.Unmarshal(ev.Data, &f); err != nil {
+		return err
+	}
+	f.Seq = ev.Seq
+	return fc.send(f)
+}
+
+// sendError writes an error frame about message replyTo.
+func (fc *frameConn) sendError(replyTo string, code httputil.Code, message string) error {
+	return fc.send(Frame{Type: FrameError, ReplyTo: replyTo, Code: code, Message: message})
+}
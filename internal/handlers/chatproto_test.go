@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"matchmaker/internal/clients"
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/llm"
+	"matchmaker/internal/store"
+)
+
+func dialFrames(t *testing.T, url string) *websocket.Conn {
+	d := websocket.Dialer{Subprotocols: []string{ChatProtocolV1}}
+	ws, resp, err := d.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("Sec-WebSocket-Protocol") != ChatProtocolV1 {
+		t.Fatalf("subprotocol not negotiated: %q", resp.Header.Get("Sec-WebSocket-Protocol"))
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// readFrame reads the next frame and checks that sequence numbers increase
+// by one. Errors about the client's own frames are not numbered.
+func readFrame(t *testing.T, ws *websocket.Conn, lastSeq *uint64) Frame {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var f Frame
+	if err := ws.ReadJSON(&f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Seq == 0 && f.Type == FrameError && f.Code != httputil.CodeUpstream {
+		return f
+	}
+	if f.Seq != *lastSeq+1 {
+		t.Fatalf("expected seq %d, got %+v", *lastSeq+1, f)
+	}
+	*lastSeq = f.Seq
+	return f
+}
+
+func TestChatFrames(t *testing.T) {
+	t.Parallel()
+	history := store.NewMemoryChatHistory()
+	url := serveChat(t, NewChat(history, store.NewMemoryChatTranscripts(), store.NewMemoryChatBus(), &llm.Fake{Reply: "hi there"}, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{}))
+	ws := dialFrames(t, url)
+	var seq uint64
+
+	ws.WriteJSON(Frame{Type: FrameUserMessage, ID: "m1", Text: "hello"})
+	if f := readFrame(t, ws, &seq); f.Type != FrameTyping || f.ReplyTo != "m1" {
+		t.Fatalf("expected typing, got %+v", f)
+	}
+	var text strings.Builder
+	var replyID string
+	for {
+		f := readFrame(t, ws, &seq)
+		if f.Type == FrameAssistantDone {
+			if f.FinishReason != FinishStop || f.ID != replyID || f.ReplyTo != "m1" {
+				t.Fatalf("unexpected done %+v", f)
+			}
+			break
+		}
+		if f.Type != FrameAssistantDelta || f.ReplyTo != "m1" || f.ID == "" {
+			t.Fatalf("unexpected frame %+v", f)
+		}
+		replyID = f.ID
+		text.WriteString(f.Text)
+	}
+	if text.String() != "hi there" {
+		t.Fatalf("unexpected reply %q", text.String())
+	}
+
+	ws.WriteMessage(websocket.TextMessage, []byte("not json"))
+	if f := readFrame(t, ws, &seq); f.Type != FrameError || f.Code != httputil.CodeInvalidRequest {
+		t.Fatalf("expected invalid_request, got %+v", f)
+	}
+	ws.WriteJSON(Frame{Type: FrameUserMessage, ID: "m2"})
+	if f := readFrame(t, ws, &seq); f.Type != FrameError || f.Code != httputil.CodeValidationFailed || f.ReplyTo != "m2" {
+		t.Fatalf("expected validation_failed, got %+v", f)
+	}
+	if v := transcript(history, 1, ""); !strings.Contains(v, "assistant: hi there") {
+		t.Fatalf("history not stored: %q", v)
+	}
+}
+
+func TestChatFramesCancel(t *testing.T) {
+	t.Parallel()
+	history := store.NewMemoryChatHistory()
+	url := serveChat(t, NewChat(history, store.NewMemoryChatTranscripts(), store.NewMemoryChatBus(), &llm.Fake{Reply: "partial", Stall: true}, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{}))
+	ws := dialFrames(t, url)
+	var seq uint64
+
+	ws.WriteJSON(Frame{Type: FrameUserMessage, ID: "m1", Text: "tell me everything"})
+	readFrame(t, ws, &seq) // typing
+	if f := readFrame(t, ws, &seq); f.Type != FrameAssistantDelta || f.Text != "partial" {
+		t.Fatalf("expected delta, got %+v", f)
+	}
+	ws.WriteJSON(Frame{Type: FrameUserMessage, ID: "m2", Text: "and more"})
+	if f := readFrame(t, ws, &seq); f.Type != FrameError || f.Code != httputil.CodeConflict || f.ReplyTo != "m2" {
+		t.Fatalf("expected conflict while generating, got %+v", f)
+	}
+	ws.WriteJSON(Frame{Type: FrameCancel, ID: "m1"})
+	if f := readFrame(t, ws, &seq); f.Type != FrameAssistantDone || f.FinishReason != FinishCancelled {
+		t.Fatalf("expected cancelled done, got %+v", f)
+	}
+	if v := transcript(history, 1, ""); !strings.Contains(v, "assistant: partial") {
+		t.Fatalf("partial answer not stored: %q", v)
+	}
+
+	// the socket is ready for the next message
+	ws.WriteJSON(Frame{Type: FrameUserMessage, ID: "m3", Text: "again"})
+	if f := readFrame(t, ws, &seq); f.Type != FrameTyping || f.ReplyTo != "m3" {
+		t.Fatalf("expected typing, got %+v", f)
+	}
+}
+
+func TestChatFramesLLMFailure(t *testing.T) {
+	t.Parallel()
+	url := serveChat(t, NewChat(store.NewMemoryChatHistory(), store.NewMemoryChatTranscripts(), store.NewMemoryChatBus(), &llm.Fake{Err: errors.New("llm down")}, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{}))
+	ws := dialFrames(t, url)
+	var seq uint64
+
+	for _, id := range []string{"m1", "m2"} {
+		ws.WriteJSON(Frame{Type: FrameUserMessage, ID: id, Text: "hi"})
+		readFrame(t, ws, &seq) // typing
+		if f := readFrame(t, ws, &seq); f.Type != FrameError || f.Code != httputil.CodeUpstream || f.ReplyTo != id {
+			t.Fatalf("expected upstream error for %s, got %+v", id, f)
+		}
+	}
+}
+
+func TestChatFramesInterrupted(t *testing.T) {
+	t.Parallel()
+	for name, tc := range map[string]struct {
+		err  error
+		code httputil.Code
+	}{
+		"stream error": {io.ErrUnexpectedEOF, httputil.CodeUpstream},
+		"timeout":      {llm.ErrTimeout, httputil.CodeTimeout},
+	} {
+		client := &llm.Fake{Reply: "Your moons", StreamErr: tc.err}
+		ws := dialFrames(t, serveChat(t, NewChat(store.NewMemoryChatHistory(), store.NewMemoryChatTranscripts(), store.NewMemoryChatBus(), client, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{})))
+		var seq uint64
+
+		for _, id := range []string{"m1", "m2"} {
+			ws.WriteJSON(Frame{Type: FrameUserMessage, ID: id, Text: "hi"})
+			readFrame(t, ws, &seq) // typing
+			delta := readFrame(t, ws, &seq)
+			if delta.Type != FrameAssistantDelta || delta.Text != client.Reply {
+				t.Fatalf("%s: expected the partial reply, got %+v", name, delta)
+			}
+			if f := readFrame(t, ws, &seq); f.Type != FrameError || f.Code != tc.code || f.ReplyTo != id || f.ID != delta.ID {
+				t.Fatalf("%s: expected %s about reply %s, got %+v", name, tc.code, delta.ID, f)
+			}
+		}
+	}
+}
+
+func TestChatFramesAcrossReplicas(t *testing.T) {
+	t.Parallel()
+	history := store.NewMemoryChatHistory()
+	transcripts := store.NewMemoryChatTranscripts()
+	bus := store.NewMemoryChatBus()
+	client := &llm.Fake{Reply: "partial", Stall: true}
+	replica := func() string {
+		return serveChat(t, NewChat(history, transcripts, bus, client, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{}))
+	}
+	url1, url2 := replica(), replica()
+	ws1, ws2 := dialFrames(t, url1), dialFrames(t, url2)
+	var seq1, seq2 uint64
+
+	// An answer asked on one replica reaches the user's socket on the other.
+	ws1.WriteJSON(Frame{Type: FrameUserMessage, ID: "m1", Text: "tell me everything"})
+	for _, read := range []func() Frame{
+		func() Frame { return readFrame(t, ws1, &seq1) },
+		func() Frame { return readFrame(t, ws2, &seq2) },
+	} {
+		if f := read(); f.Type != FrameTyping || f.ReplyTo != "m1" {
+			t.Fatalf("expected typing, got %+v", f)
+		}
+		if f := read(); f.Type != FrameAssistantDelta || f.Text != "partial" {
+			t.Fatalf("expected delta, got %+v", f)
+		}
+	}
+
+	// One answer at a time per conversation, whichever replica is asked.
+	ws2.WriteJSON(Frame{Type: FrameUserMessage, ID: "m2", Text: "and more"})
+	if f := readFrame(t, ws2, &seq2); f.Type != FrameError || f.Code != httputil.CodeConflict {
+		t.Fatalf("expected conflict, got %+v", f)
+	}
+
+	// Either socket can cancel it.
+	ws2.WriteJSON(Frame{Type: FrameCancel})
+	for _, f := range []Frame{readFrame(t, ws1, &seq1), readFrame(t, ws2, &seq2)} {
+		if f.Type != FrameAssistantDone || f.FinishReason != FinishCancelled {
+			t.Fatalf("expected cancelled done, got %+v", f)
+		}
+	}
+
+	// A client reconnecting with the last sequence number it saw gets the
+	// frames it missed.
+	d := websocket.Dialer{Subprotocols: []string{ChatProtocolV1}}
+	ws3, _, err := d.Dial(url2+"?lastSeq=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws3.Close()
+	seq3 := uint64(1)
+	if f := readFrame(t, ws3, &seq3); f.Type != FrameAssistantDelta || f.Text != "partial" {
+		t.Fatalf("expected replayed delta, got %+v", f)
+	}
+	if f := readFrame(t, ws3, &seq3); f.Type != FrameAssistantDone {
+		t.Fatalf("expected replayed done, got %+v", f)
+	}
+}
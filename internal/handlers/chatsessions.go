@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/llm"
+	"matchmaker/internal/logging"
+	"matchmaker/internal/models"
+	"matchmaker/internal/store"
+)
+
+// ChatSessionPage is one page of a user's chat sessions, most recently
+// active first.
+type ChatSessionPage struct {
+	Items  []models.ChatSession `json:"items"`
+	Total  int64                `json:"total"`
+	Offset int                  `json:"offset"`
+	Limit  int                  `json:"limit"`
+}
+
+// TranscriptPage is one page of the messages of a chat session, oldest
+// first.
+type TranscriptPage struct {
+	Session models.ChatSession         `json:"session"`
+	Items   []models.TranscriptMessage `json:"items"`
+	Total   int64                      `json:"total"`
+	Offset  int                        `json:"offset"`
+	Limit   int                        `json:"limit"`
+}
+
+// TranscriptExport is a whole chat session, as exported in JSON.
+type TranscriptExport struct {
+	Session  models.ChatSession         `json:"session"`
+	Messages []models.TranscriptMessage `json:"messages"`
+}
+
+// Export formats of GET /api/v1/chat/sessions/{id}/export.
+const (
+	ExportMarkdown = "markdown"
+	ExportJSON     = "json"
+)
+
+// maxTitleLength bounds session titles, which are taken from the first
+// question.
+const maxTitleLength = 80
+
+// sessionTitle shortens text to a session title, cutting at a word
+// boundary.
+func sessionTitle(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= maxTitleLength {
+		return text
+	}
+	cut := string([]rune(text)[:maxTitleLength])
+	if i := strings.LastIndex(cut, " "); i > maxTitleLength/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// ListSessions handles GET /api/v1/chat/sessions.
+func (h *Chat) ListSessions(c *gin.Context) {
+	offset, limit := pageParams(c)
+	items, total, err := h.transcripts.ListSessions(c.Request.Context(), c.GetUint("user_id"), offset, limit)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to list chat sessions")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	c.JSON(http.StatusOK, ChatSessionPage{Items: items, Total: total, Offset: offset, Limit: limit})
+}
+
+// Transcript handles GET /api/v1/chat/sessions/{id}/messages.
+func (h *Chat) Transcript(c *gin.Context) {
+	sess, ok := h.ownedSession(c)
+	if !ok {
+		return
+	}
+	offset, limit := pageParams(c)
+	items, err := h.transcripts.Messages(c.Request.Context(), sess.ID, offset, limit)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to load chat transcript")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	c.JSON(http.StatusOK, TranscriptPage{Session: *sess, Items: items, Total: sess.MessageCount, Offset: offset, Limit: limit})
+}
+
+// DeleteSession handles DELETE /api/v1/chat/sessions/{id}. The assistant
+// forgets the conversation too.
+func (h *Chat) DeleteSession(c *gin.Context) {
+	sess, ok := h.ownedSession(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	if err := h.transcripts.DeleteSession(ctx, sess.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+		logging.FromContext(c).WithError(err).Error("failed to delete chat session")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	if err := h.history.Delete(ctx, sess.UserID, sess.AnalysisID); err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to delete chat memory")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Export handles GET /api/v1/chat/sessions/{id}/export, returning the whole
+// transcript as a Markdown or JSON attachment. Without a format query
+// parameter, JSON is returned to clients that accept it.
+func (h *Chat) Export(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = ExportMarkdown
+		if strings.Contains(c.GetHeader("Accept"), "application/json") {
+			format = ExportJSON
+		}
+	}
+	if format != ExportMarkdown && format != ExportJSON {
+		e := httputil.New(httputil.CodeValidationFailed, "invalid request")
+		e.Details = []httputil.FieldError{{Field: "format", Code: "invalid", Message: "must be one of markdown, json"}}
+		httputil.WriteError(c, e)
+		return
+	}
+	sess, ok := h.ownedSession(c)
+	if !ok {
+		return
+	}
+	msgs, err := h.transcripts.Messages(c.Request.Context(), sess.ID, 0, 0)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to load chat transcript")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	name := "chat-" + sess.ID
+	if format == ExportJSON {
+		c.Header("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		c.JSON(http.StatusOK, TranscriptExport{Session: *sess, Messages: msgs})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+name+`.md"`)
+	c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(transcriptMarkdown(sess, msgs)))
+}
+
+// transcriptMarkdown renders a session as a Markdown document.
+func transcriptMarkdown(sess *models.ChatSession, msgs []models.TranscriptMessage) string {
+	var b strings.Builder
+	title := sess.Title
+	if title == "" {
+		title = "Chat"
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	if sess.AnalysisID != "" {
+		fmt.Fprintf(&b, "About analysis `%s`.\n\n", sess.AnalysisID)
+	}
+	fmt.Fprintf(&b, "Started %s.\n", sess.CreatedAt.UTC().Format(time.RFC1123))
+	for _, m := range msgs {
+		speaker := "You"
+		if m.Role == llm.RoleAssistant {
+			speaker = "Assistant"
+		}
+		fmt.Fprintf(&b, "\n**%s** · %s\n\n%s\n", speaker, m.At.UTC().Format("2006-01-02 15:04 MST"), strings.TrimSpace(m.Content))
+	}
+	return b.String()
+}
+
+// ownedSession loads the session named by the id path parameter, answering
+// 404 when it does not belong to the caller.
+func (h *Chat) ownedSession(c *gin.Context) (*models.ChatSession, bool) {
+	sess, err := h.transcripts.GetSession(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, store.ErrNotFound) || (err == nil && sess.UserID != c.GetUint("user_id")) {
+		httputil.Fail(c, httputil.CodeNotFound, "chat session not found")
+		return nil, false
+	}
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to fetch chat session")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return nil, false
+	}
+	return sess, true
+}
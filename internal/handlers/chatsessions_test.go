@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"matchmaker/internal/clients"
+	"matchmaker/internal/llm"
+	"matchmaker/internal/store"
+)
+
+func TestChatSessions(t *testing.T) {
+	t.Parallel()
+	history := store.NewMemoryChatHistory()
+	transcripts := store.NewMemoryChatTranscripts()
+	h := NewChat(history, transcripts, store.NewMemoryChatBus(), &llm.Fake{Reply: "hi"}, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{})
+	url := serveChat(t, h)
+
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	for _, q := range []string{"hello", "how are we matched?"} {
+		ws.WriteMessage(websocket.TextMessage, []byte(q))
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := ws.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if c.GetHeader("X-User") == "2" {
+			c.Set("user_id", uint(2))
+		} else {
+			c.Set("user_id", uint(1))
+		}
+	})
+	r.GET("/chat/sessions", h.ListSessions)
+	r.GET("/chat/sessions/:id/messages", h.Transcript)
+	r.GET("/chat/sessions/:id/export", h.Export)
+	r.DELETE("/chat/sessions/:id", h.DeleteSession)
+	do := func(method, path, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/chat/sessions", "1")
+	var sessions ChatSessionPage
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &sessions) != nil || sessions.Total != 1 {
+		t.Fatalf("unexpected sessions %d %s", w.Code, w.Body)
+	}
+	sess := sessions.Items[0]
+	if sess.Title != "hello" || sess.MessageCount != 4 {
+		t.Fatalf("unexpected session %+v", sess)
+	}
+	if w := do(http.MethodGet, "/chat/sessions", "2"); !strings.Contains(w.Body.String(), `"total":0`) {
+		t.Fatalf("sessions of another user listed: %s", w.Body)
+	}
+
+	w = do(http.MethodGet, "/chat/sessions/"+sess.ID+"/messages?offset=2&limit=1", "1")
+	var page TranscriptPage
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &page) != nil {
+		t.Fatalf("unexpected transcript %d %s", w.Code, w.Body)
+	}
+	if page.Total != 4 || len(page.Items) != 1 || page.Items[0].Seq != 3 || page.Items[0].Content != "how are we matched?" {
+		t.Fatalf("unexpected page %+v", page)
+	}
+
+	w = do(http.MethodGet, "/chat/sessions/"+sess.ID+"/export", "1")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/markdown") ||
+		!strings.Contains(w.Body.String(), "# hello") || !strings.Contains(w.Body.String(), "**Assistant**") {
+		t.Fatalf("unexpected markdown export %d %s", w.Code, w.Body)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="chat-`+sess.ID+`.md"` {
+		t.Fatalf("unexpected disposition %q", cd)
+	}
+	w = do(http.MethodGet, "/chat/sessions/"+sess.ID+"/export?format=json", "1")
+	var export TranscriptExport
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &export) != nil || len(export.Messages) != 4 {
+		t.Fatalf("unexpected json export %d %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, "/chat/sessions/"+sess.ID+"/export?format=pdf", "1"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown format, got %d", w.Code)
+	}
+
+	for _, path := range []string{"/messages", "/export"} {
+		if w := do(http.MethodGet, "/chat/sessions/"+sess.ID+path, "2"); w.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for another user's session, got %d", w.Code)
+		}
+	}
+	if w := do(http.MethodDelete, "/chat/sessions/"+sess.ID, "2"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 deleting another user's session, got %d", w.Code)
+	}
+
+	if w := do(http.MethodDelete, "/chat/sessions/"+sess.ID, "1"); w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected delete status %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/chat/sessions/"+sess.ID+"/messages", "1"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", w.Code)
+	}
+	if mem, _ := history.Get(context.Background(), 1, ""); len(mem.Messages) != 0 {
+		t.Fatalf("memory kept after delete: %+v", mem)
+	}
+}
+
+func TestChatMemoryFromTranscript(t *testing.T) {
+	t.Parallel()
+	history := store.NewMemoryChatHistory()
+	client := &llm.Fake{Reply: "hi"}
+	url := serveChat(t, NewChat(history, store.NewMemoryChatTranscripts(), store.NewMemoryChatBus(), client, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{}))
+
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ask := func(q string) {
+		ws.WriteMessage(websocket.TextMessage, []byte(q))
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := ws.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	ask("hello")
+	// The memory expires; the transcript is kept.
+	history.Delete(context.Background(), 1, "")
+	ask("again")
+
+	r := client.Requests()
+	if len(r) != 2 || len(r[1].Messages) != 3 || r[1].Messages[0].Content != "hello" {
+		t.Fatalf("conversation not restored from the transcript: %+v", r)
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"matchmaker/internal/llm"
+	"matchmaker/internal/logging"
+	"matchmaker/internal/models"
+)
+
+// Tools the assistant may call while answering.
+const (
+	ToolGetReport    = "get_report"
+	ToolRunAnalysis  = "run_analysis"
+	ToolGetMyProfile = "get_my_profile"
+)
+
+// maxToolRounds bounds the completions of one answer. The last one is
+// offered no tools, so the model has to answer with what it has.
+const maxToolRounds = 4
+
+// birthSchema is the JSON Schema of a person's birth details.
+const birthSchema = `{"type":"object","properties":{` +
+	`"dob":{"type":"string","description":"Date of birth, YYYY-MM-DD"},` +
+	`"tob":{"type":"string","description":"Local time of birth, HH:MM"},` +
+	`"lat":{"type":"number","description":"Latitude of the place of birth"},` +
+	`"lon":{"type":"number","description":"Longitude of the place of birth"}},` +
+	`"required":["dob","tob"]}`
+
+// chatToolDefs describes the tools to the model.
+var chatToolDefs = []llm.Tool{
+	{
+		Name:        ToolGetReport,
+		Description: "Fetch the Vedic astrology report of a birth chart.",
+		Parameters:  json.RawMessage(birthSchema),
+	},
+	{
+		Name:        ToolRunAnalysis,
+		Description: "Run an Ashtakoota compatibility analysis of two people and save it to the user's analyses.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"personA":` + birthSchema + `,"personB":` + birthSchema + `},"required":["personA","personB"]}`),
+	},
+	{
+		Name:        ToolGetMyProfile,
+		Description: "Read the profile of the user, including their birth details when they have saved them.",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{}}`),
+	},
+}
+
+// ChatTools lets the assistant fetch reports, run analyses and read the
+// profile of the user it talks to. Tools always act as that user: analyses
+// are saved to their account and only their own profile can be read.
+type ChatTools struct {
+	reports  ReportFetcher
+	analyses AnalysisRunner
+	users    UserLoader
+}
+
+// NewChatTools returns tools backed by the report, match and user services.
+func NewChatTools(reports ReportFetcher, analyses AnalysisRunner, users UserLoader) *ChatTools {
+	return &ChatTools{reports: reports, analyses: analyses, users: users}
+}
+
+// toolProfile is the profile get_my_profile returns.
+type toolProfile struct {
+	Email        string        `json:"email"`
+	Gender       string        `json:"gender,omitempty"`
+	Location     string        `json:"location,omitempty"`
+	Plan         string        `json:"plan,omitempty"`
+	BirthDetails *BirthDetails `json:"birthDetails,omitempty"`
+}
+
+// call runs c for userID and returns its result as JSON. Failures are
+// results too, {"error": ...}, so that the model can explain them.
+func (t *ChatTools) call(ctx context.Context, userID uint, c llm.ToolCall) string {
+	start := time.Now()
+	out, err := t.run(ctx, userID, c)
+	log := logging.FromContext(ctx).WithField("user_id", userID).WithField("tool", c.Name).WithField("duration", time.Since(start))
+	if err != nil {
+		log.WithError(err).Warn("chat tool failed")
+		b, _ := json.Marshal(map[string]string{"error": toolError(err)})
+		return string(b)
+	}
+	log.Info("chat tool called")
+	return string(out)
+}
+
+// errToolArgs marks arguments the model got wrong.
+var errToolArgs = errors.New("invalid arguments")
+
+func (t *ChatTools) run(ctx context.Context, userID uint, c llm.ToolCall) ([]byte, error) {
+	switch c.Name {
+	case ToolGetReport:
+		var bd BirthDetails
+		if err := toolArgs(c, &bd); err != nil {
+			return nil, err
+		}
+		if err := checkBirth("", bd); err != nil {
+			return nil, err
+		}
+		report, err := t.reports.FetchReport(ctx, bd)
+		if err != nil {
+			return nil, err
+		}
+		if len(report) > maxPromptReport || !json.Valid(report) {
+			if len(report) > maxPromptReport {
+				report = report[:maxPromptReport]
+			}
+			return json.Marshal(map[string]string{"report": string(report)})
+		}
+		return report, nil
+	case ToolRunAnalysis:
+		var req AnalysisRequest
+		if err := toolArgs(c, &req); err != nil {
+			return nil, err
+		}
+		if err := checkBirth("personA.", req.PersonA); err != nil {
+			return nil, err
+		}
+		if err := checkBirth("personB.", req.PersonB); err != nil {
+			return nil, err
+		}
+		a, err := t.analyses.RunAnalysis(ctx, userID, req)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(a)
+	case ToolGetMyProfile:
+		u, err := t.users.LoadUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(profileOf(u))
+	}
+	return nil, fmt.Errorf("%w: unknown tool %q", errToolArgs, c.Name)
+}
+
+// toolArgs decodes the arguments of c into v.
+func toolArgs(c llm.ToolCall, v interface{}) error {
+	if err := json.Unmarshal(c.Arguments, v); err != nil {
+		return fmt.Errorf("%w: %v", errToolArgs, err)
+	}
+	return nil
+}
+
+// checkBirth reports the missing fields of bd, named with prefix.
+func checkBirth(prefix string, bd BirthDetails) error {
+	var missing []string
+	if bd.DOB == "" {
+		missing = append(missing, prefix+"dob")
+	}
+	if bd.TOB == "" {
+		missing = append(missing, prefix+"tob")
+	}
+	if missing != nil {
+		return fmt.Errorf("%w: %s required", errToolArgs, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// toolError is what the model is told about err. Only argument errors are
+// detailed; the others may hold internal addresses.
+func toolError(err error) string {
+	switch {
+	case errors.Is(err, errToolArgs):
+		return err.Error()
+	case isNotFound(err):
+		return "not found"
+	}
+	return "the service is unavailable; try again later"
+}
+
+// profileOf is the profile of u shown to the model.
+func profileOf(u *models.User) toolProfile {
+	p := toolProfile{Email: u.Email, Gender: u.Gender, Location: u.Location, Plan: u.Plan}
+	if b := u.BirthDetail; !b.DOB.IsZero() {
+		p.BirthDetails = &BirthDetails{DOB: b.DOB.Format("2006-01-02"), TOB: b.TOB, Lat: b.Latitude, Lon: b.Longitude}
+	}
+	return p
+}
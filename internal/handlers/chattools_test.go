@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"matchmaker/internal/clients"
+	"matchmaker/internal/llm"
+	"matchmaker/internal/models"
+	"matchmaker/internal/store"
+)
+
+func TestChatTools(t *testing.T) {
+	t.Parallel()
+	client := &llm.Fake{Reply: "You are a good match.", ToolCalls: []llm.ToolCall{
+		{ID: "c1", Name: ToolGetMyProfile, Arguments: json.RawMessage(`{}`)},
+		{ID: "c2", Name: ToolRunAnalysis, Arguments: json.RawMessage(`{"personA":{"dob":"1990-01-02","tob":"10:30"},"personB":{"dob":"1991-03-04","tob":"08:15"}}`)},
+		{ID: "c3", Name: ToolGetReport, Arguments: json.RawMessage(`{"dob":"1990-01-02"}`)},
+		{ID: "c4", Name: ToolGetReport, Arguments: json.RawMessage(`{"dob":"1990-01-02","tob":"10:30"}`)},
+	}}
+	user := &models.User{Email: "asha@example.com", Plan: "pro", BirthDetail: models.BirthDetail{
+		DOB: time.Date(1990, 1, 2, 0, 0, 0, 0, time.UTC), TOB: "10:30:00", Latitude: 12.97, Longitude: 77.59,
+	}}
+	user.ID = 1
+	other := &models.User{Email: "other@example.com"}
+	other.ID = 2
+	users := &clients.FakeUsers{Profiles: map[uint]*models.User{1: user, 2: other}}
+	match := &clients.FakeMatch{Result: clients.AnalysisResult{ID: "a9", Score: 81}}
+	reports := &clients.FakeReports{Default: []byte(`{"moon":"rohini"}`)}
+	tools := NewChatTools(reports, match, users)
+	transcripts := store.NewMemoryChatTranscripts()
+	url := serveChat(t, NewChat(store.NewMemoryChatHistory(), transcripts, store.NewMemoryChatBus(), client, match, reports, ChatOptions{Tools: tools}))
+	ws := dialFrames(t, url)
+	var seq uint64
+
+	ws.WriteJSON(Frame{Type: FrameUserMessage, ID: "m1", Text: "Am I compatible with someone born 1991-03-04 at 08:15?"})
+	var shown strings.Builder
+	var f Frame
+	for f = readFrame(t, ws, &seq); f.Type != FrameAssistantDone; f = readFrame(t, ws, &seq) {
+		shown.WriteString(f.Text)
+	}
+	if f.FinishReason != FinishStop || shown.String() != client.Reply {
+		t.Fatalf("unexpected answer %q %+v", shown.String(), f)
+	}
+
+	reqs := client.Requests()
+	if len(reqs) != 2 || len(reqs[0].Tools) != 3 {
+		t.Fatalf("expected a tool round and an answer, got %+v", reqs)
+	}
+	msgs := reqs[1].Messages
+	if len(msgs) != 6 || msgs[1].Role != llm.RoleAssistant || len(msgs[1].ToolCalls) != 4 {
+		t.Fatalf("calls not sent back: %+v", msgs)
+	}
+	results := map[string]map[string]interface{}{}
+	for _, m := range msgs[2:] {
+		var r map[string]interface{}
+		if m.Role != llm.RoleTool || json.Unmarshal([]byte(m.Content), &r) != nil {
+			t.Fatalf("unexpected result %+v", m)
+		}
+		results[m.ToolCallID] = r
+	}
+	if p := results["c1"]; p["email"] != user.Email || p["birthDetails"].(map[string]interface{})["dob"] != "1990-01-02" {
+		t.Fatalf("profile of another user: %v", p)
+	}
+	if a := results["c2"]; a["analysisId"] != "a9" || a["score"] != float64(81) {
+		t.Fatalf("unexpected analysis %v", a)
+	}
+	if stored, err := match.LoadAnalysis(context.Background(), 1, "a9"); err != nil || stored.Score != 81 {
+		t.Fatalf("analysis not saved for the caller: %v %v", stored, err)
+	}
+	if e := results["c3"]["error"]; e != "invalid arguments: tob required" {
+		t.Fatalf("missing argument not reported: %v", results["c3"])
+	}
+	if r := results["c4"]; r["moon"] != "rohini" {
+		t.Fatalf("unexpected report %v", r)
+	}
+
+	// Only the question and the answer are remembered.
+	sess, _ := transcripts.FindSession(context.Background(), 1, "")
+	var transcript []models.TranscriptMessage
+	for deadline := time.Now().Add(time.Second); len(transcript) < 2 && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		transcript, _ = transcripts.Messages(context.Background(), sess.ID, 0, 0)
+	}
+	if len(transcript) != 2 || transcript[1].Content != client.Reply {
+		t.Fatalf("unexpected transcript %+v", transcript)
+	}
+}
+
+func TestChatToolErrors(t *testing.T) {
+	t.Parallel()
+	tools := NewChatTools(&clients.FakeReports{}, &clients.FakeMatch{}, &clients.FakeUsers{})
+	for name, tc := range map[string]struct {
+		call llm.ToolCall
+		want string
+	}{
+		"unknown tool":      {llm.ToolCall{Name: "delete_account", Arguments: json.RawMessage(`{}`)}, `{"error":"invalid arguments: unknown tool \"delete_account\""}`},
+		"malformed":         {llm.ToolCall{Name: ToolGetReport, Arguments: json.RawMessage(`[]`)}, "invalid arguments"},
+		"missing people":    {llm.ToolCall{Name: ToolRunAnalysis, Arguments: json.RawMessage(`{"personA":{"dob":"1990-01-02","tob":"10:30"}}`)}, "personB.dob, personB.tob required"},
+		"profile not found": {llm.ToolCall{Name: ToolGetMyProfile, Arguments: json.RawMessage(`{}`)}, `{"error":"not found"}`},
+	} {
+		if got := tools.call(context.Background(), 5, tc.call); !strings.Contains(got, tc.want) {
+			t.Errorf("%s: got %s, want %s", name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+
+	"matchmaker/internal/models"
+)
+
+// ReportFetcher returns the raw astrology report for a set of birth details.
+// The match service uses it to reach the report service, either over HTTP
+// through *clients.ReportClient or in-process through *Reports when both run
+// in the same binary.
+type ReportFetcher interface {
+	FetchReport(ctx context.Context, bd BirthDetails) ([]byte, error)
+}
+
+// UserRegistrar finds or creates a user by email and returns its ID, and
+// loads the user's preferences. The auth service uses it to reach the user
+// service, through *clients.UserClient or in-process through *Users.
+type UserRegistrar interface {
+	RegisterUser(ctx context.Context, email, name string) (uint, error)
+	UserLoader
+}
+
+// AnalysisLoader returns a stored analysis if it belongs to userID, failing
+// with store.ErrNotFound or a not_found *clients.APIError otherwise. The chat
+// service uses it to reach the match service, through *clients.MatchClient or
+// in-process through *Analysis.
+type AnalysisLoader interface {
+	LoadAnalysis(ctx context.Context, userID uint, id string) (*models.Analysis, error)
+}
+
+// ReportLoader returns a cached report by its key, through
+// *clients.ReportClient or in-process through *Reports.
+type ReportLoader interface {
+	LoadReport(ctx context.Context, key string) ([]byte, error)
+}
+
+// AnalysisRunner analyses a pair of birth details and stores the result for
+// userID. The chat service uses it to run analyses the user asks for,
+// through *clients.MatchClient or in-process through *Analysis.
+type AnalysisRunner interface {
+	RunAnalysis(ctx context.Context, userID uint, req AnalysisRequest) (*models.Analysis, error)
+}
+
+// UserLoader returns a user's profile, failing with store.ErrNotFound or a
+// not_found *clients.APIError when there is none. The chat service uses it
+// through *clients.UserClient or in-process through *Users.
+type UserLoader interface {
+	LoadUser(ctx context.Context, id uint) (*models.User, error)
+}
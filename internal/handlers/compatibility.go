@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+
+	"matchmaker/internal/i18n"
+	"matchmaker/internal/models"
+)
+
+// Scoring algorithms recorded with each analysis.
+const (
+	// AshtakootaAlgorithm scores the eight kootas from each report's moon
+	// nakshatra and rashi.
+	AshtakootaAlgorithm = "ashtakoota-1"
+	// LegacyAlgorithm is used when a report carries no moon position.
+	LegacyAlgorithm = "report-length-1"
+)
+
+// Koota names, in classical order.
+const (
+	KootaVarna       = "varna"
+	KootaVashya      = "vashya"
+	KootaTara        = "tara"
+	KootaYoni        = "yoni"
+	KootaGrahaMaitri = "graha_maitri"
+	KootaGana        = "gana"
+	KootaBhakoot     = "bhakoot"
+	KootaNadi        = "nadi"
+)
+
+// kootaText holds the English label of each koota and what it measures;
+// the i18n catalogs translate them.
+var kootaText = map[string]struct{ label, about string }{
+	KootaVarna:       {"Varna", "Varna compares the spiritual development of the partners."},
+	KootaVashya:      {"Vashya", "Vashya measures mutual attraction and influence."},
+	KootaTara:        {"Tara", "Tara compares the birth stars for health and well-being."},
+	KootaYoni:        {"Yoni", "Yoni measures physical and intimate compatibility."},
+	KootaGrahaMaitri: {"Graha Maitri", "Graha Maitri measures the friendship between the lords of the moon signs."},
+	KootaGana:        {"Gana", "Gana compares temperament: divine, human or demonic."},
+	KootaBhakoot:     {"Bhakoot", "Bhakoot measures emotional bonding and family welfare from the moon signs."},
+	KootaNadi:        {"Nadi", "Nadi relates to health and children."},
+}
+
+// Verdicts on the points of a koota, appended to its explanation.
+const (
+	verdictFull    = "This factor is fully favourable."
+	verdictPartial = "This factor is partly favourable."
+	verdictNone    = "This factor is unfavourable."
+)
+
+// localized returns a copy of a whose breakdown is labelled and explained
+// in locale.
+func localized(a *models.Analysis, locale string) *models.Analysis {
+	out := *a
+	out.Breakdown = make([]models.Koota, len(a.Breakdown))
+	for i, k := range a.Breakdown {
+		if text, ok := kootaText[k.Name]; ok {
+			verdict := verdictPartial
+			switch k.Points {
+			case k.Max:
+				verdict = verdictFull
+			case 0:
+				verdict = verdictNone
+			}
+			k.Label = i18n.T(locale, text.label)
+			k.Explanation = i18n.T(locale, text.about) + " " + i18n.T(locale, verdict)
+		}
+		out.Breakdown[i] = k
+	}
+	return &out
+}
+
+// ashtakootaMax is the highest possible Ashtakoota total.
+const ashtakootaMax = 36
+
+// compatibility is the outcome of scoring two reports.
+type compatibility struct {
+	Score            int
+	Breakdown        []models.Koota
+	AlgorithmVersion string
+}
+
+// moonPosition is the part of an engine report the scorer reads. Nakshatra
+// is 1–27 (Ashwini–Revati) and rashi 1–12 (Aries–Pisces).
+type moonPosition struct {
+	Moon *struct {
+		Nakshatra int `json:"nakshatra"`
+		Rashi     int `json:"rashi"`
+	} `json:"moon"`
+}
+
+func parseMoon(report []byte) (nakshatra, rashi int, ok bool) {
+	var p moonPosition
+	if json.Unmarshal(report, &p) != nil || p.Moon == nil {
+		return 0, 0, false
+	}
+	if p.Moon.Nakshatra < 1 || p.Moon.Nakshatra > 27 || p.Moon.Rashi < 1 || p.Moon.Rashi > 12 {
+		return 0, 0, false
+	}
+	return p.Moon.Nakshatra - 1, p.Moon.Rashi - 1, true
+}
+
+// calculateCompatibility scores two reports with the Ashtakoota system when
+// both carry a moon position, and with the legacy report-length heuristic
+// otherwise. Score is the percentage of the maximum.
+func calculateCompatibility(repA, repB []byte) compatibility {
+	na, ra, okA := parseMoon(repA)
+	nb, rb, okB := parseMoon(repB)
+	if !okA || !okB {
+		return legacyCompatibility(repA, repB)
+	}
+	breakdown := []models.Koota{
+		{Name: KootaVarna, Points: varnaPoints(ra, rb), Max: 1},
+		{Name: KootaVashya, Points: vashyaPoints(ra, rb), Max: 2},
+		{Name: KootaTara, Points: taraPoints(na, nb), Max: 3},
+		{Name: KootaYoni, Points: yoniPoints(na, nb), Max: 4},
+		{Name: KootaGrahaMaitri, Points: grahaMaitriPoints(ra, rb), Max: 5},
+		{Name: KootaGana, Points: ganaPoints(na, nb), Max: 6},
+		{Name: KootaBhakoot, Points: bhakootPoints(ra, rb), Max: 7},
+		{Name: KootaNadi, Points: nadiPoints(na, nb), Max: 8},
+	}
+	var total float64
+	for _, k := range breakdown {
+		total += k.Points
+	}
+	return compatibility{
+		Score:            int(math.Round(total / ashtakootaMax * 100)),
+		Breakdown:        breakdown,
+		AlgorithmVersion: AshtakootaAlgorithm,
+	}
+}
+
+func legacyCompatibility(repA, repB []byte) compatibility {
+	diff := len(repA) - len(repB)
+	if diff < 0 {
+		diff = -diff
+	}
+	score := 100 - diff%100
+	if score < 0 {
+		score = 0
+	}
+	return compatibility{Score: score, Breakdown: []models.Koota{}, AlgorithmVersion: LegacyAlgorithm}
+}
+
+// Rashi attributes, indexed Aries–Pisces.
+var (
+	// varna: 3 Brahmin, 2 Kshatriya, 1 Vaishya, 0 Shudra.
+	rashiVarna = [12]int{2, 1, 0, 3, 2, 1, 0, 3, 2, 1, 0, 3}
+	// vashya: 0 quadruped, 1 human, 2 water, 3 wild, 4 insect.
+	rashiVashya = [12]int{0, 0, 1, 2, 3, 1, 1, 4, 1, 0, 1, 2}
+	rashiLord   = [12]planet{mars, venus, mercury, moon, sun, mercury, venus, mars, jupiter, saturn, saturn, jupiter}
+)
+
+// Nakshatra attributes, indexed Ashwini–Revati.
+var (
+	// gana: 0 Deva, 1 Manushya, 2 Rakshasa.
+	nakshatraGana = [27]int{0, 1, 2, 1, 0, 1, 0, 0, 2, 2, 1, 1, 0, 2, 0, 2, 0, 2, 2, 1, 1, 0, 2, 2, 1, 1, 0}
+	// nadi: 0 Adi, 1 Madhya, 2 Antya.
+	nakshatraNadi = [27]int{0, 1, 2, 2, 1, 0, 0, 1, 2, 2, 1, 0, 0, 1, 2, 2, 1, 0, 0, 1, 2, 2, 1, 0, 0, 1, 2}
+	nakshatraYoni = [27]yoni{horse, elephant, sheep, serpent, serpent, dog, cat, sheep, cat, rat, rat, cow, buffalo, tiger, buffalo, tiger, deer, deer, dog, monkey, mongoose, monkey, lion, horse, lion, cow, elephant}
+)
+
+type yoni int
+
+const (
+	horse yoni = iota
+	elephant
+	sheep
+	serpent
+	dog
+	cat
+	rat
+	cow
+	buffalo
+	tiger
+	deer
+	monkey
+	mongoose
+	lion
+)
+
+// yoniEnemy pairs the sworn-enemy yonis.
+var yoniEnemy = map[yoni]yoni{
+	horse: buffalo, buffalo: horse,
+	elephant: lion, lion: elephant,
+	sheep: monkey, monkey: sheep,
+	serpent: mongoose, mongoose: serpent,
+	dog: deer, deer: dog,
+	cat: rat, rat: cat,
+	cow: tiger, tiger: cow,
+}
+
+type planet int
+
+const (
+	sun planet = iota
+	moon
+	mars
+	mercury
+	jupiter
+	venus
+	saturn
+)
+
+// planetFriends and planetEnemies are the natural relationships; any other
+// pair is neutral.
+var (
+	planetFriends = map[planet][]planet{
+		sun:     {moon, mars, jupiter},
+		moon:    {sun, mercury},
+		mars:    {sun, moon, jupiter},
+		mercury: {sun, venus},
+		jupiter: {sun, moon, mars},
+		venus:   {mercury, saturn},
+		saturn:  {mercury, venus},
+	}
+	planetEnemies = map[planet][]planet{
+		sun:     {venus, saturn},
+		mars:    {mercury},
+		mercury: {moon},
+		jupiter: {mercury, venus},
+		venus:   {sun, moon},
+		saturn:  {sun, moon, mars},
+	}
+)
+
+// relation returns 1 when a regards b as a friend, -1 as an enemy and 0
+// otherwise.
+func relation(a, b planet) int {
+	for _, p := range planetFriends[a] {
+		if p == b {
+			return 1
+		}
+	}
+	for _, p := range planetEnemies[a] {
+		if p == b {
+			return -1
+		}
+	}
+	return 0
+}
+
+func varnaPoints(ra, rb int) float64 {
+	if rashiVarna[ra] >= rashiVarna[rb] {
+		return 1
+	}
+	return 0
+}
+
+func vashyaPoints(ra, rb int) float64 {
+	if rashiVashya[ra] == rashiVashya[rb] {
+		return 2
+	}
+	return 0
+}
+
+// taraPoints counts the nakshatras from each moon to the other; a count
+// falling on the 3rd, 5th or 7th tara is inauspicious.
+func taraPoints(na, nb int) float64 {
+	good := func(from, to int) bool {
+		switch ((to-from+27)%27 + 1) % 9 {
+		case 3, 5, 7:
+			return false
+		}
+		return true
+	}
+	var points float64
+	if good(na, nb) {
+		points += 1.5
+	}
+	if good(nb, na) {
+		points += 1.5
+	}
+	return points
+}
+
+func yoniPoints(na, nb int) float64 {
+	ya, yb := nakshatraYoni[na], nakshatraYoni[nb]
+	switch {
+	case ya == yb:
+		return 4
+	case yoniEnemy[ya] == yb:
+		return 0
+	}
+	return 2
+}
+
+func grahaMaitriPoints(ra, rb int) float64 {
+	a, b := rashiLord[ra], rashiLord[rb]
+	if a == b {
+		return 5
+	}
+	switch relation(a, b) + relation(b, a) {
+	case 2:
+		return 5
+	case 1:
+		return 4
+	case 0:
+		if relation(a, b) == 0 {
+			return 3
+		}
+		return 1
+	case -1:
+		return 0.5
+	}
+	return 0
+}
+
+func ganaPoints(na, nb int) float64 {
+	ga, gb := nakshatraGana[na], nakshatraGana[nb]
+	if ga > gb {
+		ga, gb = gb, ga
+	}
+	switch {
+	case ga == gb:
+		return 6
+	case ga == 0 && gb == 1:
+		return 5
+	case ga == 0 && gb == 2:
+		return 1
+	}
+	return 0
+}
+
+// bhakootPoints scores the distance between the moon signs; the 2/12, 5/9
+// and 6/8 placements score nothing.
+func bhakootPoints(ra, rb int) float64 {
+	switch (rb-ra+12)%12 + 1 {
+	case 2, 12, 5, 9, 6, 8:
+		return 0
+	}
+	return 7
+}
+
+// nadiPoints is all or nothing: partners of the same nadi score zero.
+func nadiPoints(na, nb int) float64 {
+	if nakshatraNadi[na] == nakshatraNadi[nb] {
+		return 0
+	}
+	return 8
+}
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"bytes"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"net/http"
 	stdproxy "net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -15,6 +19,7 @@ import (
 
 	"matchmaker/internal/httputil"
 	"matchmaker/internal/logging"
+	"matchmaker/internal/metrics"
 )
 
 // workerPool limits concurrent proxy requests.
@@ -36,7 +41,12 @@ func newWorkerPool(n int) *workerPool {
 
 func (p *workerPool) Do(fn func()) {
 	done := make(chan struct{})
-	p.jobs <- func() { fn(); close(done) }
+	metrics.GatewayQueueDepth.Inc()
+	p.jobs <- func() {
+		metrics.GatewayQueueDepth.Dec()
+		fn()
+		close(done)
+	}
 	<-done
 }
 
@@ -46,33 +56,52 @@ type Gateway struct {
 	user  *stdproxy.ReverseProxy
 	match *stdproxy.ReverseProxy
 	chat  *stdproxy.ReverseProxy
-	key   *rsa.PublicKey
+	key   *rsa.PrivateKey
 	pool  *workerPool
 }
 
 // NewGateway constructs a Gateway using service URLs and RSA key.
 func NewGateway(authURL, userURL, matchURL, chatURL, pemKey string, workers int) (*Gateway, error) {
-	parse := func(u string) (*stdproxy.ReverseProxy, error) {
+	parse := func(name, u string) (*stdproxy.ReverseProxy, error) {
 		url, err := url.Parse(u)
 		if err != nil {
 			return nil, err
 		}
 		p := stdproxy.NewSingleHostReverseProxy(url)
+		p.ModifyResponse = func(resp *http.Response) error {
+			if resp.StatusCode >= http.StatusInternalServerError {
+				metrics.GatewayUpstreamErrors.WithLabelValues(name).Inc()
+			}
+			if resp.StatusCode >= http.StatusBadRequest {
+				return normalizeError(resp)
+			}
+			return nil
+		}
+		p.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			metrics.GatewayUpstreamErrors.WithLabelValues(name).Inc()
+			logging.FromContext(r.Context()).WithError(err).WithField("upstream", name).Error("proxy request failed")
+			e := httputil.New(httputil.CodeUpstream, name+" service unavailable")
+			e.RequestID = r.Header.Get(logging.RequestIDHeader)
+			contentType, body := httputil.Render(e, r)
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(e.Status)
+			w.Write(body)
+		}
 		return p, nil
 	}
-	auth, err := parse(authURL)
+	auth, err := parse("auth", authURL)
 	if err != nil {
 		return nil, err
 	}
-	user, err := parse(userURL)
+	user, err := parse("user", userURL)
 	if err != nil {
 		return nil, err
 	}
-	match, err := parse(matchURL)
+	match, err := parse("match", matchURL)
 	if err != nil {
 		return nil, err
 	}
-	chat, err := parse(chatURL)
+	chat, err := parse("chat", chatURL)
 	if err != nil {
 		return nil, err
 	}
@@ -86,11 +115,49 @@ func NewGateway(authURL, userURL, matchURL, chatURL, pemKey string, workers int)
 		return nil, err
 	}
 
-	return &Gateway{auth, user, match, chat, &key.PublicKey, newWorkerPool(workers)}, nil
+	return &Gateway{auth, user, match, chat, key, newWorkerPool(workers)}, nil
+}
+
+// maxErrorBody bounds how much of an upstream error body is read.
+const maxErrorBody = 1 << 20
+
+// normalizeError rewrites an upstream error response into the standard error
+// envelope, keeping its status, code and details when it already is one.
+func normalizeError(resp *http.Response) error {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	e, ok := httputil.Decode(resp.StatusCode, data)
+	if !ok {
+		e = &httputil.Error{Status: resp.StatusCode, Code: httputil.CodeForStatus(resp.StatusCode), Message: strings.ToLower(http.StatusText(resp.StatusCode))}
+	}
+	e.Status = resp.StatusCode
+	if e.RequestID == "" {
+		e.RequestID = resp.Header.Get(logging.RequestIDHeader)
+	}
+	if e.RequestID == "" && resp.Request != nil {
+		e.RequestID = resp.Request.Header.Get(logging.RequestIDHeader)
+	}
+	contentType, body := httputil.Render(e, resp.Request)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Content-Type", contentType)
+	resp.Header.Del("Content-Encoding")
+	return nil
 }
 
+// proxy serves requests through p on a gateway worker. Event streams stay
+// open until the upstream ends them, so they bypass the workers rather than
+// hold one each.
 func (g *Gateway) proxy(p *stdproxy.ReverseProxy) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+			p.ServeHTTP(c.Writer, c.Request)
+			return
+		}
 		g.pool.Do(func() { p.ServeHTTP(c.Writer, c.Request) })
 	}
 }
@@ -100,22 +167,75 @@ func (g *Gateway) JWTMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.GetHeader("Authorization")
 		if !strings.HasPrefix(auth, "Bearer ") {
-			httputil.AbortJSONError(c, http.StatusUnauthorized, "missing bearer token")
+			httputil.AbortWith(c, httputil.CodeUnauthenticated, "missing bearer token")
 			return
 		}
 		tokenStr := strings.TrimPrefix(auth, "Bearer ")
 		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			return g.key, nil
+			return &g.key.PublicKey, nil
 		})
 		if err != nil || !token.Valid {
-			logging.Log.WithError(err).Warn("jwt verification failed")
-			httputil.AbortJSONError(c, http.StatusUnauthorized, "invalid token")
+			logging.FromContext(c).WithError(err).Warn("jwt verification failed")
+			httputil.AbortWith(c, httputil.CodeUnauthenticated, "invalid token")
 			return
 		}
 		c.Next()
 	}
 }
 
+// RefreshedTokenHeader carries the token that replaces the caller's after a
+// change of their profile alters its claims.
+const RefreshedTokenHeader = "X-Refreshed-Token"
+
+// maxProfileBody bounds how much of a profile update RefreshLocale reads.
+const maxProfileBody = 64 << 10
+
+// RefreshLocale follows JWTMiddleware on PUT /api/v1/users/me. Services
+// answer in the locale claim of the token, so when the update changes the
+// locale and succeeds, the response carries the caller's token re-signed
+// with the new locale in RefreshedTokenHeader. The token keeps its expiry.
+// Other requests pass through.
+func (g *Gateway) RefreshLocale() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodPut || c.Request.URL.Path != "/api/v1/users/me" {
+			c.Next()
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxProfileBody))
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+		var req struct {
+			Locale string `json:"locale"`
+		}
+		claims, cerr := bearerToken(c)
+		if err != nil || cerr != nil || json.Unmarshal(body, &req) != nil || req.Locale == "" || claims["locale"] == req.Locale {
+			c.Next()
+			return
+		}
+		claims["locale"] = req.Locale
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(g.key)
+		if err != nil {
+			logging.FromContext(c).WithError(err).Error("failed to sign jwt")
+			c.Next()
+			return
+		}
+		c.Writer = &refreshWriter{ResponseWriter: c.Writer, token: signed}
+		c.Next()
+	}
+}
+
+// refreshWriter adds a refreshed token to successful responses.
+type refreshWriter struct {
+	gin.ResponseWriter
+	token string
+}
+
+func (w *refreshWriter) WriteHeader(code int) {
+	if code == http.StatusOK {
+		w.Header().Set(RefreshedTokenHeader, w.token)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
 func (g *Gateway) AuthHandler() gin.HandlerFunc  { return g.proxy(g.auth) }
 func (g *Gateway) UserHandler() gin.HandlerFunc  { return g.proxy(g.user) }
 func (g *Gateway) MatchHandler() gin.HandlerFunc { return g.proxy(g.match) }
@@ -4,13 +4,19 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/logging"
 )
 
 func genKey(t *testing.T) *rsa.PrivateKey {
@@ -22,7 +28,7 @@ func genKey(t *testing.T) *rsa.PrivateKey {
 }
 
 func TestGatewayUserProxy(t *testing.T) {
-	gin.SetMode(gin.TestMode)
+	t.Parallel()
 	key := genKey(t)
 	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
 
@@ -73,3 +79,152 @@ func TestGatewayUserProxy(t *testing.T) {
 		t.Fatalf("expected 401 got %d", resp.StatusCode)
 	}
 }
+
+func TestGatewayRefreshLocale(t *testing.T) {
+	t.Parallel()
+	key := genKey(t)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	gw, err := NewGateway("http://x", "http://y", "http://z", "http://w", string(pemKey), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _, user := newTestUsers(t)
+	r := gin.New()
+	r.PUT("/api/v1/users/me", gw.JWTMiddleware(), RequireUserID(), gw.RefreshLocale(), h.UpdateMe)
+	exp := time.Now().Add(time.Hour).Unix()
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"user_id": user.ID, "locale": "en", "exp": exp}).SignedString(key)
+	put := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/api/v1/users/me", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+signed)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// A new locale comes back in a token that keeps the expiry.
+	w := put(`{"locale":"hi"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(w.Header().Get(RefreshedTokenHeader), claims, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil }); err != nil {
+		t.Fatalf("refreshed token: %v", err)
+	}
+	if claims["locale"] != "hi" || claims["exp"] != float64(exp) || claims["user_id"] != float64(user.ID) {
+		t.Fatalf("unexpected claims %v", claims)
+	}
+
+	// Failed updates and ones that keep the locale leave the token alone.
+	for body, want := range map[string]int{`{"locale":"fr"}`: http.StatusBadRequest, `{"locale":"en"}`: http.StatusOK, `{"location":"LA"}`: http.StatusOK} {
+		if w := put(body); w.Code != want || w.Header().Get(RefreshedTokenHeader) != "" {
+			t.Errorf("%s: %d with token %q", body, w.Code, w.Header().Get(RefreshedTokenHeader))
+		}
+	}
+}
+
+func TestGatewayNormalizesUpstreamErrors(t *testing.T) {
+	t.Parallel()
+	key := genKey(t)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	userSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"user not found","code":"not_found"}`))
+			return
+		}
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer userSrv.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	gw, err := NewGateway("http://x", userSrv.URL, down.URL, "http://z", string(pemKey), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/missing", gw.UserHandler())
+	r.GET("/broken", gw.UserHandler())
+	r.POST("/analysis", gw.MatchHandler())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	cases := []struct {
+		method, path string
+		status       int
+		code         httputil.Code
+	}{
+		{"GET", "/missing", http.StatusNotFound, httputil.CodeNotFound},
+		{"GET", "/broken", http.StatusInternalServerError, httputil.CodeInternal},
+		{"POST", "/analysis", http.StatusBadGateway, httputil.CodeUpstream},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.method, srv.URL+tc.path, nil)
+		req.Header.Set(logging.RequestIDHeader, "rid")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var e httputil.Error
+		err = json.NewDecoder(resp.Body).Decode(&e)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: body is not an envelope: %v", tc.path, err)
+		}
+		if resp.StatusCode != tc.status || e.Code != tc.code || e.Message == "" || e.RequestID != "rid" {
+			t.Fatalf("%s: got %d %+v", tc.path, resp.StatusCode, e)
+		}
+	}
+}
+
+func TestGatewayEventStreams(t *testing.T) {
+	t.Parallel()
+	key := genKey(t)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	release := make(chan struct{})
+	matchSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("event:status\ndata:{}\n\n"))
+			w.(http.Flusher).Flush()
+			<-release
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer matchSrv.Close()
+	defer close(release)
+
+	gw, err := NewGateway("http://x", "http://y", matchSrv.URL, "http://z", string(pemKey), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/*path", gw.MatchHandler())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	// An open stream, flushed as it is written, leaves the only worker
+	// free for other requests.
+	req, _ := http.NewRequest("GET", srv.URL+"/events", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	buf := make([]byte, 64)
+	if n, err := stream.Body.Read(buf); err != nil || !strings.HasPrefix(string(buf[:n]), "event:status") {
+		t.Fatalf("stream: %q %v", buf[:n], err)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(srv.URL + "/ping")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("request during stream: %v %v", resp, err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/i18n"
+	"matchmaker/internal/logging"
+	"matchmaker/internal/metrics"
+	"matchmaker/internal/models"
+	"matchmaker/internal/store"
+)
+
+// JobStatus is the state of an analysis job. Once it has succeeded,
+// Analysis holds the result of an analysis job and Result that of a batch;
+// once it has failed, Error says why.
+type JobStatus struct {
+	JobID     string           `json:"jobId"`
+	Kind      string           `json:"kind"`
+	Status    string           `json:"status"`
+	Analysis  *models.Analysis `json:"analysis,omitempty"`
+	Result    *BatchResult     `json:"result,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
+
+// jobStatus returns the state of job with its result and error in locale.
+func jobStatus(job *models.AnalysisJob, locale string) (*JobStatus, error) {
+	s := &JobStatus{
+		JobID:     job.ID,
+		Kind:      job.Kind,
+		Status:    job.Status,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+	if job.Error != "" {
+		s.Error = i18n.T(locale, job.Error)
+	}
+	if len(job.Result) == 0 {
+		return s, nil
+	}
+	switch job.Kind {
+	case models.JobAnalysis:
+		var analysis models.Analysis
+		if err := json.Unmarshal(job.Result, &analysis); err != nil {
+			return nil, err
+		}
+		s.Analysis = localized(&analysis, locale)
+	case models.JobBatch:
+		var result BatchResult
+		if err := json.Unmarshal(job.Result, &result); err != nil {
+			return nil, err
+		}
+		s.Result = result.localized(locale)
+	}
+	return s, nil
+}
+
+// enqueue queues a job of kind running req for userID and answers with 202
+// and the job.
+func (a *Analysis) enqueue(c *gin.Context, userID uint, kind string, req any) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		httputil.Fail(c, httputil.CodeInternal, "internal error")
+		return
+	}
+	locale := i18n.RequestLocale(c.Request)
+	now := time.Now().UTC()
+	job := &models.AnalysisJob{
+		ID:        newID(),
+		UserID:    userID,
+		Kind:      kind,
+		Status:    models.JobQueued,
+		Locale:    locale,
+		Request:   body,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	log := logging.FromContext(c).WithField("job_id", job.ID).WithField("kind", kind)
+	if err := a.opts.Jobs.Put(c.Request.Context(), job); err != nil {
+		log.WithError(err).Error("failed to store analysis job")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	if err := a.opts.Queue.Push(c.Request.Context(), job.ID); err != nil {
+		log.WithError(err).Error("failed to queue analysis job")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	log.Info("analysis job queued")
+	status, _ := jobStatus(job, locale)
+	c.Header("Location", "/api/v1/analysis/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, status)
+}
+
+// Job handles GET /api/v1/analysis/jobs/:id. Jobs of other users are
+// reported as not found.
+func (a *Analysis) Job(c *gin.Context) {
+	job, ok := a.ownedJob(c)
+	if !ok {
+		return
+	}
+	status, err := jobStatus(job, i18n.RequestLocale(c.Request))
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to decode analysis job")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// JobEvents handles GET /api/v1/analysis/jobs/:id/events, a stream of
+// server-sent "status" events carrying the job each time its status
+// changes. The stream ends once the job has finished, or after JobTimeout;
+// clients still waiting then reconnect.
+func (a *Analysis) JobEvents(c *gin.Context) {
+	job, ok := a.ownedJob(c)
+	if !ok {
+		return
+	}
+	log := logging.FromContext(c).WithField("job_id", job.ID)
+	locale := i18n.RequestLocale(c.Request)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), a.opts.JobTimeout)
+	defer cancel()
+	// The server's write timeout would cut the stream short.
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(a.opts.JobTimeout + 10*time.Second))
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	t := time.NewTicker(a.opts.JobEventInterval)
+	defer t.Stop()
+	var sent string
+	for {
+		if job.Status != sent {
+			status, err := jobStatus(job, locale)
+			if err != nil {
+				log.WithError(err).Error("failed to decode analysis job")
+				return
+			}
+			c.SSEvent("status", status)
+			c.Writer.Flush()
+			sent = job.Status
+		}
+		if job.Done() {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		next, err := a.opts.Jobs.Get(ctx, job.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			return
+		}
+		if err != nil {
+			log.WithError(err).Warn("failed to fetch analysis job")
+			continue
+		}
+		job = next
+	}
+}
+
+// ownedJob loads the job named by the id path parameter when it belongs to
+// the caller, writing an error response otherwise.
+func (a *Analysis) ownedJob(c *gin.Context) (*models.AnalysisJob, bool) {
+	job, err := a.opts.Jobs.Get(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, store.ErrNotFound) || err == nil && job.UserID != c.GetUint("user_id") {
+		httputil.Fail(c, httputil.CodeNotFound, "analysis job not found")
+		return nil, false
+	}
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to fetch analysis job")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return nil, false
+	}
+	return job, true
+}
+
+// queueWait is how long a worker waits for a job before checking whether
+// it should stop.
+const queueWait = time.Second
+
+// Work runs queued jobs on workers goroutines until ctx is done. Jobs being
+// run then are finished first. Jobs other workers took but never finished,
+// having crashed or been killed, are queued again when Work starts and
+// then as their leases run out.
+func (a *Analysis) Work(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.recoverJobs(ctx)
+	}()
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// recoverJobs queues again the jobs whose lease has run out, every
+// AnalysisJobLease until ctx is done.
+func (a *Analysis) recoverJobs(ctx context.Context) {
+	t := time.NewTicker(store.AnalysisJobLease)
+	defer t.Stop()
+	for {
+		n, err := a.opts.Queue.Recover(ctx)
+		if err != nil && ctx.Err() == nil {
+			logging.FromContext(ctx).WithError(err).Error("failed to recover analysis jobs")
+		}
+		if n > 0 {
+			logging.FromContext(ctx).WithField("jobs", n).Warn("queued abandoned analysis jobs again")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// work runs the jobs it takes from the queue until ctx is done.
+func (a *Analysis) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		id, err := a.opts.Queue.Pop(ctx, queueWait)
+		if err != nil {
+			if ctx.Err() == nil {
+				logging.FromContext(ctx).WithError(err).Error("failed to take an analysis job")
+				select {
+				case <-ctx.Done():
+				case <-time.After(queueWait):
+				}
+			}
+			continue
+		}
+		if id != "" {
+			a.leased(context.WithoutCancel(ctx), id)
+		}
+	}
+}
+
+// leased runs the job with id, which the worker took from the queue,
+// extending its lease until the job has finished and then acknowledging it.
+func (a *Analysis) leased(ctx context.Context, id string) {
+	log := logging.FromContext(ctx).WithField("job_id", id)
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(store.AnalysisJobLease / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if err := a.opts.Queue.Extend(ctx, id); err != nil {
+					log.WithError(err).Warn("failed to extend analysis job lease")
+				}
+			}
+		}
+	}()
+	a.runJob(ctx, id)
+	close(done)
+	if err := a.opts.Queue.Ack(ctx, id); err != nil {
+		// The job is queued again once its lease runs out, and then
+		// skipped as finished.
+		log.WithError(err).Warn("failed to acknowledge analysis job")
+	}
+}
+
+// runJob runs the job with id, recording its progress in the job store,
+// and posts it to its owner's webhook once it has finished.
+func (a *Analysis) runJob(ctx context.Context, id string) {
+	log := logging.FromContext(ctx).WithField("job_id", id)
+	job, err := a.opts.Jobs.Get(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		log.Warn("analysis job expired before it ran")
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("failed to fetch analysis job")
+		return
+	}
+	if job.Done() {
+		return
+	}
+	log = log.WithField("kind", job.Kind)
+	runCtx, cancel := context.WithTimeout(ctx, a.opts.JobTimeout)
+	defer cancel()
+	save := func() {
+		job.UpdatedAt = time.Now().UTC()
+		if err := a.opts.Jobs.Put(ctx, job); err != nil {
+			log.WithError(err).Error("failed to store analysis job")
+		}
+	}
+
+	job.Status = models.JobRunning
+	save()
+	if result, err := a.execute(runCtx, job); err != nil {
+		log.WithError(err).Error("analysis job failed")
+		job.Status, job.Error = models.JobFailed, err.Message
+	} else {
+		log.Info("analysis job finished")
+		job.Status = models.JobSucceeded
+		job.Result, _ = json.Marshal(result)
+	}
+	save()
+	metrics.MatchJobs.WithLabelValues(job.Kind, job.Status).Inc()
+	metrics.MatchJobDuration.WithLabelValues(job.Kind).Observe(job.UpdatedAt.Sub(job.CreatedAt).Seconds())
+	a.notify(ctx, job)
+}
+
+// execute runs the request of job and returns its result.
+func (a *Analysis) execute(ctx context.Context, job *models.AnalysisJob) (any, *httputil.Error) {
+	switch job.Kind {
+	case models.JobAnalysis:
+		var req AnalysisRequest
+		if err := json.Unmarshal(job.Request, &req); err != nil {
+			return nil, httputil.New(httputil.CodeInternal, "internal error")
+		}
+		analysis, err := a.analyze(ctx, job.UserID, req)
+		if err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("job_id", job.ID).Error("failed to fetch report")
+			return nil, httputil.New(httputil.CodeUpstream, "report service error")
+		}
+		if err := a.analyses.Create(ctx, analysis); err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("job_id", job.ID).Error("failed to store analysis")
+			return nil, httputil.New(httputil.CodeInternal, "failed to store analysis")
+		}
+		return analysis, nil
+	case models.JobBatch:
+		var req BatchRequest
+		if err := json.Unmarshal(job.Request, &req); err != nil {
+			return nil, httputil.New(httputil.CodeInternal, "internal error")
+		}
+		return a.batch(ctx, job.UserID, req)
+	}
+	return nil, httputil.New(httputil.CodeInternal, "internal error")
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"matchmaker/internal/clients"
+	"matchmaker/internal/models"
+	"matchmaker/internal/store"
+)
+
+func TestAnalysisJob(t *testing.T) {
+	t.Parallel()
+	analyses := store.NewMemoryAnalysisStore()
+	reports := &clients.FakeReports{Default: []byte(`{"moon":{"nakshatra":1,"rashi":1}}`)}
+	a := NewAnalysis(reports, analyses, AnalysisOptions{JobEventInterval: 5 * time.Millisecond})
+	r := batchRouter(a)
+
+	if w := batchRequest(r, "POST", "/api/v1/analysis?async=true", 0, analysisBody); w.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous async analysis: %d", w.Code)
+	}
+	if w := batchRequest(r, "POST", "/api/v1/analysis?async=true", 1, `{}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid async analysis: %d", w.Code)
+	}
+
+	// The job waits in the queue until a worker takes it.
+	w := batchRequest(r, "POST", "/api/v1/analysis?async=true", 1, analysisBody)
+	var queued JobStatus
+	json.Unmarshal(w.Body.Bytes(), &queued)
+	if w.Code != http.StatusAccepted || queued.Kind != models.JobAnalysis || queued.Status != models.JobQueued {
+		t.Fatalf("async analysis: %d %s", w.Code, w.Body.String())
+	}
+	loc := w.Header().Get("Location")
+	if w := batchRequest(r, "GET", loc, 1, ""); !strings.Contains(w.Body.String(), `"status":"queued"`) {
+		t.Fatalf("queued job: %s", w.Body.String())
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	t.Cleanup(stop)
+	go a.Work(ctx, 1)
+
+	// The event stream follows the job until it has finished.
+	w = batchRequest(r, "GET", loc+"/events", 1, "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events: %d %s", w.Code, w.Header())
+	}
+	var events []JobStatus
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if data, ok := strings.CutPrefix(line, "data:"); ok {
+			var s JobStatus
+			if err := json.Unmarshal([]byte(data), &s); err != nil {
+				t.Fatalf("event %q: %v", data, err)
+			}
+			events = append(events, s)
+		}
+	}
+	if len(events) < 2 || events[0].Status != models.JobQueued && events[0].Status != models.JobRunning {
+		t.Fatalf("events: %s", w.Body.String())
+	}
+	last := events[len(events)-1]
+	if last.Status != models.JobSucceeded || last.Analysis == nil || last.Analysis.Breakdown[0].Label != "Varna" {
+		t.Fatalf("last event: %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "event:status\n") {
+		t.Fatalf("events not named: %s", w.Body.String())
+	}
+	if stored, err := analyses.Get(context.Background(), last.Analysis.ID); err != nil || stored.UserID != 1 {
+		t.Fatalf("analysis not stored for the user: %+v %v", stored, err)
+	}
+
+	w = batchRequest(r, "GET", loc, 1, "")
+	var done JobStatus
+	json.Unmarshal(w.Body.Bytes(), &done)
+	if w.Code != http.StatusOK || done.Status != models.JobSucceeded || done.Analysis.ID != last.Analysis.ID {
+		t.Fatalf("finished job: %d %s", w.Code, w.Body.String())
+	}
+	for _, path := range []string{loc, loc + "/events"} {
+		if w := batchRequest(r, "GET", path, 2, ""); w.Code != http.StatusNotFound {
+			t.Fatalf("%s as another user: %d", path, w.Code)
+		}
+	}
+}
+
+// recoveringQueue queues abandoned once it is first asked to recover jobs,
+// and records the jobs acknowledged.
+type recoveringQueue struct {
+	*store.MemoryAnalysisJobQueue
+	abandoned string
+
+	mu    sync.Mutex
+	acked []string
+}
+
+func (q *recoveringQueue) Recover(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	id := q.abandoned
+	q.abandoned = ""
+	q.mu.Unlock()
+	if id == "" {
+		return 0, nil
+	}
+	return 1, q.Push(ctx, id)
+}
+
+func (q *recoveringQueue) Ack(ctx context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.acked = append(q.acked, id)
+	return nil
+}
+
+func TestAnalysisJobRecovered(t *testing.T) {
+	t.Parallel()
+	// The job was running on a worker that crashed.
+	jobs := store.NewMemoryAnalysisJobStore()
+	now := time.Now().UTC()
+	jobs.Put(context.Background(), &models.AnalysisJob{
+		ID: "j1", UserID: 1, Kind: models.JobAnalysis, Status: models.JobRunning,
+		Request: []byte(analysisBody), CreatedAt: now, UpdatedAt: now,
+	})
+	queue := &recoveringQueue{MemoryAnalysisJobQueue: store.NewMemoryAnalysisJobQueue(), abandoned: "j1"}
+	reports := &clients.FakeReports{Default: []byte(`{"moon":{"nakshatra":1,"rashi":1}}`)}
+	a := NewAnalysis(reports, store.NewMemoryAnalysisStore(), AnalysisOptions{Jobs: jobs, Queue: queue})
+	ctx, stop := context.WithCancel(context.Background())
+	t.Cleanup(stop)
+	go a.Work(ctx, 1)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		queue.mu.Lock()
+		acked := len(queue.acked)
+		queue.mu.Unlock()
+		if acked > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	got, err := jobs.Get(context.Background(), "j1")
+	if err != nil || got.Status != models.JobSucceeded {
+		t.Fatalf("recovered job: %+v %v", got, err)
+	}
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if len(queue.acked) != 1 || queue.acked[0] != "j1" {
+		t.Fatalf("acknowledged %v", queue.acked)
+	}
+}
+
+func TestAnalysisWebhook(t *testing.T) {
+	t.Parallel()
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	deliveries := make(chan delivery, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		first := attempts == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{r.Header, body}
+	}))
+	t.Cleanup(receiver.Close)
+
+	reports := &clients.FakeReports{Default: []byte(`{"moon":{"nakshatra":1,"rashi":1}}`)}
+	a := NewAnalysis(reports, store.NewMemoryAnalysisStore(), AnalysisOptions{WebhookBackoff: time.Millisecond, WebhookAllowPrivate: true})
+	r := batchRouter(a)
+	ctx, stop := context.WithCancel(context.Background())
+	t.Cleanup(stop)
+	go a.Work(ctx, 1)
+
+	for _, body := range []string{`{"url":"ftp://example.com/hook"}`, `{"url":"not a url"}`, `{}`} {
+		if w := batchRequest(r, "PUT", "/api/v1/analysis/webhook", 1, body); w.Code != http.StatusBadRequest {
+			t.Fatalf("webhook %s: %d", body, w.Code)
+		}
+	}
+	if w := batchRequest(r, "GET", "/api/v1/analysis/webhook", 1, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("no webhook: %d", w.Code)
+	}
+	w := batchRequest(r, "PUT", "/api/v1/analysis/webhook", 1, `{"url":"`+receiver.URL+`"}`)
+	var hook models.AnalysisWebhook
+	json.Unmarshal(w.Body.Bytes(), &hook)
+	if w.Code != http.StatusOK || hook.URL != receiver.URL || len(hook.Secret) != 64 {
+		t.Fatalf("register webhook: %d %s", w.Code, w.Body.String())
+	}
+	w = batchRequest(r, "GET", "/api/v1/analysis/webhook", 1, "")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "secret") || !strings.Contains(w.Body.String(), receiver.URL) {
+		t.Fatalf("get webhook: %d %s", w.Code, w.Body.String())
+	}
+
+	// The finished job is delivered, signed, after a failed attempt.
+	w = batchRequest(r, "POST", "/api/v1/analysis?async=true", 1, analysisBody)
+	var queued JobStatus
+	json.Unmarshal(w.Body.Bytes(), &queued)
+	var d delivery
+	select {
+	case d = <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	ts, err := strconv.ParseInt(d.header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+		t.Fatalf("timestamp %q", d.header.Get(WebhookTimestampHeader))
+	}
+	if got := d.header.Get(WebhookSignatureHeader); got != SignWebhook(hook.Secret, ts, d.body) {
+		t.Fatalf("signature %q", got)
+	}
+	if d.header.Get(WebhookEventHeader) != JobFinishedEvent {
+		t.Fatalf("event %q", d.header.Get(WebhookEventHeader))
+	}
+	var status JobStatus
+	json.Unmarshal(d.body, &status)
+	if status.JobID != queued.JobID || status.Status != models.JobSucceeded || status.Analysis == nil {
+		t.Fatalf("delivered %s", d.body)
+	}
+	mu.Lock()
+	n := attempts
+	mu.Unlock()
+	if n != 2 {
+		t.Fatalf("%d attempts", n)
+	}
+
+	if w := batchRequest(r, "DELETE", "/api/v1/analysis/webhook", 1, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete webhook: %d", w.Code)
+	}
+	if w := batchRequest(r, "GET", "/api/v1/analysis/webhook", 1, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("deleted webhook: %d", w.Code)
+	}
+}
+
+func TestWebhookPrivateAddresses(t *testing.T) {
+	t.Parallel()
+	a := NewAnalysis(&clients.FakeReports{}, store.NewMemoryAnalysisStore(), AnalysisOptions{})
+	r := batchRouter(a)
+	for _, u := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.1.2.3/hook",
+		"http://192.168.0.1/hook",
+		"http://[::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://0.0.0.0/hook",
+		"http://0.1.2.3/hook",
+		"http://100.64.0.1/hook",
+		"http://[64:ff9b::a9fe:a9fe]/hook",
+		"http://localhost:8080/hook",
+		"http://hooks.invalid/hook",
+		"http://api.localhost/hook",
+	} {
+		w := batchRequest(r, "PUT", "/api/v1/analysis/webhook", 1, `{"url":"`+u+`"}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "private or local address") {
+			t.Errorf("webhook %s: %d %s", u, w.Code, w.Body.String())
+		}
+	}
+	if w := batchRequest(r, "PUT", "/api/v1/analysis/webhook", 1, `{"url":"https://203.0.113.7/hook"}`); w.Code != http.StatusOK {
+		t.Fatalf("public webhook: %d %s", w.Code, w.Body.String())
+	}
+
+	// Deliveries check the address they connect to, and are not redirected.
+	var hits int
+	var mu sync.Mutex
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	t.Cleanup(receiver.Close)
+	if _, err := webhookClient(time.Second, false).Post(receiver.URL, "application/json", nil); !errors.Is(err, errWebhookAddr) {
+		t.Fatalf("delivery to loopback: %v", err)
+	}
+	resp, err := webhookClient(time.Second, true).Post(receiver.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if resp.StatusCode != http.StatusFound || hits != 1 {
+		t.Fatalf("redirect: %d after %d requests", resp.StatusCode, hits)
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	t.Parallel()
+	// echo -n '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	if got := SignWebhook("secret", 1700000000, []byte("{}")); got != "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163" {
+		t.Fatalf("got %s", got)
+	}
+}
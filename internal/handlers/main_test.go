@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/logging"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	logging.Init()
+	os.Exit(m.Run())
+}
@@ -1,38 +1,118 @@
 package handlers
 
 import (
-	"net/http"
+	"errors"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 
 	"matchmaker/internal/httputil"
+	"matchmaker/internal/i18n"
 	"matchmaker/internal/logging"
 )
 
+var errNoBearer = errors.New("missing bearer token")
+
 // RequireUserID parses the JWT in the Authorization header and stores the user_id claim in the context.
 func RequireUserID() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		auth := c.GetHeader("Authorization")
-		if !strings.HasPrefix(auth, "Bearer ") {
-			httputil.AbortJSONError(c, http.StatusUnauthorized, "missing bearer token")
+		id, roles, err := bearerClaims(c)
+		if errors.Is(err, errNoBearer) {
+			httputil.AbortWith(c, httputil.CodeUnauthenticated, "missing bearer token")
 			return
 		}
-		tokenStr := strings.TrimPrefix(auth, "Bearer ")
-		claims := jwt.MapClaims{}
-		if _, _, err := new(jwt.Parser).ParseUnverified(tokenStr, claims); err != nil {
-			logging.Log.WithError(err).Warn("failed to parse jwt")
-			httputil.AbortJSONError(c, http.StatusUnauthorized, "invalid token")
+		if err != nil {
+			logging.FromContext(c).WithError(err).Warn("invalid jwt")
+			httputil.AbortWith(c, httputil.CodeUnauthenticated, "invalid token")
 			return
 		}
-		id, ok := claims["user_id"].(float64)
-		if !ok {
-			logging.Log.Warn("user_id claim missing")
-			httputil.AbortJSONError(c, http.StatusUnauthorized, "invalid token")
-			return
+		c.Set("user_id", id)
+		c.Set("roles", roles)
+		c.Next()
+	}
+}
+
+// Roles carried by JWTs.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// RequireRole answers 403 unless the caller's token, parsed by
+// RequireUserID, grants role.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, r := range c.GetStringSlice("roles") {
+			if r == role {
+				c.Next()
+				return
+			}
+		}
+		httputil.AbortWith(c, httputil.CodeForbidden, "requires the "+role+" role")
+	}
+}
+
+// OptionalUserID is RequireUserID for routes that also serve anonymous
+// callers: user_id is set only when the request carries a usable token.
+func OptionalUserID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if id, _, err := bearerClaims(c); err == nil {
+			c.Set("user_id", id)
+		}
+		c.Next()
+	}
+}
+
+// Locale stores the locale of each request in its context, where error
+// responses and chat prompts find it: the locale claim of its bearer token,
+// which carries the user's saved preference, or else the best supported
+// match of its Accept-Language header.
+func Locale() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var preferred string
+		if claims, err := bearerToken(c); err == nil {
+			preferred, _ = claims["locale"].(string)
 		}
-		c.Set("user_id", uint(id))
+		locale := i18n.Negotiate(preferred, c.GetHeader("Accept-Language"))
+		c.Request = c.Request.WithContext(i18n.WithLocale(c.Request.Context(), locale))
 		c.Next()
 	}
 }
+
+// bearerToken returns the claims of the request's bearer token. The
+// signature is not checked; the gateway verifies tokens.
+func bearerToken(c *gin.Context) (jwt.MapClaims, error) {
+	auth := c.GetHeader("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, errNoBearer
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(strings.TrimPrefix(auth, "Bearer "), claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// bearerClaims returns the user_id and roles claims of the request's bearer
+// token.
+func bearerClaims(c *gin.Context) (uint, []string, error) {
+	claims, err := bearerToken(c)
+	if err != nil {
+		return 0, nil, err
+	}
+	id, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, nil, errors.New("user_id claim missing")
+	}
+	var roles []string
+	if list, ok := claims["roles"].([]interface{}); ok {
+		for _, r := range list {
+			if s, ok := r.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+	}
+	return uint(id), roles, nil
+}
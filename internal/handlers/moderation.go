@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/logging"
+	"matchmaker/internal/models"
+	"matchmaker/internal/moderation"
+	"matchmaker/internal/server"
+	"matchmaker/internal/store"
+)
+
+// Moderation screens chat messages and answers, keeps the audit log of what
+// it objected to and serves the moderators' review queue.
+type Moderation struct {
+	moderator *moderation.Moderator
+	events    store.ModerationStore
+}
+
+// NewModeration returns a Moderation applying moderator and logging events
+// to events.
+func NewModeration(moderator *moderation.Moderator, events store.ModerationStore) *Moderation {
+	return &Moderation{moderator: moderator, events: events}
+}
+
+// ModerationPage is one page of moderation events, newest first.
+type ModerationPage struct {
+	Items  []models.ModerationEvent `json:"items"`
+	Total  int64                    `json:"total"`
+	Offset int                      `json:"offset"`
+	Limit  int                      `json:"limit"`
+}
+
+// ReviewRequest is the body of POST /api/v1/moderation/events/{id}/review.
+type ReviewRequest struct {
+	Decision string `json:"decision" binding:"required,oneof=upheld dismissed"`
+	Note     string `json:"note" binding:"max=1000"`
+}
+
+// screen moderates the text of user message id of sess, logging an event
+// when moderation objects to it.
+func (m *Moderation) screen(ctx context.Context, sess *chatSession, id, text string) moderation.Verdict {
+	v := m.moderator.Check(ctx, moderation.Input, text)
+	if v.Action != "" {
+		m.record(ctx, sess, id, moderation.Input, v)
+	}
+	return v
+}
+
+// review logs an event for the answer to user message id when the filter
+// it streamed through, or the external service, objects to it. The
+// external service is asked in the background, as the answer was shown
+// already.
+func (m *Moderation) review(ctx context.Context, sess *chatSession, id string, f *moderation.Filter) {
+	v := f.Verdict()
+	if v.Text == "" && v.Action == "" {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	server.Go(func() {
+		for _, fd := range m.moderator.Review(ctx, v.Text) {
+			v.Findings = append(v.Findings, fd)
+			if v.Action == "" || (v.Action == moderation.ActionRedact && fd.Action == moderation.ActionFlag) {
+				v.Action = fd.Action
+			}
+		}
+		if v.Action != "" {
+			m.record(ctx, sess, id, moderation.Output, v)
+		}
+	})
+}
+
+// record adds an event about v to the audit log. Blocked and flagged texts
+// wait for review.
+func (m *Moderation) record(ctx context.Context, sess *chatSession, id, direction string, v moderation.Verdict) {
+	status := models.ModerationLogged
+	if v.Action == moderation.ActionBlock || v.Action == moderation.ActionFlag {
+		status = models.ModerationPending
+	}
+	ev := &models.ModerationEvent{
+		ID:         newID(),
+		UserID:     sess.userID,
+		AnalysisID: sess.analysisID,
+		MessageID:  id,
+		Direction:  direction,
+		Action:     v.Action,
+		Findings:   v.Findings,
+		Text:       v.Private,
+		Status:     status,
+		CreatedAt:  time.Now().UTC(),
+	}
+	rules := make([]string, len(v.Findings))
+	for i, f := range v.Findings {
+		rules[i] = f.Rule
+	}
+	log := logging.FromContext(ctx).WithField("event_id", ev.ID).WithField("user_id", sess.userID).
+		WithField("direction", direction).WithField("action", v.Action).WithField("rules", rules)
+	if err := m.events.Record(context.WithoutCancel(ctx), ev); err != nil {
+		log.WithError(err).Error("failed to record moderation event")
+		return
+	}
+	log.Warn("moderation event")
+}
+
+// List handles GET /api/v1/moderation/events. With ?status=pending it is
+// the review queue.
+func (m *Moderation) List(c *gin.Context) {
+	offset, limit := pageParams(c)
+	filter := store.ModerationFilter{Status: c.Query("status")}
+	if v := c.Query("userId"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || id == 0 {
+			e := httputil.New(httputil.CodeValidationFailed, "invalid request")
+			e.Details = []httputil.FieldError{{Field: "userId", Code: "invalid", Message: "must be a positive integer"}}
+			httputil.WriteError(c, e)
+			return
+		}
+		filter.UserID = uint(id)
+	}
+	items, total, err := m.events.List(c.Request.Context(), filter, offset, limit)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to list moderation events")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	c.JSON(http.StatusOK, ModerationPage{Items: items, Total: total, Offset: offset, Limit: limit})
+}
+
+// Review handles POST /api/v1/moderation/events/{id}/review, recording a
+// moderator's decision on a pending event.
+func (m *Moderation) Review(c *gin.Context) {
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httputil.BindError(c, err)
+		return
+	}
+	moderatorID := c.GetUint("user_id")
+	review := models.ModerationReview{ModeratorID: moderatorID, Note: req.Note, At: time.Now().UTC()}
+	ev, err := m.events.Review(c.Request.Context(), c.Param("id"), req.Decision, review)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		httputil.Fail(c, httputil.CodeNotFound, "moderation event not found")
+		return
+	case errors.Is(err, store.ErrReviewed):
+		httputil.Fail(c, httputil.CodeConflict, "moderation event already reviewed")
+		return
+	case err != nil:
+		logging.FromContext(c).WithError(err).Error("failed to review moderation event")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	logging.FromContext(c).WithField("event_id", ev.ID).WithField("moderator_id", moderatorID).
+		WithField("decision", req.Decision).Info("moderation event reviewed")
+	c.JSON(http.StatusOK, ev)
+}
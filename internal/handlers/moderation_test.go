@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/clients"
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/llm"
+	"matchmaker/internal/models"
+	"matchmaker/internal/moderation"
+	"matchmaker/internal/store"
+)
+
+func TestChatModeration(t *testing.T) {
+	t.Parallel()
+	moderator, err := moderation.New([]moderation.Rule{
+		{Name: "threats", Category: "violence", Action: moderation.ActionBlock, Pattern: `(?i)\bkill (you|him|her)\b`},
+		moderation.PhoneRule(moderation.ActionRedact),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := store.NewMemoryModerationStore()
+	mod := NewModeration(moderator, events)
+	client := &llm.Fake{Reply: strings.Repeat("Venus is strong. ", 5) + "Mars may kill you. Sorry."}
+	transcripts := store.NewMemoryChatTranscripts()
+	url := serveChat(t, NewChat(store.NewMemoryChatHistory(), transcripts, store.NewMemoryChatBus(), client, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{Moderation: mod}))
+	ws := dialFrames(t, url)
+	var seq uint64
+
+	// Blocked messages are not answered.
+	ws.WriteJSON(Frame{Type: FrameUserMessage, ID: "m1", Text: "I will kill him"})
+	if f := readFrame(t, ws, &seq); f.Type != FrameError || f.Code != httputil.CodeContentBlocked || f.ReplyTo != "m1" {
+		t.Fatalf("expected content_blocked, got %+v", f)
+	}
+
+	// Phone numbers never reach the model, and the answer stops before
+	// the blocked text.
+	ws.WriteJSON(Frame{Type: FrameUserMessage, ID: "m2", Text: "Call me on 415 555 0100"})
+	var shown strings.Builder
+	var f Frame
+	for f = readFrame(t, ws, &seq); f.Type != FrameAssistantDone; f = readFrame(t, ws, &seq) {
+		shown.WriteString(f.Text)
+	}
+	if f.FinishReason != FinishModerated || strings.Contains(shown.String(), "kill") || !strings.HasPrefix(shown.String(), "Venus") {
+		t.Fatalf("expected a moderated answer, got %q %+v", shown.String(), f)
+	}
+	reqs := client.Requests()
+	if last := reqs[0].Messages[len(reqs[0].Messages)-1].Content; last != "Call me on [redacted]" {
+		t.Fatalf("model was sent %q", last)
+	}
+	sess, _ := transcripts.FindSession(context.Background(), 1, "")
+	msgs, _ := transcripts.Messages(context.Background(), sess.ID, 0, 0)
+	if len(msgs) != 2 || msgs[0].Content != "Call me on [redacted]" || msgs[1].Content != shown.String() {
+		t.Fatalf("unexpected transcript %+v", msgs)
+	}
+
+	// Moderators review the pending events.
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", uint(7))
+		c.Set("roles", strings.Split(c.GetHeader("X-Roles"), ","))
+	})
+	mods := r.Group("/moderation", RequireRole(RoleModerator))
+	mods.GET("/events", mod.List)
+	mods.POST("/events/:id/review", mod.Review)
+	do := func(method, target, roles, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Roles", roles)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := do(http.MethodGet, "/moderation/events", RoleUser, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("users must not list events: %d", w.Code)
+	}
+	var page ModerationPage
+	deadline := time.Now().Add(2 * time.Second)
+	for page.Total < 2 && time.Now().Before(deadline) {
+		w := do(http.MethodGet, "/moderation/events?status=pending", RoleModerator, "")
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &page) != nil {
+			t.Fatalf("list: %d %s", w.Code, w.Body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if page.Total != 2 {
+		t.Fatalf("expected the blocked message and answer pending, got %+v", page)
+	}
+	var answer models.ModerationEvent
+	for _, ev := range page.Items {
+		if ev.Direction == moderation.Output {
+			answer = ev
+		}
+	}
+	if answer.MessageID != "m2" || answer.Action != moderation.ActionBlock || !strings.Contains(answer.Text, "kill you") {
+		t.Fatalf("unexpected answer event %+v", answer)
+	}
+	if w := do(http.MethodGet, "/moderation/events?status=logged", RoleModerator, ""); !strings.Contains(w.Body.String(), "Call me on [redacted]") {
+		t.Fatalf("redaction not logged: %s", w.Body)
+	}
+
+	target := "/moderation/events/" + answer.ID + "/review"
+	if w := do(http.MethodPost, target, RoleModerator, `{"decision":"maybe"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid decision: %d %s", w.Code, w.Body)
+	}
+	w := do(http.MethodPost, target, RoleModerator, `{"decision":"upheld","note":"threat"}`)
+	var reviewed models.ModerationEvent
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &reviewed) != nil ||
+		reviewed.Status != models.ModerationUpheld || reviewed.Review == nil || reviewed.Review.ModeratorID != 7 {
+		t.Fatalf("review: %d %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, target, RoleModerator, `{"decision":"dismissed"}`); w.Code != http.StatusConflict {
+		t.Fatalf("second review: %d %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, "/moderation/events/missing/review", RoleModerator, `{"decision":"dismissed"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("missing event: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/i18n"
+	"matchmaker/internal/logging"
+	"matchmaker/internal/prompts"
+)
+
+// defaultPrompts holds the built-in template, for chats configured without
+// templates.
+var defaultPrompts = func() *prompts.Set {
+	s, err := prompts.New(prompts.Default(), "")
+	if err != nil {
+		panic(err)
+	}
+	return s
+}()
+
+// PromptPreviewRequest is the body of POST /api/v1/admin/prompts/preview.
+// Version defaults to the version assigned to UserID, and UserID to the
+// caller. With AnalysisID the prompt is about that analysis of UserID.
+// Locale is matched to a supported locale as a chat's would be.
+type PromptPreviewRequest struct {
+	Version    string `json:"version"`
+	UserID     uint   `json:"userId"`
+	AnalysisID string `json:"analysisId"`
+	Locale     string `json:"locale" binding:"max=35"`
+	Persona    string `json:"persona" binding:"max=200"`
+}
+
+// PromptPreview is a rendered system prompt.
+type PromptPreview struct {
+	Version string `json:"version"`
+	Prompt  string `json:"prompt"`
+}
+
+// PreviewPrompt handles POST /api/v1/admin/prompts/preview, rendering the
+// system prompt a chat would be given.
+func (h *Chat) PreviewPrompt(c *gin.Context) {
+	var req PromptPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httputil.BindError(c, err)
+		return
+	}
+	if req.UserID == 0 {
+		req.UserID = c.GetUint("user_id")
+	}
+	set := h.opts.Prompts
+	tmpl := set.Assign(req.UserID)
+	if req.Version != "" {
+		t, ok := set.Version(req.Version)
+		if !ok {
+			httputil.Fail(c, httputil.CodeNotFound, "prompt template not found")
+			return
+		}
+		tmpl = t
+	}
+	data := prompts.Data{Locale: i18n.Negotiate(req.Locale, ""), Persona: req.Persona}
+	if req.AnalysisID != "" {
+		a, err := h.analysisContext(c.Request.Context(), req.UserID, req.AnalysisID)
+		if isNotFound(err) {
+			httputil.Fail(c, httputil.CodeNotFound, "analysis not found")
+			return
+		}
+		if err != nil {
+			logging.FromContext(c).WithError(err).Error("failed to load analysis")
+			httputil.Fail(c, httputil.CodeUpstream, "match service error")
+			return
+		}
+		data.Analysis = a
+	}
+	prompt, err := set.Render(tmpl, data)
+	if err != nil {
+		httputil.Fail(c, httputil.CodeInvalidRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, PromptPreview{Version: tmpl.Version, Prompt: prompt})
+}
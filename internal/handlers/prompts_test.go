@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"matchmaker/internal/clients"
+	"matchmaker/internal/llm"
+	"matchmaker/internal/models"
+	"matchmaker/internal/prompts"
+	"matchmaker/internal/store"
+)
+
+func TestChatPrompts(t *testing.T) {
+	t.Parallel()
+	set, err := prompts.New([]prompts.Template{
+		{Version: "plain", Weight: 1, Text: "You are {{.Persona}}; reply in {{.Language}} ({{.Locale}})."},
+		{Version: "warm", Weight: 1, Persona: "a warm astrologer", Text: "You are {{.Persona}}; reply in {{.Language}} ({{.Locale}}).{{with .Analysis}} Score {{.Score}}%.{{end}}"},
+	}, "a plain astrologer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &llm.Fake{Reply: "hello"}
+	transcripts := store.NewMemoryChatTranscripts()
+	analyses := &clients.FakeMatch{Analyses: map[string]*clients.AnalysisResult{"a1": {ID: "a1", UserID: 1, Score: 78}}}
+	h := NewChat(store.NewMemoryChatHistory(), transcripts, store.NewMemoryChatBus(), client, analyses, &clients.FakeReports{}, ChatOptions{Prompts: set})
+	url := serveChat(t, h)
+
+	// Questions are sent with the user's template in their language, and
+	// answers record its version.
+	ws, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Accept-Language": {"hi-IN,hi;q=0.9,en;q=0.8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.WriteMessage(websocket.TextMessage, []byte("hi"))
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := ws.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	assigned := set.Assign(1)
+	want, _ := set.Render(assigned, prompts.Data{Locale: "hi"})
+	if reqs := client.Requests(); len(reqs) != 1 || reqs[0].System != want || !strings.HasSuffix(want, "reply in Hindi (hi).") {
+		t.Fatalf("expected system %q, got %+v", want, reqs)
+	}
+	var msgs []models.TranscriptMessage
+	for deadline := time.Now().Add(time.Second); len(msgs) < 2 && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if sess, err := transcripts.FindSession(context.Background(), 1, ""); err == nil {
+			msgs, _ = transcripts.Messages(context.Background(), sess.ID, 0, 0)
+		}
+	}
+	if len(msgs) != 2 || msgs[0].PromptVersion != "" || msgs[1].PromptVersion != assigned.Version {
+		t.Fatalf("unexpected transcript %+v", msgs)
+	}
+
+	// Admins preview prompts.
+	r := gin.New()
+	r.POST("/preview", func(c *gin.Context) {
+		c.Set("user_id", uint(9))
+		h.PreviewPrompt(c)
+	})
+	preview := func(body string) (int, PromptPreview) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/preview", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		var p PromptPreview
+		json.Unmarshal(w.Body.Bytes(), &p)
+		return w.Code, p
+	}
+	if code, p := preview(`{}`); code != http.StatusOK || p.Version != set.Assign(9).Version || !strings.HasSuffix(p.Prompt, "reply in English (en).") {
+		t.Fatalf("preview for the caller: %d %+v", code, p)
+	}
+	code, p := preview(`{"version":"warm","userId":1,"analysisId":"a1","locale":"ta-IN"}`)
+	if code != http.StatusOK || p.Prompt != "You are a warm astrologer; reply in Tamil (ta). Score 78%." {
+		t.Fatalf("preview of an analysis: %d %+v", code, p)
+	}
+	if code, p := preview(`{"version":"plain","persona":"a poet"}`); code != http.StatusOK || p.Prompt != "You are a poet; reply in English (en)." {
+		t.Fatalf("preview with a persona: %d %+v", code, p)
+	}
+	if code, _ := preview(`{"version":"missing"}`); code != http.StatusNotFound {
+		t.Fatalf("unknown version: %d", code)
+	}
+	if code, _ := preview(`{"userId":2,"analysisId":"a1"}`); code != http.StatusNotFound {
+		t.Fatalf("analysis of another user: %d", code)
+	}
+}
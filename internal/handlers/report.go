@@ -6,72 +6,127 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
-	"matchmaker/internal/database"
+	"matchmaker/internal/clients"
 	"matchmaker/internal/httputil"
 	"matchmaker/internal/logging"
+	"matchmaker/internal/metrics"
+	"matchmaker/internal/server"
+	"matchmaker/internal/store"
 )
 
-type BirthDetails struct {
-	DOB string  `json:"dob"`
-	TOB string  `json:"tob"`
-	Lat float64 `json:"lat"`
-	Lon float64 `json:"lon"`
+// BirthDetails identify the chart a report is computed for.
+type BirthDetails = clients.BirthDetails
+
+// Reports serves astrology reports through a two-level cache in front of the
+// astrology engine.
+type Reports struct {
+	l1, l2       store.ReportStore
+	engineURL    string
+	engineAPIKey string
+	client       *http.Client
+}
+
+// NewReports returns a Reports that caches in l1 (Redis in production) and
+// l2 (MongoDB) in front of the astrology engine at engineURL, authenticating
+// with apiKey when it is set.
+func NewReports(l1, l2 store.ReportStore, engineURL, apiKey string) *Reports {
+	return &Reports{l1: l1, l2: l2, engineURL: engineURL, engineAPIKey: apiKey, client: http.DefaultClient}
 }
 
-// CreateReport handles POST /internal/v1/reports to fetch astrology reports.
-func CreateReport(c *gin.Context) {
+// Create handles POST /internal/v1/reports to fetch astrology reports.
+func (h *Reports) Create(c *gin.Context) {
 	var bd BirthDetails
 	if err := c.ShouldBindJSON(&bd); err != nil {
-		logging.Log.WithError(err).Warn("invalid report payload")
-		httputil.JSONError(c, http.StatusBadRequest, "invalid request")
+		logging.FromContext(c).WithError(err).Warn("invalid report payload")
+		httputil.BindError(c, err)
+		return
+	}
+
+	data, err := h.FetchReport(c.Request.Context(), bd)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("engine request failed")
+		httputil.Fail(c, httputil.CodeUpstream, "engine error")
 		return
 	}
+	c.Data(http.StatusOK, "application/json", data)
+}
 
+// FetchReport returns the report for bd from the Redis (L1) or MongoDB (L2)
+// cache, falling back to the external engine on a miss. Cache write-backs run
+// in the background. An error means the engine call failed. It implements
+// ReportFetcher so the match module can use it in-process.
+func (h *Reports) FetchReport(ctx context.Context, bd BirthDetails) ([]byte, error) {
 	key := reportKey(bd)
-	ctx := context.Background()
 
 	// L1 Cache (Redis)
-	if val, err := database.Redis.Get(ctx, key).Result(); err == nil {
-		c.Data(http.StatusOK, "application/json", []byte(val))
-		return
-	} else if err != redis.Nil {
-		logging.Log.WithError(err).WithField("key", key).Error("redis get failed")
+	if val, err := h.l1.Get(ctx, key); err == nil {
+		metrics.ReportCacheHits.WithLabelValues("l1").Inc()
+		return val, nil
+	} else if !errors.Is(err, store.ErrNotFound) {
+		logging.FromContext(ctx).WithError(err).WithField("key", key).Error("redis get failed")
 	}
+	metrics.ReportCacheMisses.WithLabelValues("l1").Inc()
 
 	// L2 Cache (MongoDB)
-	var doc struct {
-		Report json.RawMessage `bson:"report"`
-	}
-	if err := database.Mongo.Collection("reports").FindOne(ctx, bson.M{"_id": key}).Decode(&doc); err == nil {
-		c.Data(http.StatusOK, "application/json", doc.Report)
-		go writeCaches(key, doc.Report)
-		return
-	} else if err != mongo.ErrNoDocuments {
-		logging.Log.WithError(err).WithField("key", key).Error("mongo find failed")
+	if val, err := h.l2.Get(ctx, key); err == nil {
+		metrics.ReportCacheHits.WithLabelValues("l2").Inc()
+		server.Go(func() { h.writeCaches(key, val) })
+		return val, nil
+	} else if !errors.Is(err, store.ErrNotFound) {
+		logging.FromContext(ctx).WithError(err).WithField("key", key).Error("mongo find failed")
 	}
+	metrics.ReportCacheMisses.WithLabelValues("l2").Inc()
 
 	// Cache miss - fetch from external engine
-	data, err := fetchFromEngine(ctx, bd)
+	engineStart := time.Now()
+	data, err := h.fetchFromEngine(ctx, bd)
+	metrics.ReportEngineLatency.Observe(time.Since(engineStart).Seconds())
 	if err != nil {
-		logging.Log.WithError(err).Error("engine request failed")
-		httputil.JSONError(c, http.StatusBadGateway, "engine error")
-		return
+		metrics.ReportEngineCalls.WithLabelValues("error").Inc()
+		return nil, err
 	}
+	metrics.ReportEngineCalls.WithLabelValues("success").Inc()
+
+	server.Go(func() { h.writeCaches(key, data) })
+	return data, nil
+}
 
+// Get handles GET /internal/v1/reports/:key, returning a cached report by
+// the key recorded with an analysis.
+func (h *Reports) Get(c *gin.Context) {
+	data, err := h.LoadReport(c.Request.Context(), c.Param("key"))
+	if errors.Is(err, store.ErrNotFound) {
+		httputil.Fail(c, httputil.CodeNotFound, "report not found")
+		return
+	}
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to load report")
+		httputil.Fail(c, httputil.CodeInternal, "cache error")
+		return
+	}
 	c.Data(http.StatusOK, "application/json", data)
-	go writeCaches(key, data)
+}
+
+// LoadReport returns the cached report with key from L1 or L2, or
+// store.ErrNotFound; the engine cannot be asked without birth details. It
+// implements ReportLoader so the chat module can use it in-process.
+func (h *Reports) LoadReport(ctx context.Context, key string) ([]byte, error) {
+	val, err := h.l1.Get(ctx, key)
+	if err == nil {
+		return val, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		logging.FromContext(ctx).WithError(err).WithField("key", key).Error("redis get failed")
+	}
+	return h.l2.Get(ctx, key)
 }
 
 func reportKey(b BirthDetails) string {
@@ -79,25 +134,23 @@ func reportKey(b BirthDetails) string {
 	return hex.EncodeToString(sum[:])
 }
 
-func fetchFromEngine(ctx context.Context, b BirthDetails) ([]byte, error) {
-	url := os.Getenv("ASTROLOGY_ENGINE_URL")
-	apiKey := os.Getenv("ASTROLOGY_ENGINE_API_KEY")
-	if url == "" {
-		return nil, fmt.Errorf("ASTROLOGY_ENGINE_URL not set")
+func (h *Reports) fetchFromEngine(ctx context.Context, b BirthDetails) ([]byte, error) {
+	if h.engineURL == "" {
+		return nil, fmt.Errorf("astrology engine URL not configured")
 	}
 	body, err := json.Marshal(b)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.engineURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	if apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+apiKey)
+	if h.engineAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.engineAPIKey)
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := h.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -109,17 +162,12 @@ func fetchFromEngine(ctx context.Context, b BirthDetails) ([]byte, error) {
 	return io.ReadAll(resp.Body)
 }
 
-func writeCaches(key string, data []byte) {
+func (h *Reports) writeCaches(key string, data []byte) {
 	ctx := context.Background()
-	if err := database.Redis.Set(ctx, key, data, time.Hour).Err(); err != nil {
+	if err := h.l1.Put(ctx, key, data); err != nil {
 		logging.Log.WithError(err).WithField("key", key).Error("redis set failed")
 	}
-	_, err := database.Mongo.Collection("reports").UpdateOne(ctx,
-		bson.M{"_id": key},
-		bson.M{"$set": bson.M{"report": data, "createdAt": time.Now()}},
-		options.Update().SetUpsert(true),
-	)
-	if err != nil {
+	if err := h.l2.Put(ctx, key, data); err != nil {
 		logging.Log.WithError(err).WithField("key", key).Error("mongo upsert failed")
 	}
 }
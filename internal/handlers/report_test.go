@@ -2,76 +2,91 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
-	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
 
-	"matchmaker/internal/database"
-	"matchmaker/internal/logging"
+	"matchmaker/internal/server"
+	"matchmaker/internal/store"
 )
 
-func TestCreateReport(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	logging.Init()
-	mr, err := miniredis.Run()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer mr.Close()
-	database.Redis = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+func postReport(h *Reports, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.Create(c)
+	return w
+}
 
-	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
-	mt.Run("success", func(mt *mtest.T) {
-		database.Mongo = mt.DB
-		mt.AddMockResponses(
-			mtest.CreateCursorResponse(0, "astrology.reports", mtest.FirstBatch),
-			mtest.CreateSuccessResponse(),
-		)
+func TestCreateReport(t *testing.T) {
+	t.Parallel()
 
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+		var calls int32
 		engine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
 			w.Write([]byte(`{"ok":true}`))
 		}))
 		defer engine.Close()
-		os.Setenv("ASTROLOGY_ENGINE_URL", engine.URL)
+		l1, l2 := store.NewMemoryReportStore(), store.NewMemoryReportStore()
+		h := NewReports(l1, l2, engine.URL, "")
 
-		w := httptest.NewRecorder()
-		c, _ := gin.CreateTestContext(w)
 		body := `{"dob":"2000-02-02","tob":"12:00:00","lat":5,"lon":3}`
-		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
-		c.Request.Header.Set("Content-Type", "application/json")
-		CreateReport(c)
-		if w.Code != http.StatusOK {
+		if w := postReport(h, body); w.Code != http.StatusOK {
 			t.Fatalf("expected 200 got %d", w.Code)
 		}
-		time.Sleep(20 * time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Wait(ctx)
+		if l1.Len() != 1 || l2.Len() != 1 {
+			t.Fatalf("caches not written: l1=%d l2=%d", l1.Len(), l2.Len())
+		}
+
+		// second request is served from L1
+		if w := postReport(h, body); w.Code != http.StatusOK || w.Body.String() != `{"ok":true}` {
+			t.Fatalf("unexpected cached response %d %s", w.Code, w.Body)
+		}
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Fatalf("expected 1 engine call, got %d", n)
+		}
 	})
 
-	mt.Run("engine failure", func(mt *mtest.T) {
-		database.Mongo = mt.DB
-		mt.AddMockResponses(
-			mtest.CreateCursorResponse(0, "astrology.reports", mtest.FirstBatch),
-		)
+	t.Run("engine failure", func(t *testing.T) {
+		t.Parallel()
 		engine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(500)
 		}))
 		defer engine.Close()
-		os.Setenv("ASTROLOGY_ENGINE_URL", engine.URL)
+		h := NewReports(store.NewMemoryReportStore(), store.NewMemoryReportStore(), engine.URL, "")
 
-		w := httptest.NewRecorder()
-		c, _ := gin.CreateTestContext(w)
 		body := `{"dob":"2000-01-01","tob":"12:00:00","lat":1,"lon":2}`
-		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
-		c.Request.Header.Set("Content-Type", "application/json")
-		CreateReport(c)
-		if w.Code != http.StatusBadGateway {
+		if w := postReport(h, body); w.Code != http.StatusBadGateway {
 			t.Fatalf("expected 502 got %d", w.Code)
 		}
 	})
 }
+
+func TestGetReportByKey(t *testing.T) {
+	t.Parallel()
+	l2 := store.NewMemoryReportStore()
+	h := NewReports(store.NewMemoryReportStore(), l2, "", "")
+	key := reportKey(BirthDetails{DOB: "2000-01-01", TOB: "12:00:00"})
+	l2.Put(context.Background(), key, []byte(`{"ok":true}`))
+
+	r := gin.New()
+	r.GET("/internal/v1/reports/:key", h.Get)
+	for k, want := range map[string]int{key: http.StatusOK, "missing": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/internal/v1/reports/"+k, nil))
+		if w.Code != want {
+			t.Fatalf("key %s: expected %d got %d", k, want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/llm"
+	"matchmaker/internal/logging"
+	"matchmaker/internal/metering"
+	"matchmaker/internal/models"
+)
+
+// UsageMeter holds users to the quotas of their plans and counts the tokens
+// they spend chatting, through *metering.Meter.
+type UsageMeter interface {
+	// Check returns a *metering.QuotaError when the user spent a quota.
+	Check(ctx context.Context, userID uint) error
+	Record(ctx context.Context, userID uint, u models.Usage) error
+	Report(ctx context.Context, userID uint) (*metering.Report, error)
+}
+
+// Usage handles GET /api/v1/usage, returning the caller's plan and what
+// they spent today and this month.
+func (h *Chat) Usage(c *gin.Context) {
+	if h.opts.Meter == nil {
+		httputil.Fail(c, httputil.CodeNotFound, "usage is not metered")
+		return
+	}
+	r, err := h.opts.Meter.Report(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to load chat usage")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// checkQuota returns the quota sess's user spent, or nil. When the quotas
+// cannot be checked, the user is let through.
+func (h *Chat) checkQuota(ctx context.Context, sess *chatSession) *metering.QuotaError {
+	if h.opts.Meter == nil {
+		return nil
+	}
+	err := h.opts.Meter.Check(ctx, sess.userID)
+	var q *metering.QuotaError
+	if errors.As(err, &q) {
+		return q
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Warn("chat quota check failed")
+	}
+	return nil
+}
+
+// meterUsage counts spent against sess's user.
+func (h *Chat) meterUsage(ctx context.Context, sess *chatSession, spent models.Usage) {
+	if h.opts.Meter == nil {
+		return
+	}
+	if err := h.opts.Meter.Record(context.WithoutCancel(ctx), sess.userID, spent); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("user_id", sess.userID).Error("failed to record chat usage")
+	}
+}
+
+// spentOn returns what answering req with reply cost, as reported by the
+// provider or, failing that, estimated.
+func spentOn(req llm.Request, reply string, usage *llm.Usage) models.Usage {
+	u := models.Usage{Messages: 1}
+	if usage != nil && usage.InputTokens > 0 {
+		u.PromptTokens = int64(usage.InputTokens)
+	} else {
+		if req.System != "" {
+			u.PromptTokens = int64(llm.CountTokens(req.System))
+		}
+		for _, m := range req.Messages {
+			u.PromptTokens += int64(llm.CountTokens(m.Content))
+		}
+	}
+	if usage != nil && usage.OutputTokens > 0 {
+		u.CompletionTokens = int64(usage.OutputTokens)
+	} else if reply != "" {
+		u.CompletionTokens = int64(llm.CountTokens(reply))
+	}
+	return u
+}
+
+// quotaNotice tells a legacy client that q was spent.
+func quotaNotice(q *metering.QuotaError) string {
+	return fmt.Sprintf("You have used your %s chat allowance of %d tokens. It resets at %s.", q.Period, q.Limit, q.ResetsAt.UTC().Format(time.RFC1123))
+}
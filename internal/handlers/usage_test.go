@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"matchmaker/internal/clients"
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/llm"
+	"matchmaker/internal/metering"
+	"matchmaker/internal/prompts"
+	"matchmaker/internal/store"
+)
+
+func TestChatQuota(t *testing.T) {
+	t.Parallel()
+	meter := metering.New(store.NewMemoryUsageCounters(), store.NewMemoryUsageStore(), nil,
+		map[string]metering.Plan{"free": {Name: "free", DailyTokens: 20}}, "free")
+	transcripts := store.NewMemoryChatTranscripts()
+	// Without a system prompt only the conversation counts.
+	bare, _ := prompts.New([]prompts.Template{{Version: "bare", Weight: 1}}, "")
+	h := NewChat(store.NewMemoryChatHistory(), transcripts, store.NewMemoryChatBus(), &llm.Fake{Reply: "hi there"}, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{Prompts: bare, Meter: meter})
+	url := serveChat(t, h)
+	ws := dialFrames(t, url)
+	var seq uint64
+
+	// Questions are answered until the quota is spent.
+	for _, id := range []string{"m1", "m2"} {
+		ws.WriteJSON(Frame{Type: FrameUserMessage, ID: id, Text: "hello"})
+		for f := readFrame(t, ws, &seq); f.Type != FrameAssistantDone; f = readFrame(t, ws, &seq) {
+			if f.Type == FrameQuotaExceeded {
+				t.Fatalf("%s: quota exceeded too early: %+v", id, f)
+			}
+		}
+	}
+	ws.WriteJSON(Frame{Type: FrameUserMessage, ID: "m3", Text: "hello"})
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var f Frame
+	if err := ws.ReadJSON(&f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != FrameQuotaExceeded || f.ReplyTo != "m3" || f.Seq != 0 || f.Code != httputil.CodeRateLimited ||
+		f.Quota == nil || f.Quota.Period != metering.Daily || f.Quota.Limit != 20 || f.Quota.Used < 20 {
+		t.Fatalf("expected quota_exceeded, got %+v", f)
+	}
+
+	// Legacy clients are told in plain text.
+	legacy, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.Close()
+	legacy.WriteMessage(websocket.TextMessage, []byte("hello"))
+	legacy.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, msg, err := legacy.ReadMessage(); err != nil || !strings.Contains(string(msg), "daily chat allowance of 20 tokens") {
+		t.Fatalf("expected a quota notice, got %q %v", msg, err)
+	}
+
+	// Answers record what they cost.
+	sess, err := transcripts.FindSession(context.Background(), 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := transcripts.Messages(context.Background(), sess.ID, 0, 0)
+	if len(msgs) != 4 || msgs[1].PromptTokens == 0 || msgs[1].CompletionTokens != int64(llm.CountTokens("hi there")) {
+		t.Fatalf("unexpected transcript %+v", msgs)
+	}
+
+	r := gin.New()
+	r.GET("/usage", func(c *gin.Context) {
+		c.Set("user_id", uint(1))
+		h.Usage(c)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/usage", nil))
+	var report metering.Report
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &report) != nil {
+		t.Fatalf("usage: %d %s", w.Code, w.Body)
+	}
+	want := msgs[1].PromptTokens + msgs[1].CompletionTokens + msgs[3].PromptTokens + msgs[3].CompletionTokens
+	if report.Plan != "free" || report.Daily.Messages != 2 || report.Daily.Tokens != want || report.Daily.Limit != 20 || report.Monthly.Limit != 0 {
+		t.Fatalf("unexpected report %s", w.Body)
+	}
+}
+
+func TestChatMetersFailedWrites(t *testing.T) {
+	t.Parallel()
+	meter := metering.New(store.NewMemoryUsageCounters(), store.NewMemoryUsageStore(), nil,
+		map[string]metering.Plan{"free": {Name: "free", DailyTokens: 1000}}, "free")
+	bare, _ := prompts.New([]prompts.Template{{Version: "bare", Weight: 1}}, "")
+	h := NewChat(store.NewMemoryChatHistory(), store.NewMemoryChatTranscripts(), store.NewMemoryChatBus(), &llm.Fake{Reply: "hi there"}, &clients.FakeMatch{}, &clients.FakeReports{}, ChatOptions{Prompts: bare, Meter: meter})
+	gone := errors.New("client gone")
+	_, _, err := h.answer(context.Background(), &chatSession{userID: 1}, "m1", "hello", func([]byte) error { return gone })
+	if !errors.Is(err, gone) {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+	report, err := meter.Report(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Daily.Messages != 1 || report.Daily.Tokens == 0 {
+		t.Fatalf("an answer the client did not receive was not metered: %+v", report.Daily)
+	}
+}
+
+func TestSpentOn(t *testing.T) {
+	t.Parallel()
+	req := llm.Request{System: "be brief", Messages: []llm.Message{{Role: llm.RoleUser, Content: "hello"}}}
+	if u := spentOn(req, "hi", &llm.Usage{InputTokens: 12, OutputTokens: 3}); u.Messages != 1 || u.PromptTokens != 12 || u.CompletionTokens != 3 {
+		t.Fatalf("reported usage: %+v", u)
+	}
+	want := int64(llm.CountTokens("be brief") + llm.CountTokens("hello"))
+	if u := spentOn(req, "hi", nil); u.PromptTokens != want || u.CompletionTokens != int64(llm.CountTokens("hi")) {
+		t.Fatalf("estimated usage: %+v", u)
+	}
+}
@@ -1,86 +1,140 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 
-	"matchmaker/internal/database"
 	"matchmaker/internal/httputil"
+	"matchmaker/internal/i18n"
 	"matchmaker/internal/logging"
 	"matchmaker/internal/models"
+	"matchmaker/internal/store"
 )
 
-// CreateUser creates a user if it does not exist and returns the ID.
-func CreateUser(c *gin.Context) {
+// Users serves user profiles.
+type Users struct {
+	repo store.UserRepository
+}
+
+// NewUsers returns a Users backed by repo.
+func NewUsers(repo store.UserRepository) *Users {
+	return &Users{repo: repo}
+}
+
+// Create handles POST /internal/v1/users. It creates a user if it does not
+// exist and returns the ID.
+func (h *Users) Create(c *gin.Context) {
 	var req struct {
-		Email string `json:"email"`
+		Email string `json:"email" binding:"required"`
 		Name  string `json:"name"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil || req.Email == "" {
-		logging.Log.WithError(err).Warn("invalid create user payload")
-		httputil.JSONError(c, http.StatusBadRequest, "invalid request")
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logging.FromContext(c).WithError(err).Warn("invalid create user payload")
+		httputil.BindError(c, err)
 		return
 	}
 
-	var user models.User
-	err := database.DB.Where("email = ?", req.Email).First(&user).Error
+	user, created, err := h.repo.FindOrCreateByEmail(c.Request.Context(), req.Email)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			user = models.User{Email: req.Email}
-			if err := database.DB.Create(&user).Error; err != nil {
-				logging.Log.WithError(err).Error("failed to create user")
-				httputil.JSONError(c, http.StatusInternalServerError, "create failed")
-				return
-			}
-			c.JSON(http.StatusCreated, gin.H{"id": user.ID})
-			return
-		}
-		logging.Log.WithError(err).Error("failed to query user")
-		httputil.JSONError(c, http.StatusInternalServerError, "database error")
+		logging.FromContext(c).WithError(err).Error("failed to find or create user")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	if created {
+		c.JSON(http.StatusCreated, gin.H{"id": user.ID})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"id": user.ID})
 }
 
+// RegisterUser implements UserRegistrar so the auth module can register users
+// in-process.
+func (h *Users) RegisterUser(ctx context.Context, email, name string) (uint, error) {
+	user, _, err := h.repo.FindOrCreateByEmail(ctx, email)
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// InternalGet handles GET /internal/v1/users/:id, the call the chat service
+// makes to read the profile of the user it is talking to.
+func (h *Users) InternalGet(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		httputil.Fail(c, httputil.CodeInvalidRequest, "invalid user id")
+		return
+	}
+	user, err := h.LoadUser(c.Request.Context(), uint(id))
+	if errors.Is(err, store.ErrNotFound) {
+		httputil.Fail(c, httputil.CodeNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to fetch user")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// LoadUser returns the user with id, or store.ErrNotFound. It implements
+// UserLoader so the chat module can use it in-process.
+func (h *Users) LoadUser(ctx context.Context, id uint) (*models.User, error) {
+	return h.repo.Get(ctx, id)
+}
+
 // GetMe returns the authenticated user's profile.
-func GetMe(c *gin.Context) {
-	uid := c.GetUint("user_id")
-	var user models.User
-	if err := database.DB.Preload("BirthDetail").First(&user, uid).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			httputil.JSONError(c, http.StatusNotFound, "user not found")
+func (h *Users) GetMe(c *gin.Context) {
+	user, err := h.repo.Get(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			httputil.Fail(c, httputil.CodeNotFound, "user not found")
 			return
 		}
-		logging.Log.WithError(err).Error("failed to fetch user")
-		httputil.JSONError(c, http.StatusInternalServerError, "database error")
+		logging.FromContext(c).WithError(err).Error("failed to fetch user")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
 		return
 	}
 	c.JSON(http.StatusOK, user)
 }
 
-// UpdateMe updates profile fields for the authenticated user.
-func UpdateMe(c *gin.Context) {
-	uid := c.GetUint("user_id")
+// UpdateMe updates profile fields for the authenticated user and returns
+// the profile without birth details. The locale must be one i18n supports;
+// behind the gateway, a new one comes back in a refreshed token (see
+// Gateway.RefreshLocale).
+func (h *Users) UpdateMe(c *gin.Context) {
 	var req struct {
 		Gender   string `json:"gender"`
 		Location string `json:"location"`
 		PhotoURL string `json:"photoURL"`
+		Locale   string `json:"locale"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		logging.Log.WithError(err).Warn("invalid update payload")
-		httputil.JSONError(c, http.StatusBadRequest, "invalid request")
+		logging.FromContext(c).WithError(err).Warn("invalid update payload")
+		httputil.BindError(c, err)
 		return
 	}
-	var user models.User
-	if err := database.DB.First(&user, uid).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			httputil.JSONError(c, http.StatusNotFound, "user not found")
+	if req.Locale != "" && !slices.Contains(i18n.Supported(), req.Locale) {
+		e := httputil.New(httputil.CodeValidationFailed, "invalid request")
+		e.Details = []httputil.FieldError{{Field: "locale", Code: "invalid", Message: "must be one of " + strings.Join(i18n.Supported(), ", ")}}
+		httputil.WriteError(c, e)
+		return
+	}
+	user, err := h.repo.GetProfile(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			httputil.Fail(c, httputil.CodeNotFound, "user not found")
 			return
 		}
-		logging.Log.WithError(err).Error("failed to fetch user")
-		httputil.JSONError(c, http.StatusInternalServerError, "database error")
+		logging.FromContext(c).WithError(err).Error("failed to fetch user")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
 		return
 	}
 	if req.Gender != "" {
@@ -92,9 +146,12 @@ func UpdateMe(c *gin.Context) {
 	if req.PhotoURL != "" {
 		user.PhotoURL = req.PhotoURL
 	}
-	if err := database.DB.Save(&user).Error; err != nil {
-		logging.Log.WithError(err).Error("failed to update user")
-		httputil.JSONError(c, http.StatusInternalServerError, "update failed")
+	if req.Locale != "" {
+		user.Locale = req.Locale
+	}
+	if err := h.repo.Save(c.Request.Context(), user); err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to update user")
+		httputil.Fail(c, httputil.CodeInternal, "update failed")
 		return
 	}
 	c.JSON(http.StatusOK, user)
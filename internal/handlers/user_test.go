@@ -2,48 +2,50 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
-	"matchmaker/internal/logging"
 
-	"matchmaker/internal/database"
+	"matchmaker/internal/httputil"
 	"matchmaker/internal/models"
+	"matchmaker/internal/store"
 )
 
-func setupTestDB(t *testing.T) {
-	logging.Init()
-	dsn := fmt.Sprintf("file:%d?mode=memory&cache=shared", time.Now().UnixNano())
-	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+// newTestUsers returns a Users backed by an in-memory repository holding one
+// user.
+func newTestUsers(t *testing.T) (*Users, *store.MemoryUserRepository, *models.User) {
+	repo := store.NewMemoryUserRepository()
+	user, _, err := repo.FindOrCreateByEmail(context.Background(), "u@x.com")
 	if err != nil {
-		t.Fatalf("db open: %v", err)
+		t.Fatal(err)
 	}
-	if err := db.AutoMigrate(&models.User{}, &models.BirthDetail{}); err != nil {
-		t.Fatalf("migrate: %v", err)
-	}
-	database.DB = db
+	return NewUsers(repo), repo, user
 }
 
 func TestCreateUser(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	setupTestDB(t)
+	t.Parallel()
+	h := NewUsers(store.NewMemoryUserRepository())
 
 	// invalid
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(`{}`))
 	c.Request.Header.Set("Content-Type", "application/json")
-	CreateUser(c)
+	h.Create(c)
 	if w.Code != http.StatusBadRequest {
 		t.Fatalf("expected 400 got %d", w.Code)
 	}
+	var e httputil.Error
+	json.Unmarshal(w.Body.Bytes(), &e)
+	if e.Code != httputil.CodeValidationFailed || len(e.Details) != 1 || e.Details[0].Field != "email" {
+		t.Fatalf("unexpected error %s", w.Body)
+	}
 
 	// success
 	w = httptest.NewRecorder()
@@ -51,7 +53,7 @@ func TestCreateUser(t *testing.T) {
 	body := `{"email":"a@b.com","name":"Alice"}`
 	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
 	c.Request.Header.Set("Content-Type", "application/json")
-	CreateUser(c)
+	h.Create(c)
 	if w.Code != http.StatusCreated {
 		t.Fatalf("expected 201 got %d", w.Code)
 	}
@@ -60,20 +62,28 @@ func TestCreateUser(t *testing.T) {
 	if resp["id"] == 0 {
 		t.Fatal("missing id")
 	}
+
+	// existing
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.Create(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
 }
 
 func TestGetMe(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	setupTestDB(t)
-	user := models.User{Email: "u@x.com"}
-	database.DB.Create(&user)
+	t.Parallel()
+	h, _, user := newTestUsers(t)
 
 	// success
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest("GET", "/", nil)
 	c.Set("user_id", user.ID)
-	GetMe(c)
+	h.GetMe(c)
 	if w.Code != http.StatusOK {
 		t.Fatalf("expected 200 got %d", w.Code)
 	}
@@ -83,24 +93,33 @@ func TestGetMe(t *testing.T) {
 	c, _ = gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest("GET", "/", nil)
 	c.Set("user_id", uint(999))
-	GetMe(c)
+	h.GetMe(c)
 	if w.Code != http.StatusNotFound {
 		t.Fatalf("expected 404 got %d", w.Code)
 	}
+
+	// internal
+	r := gin.New()
+	r.GET("/internal/v1/users/:id", h.InternalGet)
+	for path, want := range map[string]int{fmt.Sprintf("/internal/v1/users/%d", user.ID): http.StatusOK, "/internal/v1/users/999": http.StatusNotFound, "/internal/v1/users/me": http.StatusBadRequest} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Fatalf("internal get %s: expected %d got %d", path, want, w.Code)
+		}
+	}
 }
 
 func TestUpdateMe(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	setupTestDB(t)
-	user := models.User{Email: "u@x.com"}
-	database.DB.Create(&user)
+	t.Parallel()
+	h, repo, user := newTestUsers(t)
 
 	// invalid body
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest("PUT", "/", bytes.NewBufferString(`x`))
 	c.Set("user_id", user.ID)
-	UpdateMe(c)
+	h.UpdateMe(c)
 	if w.Code != http.StatusBadRequest {
 		t.Fatalf("expected 400 got %d", w.Code)
 	}
@@ -112,13 +131,31 @@ func TestUpdateMe(t *testing.T) {
 	c.Request = httptest.NewRequest("PUT", "/", bytes.NewBufferString(body))
 	c.Request.Header.Set("Content-Type", "application/json")
 	c.Set("user_id", user.ID)
-	UpdateMe(c)
+	h.UpdateMe(c)
 	if w.Code != http.StatusOK {
 		t.Fatalf("expected 200 got %d", w.Code)
 	}
-	var updated models.User
-	database.DB.First(&updated, user.ID)
-	if updated.Location != "LA" {
-		t.Fatalf("location not updated: %s", updated.Location)
+	updated, err := repo.Get(context.Background(), user.ID)
+	if err != nil || updated.Location != "LA" {
+		t.Fatalf("location not updated: %v %+v", err, updated)
+	}
+
+	// locales are limited to the supported ones
+	for body, want := range map[string]int{`{"locale":"ta"}`: http.StatusOK, `{"locale":"fr"}`: http.StatusBadRequest} {
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("PUT", "/", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", user.ID)
+		h.UpdateMe(c)
+		if w.Code != want {
+			t.Fatalf("%s: expected %d got %d: %s", body, want, w.Code, w.Body)
+		}
+		if want == http.StatusBadRequest && !strings.Contains(w.Body.String(), "must be one of en, hi, ta, te") {
+			t.Fatalf("%s: unexpected error %s", body, w.Body)
+		}
+	}
+	if updated, _ := repo.Get(context.Background(), user.ID); updated.Locale != "ta" || updated.Location != "LA" {
+		t.Fatalf("locale not updated: %+v", updated)
 	}
 }
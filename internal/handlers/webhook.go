@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/i18n"
+	"matchmaker/internal/logging"
+	"matchmaker/internal/metrics"
+	"matchmaker/internal/models"
+	"matchmaker/internal/server"
+	"matchmaker/internal/store"
+)
+
+// Webhook deliveries post a JobStatus with these headers. The signature is
+// "sha256=" and the hex HMAC-SHA256, keyed with the webhook's secret, of
+// the timestamp, a dot and the body, so that receivers can reject forged
+// deliveries and, by checking the timestamp, replayed ones.
+const (
+	WebhookEventHeader     = "X-Matchmaker-Event"
+	WebhookTimestampHeader = "X-Matchmaker-Timestamp"
+	WebhookSignatureHeader = "X-Matchmaker-Signature"
+
+	// JobFinishedEvent is the event of deliveries about finished jobs.
+	JobFinishedEvent = "analysis.job.finished"
+)
+
+// SignWebhook returns the signature of a delivery of body sent at
+// timestamp, in Unix seconds, to a webhook with secret.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookRequest registers the URL to which the caller's finished analysis
+// jobs are posted.
+type WebhookRequest struct {
+	URL string `json:"url" binding:"required,url,max=2048"`
+}
+
+// PutWebhook handles PUT /api/v1/analysis/webhook. The webhook replaces
+// any the caller had and gets a new secret, which only this response shows.
+func (a *Analysis) PutWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		httputil.BindError(c, err)
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Hostname() == "" {
+		e := httputil.New(httputil.CodeValidationFailed, "invalid request")
+		e.Details = []httputil.FieldError{{Field: "url", Code: "invalid_format", Message: "must be an http or https URL"}}
+		httputil.WriteError(c, e)
+		return
+	}
+	if !a.webhookHostAllowed(c.Request.Context(), u.Hostname()) {
+		e := httputil.New(httputil.CodeValidationFailed, "invalid request")
+		e.Details = []httputil.FieldError{{Field: "url", Code: "invalid", Message: "must not point to a private or local address"}}
+		httputil.WriteError(c, e)
+		return
+	}
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	hook := &models.AnalysisWebhook{
+		UserID:    c.GetUint("user_id"),
+		URL:       req.URL,
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := a.opts.Webhooks.Put(c.Request.Context(), hook); err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to store analysis webhook")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	c.JSON(http.StatusOK, hook)
+}
+
+// GetWebhook handles GET /api/v1/analysis/webhook. The secret is not shown.
+func (a *Analysis) GetWebhook(c *gin.Context) {
+	hook, err := a.opts.Webhooks.Get(c.Request.Context(), c.GetUint("user_id"))
+	if errors.Is(err, store.ErrNotFound) {
+		httputil.Fail(c, httputil.CodeNotFound, "analysis webhook not found")
+		return
+	}
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to fetch analysis webhook")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	hook.Secret = ""
+	c.JSON(http.StatusOK, hook)
+}
+
+// DeleteWebhook handles DELETE /api/v1/analysis/webhook.
+func (a *Analysis) DeleteWebhook(c *gin.Context) {
+	if err := a.opts.Webhooks.Delete(c.Request.Context(), c.GetUint("user_id")); err != nil {
+		logging.FromContext(c).WithError(err).Error("failed to delete analysis webhook")
+		httputil.Fail(c, httputil.CodeInternal, "database error")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// errWebhookAddr refuses connections to addresses webhooks may not use.
+var errWebhookAddr = errors.New("webhook address is not public")
+
+// nonPublicPrefixes are the ranges publicAddr refuses besides those the
+// netip methods name: "this network", carrier-grade NAT, and NAT64, which
+// reaches IPv4 addresses of any kind.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// publicAddr reports whether webhooks may be posted to ip, which must not be
+// a loopback, link-local, private, carrier-grade NAT, NAT64, multicast or
+// unspecified address.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsPrivate() || ip.IsUnspecified() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookHostAllowed reports whether webhooks may be registered on host.
+// Names are refused when they do not resolve or one of their addresses is
+// not public; webhookClient checks the address again on every connection.
+func (a *Analysis) webhookHostAllowed(ctx context.Context, host string) bool {
+	if a.opts.WebhookAllowPrivate {
+		return true
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return publicAddr(ip)
+	}
+	if host = strings.ToLower(strings.TrimSuffix(host, ".")); host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.opts.WebhookTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return false
+	}
+	for _, ip := range addrs {
+		if !publicAddr(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookClient returns the client that delivers webhooks. It neither
+// follows redirects nor uses proxies and, unless allowPrivate, refuses to
+// connect to addresses that are not public. The address is checked once
+// resolved, so names that resolve to other addresses than they did when
+// the webhook was registered are refused too.
+func webhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || !publicAddr(ap.Addr()) {
+				return fmt.Errorf("%w: %s", errWebhookAddr, address)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// notify posts the finished job to its owner's webhook, if they have one,
+// in the background and in the language of the request that queued it.
+func (a *Analysis) notify(ctx context.Context, job *models.AnalysisJob) {
+	log := logging.FromContext(ctx).WithField("job_id", job.ID)
+	hook, err := a.opts.Webhooks.Get(ctx, job.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("failed to fetch analysis webhook")
+		return
+	}
+	locale := job.Locale
+	if locale == "" {
+		locale = i18n.Default
+	}
+	status, err := jobStatus(job, locale)
+	if err != nil {
+		log.WithError(err).Error("failed to decode analysis job")
+		return
+	}
+	body, _ := json.Marshal(status)
+	server.Go(func() { a.deliver(ctx, hook, job.ID, body) })
+}
+
+// deliver posts body to hook, retrying failed deliveries with backoff.
+func (a *Analysis) deliver(ctx context.Context, hook *models.AnalysisWebhook, jobID string, body []byte) {
+	log := logging.FromContext(ctx).WithField("job_id", jobID)
+	backoff := a.opts.WebhookBackoff
+	for attempt := 0; ; attempt++ {
+		err := a.post(ctx, hook, body)
+		if err == nil {
+			metrics.MatchWebhookDeliveries.WithLabelValues("success").Inc()
+			log.Info("analysis webhook delivered")
+			return
+		}
+		if attempt == a.opts.WebhookMaxRetries {
+			metrics.MatchWebhookDeliveries.WithLabelValues("error").Inc()
+			log.WithError(err).Warn("analysis webhook delivery failed")
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes one signed delivery of body to hook.
+func (a *Analysis) post(ctx context.Context, hook *models.AnalysisWebhook, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, JobFinishedEvent)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(hook.Secret, ts, body))
+	resp, err := a.hooks.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Check reports whether a dependency is usable.
+type Check func(ctx context.Context) error
+
+// checkTimeout bounds each dependency check run by Readiness.
+const checkTimeout = 2 * time.Second
+
+var (
+	mu       sync.RWMutex
+	checks   = map[string]Check{}
+	draining atomic.Bool
+)
+
+// Register adds a named readiness check, replacing any previous check with
+// the same name.
+func Register(name string, check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = check
+}
+
+// Reset removes all checks and clears the draining flag.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	checks = map[string]Check{}
+	draining.Store(false)
+}
+
+// SetDraining marks the process as shutting down so Readiness fails and load
+// balancers stop routing new requests to it.
+func SetDraining() {
+	draining.Store(true)
+}
+
+// Liveness handles GET /healthz. It only reports that the process is serving.
+func Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness handles GET /readyz. It runs every registered check concurrently
+// and returns 503 if any fails or the process is draining.
+func Readiness(c *gin.Context) {
+	if draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	mu.RLock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fns := make([]Check, len(names))
+	for i, name := range names {
+		fns[i] = checks[name]
+	}
+	mu.RUnlock()
+
+	results := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, fn := range fns {
+		wg.Add(1)
+		go func(i int, fn Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(c.Request.Context(), checkTimeout)
+			defer cancel()
+			results[i] = fn(ctx)
+		}(i, fn)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	report := make(gin.H, len(names))
+	for i, name := range names {
+		if results[i] != nil {
+			status = http.StatusServiceUnavailable
+			report[name] = results[i].Error()
+			continue
+		}
+		report[name] = "ok"
+	}
+	state := "ready"
+	if status != http.StatusOK {
+		state = "unavailable"
+	}
+	c.JSON(status, gin.H{"status": state, "checks": report})
+}
+
+// HTTPCheck returns a Check that expects a 2xx response from a GET to url,
+// typically another service's /healthz.
+func HTTPCheck(url string) Check {
+	client := &http.Client{}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,64 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadiness(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Reset()
+	defer Reset()
+
+	r := gin.New()
+	r.GET("/readyz", Readiness)
+	get := func() (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		var body map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	Register("redis", func(ctx context.Context) error { return nil })
+	if code, _ := get(); code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", code)
+	}
+
+	Register("postgres", func(ctx context.Context) error { return errors.New("connection refused") })
+	code, body := get()
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 got %d", code)
+	}
+	checks := body["checks"].(map[string]interface{})
+	if checks["redis"] != "ok" || checks["postgres"] != "connection refused" {
+		t.Fatalf("unexpected checks %v", checks)
+	}
+
+	Reset()
+	SetDraining()
+	if code, body := get(); code != http.StatusServiceUnavailable || body["status"] != "draining" {
+		t.Fatalf("expected draining 503, got %d %v", code, body)
+	}
+}
+
+func TestHTTPCheck(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+	if err := HTTPCheck(ok.URL)(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	if err := HTTPCheck(bad.URL)(context.Background()); err == nil {
+		t.Fatal("expected error for 503")
+	}
+}
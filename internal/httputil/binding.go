@@ -0,0 +1,92 @@
+package httputil
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report validation failures by JSON field name rather than Go name.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return f.Name
+			}
+			return name
+		})
+	}
+}
+
+// BindError writes the response for a failed ShouldBind* call, listing each
+// invalid field.
+func BindError(c *gin.Context, err error) {
+	WriteError(c, FromBindError(err))
+}
+
+// FromBindError converts an error returned by Gin binding into a
+// validation_failed Error with per-field details. Malformed JSON becomes
+// invalid_request.
+func FromBindError(err error) *Error {
+	var verrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &verrs):
+		e := New(CodeValidationFailed, "invalid request")
+		for _, fe := range verrs {
+			e.Details = append(e.Details, fieldError(fe))
+		}
+		return e
+	case errors.As(err, &typeErr):
+		e := New(CodeValidationFailed, "invalid request")
+		e.Details = []FieldError{{Field: typeErr.Field, Code: "invalid_type", Message: "must be a " + jsonType(typeErr.Type)}}
+		return e
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return New(CodeInvalidRequest, "malformed JSON body")
+	}
+	return New(CodeInvalidRequest, "invalid request")
+}
+
+func fieldError(fe validator.FieldError) FieldError {
+	field := fe.Namespace()
+	// Drop the root struct name: "AnalysisRequest.personA.dob" -> "personA.dob".
+	if i := strings.Index(field, "."); i >= 0 {
+		field = field[i+1:]
+	}
+	switch fe.Tag() {
+	case "required":
+		return FieldError{Field: field, Code: "required", Message: "is required"}
+	case "datetime":
+		return FieldError{Field: field, Code: "invalid_format", Message: "must match " + fe.Param()}
+	case "email":
+		return FieldError{Field: field, Code: "invalid_format", Message: "must be an email address"}
+	case "oneof":
+		return FieldError{Field: field, Code: "invalid", Message: "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")}
+	}
+	return FieldError{Field: field, Code: "invalid", Message: "failed " + fe.Tag() + " validation"}
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return "number"
+}
@@ -1,13 +1,184 @@
+// Package httputil defines the error envelope returned by every service.
+//
+// Errors are JSON objects of the form
+//
+//	{"error": "invalid request", "code": "validation_failed",
+//	 "details": [{"field": "personA.dob", "code": "required", "message": "is required"}],
+//	 "requestId": "..."}
+//
+// "error" is a human-readable message kept for older clients; "code" is a
+// stable, machine-readable identifier. Clients that send
+// Accept: application/problem+json receive the same information as an
+// RFC 7807 problem document instead. Messages are translated into the
+// locale of the request (see package i18n) when its catalog has them;
+// codes and fields never are.
 package httputil
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
 
-// JSONError sends a JSON response with a standard error structure.
-func JSONError(c *gin.Context, status int, message string) {
-	c.JSON(status, gin.H{"error": message})
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/i18n"
+)
+
+// Code is a stable, machine-readable error identifier.
+type Code string
+
+const (
+	CodeInvalidRequest      Code = "invalid_request"
+	CodeValidationFailed    Code = "validation_failed"
+	CodeUnauthenticated     Code = "unauthenticated"
+	CodeForbidden           Code = "forbidden"
+	CodeNotFound            Code = "not_found"
+	CodeMethodNotAllowed    Code = "method_not_allowed"
+	CodeConflict            Code = "conflict"
+	CodeRateLimited         Code = "rate_limited"
+	CodeContentBlocked      Code = "content_blocked"
+	CodeInternal            Code = "internal"
+	CodeUpstream            Code = "upstream_error"
+	CodeUpstreamUnavailable Code = "upstream_unavailable"
+	CodeTimeout             Code = "timeout"
+)
+
+var codeStatus = map[Code]int{
+	CodeInvalidRequest:      http.StatusBadRequest,
+	CodeValidationFailed:    http.StatusBadRequest,
+	CodeUnauthenticated:     http.StatusUnauthorized,
+	CodeForbidden:           http.StatusForbidden,
+	CodeNotFound:            http.StatusNotFound,
+	CodeMethodNotAllowed:    http.StatusMethodNotAllowed,
+	CodeConflict:            http.StatusConflict,
+	CodeRateLimited:         http.StatusTooManyRequests,
+	CodeContentBlocked:      http.StatusUnprocessableEntity,
+	CodeInternal:            http.StatusInternalServerError,
+	CodeUpstream:            http.StatusBadGateway,
+	CodeUpstreamUnavailable: http.StatusServiceUnavailable,
+	CodeTimeout:             http.StatusGatewayTimeout,
+}
+
+// Status returns the HTTP status for c; unknown codes map to 500.
+func (c Code) Status() int {
+	if s, ok := codeStatus[c]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeForStatus returns the default code for an HTTP error status.
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway:
+		return CodeUpstream
+	case http.StatusServiceUnavailable:
+		return CodeUpstreamUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	}
+	if status >= 400 && status < 500 {
+		return CodeInvalidRequest
+	}
+	return CodeInternal
+}
+
+// FieldError describes one invalid field of a request body.
+type FieldError struct {
+	// Field is the JSON path of the field, e.g. "personA.dob".
+	Field string `json:"field"`
+	// Code is "required", "invalid_type", "invalid_format" or "invalid".
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an API error response.
+type Error struct {
+	Status    int          `json:"-"`
+	Message   string       `json:"error"`
+	Code      Code         `json:"code"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+// New returns an Error with code, its status, and message.
+func New(code Code, message string) *Error {
+	return &Error{Status: code.Status(), Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Fail writes an error response with code and message.
+func Fail(c *gin.Context, code Code, message string) {
+	WriteError(c, New(code, message))
+}
+
+// AbortWith aborts the handler chain with an error response.
+func AbortWith(c *gin.Context, code Code, message string) {
+	c.Abort()
+	WriteError(c, New(code, message))
+}
+
+// WriteError writes e, tagged with the request ID, as JSON or as a problem
+// document depending on the request's Accept header.
+func WriteError(c *gin.Context, e *Error) {
+	if e.RequestID == "" {
+		e.RequestID = requestID(c.Writer.Header(), c.Request)
+	}
+	contentType, body := Render(e, c.Request)
+	c.Data(e.Status, contentType, body)
+}
+
+// localize returns a copy of e with its messages translated into locale.
+func localize(e *Error, locale string) *Error {
+	if locale == i18n.Default {
+		return e
+	}
+	out := *e
+	out.Message = i18n.T(locale, e.Message)
+	if e.Details != nil {
+		out.Details = make([]FieldError, len(e.Details))
+		for i, d := range e.Details {
+			d.Message = i18n.T(locale, d.Message)
+			out.Details[i] = d
+		}
+	}
+	return &out
+}
+
+// requestID returns the ID set by the request ID middleware on the response,
+// falling back to the incoming header.
+func requestID(h http.Header, r *http.Request) string {
+	if id := h.Get("X-Request-ID"); id != "" {
+		return id
+	}
+	if r != nil {
+		return r.Header.Get("X-Request-ID")
+	}
+	return ""
+}
+
+// NotFound responds to requests for unknown routes.
+func NotFound(c *gin.Context) {
+	Fail(c, CodeNotFound, "route not found")
 }
 
-// AbortJSONError aborts the context and sends a JSON error response.
-func AbortJSONError(c *gin.Context, status int, message string) {
-	c.AbortWithStatusJSON(status, gin.H{"error": message})
+// Recovery responds to a recovered panic.
+func Recovery(c *gin.Context, _ interface{}) {
+	c.Abort()
+	WriteError(c, New(CodeInternal, "internal error"))
 }
@@ -0,0 +1,131 @@
+package httputil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+type birth struct {
+	DOB string  `json:"dob" binding:"required"`
+	Lat float64 `json:"lat"`
+}
+
+type pair struct {
+	PersonA birth `json:"personA"`
+}
+
+func bind(body, accept string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/analysis", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.Header.Set("X-Request-ID", "req-1")
+	if accept != "" {
+		c.Request.Header.Set("Accept", accept)
+	}
+	var p pair
+	if err := c.ShouldBindJSON(&p); err != nil {
+		BindError(c, err)
+	}
+	return w
+}
+
+func TestBindErrorDetails(t *testing.T) {
+	cases := []struct {
+		name, body string
+		code       Code
+		field      string
+		fieldCode  string
+	}{
+		{"missing", `{"personA":{}}`, CodeValidationFailed, "personA.dob", "required"},
+		{"wrong type", `{"personA":{"dob":"2000-01-01","lat":"north"}}`, CodeValidationFailed, "personA.lat", "invalid_type"},
+		{"malformed", `{`, CodeInvalidRequest, "", ""},
+		{"empty", ``, CodeInvalidRequest, "", ""},
+	}
+	for _, tc := range cases {
+		w := bind(tc.body, "")
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400 got %d", tc.name, w.Code)
+		}
+		var e Error
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if e.Code != tc.code || e.Message == "" || e.RequestID != "req-1" {
+			t.Fatalf("%s: unexpected envelope %s", tc.name, w.Body)
+		}
+		if tc.field != "" && (len(e.Details) != 1 || e.Details[0].Field != tc.field || e.Details[0].Code != tc.fieldCode) {
+			t.Fatalf("%s: unexpected details %+v", tc.name, e.Details)
+		}
+	}
+}
+
+func TestProblemJSON(t *testing.T) {
+	w := bind(`{"personA":{}}`, "application/problem+json")
+	if ct := w.Header().Get("Content-Type"); ct != ProblemContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	var p map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &p)
+	if p["type"] != "urn:matchmaker:error:validation_failed" || p["status"].(float64) != 400 ||
+		p["instance"] != "/api/v1/analysis" || p["requestId"] != "req-1" || p["errors"] == nil {
+		t.Fatalf("unexpected problem %s", w.Body)
+	}
+
+	e, ok := Decode(400, w.Body.Bytes())
+	if !ok || e.Code != CodeValidationFailed || len(e.Details) != 1 {
+		t.Fatalf("problem not decoded: %+v", e)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	if e, ok := Decode(404, []byte(`{"error":"user not found"}`)); !ok || e.Code != CodeNotFound || e.Message != "user not found" {
+		t.Fatalf("legacy envelope not decoded: %+v", e)
+	}
+	if _, ok := Decode(500, []byte(`Internal Server Error`)); ok {
+		t.Fatal("plain text decoded as envelope")
+	}
+	if _, ok := Decode(500, []byte(`{"status":"down"}`)); ok {
+		t.Fatal("unrelated JSON decoded as envelope")
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	for _, tc := range []struct {
+		accept, language, message, detail string
+	}{
+		{"", "hi-IN,en;q=0.5", "अमान्य अनुरोध", "आवश्यक है"},
+		{ProblemContentType, "ta", "தவறான கோரிக்கை", "தேவை"},
+		{"", "fr", "invalid request", "is required"},
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/v1/analysis", strings.NewReader(`{"personA":{}}`))
+		c.Request.Header.Set("Accept-Language", tc.language)
+		c.Request.Header.Set("Accept", tc.accept)
+		var p pair
+		BindError(c, c.ShouldBindJSON(&p))
+
+		e, ok := Decode(w.Code, w.Body.Bytes())
+		if !ok || e.Code != CodeValidationFailed || e.Message != tc.message || len(e.Details) != 1 || e.Details[0].Message != tc.detail || e.Details[0].Field != "personA.dob" {
+			t.Fatalf("%s: unexpected error %s", tc.language, w.Body)
+		}
+	}
+
+	// The caller's error is left untranslated.
+	e := New(CodeNotFound, "user not found")
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "te")
+	if _, body := Render(e, r); !strings.Contains(string(body), "వినియోగదారు కనబడలేదు") || e.Message != "user not found" {
+		t.Fatalf("unexpected messages %s %+v", body, e)
+	}
+}
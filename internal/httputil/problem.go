@@ -0,0 +1,103 @@
+package httputil
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"matchmaker/internal/i18n"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem documents.
+const ProblemContentType = "application/problem+json"
+
+// problemTypeBase prefixes the code to form the problem "type" URI.
+const problemTypeBase = "urn:matchmaker:error:"
+
+// problem is an RFC 7807 document with the envelope fields as extensions.
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      Code         `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+// WantsProblem reports whether r asks for application/problem+json.
+func WantsProblem(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mt == ProblemContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// Render encodes e for r, in the language of r, returning the content
+// type and body.
+func Render(e *Error, r *http.Request) (string, []byte) {
+	e = localize(e, i18n.RequestLocale(r))
+	if WantsProblem(r) {
+		p := problem{
+			Type:      problemTypeBase + string(e.Code),
+			Title:     http.StatusText(e.Status),
+			Status:    e.Status,
+			Detail:    e.Message,
+			Code:      e.Code,
+			Errors:    e.Details,
+			RequestID: e.RequestID,
+		}
+		if r.URL != nil {
+			p.Instance = r.URL.Path
+		}
+		body, _ := json.Marshal(p)
+		return ProblemContentType, body
+	}
+	body, _ := json.Marshal(e)
+	return "application/json; charset=utf-8", body
+}
+
+// Decode parses an error response body in either the JSON envelope or the
+// problem format. ok is false when body is neither.
+func Decode(status int, body []byte) (e *Error, ok bool) {
+	var raw struct {
+		Error     json.RawMessage `json:"error"`
+		Code      Code            `json:"code"`
+		Details   []FieldError    `json:"details"`
+		RequestID string          `json:"requestId"`
+		Type      string          `json:"type"`
+		Detail    string          `json:"detail"`
+		Errors    []FieldError    `json:"errors"`
+	}
+	if json.Unmarshal(body, &raw) != nil {
+		return nil, false
+	}
+	e = &Error{Status: status, Code: raw.Code, RequestID: raw.RequestID}
+	switch {
+	case len(raw.Error) > 0:
+		if json.Unmarshal(raw.Error, &e.Message) != nil {
+			return nil, false
+		}
+		e.Details = raw.Details
+	case strings.HasPrefix(raw.Type, problemTypeBase) || raw.Detail != "":
+		e.Message = raw.Detail
+		e.Details = raw.Errors
+		if e.Code == "" {
+			e.Code = Code(strings.TrimPrefix(raw.Type, problemTypeBase))
+		}
+	default:
+		return nil, false
+	}
+	if e.Code == "" {
+		e.Code = CodeForStatus(status)
+	}
+	return e, true
+}
@@ -0,0 +1,152 @@
+// Package i18n negotiates the language of a request and translates the
+// messages users see.
+//
+// Messages are written in English in the code and translated through the
+// catalogs in catalogs/<locale>.json, which map each English message to its
+// translation. Messages a catalog lacks are shown in English.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the locale of the messages in the code, used when a request
+// asks for no supported locale.
+const Default = "en"
+
+// names maps the supported locales to their English names.
+var names = map[string]string{
+	"en": "English",
+	"hi": "Hindi",
+	"ta": "Tamil",
+	"te": "Telugu",
+}
+
+// Supported returns the supported locales, sorted.
+func Supported() []string {
+	locales := make([]string, 0, len(names))
+	for l := range names {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Name returns the English name of locale, e.g. "Hindi" for "hi" or
+// "hi-IN", for telling a model which language to use. Unsupported locales
+// are named after Default.
+func Name(locale string) string {
+	if l, ok := Match(locale); ok {
+		return names[l]
+	}
+	return names[Default]
+}
+
+//go:embed catalogs/*.json
+var catalogFiles embed.FS
+
+// catalogs maps each locale but Default to its translations.
+var catalogs = func() map[string]map[string]string {
+	files, err := catalogFiles.ReadDir("catalogs")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]map[string]string, len(files))
+	for _, f := range files {
+		b, err := catalogFiles.ReadFile(path.Join("catalogs", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var msgs map[string]string
+		if err := json.Unmarshal(b, &msgs); err != nil {
+			panic("i18n: " + f.Name() + ": " + err.Error())
+		}
+		out[strings.TrimSuffix(f.Name(), ".json")] = msgs
+	}
+	return out
+}()
+
+// T translates msg into locale, returning msg itself when the catalog of
+// locale has no translation.
+func T(locale, msg string) string {
+	if t, ok := catalogs[locale][msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// Match returns the supported locale for a language tag such as "hi-IN",
+// ignoring its region and case.
+func Match(tag string) (string, bool) {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	base, _, _ = strings.Cut(base, "_")
+	if _, ok := names[base]; ok {
+		return base, true
+	}
+	return "", false
+}
+
+// Negotiate picks the locale of a request: preferred, the user's saved
+// preference, when it is supported, then the supported language the
+// Accept-Language header ranks highest, then Default.
+func Negotiate(preferred, acceptLanguage string) string {
+	if l, ok := Match(preferred); ok {
+		return l
+	}
+	type choice struct {
+		tag string
+		q   float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			choices = append(choices, choice{tag, q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	for _, c := range choices {
+		if l, ok := Match(c.tag); ok {
+			return l
+		}
+	}
+	return Default
+}
+
+type ctxKey struct{}
+
+// WithLocale returns a copy of ctx carrying locale.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, locale)
+}
+
+// FromContext returns the locale stored by WithLocale, or "" when none is.
+func FromContext(ctx context.Context) string {
+	l, _ := ctx.Value(ctxKey{}).(string)
+	return l
+}
+
+// RequestLocale returns the locale of r: the one stored in its context, or
+// else the one its Accept-Language header negotiates.
+func RequestLocale(r *http.Request) string {
+	if r == nil {
+		return Default
+	}
+	if l := FromContext(r.Context()); l != "" {
+		return l
+	}
+	return Negotiate("", r.Header.Get("Accept-Language"))
+}
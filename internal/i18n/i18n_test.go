@@ -0,0 +1,74 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		preferred, header, want string
+	}{
+		{"", "", "en"},
+		{"", "*", "en"},
+		{"", "hi-IN", "hi"},
+		{"", "fr-CA, fr;q=0.9, ta;q=0.5", "ta"},
+		{"", "en;q=0.4, te;q=0.8", "te"},
+		{"", "hi;q=0, de", "en"},
+		{"ta", "hi-IN", "ta"},
+		{"TE_in", "", "te"},
+		{"fr", "hi", "hi"},
+	} {
+		if got := Negotiate(tc.preferred, tc.header); got != tc.want {
+			t.Errorf("Negotiate(%q, %q) = %q, want %q", tc.preferred, tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestRequestLocale(t *testing.T) {
+	t.Parallel()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "te-IN")
+	if got := RequestLocale(r); got != "te" {
+		t.Fatalf("from the header: %q", got)
+	}
+	if got := RequestLocale(r.WithContext(WithLocale(context.Background(), "hi"))); got != "hi" {
+		t.Fatalf("from the context: %q", got)
+	}
+}
+
+func TestCatalogs(t *testing.T) {
+	t.Parallel()
+	if got := T("hi", "user not found"); got != "उपयोगकर्ता नहीं मिला" {
+		t.Fatalf("got %q", got)
+	}
+	if got := T("ta", "no such message"); got != "no such message" {
+		t.Fatalf("untranslated message: %q", got)
+	}
+	if got := T("en", "user not found"); got != "user not found" {
+		t.Fatalf("english: %q", got)
+	}
+
+	// Every supported locale but the default has a catalog, and all
+	// catalogs translate the same messages.
+	for _, l := range Supported() {
+		if _, ok := catalogs[l]; !ok && l != Default {
+			t.Errorf("no catalog for %s", l)
+		}
+	}
+	for l, msgs := range catalogs {
+		if _, ok := names[l]; !ok {
+			t.Errorf("catalog %s is not a supported locale", l)
+		}
+		for _, other := range catalogs {
+			for msg := range other {
+				if msgs[msg] == "" {
+					t.Errorf("%s: no translation of %q", l, msg)
+				}
+			}
+		}
+	}
+}
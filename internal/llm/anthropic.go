@@ -0,0 +1,209 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// anthropicVersion is the API version sent with every request.
+const anthropicVersion = "2023-06-01"
+
+// Anthropic streams from an Anthropic-style messages endpoint, which sends
+// named server-sent events (message_start, content_block_delta,
+// message_delta, message_stop).
+type Anthropic struct {
+	URL    string
+	APIKey string
+	Model  string
+	Client *http.Client
+}
+
+// NewAnthropic returns a provider for the messages endpoint at url.
+func NewAnthropic(url, apiKey, model string) *Anthropic {
+	return &Anthropic{
+		URL:    orDefault(url, "https://api.anthropic.com/v1/messages"),
+		APIKey: apiKey,
+		Model:  orDefault(model, "claude-3-5-haiku-latest"),
+		Client: http.DefaultClient,
+	}
+}
+
+// Stream implements LLMProvider.
+func (p *Anthropic) Stream(ctx context.Context, req Request) (Stream, error) {
+	header := http.Header{}
+	header.Set("anthropic-version", anthropicVersion)
+	if p.APIKey != "" {
+		header.Set("x-api-key", p.APIKey)
+	}
+	payload := map[string]interface{}{
+		"model":      p.Model,
+		"messages":   anthropicMessages(req.Messages),
+		"max_tokens": req.maxTokens(),
+		"stream":     true,
+	}
+	if req.System != "" {
+		payload["system"] = req.System
+	}
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]interface{}, len(req.Tools))
+		for i, t := range req.Tools {
+			tools[i] = map[string]interface{}{"name": t.Name, "description": t.Description, "input_schema": t.Parameters}
+		}
+		payload["tools"] = tools
+	}
+	body, err := postStream(ctx, p.Client, p.URL, header, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &anthropicStream{body: body, sse: newSSEReader(body)}, nil
+}
+
+// anthropicBlock is a content block of the messages API.
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+// anthropicMessages returns messages in the form of the messages API:
+// tool calls become tool_use blocks of the assistant turn, and tool
+// results tool_result blocks of a user turn, consecutive results sharing
+// one.
+func anthropicMessages(messages []Message) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(messages))
+	for _, m := range messages {
+		switch {
+		case m.Role == RoleTool:
+			block := anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content}
+			if n := len(out); n > 0 {
+				if blocks, ok := out[n-1]["content"].([]anthropicBlock); ok && out[n-1]["role"] == RoleUser && blocks[0].Type == "tool_result" {
+					out[n-1]["content"] = append(blocks, block)
+					continue
+				}
+			}
+			out = append(out, map[string]interface{}{"role": RoleUser, "content": []anthropicBlock{block}})
+		case len(m.ToolCalls) > 0:
+			var blocks []anthropicBlock
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, c := range m.ToolCalls {
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: c.ID, Name: c.Name, Input: c.Arguments})
+			}
+			out = append(out, map[string]interface{}{"role": m.Role, "content": blocks})
+		default:
+			out = append(out, map[string]interface{}{"role": m.Role, "content": m.Content})
+		}
+	}
+	return out
+}
+
+type anthropicStream struct {
+	body io.ReadCloser
+	sse  *sseReader
+	// inputTokens is reported by message_start and repeated with the output
+	// tokens of message_delta.
+	inputTokens int
+	// calls collects the tool_use blocks, whose input is streamed in
+	// fragments, by block index.
+	calls map[int]*ToolCall
+	order []int
+}
+
+type anthropicEvent struct {
+	Message struct {
+		Usage struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Index        int            `json:"index"`
+	ContentBlock anthropicBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (s *anthropicStream) Recv() (Event, error) {
+	for {
+		name, data, err := s.sse.next()
+		if err == io.EOF {
+			return Event{}, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return Event{}, err
+		}
+		var ev anthropicEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return Event{}, fmt.Errorf("llm: malformed %s event: %w", name, err)
+		}
+		switch name {
+		case "message_start":
+			s.inputTokens = ev.Message.Usage.InputTokens
+		case "content_block_start":
+			if ev.ContentBlock.Type == "tool_use" {
+				if s.calls == nil {
+					s.calls = map[int]*ToolCall{}
+				}
+				s.calls[ev.Index] = &ToolCall{ID: ev.ContentBlock.ID, Name: ev.ContentBlock.Name}
+				s.order = append(s.order, ev.Index)
+			}
+		case "content_block_delta":
+			if ev.Delta.Type == "text_delta" && ev.Delta.Text != "" {
+				return Event{Text: ev.Delta.Text}, nil
+			}
+			if c := s.calls[ev.Index]; ev.Delta.Type == "input_json_delta" && c != nil {
+				c.Arguments = append(c.Arguments, ev.Delta.PartialJSON...)
+			}
+		case "message_delta":
+			out := Event{
+				FinishReason: anthropicFinish(ev.Delta.StopReason),
+				Usage:        &Usage{InputTokens: s.inputTokens, OutputTokens: ev.Usage.OutputTokens},
+			}
+			for _, i := range s.order {
+				c := *s.calls[i]
+				if len(c.Arguments) == 0 {
+					c.Arguments = json.RawMessage("{}")
+				}
+				out.ToolCalls = append(out.ToolCalls, c)
+			}
+			return out, nil
+		case "message_stop":
+			return Event{}, io.EOF
+		case "error":
+			return Event{}, errors.New("llm error: " + ev.Error.Type + ": " + ev.Error.Message)
+		}
+	}
+}
+
+func (s *anthropicStream) Close() error { return s.body.Close() }
+
+// anthropicFinish maps stop reasons to the common finish reasons.
+func anthropicFinish(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return FinishStop
+	case "max_tokens":
+		return FinishLength
+	case "tool_use":
+		return FinishToolCalls
+	}
+	return reason
+}
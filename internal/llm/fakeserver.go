@@ -0,0 +1,249 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// FakeServer is a local LLM provider for tests. It speaks the streaming
+// formats of all adapters at their usual paths — /v1/chat/completions
+// (OpenAI), /v1/messages (Anthropic) and /api/chat (Ollama) — and streams
+// Reply one word per chunk. Requests without APIKey, when it is set, are
+// rejected with 401. With ToolCalls set it calls tools the way Fake does.
+type FakeServer struct {
+	*httptest.Server
+	Reply     string
+	APIKey    string
+	ToolCalls []ToolCall
+
+	mu       sync.Mutex
+	requests []Request
+}
+
+// NewFakeServer starts a FakeServer answering with reply. Close it when done.
+func NewFakeServer(reply string) *FakeServer {
+	f := &FakeServer{Reply: reply}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", f.openAI)
+	mux.HandleFunc("/v1/messages", f.anthropic)
+	mux.HandleFunc("/api/chat", f.ollama)
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+// Requests returns the requests received so far, decoded into the common
+// form. Only the names of their tools are kept.
+func (f *FakeServer) Requests() []Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Request(nil), f.requests...)
+}
+
+// fakeRequest is the union of the request bodies of all adapters.
+type fakeRequest struct {
+	System   string        `json:"system"`
+	Messages []fakeMessage `json:"messages"`
+	Tools    []struct {
+		Name     string `json:"name"`
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	} `json:"tools"`
+	MaxTokens int `json:"max_tokens"`
+	Options   struct {
+		NumPredict int `json:"num_predict"`
+	} `json:"options"`
+}
+
+// fakeMessage is the union of the messages of all adapters. Content is a
+// string or, for Anthropic, a list of blocks.
+type fakeMessage struct {
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	ToolCalls []struct {
+		ID       string `json:"id"`
+		Function struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		} `json:"function"`
+	} `json:"tool_calls"`
+	ToolCallID string `json:"tool_call_id"`
+}
+
+// messages decodes m into the common form, splitting Anthropic tool
+// results into messages of their own.
+func (m fakeMessage) messages() []Message {
+	msg := Message{Role: m.Role, ToolCallID: m.ToolCallID}
+	for _, c := range m.ToolCalls {
+		args := c.Function.Arguments
+		var s string
+		if json.Unmarshal(args, &s) == nil {
+			args = json.RawMessage(s)
+		}
+		msg.ToolCalls = append(msg.ToolCalls, ToolCall{ID: c.ID, Name: c.Function.Name, Arguments: args})
+	}
+	if json.Unmarshal(m.Content, &msg.Content) == nil {
+		return []Message{msg}
+	}
+	var blocks []anthropicBlock
+	json.Unmarshal(m.Content, &blocks)
+	var out []Message
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			msg.Content += b.Text
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{ID: b.ID, Name: b.Name, Arguments: b.Input})
+		case "tool_result":
+			out = append(out, Message{Role: RoleTool, Content: b.Content, ToolCallID: b.ToolUseID})
+		}
+	}
+	if out != nil {
+		return out
+	}
+	return []Message{msg}
+}
+
+// accept decodes and records the request, reporting false after writing
+// an error when it is not authorized or malformed.
+func (f *FakeServer) accept(w http.ResponseWriter, r *http.Request, key string) (Request, bool) {
+	var body fakeRequest
+	if f.APIKey != "" && key != f.APIKey {
+		http.Error(w, `{"error":{"message":"invalid api key"}}`, http.StatusUnauthorized)
+		return Request{}, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return Request{}, false
+	}
+	req := Request{System: body.System, MaxTokens: body.MaxTokens}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = body.Options.NumPredict
+	}
+	for _, t := range body.Tools {
+		req.Tools = append(req.Tools, Tool{Name: orDefault(t.Name, t.Function.Name)})
+	}
+	for _, m := range body.Messages {
+		for _, m := range m.messages() {
+			if m.Role == "system" {
+				req.System = m.Content
+				continue
+			}
+			req.Messages = append(req.Messages, m)
+		}
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+	return req, true
+}
+
+// chunks splits the reply into the words streamed to clients.
+func (f *FakeServer) chunks() []string {
+	return strings.SplitAfter(f.Reply, " ")
+}
+
+// inputTokens counts the words of the request as its tokens.
+func inputTokens(req Request) int {
+	n := len(strings.Fields(req.System))
+	for _, m := range req.Messages {
+		n += len(strings.Fields(m.Content))
+	}
+	return n
+}
+
+func (f *FakeServer) openAI(w http.ResponseWriter, r *http.Request) {
+	body, ok := f.accept(w, r, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	if wantsTools(body, f.ToolCalls) {
+		// Arguments are streamed in two fragments after the name.
+		for i, c := range f.ToolCalls {
+			name, _ := json.Marshal(c.Name)
+			half := len(c.Arguments) / 2
+			first, _ := json.Marshal(string(c.Arguments[:half]))
+			rest, _ := json.Marshal(string(c.Arguments[half:]))
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":%d,\"id\":%q,\"type\":\"function\",\"function\":{\"name\":%s,\"arguments\":%s}}]}}]}\n\n", i, c.ID, name, first)
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":%d,\"function\":{\"arguments\":%s}}]}}]}\n\n", i, rest)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"tool_calls\"}]}\n\n")
+		fmt.Fprintf(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":%d,\"completion_tokens\":%d}}\n\n", inputTokens(body), len(f.ToolCalls))
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		return
+	}
+	chunks := f.chunks()
+	for _, c := range chunks {
+		b, _ := json.Marshal(c)
+		fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%s},\"finish_reason\":null}]}\n\n", b)
+		w.(http.Flusher).Flush()
+	}
+	fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+	fmt.Fprintf(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":%d,\"completion_tokens\":%d}}\n\n", inputTokens(body), len(chunks))
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func (f *FakeServer) anthropic(w http.ResponseWriter, r *http.Request) {
+	body, ok := f.accept(w, r, r.Header.Get("x-api-key"))
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	chunks := f.chunks()
+	fmt.Fprintf(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":%d,\"output_tokens\":1}}}\n\n", inputTokens(body))
+	if wantsTools(body, f.ToolCalls) {
+		for i, c := range f.ToolCalls {
+			name, _ := json.Marshal(c.Name)
+			half := len(c.Arguments) / 2
+			first, _ := json.Marshal(string(c.Arguments[:half]))
+			rest, _ := json.Marshal(string(c.Arguments[half:]))
+			fmt.Fprintf(w, "event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":%d,\"content_block\":{\"type\":\"tool_use\",\"id\":%q,\"name\":%s,\"input\":{}}}\n\n", i, c.ID, name)
+			fmt.Fprintf(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":%d,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":%s}}\n\n", i, first)
+			fmt.Fprintf(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":%d,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":%s}}\n\n", i, rest)
+			fmt.Fprintf(w, "event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":%d}\n\n", i)
+		}
+		fmt.Fprintf(w, "event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"tool_use\"},\"usage\":{\"output_tokens\":%d}}\n\n", len(f.ToolCalls))
+		fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+		return
+	}
+	fmt.Fprint(w, "event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n")
+	fmt.Fprint(w, "event: ping\ndata: {\"type\":\"ping\"}\n\n")
+	for _, c := range chunks {
+		b, _ := json.Marshal(c)
+		fmt.Fprintf(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":%s}}\n\n", b)
+		w.(http.Flusher).Flush()
+	}
+	fmt.Fprint(w, "event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n")
+	fmt.Fprintf(w, "event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":%d}}\n\n", len(chunks))
+	fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+}
+
+func (f *FakeServer) ollama(w http.ResponseWriter, r *http.Request) {
+	body, ok := f.accept(w, r, f.APIKey)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if wantsTools(body, f.ToolCalls) {
+		calls := make([]ollamaToolCall, len(f.ToolCalls))
+		for i, c := range f.ToolCalls {
+			calls[i].Function.Name, calls[i].Function.Arguments = c.Name, c.Arguments
+		}
+		b, _ := json.Marshal(calls)
+		fmt.Fprintf(w, "{\"message\":{\"role\":\"assistant\",\"content\":\"\",\"tool_calls\":%s},\"done\":false}\n", b)
+		fmt.Fprintf(w, "{\"message\":{\"role\":\"assistant\",\"content\":\"\"},\"done\":true,\"done_reason\":\"stop\",\"prompt_eval_count\":%d,\"eval_count\":%d}\n", inputTokens(body), len(f.ToolCalls))
+		return
+	}
+	chunks := f.chunks()
+	for _, c := range chunks {
+		b, _ := json.Marshal(c)
+		fmt.Fprintf(w, "{\"message\":{\"role\":\"assistant\",\"content\":%s},\"done\":false}\n", b)
+		w.(http.Flusher).Flush()
+	}
+	fmt.Fprintf(w, "{\"message\":{\"role\":\"assistant\",\"content\":\"\"},\"done\":true,\"done_reason\":\"stop\",\"prompt_eval_count\":%d,\"eval_count\":%d}\n", inputTokens(body), len(chunks))
+}
@@ -0,0 +1,275 @@
+// Package llm talks to the language model that powers the chat service.
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Message roles. RoleTool messages carry the result of a tool call.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Finish reasons reported by providers, normalized across APIs. Reasons a
+// provider reports that have no equivalent here are passed through as is.
+// FinishToolCalls means the model stopped to call tools; the request is
+// to be repeated with their results.
+const (
+	FinishStop      = "stop"
+	FinishLength    = "length"
+	FinishToolCalls = "tool_calls"
+)
+
+// Message is one turn of a conversation. An assistant turn may call tools,
+// each of whose results follows in a RoleTool turn naming its ToolCallID.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"-"`
+	ToolCallID string     `json:"-"`
+}
+
+// Tool is a function the model may call. Parameters is the JSON Schema of
+// its arguments, which are an object.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+// ToolCall is the model calling a tool with Arguments, a JSON object. ID
+// pairs the call with its result.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments json.RawMessage
+}
+
+// Request asks for the next assistant turn of a conversation.
+type Request struct {
+	// System instructs the model; it is sent the way each API expects.
+	System   string
+	Messages []Message
+	// Tools are offered to the model, which may call them instead of
+	// answering.
+	Tools []Tool
+	// MaxTokens caps the reply. Zero uses DefaultMaxTokens.
+	MaxTokens int
+}
+
+// DefaultMaxTokens caps replies when a Request does not.
+const DefaultMaxTokens = 1024
+
+func (r Request) maxTokens() int {
+	if r.MaxTokens > 0 {
+		return r.MaxTokens
+	}
+	return DefaultMaxTokens
+}
+
+// messageOverhead is the tokens a message costs beyond its text.
+const messageOverhead = 4
+
+// CountTokens estimates the tokens a message with text takes up in a
+// prompt. It counts three bytes per token, which overcounts English a
+// little and comes close for Indic scripts, so budgets hold across
+// providers and languages.
+func CountTokens(text string) int {
+	return (len(text)+2)/3 + messageOverhead
+}
+
+// Usage counts the tokens a completion consumed.
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+// Event is one step of a streamed completion: a chunk of reply text, the
+// reason generation stopped, token usage, or a mix of them. Fields a
+// provider did not report in this step are zero. The tool calls of a
+// completion are reported whole, with FinishToolCalls.
+type Event struct {
+	Text         string
+	FinishReason string
+	Usage        *Usage
+	ToolCalls    []ToolCall
+}
+
+func (e Event) empty() bool {
+	return e.Text == "" && e.FinishReason == "" && e.Usage == nil && len(e.ToolCalls) == 0
+}
+
+// Stream yields the events of a completion. Recv returns io.EOF after the
+// last event, or io.ErrUnexpectedEOF when the provider hung up before
+// finishing. The caller must close the stream.
+type Stream interface {
+	Recv() (Event, error)
+	Close() error
+}
+
+// LLMProvider streams completions from one model API.
+type LLMProvider interface {
+	Stream(ctx context.Context, req Request) (Stream, error)
+}
+
+// Providers supported by New.
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
+)
+
+// New returns the provider named kind. Empty url and model fall back to the
+// provider's public endpoint and a small default model.
+func New(kind, url, apiKey, model string) (LLMProvider, error) {
+	switch strings.ToLower(kind) {
+	case ProviderOpenAI:
+		return NewOpenAI(url, apiKey, model), nil
+	case ProviderAnthropic:
+		return NewAnthropic(url, apiKey, model), nil
+	case ProviderOllama:
+		return NewOllama(url, model), nil
+	}
+	return nil, fmt.Errorf("unknown llm provider %q", kind)
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// postStream posts body as JSON to url and returns the response body, or a
+// *StatusError carrying the provider's message when the status is not 200.
+func postStream(ctx context.Context, client *http.Client, url string, header http.Header, body interface{}) (io.ReadCloser, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: string(b)}
+	}
+	return resp.Body, nil
+}
+
+// Fake is an in-memory LLMProvider for tests. It answers every request with
+// Reply, or fails with Err when it is set, and records the requests it
+// received. With Stall set the stream blocks after Reply until ctx is
+// cancelled, and with StreamErr set it fails with StreamErr after Reply.
+// With ToolCalls set, requests that offer tools and do not end with a tool
+// result are answered with those calls instead of Reply.
+type Fake struct {
+	Reply     string
+	Err       error
+	Stall     bool
+	StreamErr error
+	ToolCalls []ToolCall
+
+	mu       sync.Mutex
+	requests []Request
+}
+
+// Stream implements LLMProvider.
+func (f *Fake) Stream(ctx context.Context, req Request) (Stream, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if wantsTools(req, f.ToolCalls) {
+		return &fakeStream{ctx: ctx, calls: f.ToolCalls}, nil
+	}
+	return &fakeStream{ctx: ctx, reply: f.Reply, stall: f.Stall, err: f.StreamErr}, nil
+}
+
+// wantsTools reports whether a fake model scripted to make calls makes
+// them in answer to req.
+func wantsTools(req Request, calls []ToolCall) bool {
+	n := len(req.Messages)
+	return len(calls) > 0 && len(req.Tools) > 0 && (n == 0 || req.Messages[n-1].Role != RoleTool)
+}
+
+type fakeStream struct {
+	ctx   context.Context
+	reply string
+	calls []ToolCall
+	stall bool
+	err   error
+	done  bool
+}
+
+func (s *fakeStream) Recv() (Event, error) {
+	if s.calls != nil {
+		calls := s.calls
+		s.calls, s.done = nil, true
+		return Event{FinishReason: FinishToolCalls, ToolCalls: calls}, nil
+	}
+	if s.reply != "" {
+		text := s.reply
+		s.reply = ""
+		return Event{Text: text}, nil
+	}
+	if s.stall {
+		<-s.ctx.Done()
+		return Event{}, s.ctx.Err()
+	}
+	if s.err != nil {
+		return Event{}, s.err
+	}
+	if !s.done {
+		s.done = true
+		return Event{FinishReason: FinishStop}, nil
+	}
+	return Event{}, io.EOF
+}
+
+func (s *fakeStream) Close() error { return nil }
+
+// Requests returns the requests received so far.
+func (f *Fake) Requests() []Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Request(nil), f.requests...)
+}
+
+// Prompts returns the requests received so far, each flattened to its
+// system text followed by its messages, one per line.
+func (f *Fake) Prompts() []string {
+	var prompts []string
+	for _, r := range f.Requests() {
+		parts := []string{}
+		if r.System != "" {
+			parts = append(parts, r.System)
+		}
+		for _, m := range r.Messages {
+			parts = append(parts, m.Content)
+		}
+		prompts = append(prompts, strings.Join(parts, "\n"))
+	}
+	return prompts
+}
@@ -0,0 +1,239 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// collect reads s to the end.
+func collect(t *testing.T, s Stream) (text, finish string, usage *Usage) {
+	t.Helper()
+	defer s.Close()
+	for {
+		ev, err := s.Recv()
+		if err == io.EOF {
+			return text, finish, usage
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		text += ev.Text
+		if ev.FinishReason != "" {
+			finish = ev.FinishReason
+		}
+		if ev.Usage != nil {
+			usage = ev.Usage
+		}
+	}
+}
+
+func TestProviders(t *testing.T) {
+	t.Parallel()
+	srv := NewFakeServer("Your moons are kind to each other.")
+	srv.APIKey = "key"
+	t.Cleanup(srv.Close)
+
+	req := Request{System: "Be brief.", Messages: []Message{{Role: RoleUser, Content: "How compatible are we?"}}, MaxTokens: 64}
+	t.Run("stream", func(t *testing.T) {
+		for name, p := range map[string]LLMProvider{
+			ProviderOpenAI:    NewOpenAI(srv.URL+"/v1/chat/completions", "key", ""),
+			ProviderAnthropic: NewAnthropic(srv.URL+"/v1/messages", "key", ""),
+			ProviderOllama:    NewOllama(srv.URL+"/api/chat", ""),
+		} {
+			name, p := name, p
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+				s, err := p.Stream(context.Background(), req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				text, finish, usage := collect(t, s)
+				if text != srv.Reply || finish != FinishStop {
+					t.Fatalf("unexpected completion %q finish %q", text, finish)
+				}
+				if usage == nil || usage.InputTokens != 6 || usage.OutputTokens != 7 {
+					t.Fatalf("unexpected usage %+v", usage)
+				}
+			})
+		}
+	})
+
+	reqs := srv.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(reqs))
+	}
+	for _, r := range reqs {
+		if r.System != req.System || len(r.Messages) != 1 || !reflect.DeepEqual(r.Messages[0], req.Messages[0]) || r.MaxTokens != 64 {
+			t.Fatalf("request not forwarded: %+v", r)
+		}
+	}
+
+	if _, err := NewOpenAI(srv.URL+"/v1/chat/completions", "wrong", "").Stream(context.Background(), req); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected 401 error, got %v", err)
+	}
+}
+
+func TestProviderTools(t *testing.T) {
+	t.Parallel()
+	calls := []ToolCall{
+		{ID: "c1", Name: "get_report", Arguments: json.RawMessage(`{"dob":"1990-01-02","tob":"10:30"}`)},
+		{ID: "c2", Name: "get_my_profile", Arguments: json.RawMessage(`{}`)},
+	}
+	srv := NewFakeServer("Your report is ready.")
+	srv.ToolCalls = calls
+	t.Cleanup(srv.Close)
+	tools := []Tool{
+		{Name: "get_report", Description: "Fetch a report.", Parameters: json.RawMessage(`{"type":"object"}`)},
+		{Name: "get_my_profile", Description: "Fetch the profile.", Parameters: json.RawMessage(`{"type":"object"}`)},
+	}
+
+	for name, p := range map[string]LLMProvider{
+		ProviderOpenAI:    NewOpenAI(srv.URL+"/v1/chat/completions", "", ""),
+		ProviderAnthropic: NewAnthropic(srv.URL+"/v1/messages", "", ""),
+		ProviderOllama:    NewOllama(srv.URL+"/api/chat", ""),
+	} {
+		name, p := name, p
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			req := Request{Messages: []Message{{Role: RoleUser, Content: "Read my chart."}}, Tools: tools}
+			s, err := p.Stream(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []ToolCall
+			var finish string
+			for {
+				ev, err := s.Recv()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, ev.ToolCalls...)
+				if ev.FinishReason != "" {
+					finish = ev.FinishReason
+				}
+			}
+			s.Close()
+			if finish != FinishToolCalls || len(got) != 2 {
+				t.Fatalf("expected tool calls, got %+v finish %q", got, finish)
+			}
+			for i, c := range got {
+				if c.Name != calls[i].Name || c.ID == "" {
+					t.Fatalf("unexpected call %+v", c)
+				}
+				var want, args map[string]string
+				json.Unmarshal(calls[i].Arguments, &want)
+				if err := json.Unmarshal(c.Arguments, &args); err != nil || !reflect.DeepEqual(args, want) {
+					t.Fatalf("unexpected arguments %s", c.Arguments)
+				}
+			}
+
+			// The results are sent back and answered.
+			req.Messages = append(req.Messages, Message{Role: RoleAssistant, ToolCalls: got})
+			for _, c := range got {
+				req.Messages = append(req.Messages, Message{Role: RoleTool, Content: `{"ok":true}`, ToolCallID: c.ID})
+			}
+			s, err = p.Stream(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text, finish, _ := collect(t, s); text != srv.Reply || finish != FinishStop {
+				t.Fatalf("unexpected answer %q finish %q", text, finish)
+			}
+		})
+	}
+
+	t.Cleanup(func() {
+		reqs := srv.Requests()
+		if len(reqs) != 6 {
+			t.Errorf("expected 6 requests, got %d", len(reqs))
+		}
+		for _, r := range reqs {
+			if len(r.Tools) != 2 || r.Tools[0].Name != "get_report" {
+				t.Errorf("tools not forwarded: %+v", r.Tools)
+			}
+			if n := len(r.Messages); n == 4 && (len(r.Messages[1].ToolCalls) != 2 || r.Messages[3].Role != RoleTool || r.Messages[3].Content != `{"ok":true}`) {
+				t.Errorf("results not forwarded: %+v", r.Messages)
+			}
+		}
+	})
+}
+
+func TestStreamErrors(t *testing.T) {
+	t.Parallel()
+	for name, tc := range map[string]struct {
+		body    string
+		newProv func(url string) LLMProvider
+		want    error
+	}{
+		"openai truncated": {
+			body:    "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n",
+			newProv: func(url string) LLMProvider { return NewOpenAI(url, "", "") },
+			want:    io.ErrUnexpectedEOF,
+		},
+		"anthropic error event": {
+			body:    "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n",
+			newProv: func(url string) LLMProvider { return NewAnthropic(url, "", "") },
+		},
+		"anthropic max tokens": {
+			body:    "event: message_delta\ndata: {\"delta\":{\"stop_reason\":\"max_tokens\"},\"usage\":{\"output_tokens\":3}}\n\nevent: message_stop\ndata: {}\n\n",
+			newProv: func(url string) LLMProvider { return NewAnthropic(url, "", "") },
+		},
+		"ollama error": {
+			body:    "{\"error\":\"model not found\"}\n",
+			newProv: func(url string) LLMProvider { return NewOllama(url, "") },
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+			s, err := tc.newProv(srv.URL).Stream(context.Background(), Request{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			var last Event
+			for {
+				ev, err := s.Recv()
+				if err == io.EOF {
+					if last.FinishReason != FinishLength {
+						t.Fatalf("expected finish %q, got %+v", FinishLength, last)
+					}
+					return
+				}
+				if err != nil {
+					if tc.want != nil && !errors.Is(err, tc.want) {
+						t.Fatalf("expected %v, got %v", tc.want, err)
+					}
+					return
+				}
+				last = ev
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	for _, kind := range []string{ProviderOpenAI, "Anthropic", ProviderOllama} {
+		if _, err := New(kind, "", "key", ""); err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+	}
+	if _, err := New("raw", "", "", ""); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+}
@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Ollama streams from an Ollama chat endpoint, which answers with one JSON
+// object per line and marks the last one with "done".
+type Ollama struct {
+	URL    string
+	Model  string
+	Client *http.Client
+}
+
+// NewOllama returns a provider for the chat endpoint at url. Ollama does not
+// authenticate requests.
+func NewOllama(url, model string) *Ollama {
+	return &Ollama{
+		URL:    orDefault(url, "http://localhost:11434/api/chat"),
+		Model:  orDefault(model, "llama3.1"),
+		Client: http.DefaultClient,
+	}
+}
+
+// Stream implements LLMProvider.
+func (p *Ollama) Stream(ctx context.Context, req Request) (Stream, error) {
+	messages := make([]ollamaMessage, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, ollamaMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Messages {
+		msg := ollamaMessage{Role: m.Role, Content: m.Content}
+		for _, c := range m.ToolCalls {
+			var call ollamaToolCall
+			call.Function.Name, call.Function.Arguments = c.Name, c.Arguments
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		}
+		messages = append(messages, msg)
+	}
+	payload := map[string]interface{}{
+		"model":    p.Model,
+		"messages": messages,
+		"stream":   true,
+		"options":  map[string]int{"num_predict": req.maxTokens()},
+	}
+	if len(req.Tools) > 0 {
+		payload["tools"] = functionTools(req.Tools)
+	}
+	body, err := postStream(ctx, p.Client, p.URL, nil, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &ollamaStream{body: body, r: bufio.NewReader(body)}, nil
+}
+
+// ollamaMessage is a message of the chat API, whose tool calls have no IDs
+// and whose arguments are objects rather than strings. Tool results are
+// matched to calls by order.
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaStream struct {
+	body  io.ReadCloser
+	r     *bufio.Reader
+	done  bool
+	calls []ToolCall
+}
+
+type ollamaChunk struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (s *ollamaStream) Recv() (Event, error) {
+	for !s.done {
+		line, err := s.r.ReadBytes('\n')
+		if len(line) == 0 || (len(line) == 1 && line[0] == '\n') {
+			if err == io.EOF {
+				return Event{}, io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return Event{}, err
+			}
+			continue
+		}
+		var chunk ollamaChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return Event{}, fmt.Errorf("llm: malformed chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return Event{}, errors.New("llm error: " + chunk.Error)
+		}
+		ev := Event{Text: chunk.Message.Content}
+		for _, c := range chunk.Message.ToolCalls {
+			args := c.Function.Arguments
+			if len(args) == 0 || string(args) == "null" {
+				args = json.RawMessage("{}")
+			}
+			id := fmt.Sprintf("call_%d", len(s.calls)+1)
+			s.calls = append(s.calls, ToolCall{ID: id, Name: c.Function.Name, Arguments: args})
+		}
+		if chunk.Done {
+			s.done = true
+			ev.FinishReason = orDefault(chunk.DoneReason, FinishStop)
+			if len(s.calls) > 0 {
+				ev.FinishReason, ev.ToolCalls = FinishToolCalls, s.calls
+			}
+			ev.Usage = &Usage{InputTokens: chunk.PromptEvalCount, OutputTokens: chunk.EvalCount}
+		}
+		if !ev.empty() {
+			return ev, nil
+		}
+	}
+	return Event{}, io.EOF
+}
+
+func (s *ollamaStream) Close() error { return s.body.Close() }
@@ -0,0 +1,201 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// OpenAI streams from an OpenAI-compatible chat completions endpoint, which
+// answers with server-sent events ending in "data: [DONE]".
+type OpenAI struct {
+	URL    string
+	APIKey string
+	Model  string
+	Client *http.Client
+}
+
+// NewOpenAI returns a provider for the chat completions endpoint at url.
+func NewOpenAI(url, apiKey, model string) *OpenAI {
+	return &OpenAI{
+		URL:    orDefault(url, "https://api.openai.com/v1/chat/completions"),
+		APIKey: apiKey,
+		Model:  orDefault(model, "gpt-4o-mini"),
+		Client: http.DefaultClient,
+	}
+}
+
+// Stream implements LLMProvider.
+func (p *OpenAI) Stream(ctx context.Context, req Request) (Stream, error) {
+	header := http.Header{}
+	if p.APIKey != "" {
+		header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	payload := map[string]interface{}{
+		"model":          p.Model,
+		"messages":       openAIMessages(req),
+		"max_tokens":     req.maxTokens(),
+		"stream":         true,
+		"stream_options": map[string]bool{"include_usage": true},
+	}
+	if len(req.Tools) > 0 {
+		payload["tools"] = functionTools(req.Tools)
+	}
+	body, err := postStream(ctx, p.Client, p.URL, header, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &openAIStream{body: body, sse: newSSEReader(body)}, nil
+}
+
+// openAIMessage is a message of the chat completions API. Content is null
+// in assistant messages that only call tools.
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    *string          `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// openAIMessages returns the system prompt and messages of req in the
+// form of the chat completions API.
+func openAIMessages(req Request) []openAIMessage {
+	out := make([]openAIMessage, 0, len(req.Messages)+1)
+	if req.System != "" {
+		system := req.System
+		out = append(out, openAIMessage{Role: "system", Content: &system})
+	}
+	for _, m := range req.Messages {
+		content := m.Content
+		msg := openAIMessage{Role: m.Role, Content: &content, ToolCallID: m.ToolCallID}
+		for i, c := range m.ToolCalls {
+			tc := openAIToolCall{Index: i, ID: c.ID, Type: "function"}
+			tc.Function.Name, tc.Function.Arguments = c.Name, string(c.Arguments)
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		if content == "" && len(msg.ToolCalls) > 0 {
+			msg.Content = nil
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// functionTools returns tools in the form shared by the OpenAI and Ollama
+// APIs.
+func functionTools(tools []Tool) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(tools))
+	for i, t := range tools {
+		out[i] = map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  t.Parameters,
+			},
+		}
+	}
+	return out
+}
+
+type openAIStream struct {
+	body io.ReadCloser
+	sse  *sseReader
+	// calls collects the tool calls streamed in fragments, by index.
+	calls []ToolCall
+}
+
+type openAIChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string           `json:"content"`
+			ToolCalls []openAIToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (s *openAIStream) Recv() (Event, error) {
+	for {
+		_, data, err := s.sse.next()
+		if err == io.EOF {
+			return Event{}, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return Event{}, err
+		}
+		if data == "[DONE]" {
+			return Event{}, io.EOF
+		}
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return Event{}, fmt.Errorf("llm: malformed chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return Event{}, errors.New("llm error: " + chunk.Error.Message)
+		}
+		var ev Event
+		for _, c := range chunk.Choices {
+			ev.Text += c.Delta.Content
+			for _, tc := range c.Delta.ToolCalls {
+				s.addCall(tc)
+			}
+			if c.FinishReason != nil {
+				ev.FinishReason = *c.FinishReason
+				if len(s.calls) > 0 {
+					for i := range s.calls {
+						if len(s.calls[i].Arguments) == 0 {
+							s.calls[i].Arguments = json.RawMessage("{}")
+						}
+					}
+					ev.ToolCalls, s.calls = s.calls, nil
+					ev.FinishReason = FinishToolCalls
+				}
+			}
+		}
+		if chunk.Usage != nil {
+			ev.Usage = &Usage{InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens}
+		}
+		if !ev.empty() {
+			return ev, nil
+		}
+	}
+}
+
+// addCall adds a fragment of a tool call: its first fragment names it and
+// the others continue its arguments.
+func (s *openAIStream) addCall(tc openAIToolCall) {
+	for len(s.calls) <= tc.Index {
+		s.calls = append(s.calls, ToolCall{})
+	}
+	c := &s.calls[tc.Index]
+	if tc.ID != "" {
+		c.ID = tc.ID
+	}
+	if tc.Function.Name != "" {
+		c.Name = tc.Function.Name
+	}
+	c.Arguments = append(c.Arguments, tc.Function.Arguments...)
+}
+
+func (s *openAIStream) Close() error { return s.body.Close() }
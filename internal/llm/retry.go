@@ -0,0 +1,230 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"net/http"
+	"time"
+
+	"matchmaker/internal/logging"
+	"matchmaker/internal/metrics"
+)
+
+// ErrTimeout is returned when a completion does not finish within
+// Options.Timeout, and ErrFirstTokenTimeout when it does not start within
+// Options.FirstTokenTimeout.
+var (
+	ErrTimeout           = errors.New("llm: completion timed out")
+	ErrFirstTokenTimeout = errors.New("llm: no response before the first-token timeout")
+)
+
+// StatusError is a non-200 response from a provider.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("llm status %d: %s", e.StatusCode, e.Message)
+}
+
+// Options bound the completions of a Resilient provider. Zero fields take
+// the defaults below.
+type Options struct {
+	// Timeout bounds a completion, from the request to its last event.
+	// Default 2m.
+	Timeout time.Duration
+	// FirstTokenTimeout bounds the wait for the first event. Default 20s.
+	FirstTokenTimeout time.Duration
+	// MaxRetries is the number of extra attempts on each provider. Default
+	// 2; a negative value disables retries.
+	MaxRetries int
+	// Backoff is the delay before the first retry; it doubles on each
+	// further retry, up to MaxBackoff. Default 250ms.
+	Backoff time.Duration
+	// MaxBackoff caps the retry delay. Default 4s.
+	MaxBackoff time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.Timeout <= 0 {
+		o.Timeout = 2 * time.Minute
+	}
+	if o.FirstTokenTimeout <= 0 {
+		o.FirstTokenTimeout = 20 * time.Second
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 2
+	} else if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 250 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 4 * time.Second
+	}
+	return o
+}
+
+// Resilient streams from a primary provider, retrying connection errors,
+// 429 and 5xx responses and first-token timeouts with jittered exponential
+// backoff, then falls back to a secondary provider. A completion is only
+// retried until its first event has been received; failures after that
+// are returned by Recv, since part of the reply may have been shown.
+type Resilient struct {
+	primary  LLMProvider
+	fallback LLMProvider
+	opts     Options
+}
+
+// NewResilient returns a provider that streams from primary, or from
+// fallback, which may be nil, when primary keeps failing.
+func NewResilient(primary, fallback LLMProvider, opts Options) *Resilient {
+	return &Resilient{primary: primary, fallback: fallback, opts: opts.withDefaults()}
+}
+
+// Stream implements LLMProvider.
+func (r *Resilient) Stream(ctx context.Context, req Request) (Stream, error) {
+	s, err := r.try(ctx, r.primary, req)
+	if err == nil || r.fallback == nil || ctx.Err() != nil {
+		return s, err
+	}
+	logging.FromContext(ctx).WithError(err).Warn("llm provider failed; falling back")
+	metrics.ChatLLMFallbacks.Inc()
+	return r.try(ctx, r.fallback, req)
+}
+
+// try starts a completion on p, retrying while it fails before its first
+// event.
+func (r *Resilient) try(ctx context.Context, p LLMProvider, req Request) (Stream, error) {
+	var lastErr error
+	for i := 0; i <= r.opts.MaxRetries; i++ {
+		if i > 0 {
+			if err := sleep(ctx, r.backoff(i)); err != nil {
+				return nil, lastErr
+			}
+			logging.FromContext(ctx).WithError(lastErr).WithField("attempt", i+1).Warn("retrying llm call")
+			metrics.ChatLLMRetries.Inc()
+		}
+		s, err := r.attempt(ctx, p, req)
+		if err == nil {
+			return s, nil
+		}
+		lastErr = err
+		if !retryable(ctx, err) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// attempt starts a completion on p and waits for its first event.
+func (r *Resilient) attempt(ctx context.Context, p LLMProvider, req Request) (Stream, error) {
+	callCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	firstToken := time.AfterFunc(r.opts.FirstTokenTimeout, cancel)
+	s, err := p.Stream(callCtx, req)
+	if err != nil {
+		firstToken.Stop()
+		err = timeoutErr(ctx, callCtx, err)
+		cancel()
+		return nil, err
+	}
+	ev, err := s.Recv()
+	first := firstToken.Stop()
+	if err != nil && err != io.EOF {
+		err = timeoutErr(ctx, callCtx, err)
+		s.Close()
+		cancel()
+		return nil, err
+	}
+	if !first {
+		s.Close()
+		cancel()
+		return nil, ErrFirstTokenTimeout
+	}
+	return &resilientStream{Stream: s, ctx: ctx, callCtx: callCtx, cancel: cancel, first: &ev, firstErr: err}, nil
+}
+
+// timeoutErr replaces err, caused by callCtx ending, with the timeout that
+// ended it: its deadline, or the first-token timer cancelling it. ctx
+// ending is reported as is.
+func timeoutErr(ctx, callCtx context.Context, err error) error {
+	switch {
+	case ctx.Err() != nil || callCtx.Err() == nil:
+		return err
+	case errors.Is(callCtx.Err(), context.DeadlineExceeded):
+		return ErrTimeout
+	}
+	return ErrFirstTokenTimeout
+}
+
+// backoff returns the delay before retry n (n >= 1): exponential d with
+// equal jitter, in [d/2, d).
+func (r *Resilient) backoff(n int) time.Duration {
+	d := r.opts.Backoff << (n - 1)
+	if d > r.opts.MaxBackoff || d <= 0 {
+		d = r.opts.MaxBackoff
+	}
+	half := d / 2
+	if d-half <= 0 {
+		return d
+	}
+	return half + time.Duration(mrand.Int63n(int64(d-half)))
+}
+
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resilientStream replays the first event of a completion and bounds the
+// rest by the completion timeout.
+type resilientStream struct {
+	Stream
+	ctx, callCtx context.Context
+	cancel       context.CancelFunc
+	first        *Event
+	firstErr     error
+}
+
+func (s *resilientStream) Recv() (Event, error) {
+	if s.first != nil {
+		ev := *s.first
+		s.first = nil
+		if s.firstErr != nil {
+			return Event{}, s.firstErr
+		}
+		return ev, nil
+	}
+	ev, err := s.Stream.Recv()
+	if err != nil && err != io.EOF && s.ctx.Err() == nil && errors.Is(s.callCtx.Err(), context.DeadlineExceeded) {
+		return ev, ErrTimeout
+	}
+	return ev, err
+}
+
+func (s *resilientStream) Close() error {
+	defer s.cancel()
+	return s.Stream.Close()
+}
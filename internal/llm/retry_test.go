@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastOptions keep retries and timeouts short in tests.
+var fastOptions = Options{Timeout: 300 * time.Millisecond, FirstTokenTimeout: 100 * time.Millisecond, MaxRetries: 2, Backoff: time.Millisecond}
+
+func TestResilientRetries(t *testing.T) {
+	t.Parallel()
+	srv := NewFakeServer("Saturn is patient.")
+	t.Cleanup(srv.Close)
+	req := Request{Messages: []Message{{Role: RoleUser, Content: "Will it last?"}}}
+
+	// failing answers with status to the first calls, then lets srv answer.
+	failing := func(status int, failures int32) (*httptest.Server, *atomic.Int32) {
+		var calls atomic.Int32
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= failures {
+				http.Error(w, `{"error":{"message":"busy"}}`, status)
+				return
+			}
+			srv.Config.Handler.ServeHTTP(w, r)
+		}))
+		t.Cleanup(s.Close)
+		return s, &calls
+	}
+
+	t.Run("retryable status", func(t *testing.T) {
+		t.Parallel()
+		s, calls := failing(http.StatusServiceUnavailable, 2)
+		p := NewResilient(NewOpenAI(s.URL+"/v1/chat/completions", "", ""), nil, fastOptions)
+		stream, err := p.Stream(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text, finish, _ := collect(t, stream); text != srv.Reply || finish != FinishStop || calls.Load() != 3 {
+			t.Fatalf("got %q %q after %d calls", text, finish, calls.Load())
+		}
+	})
+
+	t.Run("rate limited then fallback", func(t *testing.T) {
+		t.Parallel()
+		s, calls := failing(http.StatusTooManyRequests, 10)
+		p := NewResilient(NewOpenAI(s.URL+"/v1/chat/completions", "", ""), NewAnthropic(srv.URL+"/v1/messages", "", ""), fastOptions)
+		stream, err := p.Stream(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text, _, _ := collect(t, stream); text != srv.Reply || calls.Load() != 3 {
+			t.Fatalf("got %q after %d calls to the primary", text, calls.Load())
+		}
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		t.Parallel()
+		s, calls := failing(http.StatusBadRequest, 10)
+		_, err := NewResilient(NewOpenAI(s.URL+"/v1/chat/completions", "", ""), nil, fastOptions).Stream(context.Background(), req)
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest || calls.Load() != 1 {
+			t.Fatalf("expected one 400, got %v after %d calls", err, calls.Load())
+		}
+	})
+
+	t.Run("connection error", func(t *testing.T) {
+		t.Parallel()
+		primary := &Fake{Err: errors.New("connection refused")}
+		fallback := &Fake{Reply: "From the backup."}
+		stream, err := NewResilient(primary, fallback, fastOptions).Stream(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text, _, _ := collect(t, stream); text != fallback.Reply || len(primary.Requests()) != 3 {
+			t.Fatalf("got %q after %d attempts", text, len(primary.Requests()))
+		}
+	})
+}
+
+func TestResilientTimeouts(t *testing.T) {
+	t.Parallel()
+	req := Request{Messages: []Message{{Role: RoleUser, Content: "Hello?"}}}
+
+	t.Run("first token", func(t *testing.T) {
+		t.Parallel()
+		var calls atomic.Int32
+		silent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		t.Cleanup(silent.Close)
+		start := time.Now()
+		_, err := NewResilient(NewOpenAI(silent.URL, "", ""), nil, fastOptions).Stream(context.Background(), req)
+		if !errors.Is(err, ErrFirstTokenTimeout) || calls.Load() != 3 {
+			t.Fatalf("expected a first-token timeout after 3 calls, got %v after %d", err, calls.Load())
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("took %v", elapsed)
+		}
+	})
+
+	t.Run("completion", func(t *testing.T) {
+		t.Parallel()
+		p := &Fake{Reply: "Once upon", Stall: true}
+		stream, err := NewResilient(p, nil, fastOptions).Stream(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stream.Close()
+		if ev, err := stream.Recv(); err != nil || ev.Text != p.Reply {
+			t.Fatalf("first event: %+v %v", ev, err)
+		}
+		if _, err := stream.Recv(); !errors.Is(err, ErrTimeout) {
+			t.Fatalf("expected a timeout, got %v", err)
+		}
+	})
+
+	t.Run("mid-stream failure is not retried", func(t *testing.T) {
+		t.Parallel()
+		p := &Fake{Reply: "Half an", StreamErr: io.ErrUnexpectedEOF}
+		fallback := &Fake{Reply: "unused"}
+		stream, err := NewResilient(p, fallback, fastOptions).Stream(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stream.Close()
+		stream.Recv()
+		if _, err := stream.Recv(); err != io.ErrUnexpectedEOF || len(p.Requests()) != 1 || len(fallback.Requests()) != 0 {
+			t.Fatalf("expected the failure to surface, got %v", err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		p := &Fake{Err: context.Canceled}
+		if _, err := NewResilient(p, &Fake{}, fastOptions).Stream(ctx, req); !errors.Is(err, context.Canceled) || len(p.Requests()) != 1 {
+			t.Fatalf("expected no retries once cancelled, got %v", err)
+		}
+	})
+}
+
+func TestResilientBackoff(t *testing.T) {
+	r := NewResilient(&Fake{}, nil, Options{Backoff: 4 * time.Nanosecond, MaxBackoff: 16 * time.Nanosecond})
+	for n, d := range map[int]time.Duration{1: 4, 2: 8, 3: 16, 4: 16} {
+		for i := 0; i < 100; i++ {
+			if got := r.backoff(n); got < d/2 || got >= d {
+				t.Fatalf("backoff(%d) = %v, want in [%v, %v)", n, got, d/2, d)
+			}
+		}
+	}
+}
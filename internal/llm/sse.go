@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// sseReader reads server-sent events.
+type sseReader struct {
+	r *bufio.Reader
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{r: bufio.NewReader(r)}
+}
+
+// next returns the name and data of the next event. Data split over several
+// data lines is joined with newlines; comments and events without data are
+// skipped. It returns io.EOF when the stream ends between events.
+func (s *sseReader) next() (event, data string, err error) {
+	var lines []string
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF && lines != nil {
+				return event, strings.Join(lines, "\n"), nil
+			}
+			return "", "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if lines != nil {
+				return event, strings.Join(lines, "\n"), nil
+			}
+			event = ""
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			lines = append(lines, value)
+		}
+	}
+}
@@ -1,28 +1,71 @@
 package logging
 
 import (
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+
+	"matchmaker/internal/health"
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/metrics"
 )
 
 var Log *logrus.Logger
 
-// Init configures the global logger.
+// Init configures the global logger from LOG_FORMAT and LOG_LEVEL so that
+// logging works before the full config is loaded. See Configure.
 func Init() {
 	Log = logrus.New()
-	Log.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	Log.AddHook(redactHook{})
+	if err := Configure(os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL")); err != nil {
+		Log.WithError(err).Warn("invalid log settings, using defaults")
+	}
+}
+
+// Configure selects the "json" (default) or "text" formatter and the minimum
+// level (default "info"). Every entry passes through the redaction hook
+// before it is written.
+func Configure(format, level string) error {
+	if Log == nil {
+		Init()
+	}
+	if strings.EqualFold(format, "text") {
+		Log.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	} else {
+		Log.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	}
+	if level == "" {
+		level = "info"
+	}
+	l, err := logrus.ParseLevel(level)
+	if err != nil {
+		Log.SetLevel(logrus.InfoLevel)
+		return err
+	}
+	Log.SetLevel(l)
+	return nil
 }
 
-// NewGinEngine returns a Gin engine that logs requests and panics using Log.
+// NewGinEngine returns a Gin engine that logs requests and panics using Log,
+// tags each request with an ID, records request metrics and exposes them on
+// /metrics, and serves the /healthz and /readyz probes. Panics and unknown
+// routes are answered with the standard error envelope.
 func NewGinEngine() *gin.Engine {
 	if Log == nil {
 		Init()
 	}
 	engine := gin.New()
-	engine.Use(gin.RecoveryWithWriter(Log.WriterLevel(logrus.ErrorLevel)))
+	engine.NoRoute(httputil.NotFound)
+	engine.Use(RequestID())
+	engine.Use(gin.CustomRecoveryWithWriter(Log.WriterLevel(logrus.ErrorLevel), httputil.Recovery))
+	engine.Use(metrics.Middleware())
 	engine.Use(requestLogger())
+	engine.GET("/metrics", metrics.Handler())
+	engine.GET("/healthz", health.Liveness)
+	engine.GET("/readyz", health.Readiness)
 	return engine
 }
 
@@ -30,12 +73,11 @@ func requestLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		c.Next()
-		entry := Log.WithFields(logrus.Fields{
-			"status":   c.Writer.Status(),
-			"method":   c.Request.Method,
-			"path":     c.Request.URL.Path,
-			"clientIP": c.ClientIP(),
-			"latency":  time.Since(start),
+		entry := FromContext(c).WithFields(logrus.Fields{
+			"status":  c.Writer.Status(),
+			"method":  c.Request.Method,
+			"path":    c.Request.URL.Path,
+			"latency": time.Since(start).String(),
 		})
 		if len(c.Errors) > 0 {
 			entry.Error(c.Errors.String())
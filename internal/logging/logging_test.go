@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRedact(t *testing.T) {
+	in := `user a@b.com sent {"dob":"2000-01-01","lat":12.5,"lon":-3} with Bearer abc.def`
+	out := Redact(in)
+	for _, leak := range []string{"a@b.com", "2000-01-01", "12.5", "abc.def"} {
+		if strings.Contains(out, leak) {
+			t.Fatalf("redacted output %q still contains %q", out, leak)
+		}
+	}
+}
+
+func TestRedactHook(t *testing.T) {
+	Init()
+	var buf bytes.Buffer
+	Log.SetOutput(&buf)
+	Log.WithField("email", "a@b.com").
+		WithError(errors.New("upstream said {\"token\":\"secret\"}")).
+		Info("login for c@d.com")
+	out := buf.String()
+	for _, leak := range []string{"a@b.com", "c@d.com", "secret"} {
+		if strings.Contains(out, leak) {
+			t.Fatalf("log line %q leaks %q", out, leak)
+		}
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Init()
+
+	var forwarded string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(RequestIDHeader)
+	}))
+	defer upstream.Close()
+
+	r := NewGinEngine()
+	r.GET("/", func(c *gin.Context) {
+		if FromContext(c).Data["request_id"] != "req-1" {
+			t.Error("request logger missing request_id")
+		}
+		req, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, upstream.URL, nil)
+		resp, err := NewHTTPClient().Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	r.ServeHTTP(w, req)
+	if w.Header().Get(RequestIDHeader) != "req-1" {
+		t.Fatalf("response header not echoed: %q", w.Header().Get(RequestIDHeader))
+	}
+	if forwarded != "req-1" {
+		t.Fatalf("request id not forwarded, got %q", forwarded)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Header().Get(RequestIDHeader) == "" {
+		t.Fatal("expected generated request id")
+	}
+}
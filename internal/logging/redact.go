@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are field names whose values are always masked.
+var sensitiveKeys = map[string]bool{
+	"email":         true,
+	"name":          true,
+	"dob":           true,
+	"tob":           true,
+	"lat":           true,
+	"lon":           true,
+	"latitude":      true,
+	"longitude":     true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"id_token":      true,
+	"authorization": true,
+	"password":      true,
+	"secret":        true,
+	"api_key":       true,
+	"apikey":        true,
+}
+
+var (
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	bearerPattern = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`)
+	jwtPattern    = regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`)
+	// jsonFieldPattern matches sensitive "key": value pairs inside JSON text,
+	// e.g. an upstream response body embedded in an error message.
+	jsonFieldPattern = regexp.MustCompile(`(?i)"(email|name|dob|tob|lat|lon|latitude|longitude|token|access_token|refresh_token|id_token|password|secret|api_key)"\s*:\s*("(?:[^"\\]|\\.)*"|[-+0-9.eE]+)`)
+)
+
+// Redact masks emails, birth data, coordinates and tokens in s.
+func Redact(s string) string {
+	s = jsonFieldPattern.ReplaceAllString(s, `"$1":"`+redacted+`"`)
+	s = bearerPattern.ReplaceAllString(s, "Bearer "+redacted)
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	s = emailPattern.ReplaceAllString(s, redacted)
+	return s
+}
+
+// redactHook scrubs the message and fields of every entry before it is
+// formatted.
+type redactHook struct{}
+
+func (redactHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (redactHook) Fire(e *logrus.Entry) error {
+	e.Message = Redact(e.Message)
+	for k, v := range e.Data {
+		if sensitiveKeys[strings.ToLower(k)] {
+			e.Data[k] = redacted
+			continue
+		}
+		switch val := v.(type) {
+		case string:
+			e.Data[k] = Redact(val)
+		case error:
+			e.Data[k] = Redact(val.Error())
+		case fmt.Stringer:
+			e.Data[k] = Redact(val.String())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader carries the request ID between clients and services.
+const RequestIDHeader = "X-Request-ID"
+
+const (
+	ginRequestIDKey = "request_id"
+	ginLoggerKey    = "logger"
+)
+
+type ctxKey int
+
+const (
+	requestIDCtxKey ctxKey = iota
+	loggerCtxKey
+)
+
+// RequestID reuses the incoming X-Request-ID header or generates a new ID,
+// echoes it on the response and stores it, along with a logger tagged with it,
+// in both the gin context and the request context. The header is also set on
+// the incoming request so reverse proxies forward it unchanged.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		c.Request.Header.Set(RequestIDHeader, id)
+		c.Header(RequestIDHeader, id)
+
+		entry := Log.WithField("request_id", id)
+		c.Set(ginRequestIDKey, id)
+		c.Set(ginLoggerKey, entry)
+		ctx := context.WithValue(c.Request.Context(), requestIDCtxKey, id)
+		ctx = context.WithValue(ctx, loggerCtxKey, entry)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// FromContext returns the request-scoped logger stored by RequestID, or the
+// global logger when ctx carries none. ctx may be a *gin.Context.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if Log == nil {
+		Init()
+	}
+	if gc, ok := ctx.(*gin.Context); ok {
+		if v, ok := gc.Get(ginLoggerKey); ok {
+			if entry, ok := v.(*logrus.Entry); ok {
+				return entry
+			}
+		}
+		if gc.Request == nil {
+			return logrus.NewEntry(Log)
+		}
+		ctx = gc.Request.Context()
+	}
+	if entry, ok := ctx.Value(loggerCtxKey).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(Log)
+}
+
+// RequestIDFromContext returns the request ID stored by RequestID, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	if gc, ok := ctx.(*gin.Context); ok {
+		if id := gc.GetString(ginRequestIDKey); id != "" {
+			return id
+		}
+		if gc.Request == nil {
+			return ""
+		}
+		ctx = gc.Request.Context()
+	}
+	id, _ := ctx.Value(requestIDCtxKey).(string)
+	return id
+}
+
+// WithRequestID returns a copy of ctx carrying id, for work started outside an
+// HTTP request that should still be correlated with one.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDCtxKey, id)
+	return context.WithValue(ctx, loggerCtxKey, Log.WithField("request_id", id))
+}
+
+// Transport is an http.RoundTripper that forwards the request ID found in the
+// outgoing request's context to the next service hop.
+type Transport struct {
+	// Base is the underlying transport; http.DefaultTransport when nil.
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := RequestIDFromContext(req.Context()); id != "" && req.Header.Get(RequestIDHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestIDHeader, id)
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// NewHTTPClient returns an HTTP client for calls between services that
+// propagates request IDs.
+func NewHTTPClient() *http.Client {
+	return &http.Client{Transport: &Transport{}}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
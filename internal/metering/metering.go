@@ -0,0 +1,294 @@
+// Package metering counts the tokens users spend chatting and enforces the
+// daily and monthly quotas of their plans.
+package metering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"matchmaker/internal/logging"
+	"matchmaker/internal/models"
+	"matchmaker/internal/store"
+)
+
+// Quota periods. Days and months are UTC.
+const (
+	Daily   = "daily"
+	Monthly = "monthly"
+)
+
+// Plan is a set of quotas on the tokens a user may spend. A zero quota is
+// unlimited.
+type Plan struct {
+	Name          string
+	DailyTokens   int64
+	MonthlyTokens int64
+}
+
+// ParsePlans parses plans written as name:daily/monthly, such as
+// "free:20000/200000".
+func ParsePlans(specs []string) (map[string]Plan, error) {
+	plans := map[string]Plan{}
+	for _, spec := range specs {
+		name, quotas, ok := strings.Cut(strings.TrimSpace(spec), ":")
+		daily, monthly, ok2 := strings.Cut(quotas, "/")
+		if !ok || !ok2 || name == "" {
+			return nil, fmt.Errorf("plan %q: want name:daily/monthly", spec)
+		}
+		p := Plan{Name: name}
+		var err error
+		if p.DailyTokens, err = strconv.ParseInt(daily, 10, 64); err != nil || p.DailyTokens < 0 {
+			return nil, fmt.Errorf("plan %q: invalid daily quota", spec)
+		}
+		if p.MonthlyTokens, err = strconv.ParseInt(monthly, 10, 64); err != nil || p.MonthlyTokens < 0 {
+			return nil, fmt.Errorf("plan %q: invalid monthly quota", spec)
+		}
+		plans[name] = p
+	}
+	return plans, nil
+}
+
+// QuotaError reports that a user spent a quota of their plan.
+type QuotaError struct {
+	Period   string    `json:"period"`
+	Limit    int64     `json:"limit"`
+	Used     int64     `json:"used"`
+	ResetsAt time.Time `json:"resetsAt"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota of %d tokens exceeded", e.Period, e.Limit)
+}
+
+// PlanSource looks up the plan of a user. Users it does not know, or who
+// have no plan, get the default plan.
+type PlanSource interface {
+	Plan(ctx context.Context, userID uint) (string, error)
+}
+
+// PeriodUsage is a user's usage in the current day or month.
+type PeriodUsage struct {
+	Period string `json:"period"`
+	models.Usage
+	Tokens int64 `json:"tokens"`
+	// Limit is the plan's quota for the period, or 0 when unlimited.
+	Limit    int64     `json:"limit"`
+	ResetsAt time.Time `json:"resetsAt"`
+}
+
+// Report is a user's plan and current usage.
+type Report struct {
+	Plan    string      `json:"plan"`
+	Daily   PeriodUsage `json:"daily"`
+	Monthly PeriodUsage `json:"monthly"`
+}
+
+// Counters are kept in the counting store a little longer than their
+// period, so late flushes still find them.
+const (
+	dayTTL   = 48 * time.Hour
+	monthTTL = 35 * 24 * time.Hour
+)
+
+func periodTTL(period string) time.Duration {
+	if len(period) == len(monthLayout) {
+		return monthTTL
+	}
+	return dayTTL
+}
+
+// Layouts of the periods of store.UsageKey.
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// flushBatch bounds the counters persisted per round trip.
+const flushBatch = 100
+
+// Meter counts usage in counters, which are shared by the replicas, and
+// persists it to records when flushed. Counters lost from the counting
+// store are seeded from records again.
+type Meter struct {
+	counters    store.UsageCounters
+	records     store.UsageStore
+	plans       PlanSource
+	catalog     map[string]Plan
+	defaultPlan string
+
+	// now is the clock; tests replace it.
+	now func() time.Time
+}
+
+// New returns a Meter applying the plans of catalog. Users get their plan
+// from plans, or defaultPlan when plans is nil or has none for them.
+func New(counters store.UsageCounters, records store.UsageStore, plans PlanSource, catalog map[string]Plan, defaultPlan string) *Meter {
+	return &Meter{
+		counters:    counters,
+		records:     records,
+		plans:       plans,
+		catalog:     catalog,
+		defaultPlan: defaultPlan,
+		now:         time.Now,
+	}
+}
+
+// period describes one quota period of a user's plan.
+type period struct {
+	name     string
+	key      store.UsageKey
+	limit    int64
+	ttl      time.Duration
+	resetsAt time.Time
+}
+
+func (m *Meter) periods(userID uint, plan Plan) [2]period {
+	now := m.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return [2]period{
+		{Daily, store.UsageKey{UserID: userID, Period: day.Format(dayLayout)}, plan.DailyTokens, dayTTL, day.AddDate(0, 0, 1)},
+		{Monthly, store.UsageKey{UserID: userID, Period: month.Format(monthLayout)}, plan.MonthlyTokens, monthTTL, month.AddDate(0, 1, 0)},
+	}
+}
+
+// plan returns the plan of userID.
+func (m *Meter) plan(ctx context.Context, userID uint) Plan {
+	name := ""
+	if m.plans != nil {
+		var err error
+		name, err = m.plans.Plan(ctx, userID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			logging.FromContext(ctx).WithError(err).WithField("user_id", userID).Warn("plan lookup failed; using the default plan")
+		}
+	}
+	if p, ok := m.catalog[name]; ok {
+		return p
+	}
+	if name != "" {
+		logging.FromContext(ctx).WithField("plan", name).Warn("unknown plan; using the default plan")
+	}
+	return m.catalog[m.defaultPlan]
+}
+
+// usage returns the counted usage of p, seeding the counter from the
+// records when it is not counted.
+func (m *Meter) usage(ctx context.Context, p period) (models.Usage, error) {
+	u, ok, err := m.counters.Get(ctx, p.key)
+	if err != nil || ok {
+		return u, err
+	}
+	if u, err = m.records.Get(ctx, p.key); err != nil {
+		return u, err
+	}
+	if err := m.counters.Seed(ctx, p.key, u, p.ttl); err != nil {
+		return u, err
+	}
+	u, _, err = m.counters.Get(ctx, p.key)
+	return u, err
+}
+
+// Check returns a *QuotaError when userID spent the daily or monthly quota
+// of their plan.
+func (m *Meter) Check(ctx context.Context, userID uint) error {
+	for _, p := range m.periods(userID, m.plan(ctx, userID)) {
+		if p.limit == 0 {
+			continue
+		}
+		u, err := m.usage(ctx, p)
+		if err != nil {
+			return err
+		}
+		if u.Tokens() >= p.limit {
+			return &QuotaError{Period: p.name, Limit: p.limit, Used: u.Tokens(), ResetsAt: p.resetsAt}
+		}
+	}
+	return nil
+}
+
+// Record adds u to the current day and month of userID.
+func (m *Meter) Record(ctx context.Context, userID uint, u models.Usage) error {
+	for _, p := range m.periods(userID, Plan{}) {
+		if _, err := m.usage(ctx, p); err != nil {
+			return err
+		}
+		if err := m.counters.Add(ctx, p.key, u, p.ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Report returns the plan and current usage of userID.
+func (m *Meter) Report(ctx context.Context, userID uint) (*Report, error) {
+	plan := m.plan(ctx, userID)
+	r := &Report{Plan: plan.Name}
+	for i, p := range m.periods(userID, plan) {
+		u, err := m.usage(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		pu := PeriodUsage{Period: p.key.Period, Usage: u, Tokens: u.Tokens(), Limit: p.limit, ResetsAt: p.resetsAt}
+		if i == 0 {
+			r.Daily = pu
+		} else {
+			r.Monthly = pu
+		}
+	}
+	return r, nil
+}
+
+// Flush persists the counters changed since the last flush. Counters that
+// fail to persist are marked dirty again.
+func (m *Meter) Flush(ctx context.Context) error {
+	for {
+		keys, err := m.counters.Dirty(ctx, flushBatch)
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+		for i, k := range keys {
+			u, ok, err := m.counters.Get(ctx, k)
+			if err == nil && ok {
+				err = m.records.Put(ctx, k, u)
+			}
+			if err != nil {
+				m.remark(ctx, keys[i:])
+				return err
+			}
+		}
+	}
+}
+
+// remark marks keys dirty again by adding nothing to them.
+func (m *Meter) remark(ctx context.Context, keys []store.UsageKey) {
+	for _, k := range keys {
+		if err := m.counters.Add(ctx, k, models.Usage{}, periodTTL(k.Period)); err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("key", k.String()).Error("failed to keep usage for the next flush")
+		}
+	}
+}
+
+// Run flushes every interval until ctx is done, then flushes a last time.
+func (m *Meter) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+			defer cancel()
+			if err := m.Flush(final); err != nil {
+				logging.FromContext(ctx).WithError(err).Error("failed to persist chat usage")
+			}
+			return
+		case <-t.C:
+			if err := m.Flush(ctx); err != nil {
+				logging.FromContext(ctx).WithError(err).Error("failed to persist chat usage")
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package metering
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"matchmaker/internal/models"
+	"matchmaker/internal/store"
+)
+
+type fixedPlans map[uint]string
+
+func (p fixedPlans) Plan(ctx context.Context, userID uint) (string, error) {
+	name, ok := p[userID]
+	if !ok {
+		return "", store.ErrNotFound
+	}
+	return name, nil
+}
+
+func TestParsePlans(t *testing.T) {
+	t.Parallel()
+	plans, err := ParsePlans([]string{"free:100/1000", " pro:0/50000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plans["free"] != (Plan{Name: "free", DailyTokens: 100, MonthlyTokens: 1000}) || plans["pro"] != (Plan{Name: "pro", MonthlyTokens: 50000}) {
+		t.Fatalf("got %+v", plans)
+	}
+	for _, bad := range []string{"free", "free:100", ":1/2", "free:x/2", "free:1/-2"} {
+		if _, err := ParsePlans([]string{bad}); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func newTestMeter(counters store.UsageCounters, records store.UsageStore) *Meter {
+	m := New(counters, records, fixedPlans{2: "pro"}, map[string]Plan{
+		"free": {Name: "free", DailyTokens: 100, MonthlyTokens: 150},
+		"pro":  {Name: "pro"},
+	}, "free")
+	m.now = func() time.Time { return time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC) }
+	return m
+}
+
+func TestMeterQuotas(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m := newTestMeter(store.NewMemoryUsageCounters(), store.NewMemoryUsageStore())
+	if err := m.Check(ctx, 1); err != nil {
+		t.Fatalf("fresh user: %v", err)
+	}
+	if err := m.Record(ctx, 1, models.Usage{Messages: 1, PromptTokens: 60, CompletionTokens: 40}); err != nil {
+		t.Fatal(err)
+	}
+	var q *QuotaError
+	if err := m.Check(ctx, 1); !errors.As(err, &q) {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+	if q.Period != Daily || q.Limit != 100 || q.Used != 100 || !q.ResetsAt.Equal(time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("got %+v", q)
+	}
+
+	// The next day only the monthly quota is left.
+	m.now = func() time.Time { return time.Date(2026, 10, 20, 1, 0, 0, 0, time.UTC) }
+	if err := m.Check(ctx, 1); err != nil {
+		t.Fatalf("next day: %v", err)
+	}
+	m.Record(ctx, 1, models.Usage{Messages: 1, PromptTokens: 50})
+	if err := m.Check(ctx, 1); !errors.As(err, &q) || q.Period != Monthly || !q.ResetsAt.Equal(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the monthly quota, got %v", err)
+	}
+
+	// Plans without quotas are unlimited.
+	m.Record(ctx, 2, models.Usage{Messages: 1, PromptTokens: 1 << 20})
+	if err := m.Check(ctx, 2); err != nil {
+		t.Fatalf("unlimited plan: %v", err)
+	}
+	r, err := m.Report(ctx, 2)
+	if err != nil || r.Plan != "pro" || r.Daily.Period != "2026-10-20" || r.Daily.Tokens != 1<<20 || r.Monthly.Limit != 0 {
+		t.Fatalf("report: %+v %v", r, err)
+	}
+}
+
+func TestMeterFlushAndSeed(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	records := store.NewMemoryUsageStore()
+	m := newTestMeter(store.NewMemoryUsageCounters(), records)
+	m.Record(ctx, 1, models.Usage{Messages: 1, PromptTokens: 30, CompletionTokens: 10})
+	if err := m.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := models.Usage{Messages: 1, PromptTokens: 30, CompletionTokens: 10}
+	for _, period := range []string{"2026-10-19", "2026-10"} {
+		if u, _ := records.Get(ctx, store.UsageKey{UserID: 1, Period: period}); u != want {
+			t.Fatalf("%s: saved %+v, want %+v", period, u, want)
+		}
+	}
+
+	// Counters lost from Redis are restored from the records.
+	m = newTestMeter(store.NewMemoryUsageCounters(), records)
+	m.Record(ctx, 1, models.Usage{Messages: 1, PromptTokens: 30, CompletionTokens: 30})
+	var q *QuotaError
+	if err := m.Check(ctx, 1); !errors.As(err, &q) || q.Used != 100 {
+		t.Fatalf("expected the seeded usage to count, got %v", err)
+	}
+	r, err := m.Report(ctx, 1)
+	if err != nil || r.Daily.Messages != 2 || r.Monthly.Tokens != 100 {
+		t.Fatalf("report: %+v %v", r, err)
+	}
+}
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "matchmaker"
+
+// HTTP metrics shared by every service.
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Report service metrics.
+var (
+	ReportCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "report",
+		Name:      "cache_hits_total",
+		Help:      "Report cache hits, by cache level (l1, l2).",
+	}, []string{"level"})
+
+	ReportCacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "report",
+		Name:      "cache_misses_total",
+		Help:      "Report cache misses, by cache level (l1, l2).",
+	}, []string{"level"})
+
+	ReportEngineCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "report",
+		Name:      "engine_calls_total",
+		Help:      "Calls to the external astrology engine, by result (success, error).",
+	}, []string{"result"})
+
+	ReportEngineLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "report",
+		Name:      "engine_duration_seconds",
+		Help:      "Latency of calls to the external astrology engine.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	})
+)
+
+// Match service metrics.
+var (
+	MatchJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "match",
+		Name:      "jobs_total",
+		Help:      "Finished analysis jobs, by kind (analysis, batch) and status (succeeded, failed).",
+	}, []string{"kind", "status"})
+	MatchJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "match",
+		Name:      "job_duration_seconds",
+		Help:      "Time from queueing an analysis job to its end, by kind.",
+		Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"kind"})
+	MatchWebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "match",
+		Name:      "webhook_deliveries_total",
+		Help:      "Analysis job webhook deliveries, by result (success, error).",
+	}, []string{"result"})
+)
+
+// Chat service metrics.
+var (
+	ChatActiveSessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "chat",
+		Name:      "active_sessions",
+		Help:      "Currently open chat WebSocket sessions.",
+	})
+
+	ChatLLMTokens = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "chat",
+		Name:      "llm_tokens_total",
+		Help:      "LLM completion tokens streamed to clients, as reported by the provider or estimated.",
+	})
+
+	ChatLLMDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "chat",
+		Name:      "llm_stream_duration_seconds",
+		Help:      "Time from LLM request to end of the streamed response.",
+		Buckets:   []float64{.25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	})
+
+	ChatLLMRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "chat",
+		Name:      "llm_retries_total",
+		Help:      "LLM calls retried after failing before their first token.",
+	})
+
+	ChatLLMFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "chat",
+		Name:      "llm_fallbacks_total",
+		Help:      "LLM calls sent to the fallback provider after the primary one failed.",
+	})
+)
+
+// Gateway metrics.
+var (
+	GatewayQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "gateway",
+		Name:      "worker_queue_depth",
+		Help:      "Proxy requests waiting for a free gateway worker.",
+	})
+
+	GatewayUpstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gateway",
+		Name:      "upstream_errors_total",
+		Help:      "Failed proxy requests, by upstream service.",
+	}, []string{"upstream"})
+)
+
+// EstimateTokens approximates the token count of LLM output at roughly four
+// bytes per token, which is close enough for throughput dashboards.
+func EstimateTokens(n int) int {
+	return (n + 3) / 4
+}
+
+// RegisterDBStats exports connection pool statistics for db under the given
+// database name.
+func RegisterDBStats(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Middleware records request count and latency for every handled request.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the Prometheus scrape endpoint.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/items/:id", func(c *gin.Context) { c.Status(http.StatusTeapot) })
+	r.GET("/metrics", Handler())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/items/42", nil))
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/items/:id", "418")); got != 1 {
+		t.Fatalf("expected 1 request recorded, got %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/nope", nil))
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "unmatched", "404")); got != 1 {
+		t.Fatalf("expected unmatched route recorded, got %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), "matchmaker_http_requests_total") {
+		t.Fatal("metrics endpoint missing request counter")
+	}
+}
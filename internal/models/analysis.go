@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Koota is one factor of an Ashtakoota compatibility score. Label and
+// Explanation are written in the language of each response and not stored.
+type Koota struct {
+	Name        string  `bson:"name" json:"name"`
+	Points      float64 `bson:"points" json:"points"`
+	Max         float64 `bson:"max" json:"max"`
+	Label       string  `bson:"-" json:"label,omitempty"`
+	Explanation string  `bson:"-" json:"explanation,omitempty"`
+}
+
+// Analysis is a stored compatibility analysis. Birth details are not kept;
+// InputHash identifies the request and ReportKeys the two reports it used.
+type Analysis struct {
+	ID               string    `bson:"_id" json:"analysisId"`
+	UserID           uint      `bson:"userId" json:"-"`
+	InputHash        string    `bson:"inputHash" json:"inputHash"`
+	ReportKeys       [2]string `bson:"reportKeys" json:"reportKeys"`
+	Score            int       `bson:"score" json:"score"`
+	Breakdown        []Koota   `bson:"breakdown" json:"breakdown"`
+	AlgorithmVersion string    `bson:"algorithmVersion" json:"algorithmVersion"`
+	CreatedAt        time.Time `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// ChatMessage is one turn of a stored conversation. Role is "user" or
+// "assistant". Tokens is the turn's size as reported by the model, or 0
+// when it has to be estimated.
+type ChatMessage struct {
+	Role    string    `json:"role"`
+	Content string    `json:"content"`
+	Tokens  int       `json:"tokens,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// ChatMemory is what the chat service remembers of a conversation: a
+// rolling summary of older turns and the recent turns verbatim, oldest
+// first.
+type ChatMemory struct {
+	Summary  string        `json:"summary,omitempty"`
+	Messages []ChatMessage `json:"messages"`
+}
+
+// ChatSession is a durable chat conversation of a user: the general one, or
+// one about an analysis. Its messages are kept as TranscriptMessages.
+type ChatSession struct {
+	ID           string    `bson:"_id" json:"sessionId"`
+	UserID       uint      `bson:"userId" json:"-"`
+	AnalysisID   string    `bson:"analysisId" json:"analysisId,omitempty"`
+	Title        string    `bson:"title" json:"title"`
+	MessageCount int64     `bson:"messageCount" json:"messageCount"`
+	CreatedAt    time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// TranscriptMessage is one message of a ChatSession. Seq numbers the
+// messages of a session from 1. Answers record the prompt and completion
+// tokens they cost and the version of the prompt template they answered.
+type TranscriptMessage struct {
+	SessionID        string    `bson:"sessionId" json:"-"`
+	Seq              int64     `bson:"seq" json:"seq"`
+	Role             string    `bson:"role" json:"role"`
+	Content          string    `bson:"content" json:"content"`
+	PromptTokens     int64     `bson:"promptTokens,omitempty" json:"promptTokens,omitempty"`
+	CompletionTokens int64     `bson:"completionTokens,omitempty" json:"completionTokens,omitempty"`
+	PromptVersion    string    `bson:"promptVersion,omitempty" json:"promptVersion,omitempty"`
+	At               time.Time `bson:"at" json:"at"`
+}
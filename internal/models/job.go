@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Statuses of an analysis job.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Kinds of analysis job.
+const (
+	// JobAnalysis scores two people.
+	JobAnalysis = "analysis"
+	// JobBatch ranks candidates against a subject.
+	JobBatch = "batch"
+)
+
+// AnalysisJob is an analysis run in the background for UserID. Request and
+// Result are the request and response bodies of its Kind; Error says why a
+// failed job failed. Locale is the language of the request that queued it,
+// in which its webhook is notified.
+type AnalysisJob struct {
+	ID        string          `json:"jobId"`
+	UserID    uint            `json:"userId"`
+	Kind      string          `json:"kind"`
+	Status    string          `json:"status"`
+	Locale    string          `json:"locale,omitempty"`
+	Request   json.RawMessage `json:"request,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// Done reports whether the job has finished, successfully or not.
+func (j *AnalysisJob) Done() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+// AnalysisWebhook is the URL to which the analysis jobs of UserID are
+// posted once they finish, signed with Secret.
+type AnalysisWebhook struct {
+	UserID    uint      `json:"-"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
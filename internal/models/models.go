@@ -15,12 +15,16 @@ type BirthDetail struct {
 	Longitude float64   `gorm:"type:decimal(11,8);not null"`
 }
 
-// User represents the main user profile.
+// User represents the main user profile. Plan names the chat plan whose
+// quotas apply to the user. Locale is the language the user prefers, such
+// as "hi"; empty when they have not chosen one.
 type User struct {
 	gorm.Model
 	Email       string `gorm:"type:varchar(100);uniqueIndex;not null"`
 	Gender      string `gorm:"type:varchar(10)"`
 	Location    string `gorm:"type:varchar(100)"`
 	PhotoURL    string
+	Plan        string      `gorm:"type:varchar(20);not null;default:'free'"`
+	Locale      string      `gorm:"type:varchar(8)"`
 	BirthDetail BirthDetail `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 }
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// ModerationFinding is a moderation rule, or the external moderation
+// service, objecting to a text.
+type ModerationFinding struct {
+	Rule     string `bson:"rule" json:"rule"`
+	Category string `bson:"category,omitempty" json:"category,omitempty"`
+	Action   string `bson:"action" json:"action"`
+}
+
+// Statuses of a ModerationEvent. Blocked and flagged texts wait for review
+// as pending; texts that were only redacted are logged.
+const (
+	ModerationPending   = "pending"
+	ModerationUpheld    = "upheld"
+	ModerationDismissed = "dismissed"
+	ModerationLogged    = "logged"
+)
+
+// ModerationEvent is an entry of the moderation audit log: a chat message
+// (direction "input") or answer ("output") that moderation objected to.
+// Action is the strongest action taken. Text is the moderated text with
+// personal data redacted.
+type ModerationEvent struct {
+	ID         string              `bson:"_id" json:"id"`
+	UserID     uint                `bson:"userId" json:"userId"`
+	AnalysisID string              `bson:"analysisId,omitempty" json:"analysisId,omitempty"`
+	MessageID  string              `bson:"messageId,omitempty" json:"messageId,omitempty"`
+	Direction  string              `bson:"direction" json:"direction"`
+	Action     string              `bson:"action" json:"action"`
+	Findings   []ModerationFinding `bson:"findings" json:"findings"`
+	Text       string              `bson:"text" json:"text"`
+	Status     string              `bson:"status" json:"status"`
+	CreatedAt  time.Time           `bson:"createdAt" json:"createdAt"`
+	Review     *ModerationReview   `bson:"review,omitempty" json:"review,omitempty"`
+}
+
+// ModerationReview is a moderator's decision on a pending ModerationEvent.
+type ModerationReview struct {
+	ModeratorID uint      `bson:"moderatorId" json:"moderatorId"`
+	Note        string    `bson:"note,omitempty" json:"note,omitempty"`
+	At          time.Time `bson:"at" json:"at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Usage counts the chat messages a user sent and the tokens their answers
+// consumed.
+type Usage struct {
+	Messages         int64 `gorm:"not null;default:0" json:"messages"`
+	PromptTokens     int64 `gorm:"not null;default:0" json:"promptTokens"`
+	CompletionTokens int64 `gorm:"not null;default:0" json:"completionTokens"`
+}
+
+// Tokens is the total of prompt and completion tokens, which quotas limit.
+func (u Usage) Tokens() int64 {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Add returns the sum of u and v.
+func (u Usage) Add(v Usage) Usage {
+	return Usage{
+		Messages:         u.Messages + v.Messages,
+		PromptTokens:     u.PromptTokens + v.PromptTokens,
+		CompletionTokens: u.CompletionTokens + v.CompletionTokens,
+	}
+}
+
+// UsageRecord is the persisted usage of a user in one period: a UTC day,
+// such as "2026-10-19", or month, such as "2026-10".
+type UsageRecord struct {
+	UserID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	Period    string `gorm:"primaryKey;type:varchar(10)"`
+	Usage     `gorm:"embedded"`
+	UpdatedAt time.Time
+}
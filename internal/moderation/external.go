@@ -0,0 +1,80 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// External asks a moderation service about texts. The service is posted
+//
+//	{"input": "...", "direction": "input"}
+//
+// and answers
+//
+//	{"flagged": true, "action": "block", "categories": ["harassment"]}
+//
+// where action is flag or block and defaults to flag for flagged texts.
+type External struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewExternal returns an External posting to url, authenticated with
+// apiKey as a bearer token when it is set. Each call is bounded by timeout.
+func NewExternal(url, apiKey string, timeout time.Duration) *External {
+	return &External{url: url, apiKey: apiKey, client: &http.Client{Timeout: timeout}}
+}
+
+// Check returns the service's findings about text going in direction.
+func (e *External) Check(ctx context.Context, direction, text string) ([]Finding, error) {
+	body, err := json.Marshal(map[string]string{"input": text, "direction": direction})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("moderation status %d: %s", resp.StatusCode, b)
+	}
+	var out struct {
+		Flagged    bool     `json:"flagged"`
+		Action     string   `json:"action"`
+		Categories []string `json:"categories"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("moderation response: %w", err)
+	}
+	if !out.Flagged {
+		return nil, nil
+	}
+	action := ActionFlag
+	if out.Action == ActionBlock {
+		action = ActionBlock
+	}
+	if len(out.Categories) == 0 {
+		return []Finding{{Rule: "external", Action: action}}, nil
+	}
+	fs := make([]Finding, len(out.Categories))
+	for i, c := range out.Categories {
+		fs[i] = Finding{Rule: "external", Category: c, Action: action}
+	}
+	return fs, nil
+}
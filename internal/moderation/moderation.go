@@ -0,0 +1,402 @@
+// Package moderation screens chat messages and answers against configured
+// rules: keyword lists, regular expressions, detectors of personal data and
+// an optional external moderation service.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+
+	"matchmaker/internal/logging"
+	"matchmaker/internal/models"
+)
+
+// Actions taken on text a rule matches, from the mildest. Flag lets the
+// text through and queues it for review, redact replaces the matched text
+// with Redacted, and block rejects the whole text and queues it for review.
+const (
+	ActionFlag   = "flag"
+	ActionRedact = "redact"
+	ActionBlock  = "block"
+)
+
+// Directions of moderated text.
+const (
+	Input  = "input"
+	Output = "output"
+)
+
+// CategoryPII is the category of the personal data detectors.
+const CategoryPII = "pii"
+
+// Redacted replaces redacted text.
+const Redacted = "[redacted]"
+
+var severity = map[string]int{ActionFlag: 1, ActionRedact: 2, ActionBlock: 3}
+
+// stronger reports whether action a is stronger than b.
+func stronger(a, b string) bool {
+	return severity[a] > severity[b]
+}
+
+// Rule applies Action to the text matched by any of Keywords, which match
+// whole words regardless of case, or by Pattern, a regular expression.
+// Direction limits the rule to Input or Output; empty applies it to both.
+type Rule struct {
+	Name      string   `yaml:"name"`
+	Category  string   `yaml:"category"`
+	Action    string   `yaml:"action"`
+	Direction string   `yaml:"direction"`
+	Keywords  []string `yaml:"keywords"`
+	Pattern   string   `yaml:"pattern"`
+
+	re *regexp.Regexp
+	// valid, when set, rejects matches of re that are not what the rule
+	// detects.
+	valid func(string) bool
+}
+
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule without a name")
+	}
+	if severity[r.Action] == 0 {
+		return fmt.Errorf("rule %s: action must be one of flag, redact, block", r.Name)
+	}
+	if r.Direction != "" && r.Direction != Input && r.Direction != Output {
+		return fmt.Errorf("rule %s: direction must be input or output", r.Name)
+	}
+	var alts []string
+	if len(r.Keywords) > 0 {
+		words := make([]string, len(r.Keywords))
+		for i, k := range r.Keywords {
+			words[i] = regexp.QuoteMeta(strings.TrimSpace(k))
+		}
+		alts = append(alts, `(?i)\b(?:`+strings.Join(words, "|")+`)\b`)
+	}
+	if r.Pattern != "" {
+		alts = append(alts, "(?:"+r.Pattern+")")
+	}
+	if len(alts) == 0 {
+		return fmt.Errorf("rule %s: keywords or pattern required", r.Name)
+	}
+	re, err := regexp.Compile(strings.Join(alts, "|"))
+	if err != nil {
+		return fmt.Errorf("rule %s: %w", r.Name, err)
+	}
+	r.re = re
+	return nil
+}
+
+// LoadRules reads rules from the YAML file at path, a list under "rules":
+//
+//	rules:
+//	  - name: threats
+//	    category: violence
+//	    action: block
+//	    direction: input
+//	    pattern: '(?i)\bkill (you|him|her)\b'
+func LoadRules(path string) ([]Rule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Rules []Rule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc.Rules, nil
+}
+
+var datePrefix = regexp.MustCompile(`^(\d{4}[-/.]\d{1,2}[-/.]\d{1,2}|\d{1,2}[-/.]\d{1,2}[-/.]\d{4})`)
+
+// PhoneRule detects phone numbers: 10 to 15 digits, optionally grouped and
+// prefixed with +. Dates, which birth details are full of, are not phone
+// numbers.
+func PhoneRule(action string) Rule {
+	return Rule{
+		Name:     "phone",
+		Category: CategoryPII,
+		Action:   action,
+		re:       regexp.MustCompile(`\+?\(?\d[\d\s().-]{8,}\d`),
+		valid: func(s string) bool {
+			digits := 0
+			for _, c := range s {
+				if c >= '0' && c <= '9' {
+					digits++
+				}
+			}
+			return digits >= 10 && digits <= 15 && !datePrefix.MatchString(strings.TrimPrefix(s, "+"))
+		},
+	}
+}
+
+// EmailRule detects email addresses.
+func EmailRule(action string) Rule {
+	return Rule{
+		Name:     "email",
+		Category: CategoryPII,
+		Action:   action,
+		re:       regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	}
+}
+
+// Finding is a rule, or the external service, objecting to a text.
+type Finding = models.ModerationFinding
+
+// Verdict is the outcome of moderating a text. Action is the strongest
+// action of the findings, or empty when nothing objected. Text is the text
+// with redactions applied.
+type Verdict struct {
+	Action   string
+	Text     string
+	Findings []Finding
+	// Private is the text with personal data redacted whatever the rules'
+	// actions, as kept for review.
+	Private string
+}
+
+// Blocked reports whether the text must be rejected.
+func (v Verdict) Blocked() bool {
+	return v.Action == ActionBlock
+}
+
+func (v *Verdict) add(f Finding) {
+	v.Findings = append(v.Findings, f)
+	if stronger(f.Action, v.Action) {
+		v.Action = f.Action
+	}
+}
+
+// Moderator screens text against its rules and, when configured, an
+// external service.
+type Moderator struct {
+	rules    []Rule
+	external *External
+}
+
+// New returns a Moderator applying rules, and consulting external unless it
+// is nil.
+func New(rules []Rule, external *External) (*Moderator, error) {
+	m := &Moderator{external: external}
+	for _, r := range rules {
+		if r.re == nil {
+			if err := r.compile(); err != nil {
+				return nil, err
+			}
+		}
+		m.rules = append(m.rules, r)
+	}
+	return m, nil
+}
+
+// match is a span of text matched by a rule.
+type match struct {
+	rule       *Rule
+	start, end int
+}
+
+// matches returns the spans of text matched by the rules for direction,
+// in order.
+func (m *Moderator) matches(direction, text string) []match {
+	var out []match
+	for i := range m.rules {
+		r := &m.rules[i]
+		if r.Direction != "" && r.Direction != direction {
+			continue
+		}
+		for _, loc := range r.re.FindAllStringIndex(text, -1) {
+			if r.valid != nil && !r.valid(text[loc[0]:loc[1]]) {
+				continue
+			}
+			out = append(out, match{rule: r, start: loc[0], end: loc[1]})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].start < out[j].start })
+	return out
+}
+
+// redact replaces the spans of text matched by ms with Redacted, except
+// those keep accepts. Overlapping spans are replaced once.
+func redact(text string, ms []match, keep func(match) bool) string {
+	var b strings.Builder
+	pos := 0
+	for _, mt := range ms {
+		if keep(mt) || mt.end <= pos {
+			continue
+		}
+		if mt.start >= pos {
+			b.WriteString(text[pos:mt.start])
+			b.WriteString(Redacted)
+		}
+		pos = mt.end
+	}
+	b.WriteString(text[pos:])
+	return b.String()
+}
+
+func notRedacted(mt match) bool {
+	return mt.rule.Action != ActionRedact
+}
+
+func notPrivate(mt match) bool {
+	return mt.rule.Action != ActionRedact && mt.rule.Category != CategoryPII
+}
+
+// verdict applies ms to text.
+func verdict(text string, ms []match) Verdict {
+	v := Verdict{Text: text, Private: text}
+	seen := map[string]bool{}
+	for _, mt := range ms {
+		if !seen[mt.rule.Name] {
+			seen[mt.rule.Name] = true
+			v.add(Finding{Rule: mt.rule.Name, Category: mt.rule.Category, Action: mt.rule.Action})
+		}
+	}
+	if len(ms) > 0 {
+		v.Text = redact(text, ms, notRedacted)
+		v.Private = redact(text, ms, notPrivate)
+	}
+	return v
+}
+
+// Check moderates text going in direction. When the external service
+// fails, only the rules apply.
+func (m *Moderator) Check(ctx context.Context, direction, text string) Verdict {
+	v := verdict(text, m.matches(direction, text))
+	if m.external != nil && !v.Blocked() {
+		fs, err := m.external.Check(ctx, direction, text)
+		if err != nil {
+			logging.FromContext(ctx).WithError(err).Warn("external moderation failed")
+		}
+		for _, f := range fs {
+			v.add(f)
+		}
+	}
+	return v
+}
+
+// Review asks the external service about a complete answer that was
+// moderated by a Filter while it streamed. Since the answer was shown
+// already, findings that would block it only flag it.
+func (m *Moderator) Review(ctx context.Context, text string) []Finding {
+	if m.external == nil {
+		return nil
+	}
+	fs, err := m.external.Check(ctx, Output, text)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Warn("external moderation failed")
+	}
+	for i := range fs {
+		if fs[i].Action == ActionBlock {
+			fs[i].Action = ActionFlag
+		}
+	}
+	return fs
+}
+
+// holdBack is how much of a streamed text a Filter keeps back, so that a
+// rule can still match text split across chunks. Matches longer than this
+// may slip through.
+const holdBack = 64
+
+// Filter moderates streamed output with the rules of a Moderator. Text is
+// passed on once it is holdBack bytes behind the end of the stream, or
+// when the stream ends.
+type Filter struct {
+	m        *Moderator
+	pending  string
+	shown    strings.Builder
+	withheld string
+	found    Verdict
+}
+
+// Filter returns a Filter for one streamed answer.
+func (m *Moderator) Filter() *Filter {
+	return &Filter{m: m}
+}
+
+// Write adds chunk to the stream and returns the text now safe to show.
+// blocked reports that a blocking rule matched; the stream must stop.
+func (f *Filter) Write(chunk string) (out string, blocked bool) {
+	f.pending += chunk
+	return f.release(len(f.pending) - holdBack)
+}
+
+// Flush ends the stream and returns the rest of the text.
+func (f *Filter) Flush() (out string, blocked bool) {
+	return f.release(len(f.pending))
+}
+
+// release passes on the pending text before cut, moved back so that no
+// match straddles it. When a blocking rule matches, the text before the
+// match is passed on and the rest is withheld.
+func (f *Filter) release(cut int) (string, bool) {
+	ms := f.m.matches(Output, f.pending)
+	blocked := false
+	for _, mt := range ms {
+		if mt.rule.Action == ActionBlock {
+			f.record([]match{mt})
+			cut, blocked = mt.start, true
+			break
+		}
+	}
+	for _, mt := range ms {
+		if mt.start < cut && mt.end > cut {
+			cut = mt.start
+		}
+	}
+	for cut > 0 && cut < len(f.pending) && !utf8.RuneStart(f.pending[cut]) {
+		cut--
+	}
+	out := ""
+	if cut > 0 {
+		var done []match
+		for _, mt := range ms {
+			if mt.end <= cut {
+				done = append(done, mt)
+			}
+		}
+		f.record(done)
+		out = redact(f.pending[:cut], done, notRedacted)
+		f.pending = f.pending[cut:]
+		f.shown.WriteString(out)
+	}
+	if blocked {
+		f.withheld, f.pending = f.pending, ""
+	}
+	return out, blocked
+}
+
+// record adds the findings of ms not found before.
+func (f *Filter) record(ms []match) {
+	for _, mt := range ms {
+		known := false
+		for _, fd := range f.found.Findings {
+			known = known || fd.Rule == mt.rule.Name
+		}
+		if !known {
+			f.found.add(Finding{Rule: mt.rule.Name, Category: mt.rule.Category, Action: mt.rule.Action})
+		}
+	}
+}
+
+// Verdict returns what the filter found in the stream so far. Its Text is
+// the text shown, and its Private text includes the text withheld when the
+// stream was blocked.
+func (f *Filter) Verdict() Verdict {
+	v := f.found
+	v.Text = f.shown.String()
+	all := v.Text + f.withheld
+	v.Private = redact(all, f.m.matches(Output, all), notPrivate)
+	return v
+}
@@ -0,0 +1,159 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newModerator(t *testing.T, external *External) *Moderator {
+	t.Helper()
+	m, err := New([]Rule{
+		{Name: "threats", Category: "violence", Action: ActionBlock, Pattern: `(?i)\bkill (you|him|her)\b`},
+		{Name: "slurs", Action: ActionRedact, Keywords: []string{"darn", "heck"}},
+		{Name: "spam", Action: ActionFlag, Direction: Input, Keywords: []string{"buy now"}},
+		PhoneRule(ActionRedact),
+		EmailRule(ActionFlag),
+	}, external)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	m := newModerator(t, nil)
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name, direction, text string
+		action, out, private  string
+	}{
+		{"clean", Input, "Is our nadi koota a problem?", "", "Is our nadi koota a problem?", "Is our nadi koota a problem?"},
+		{"dates are not phones", Input, "born 1990-04-12 and 12/04/1991", "", "born 1990-04-12 and 12/04/1991", "born 1990-04-12 and 12/04/1991"},
+		{"redact", Input, "Heck, call +1 (415) 555-0100", ActionRedact, "[redacted], call [redacted]", "[redacted], call [redacted]"},
+		{"flag keeps text", Input, "buy now at a@b.io", ActionFlag, "buy now at a@b.io", "buy now at [redacted]"},
+		{"direction", Output, "buy now", "", "buy now", "buy now"},
+		{"block", Input, "I will kill him, darn it", ActionBlock, "I will kill him, [redacted] it", "I will kill him, [redacted] it"},
+	} {
+		v := m.Check(ctx, tc.direction, tc.text)
+		if v.Action != tc.action || v.Text != tc.out || v.Private != tc.private {
+			t.Errorf("%s: got %+v", tc.name, v)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	os.WriteFile(path, []byte("rules:\n  - name: spam\n    action: flag\n    keywords: [lottery]\n"), 0o600)
+	rules, err := LoadRules(path)
+	if err != nil || len(rules) != 1 || rules[0].Keywords[0] != "lottery" {
+		t.Fatalf("load: %+v %v", rules, err)
+	}
+	m, err := New(rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := m.Check(context.Background(), Input, "You won the LOTTERY"); v.Action != ActionFlag || v.Findings[0].Rule != "spam" {
+		t.Fatalf("keywords ignore case: %+v", v)
+	}
+	for _, bad := range []Rule{
+		{Action: ActionFlag, Keywords: []string{"x"}},
+		{Name: "a", Action: "delete", Keywords: []string{"x"}},
+		{Name: "b", Action: ActionFlag},
+		{Name: "c", Action: ActionFlag, Pattern: "("},
+		{Name: "d", Action: ActionFlag, Direction: "sideways", Pattern: "x"},
+	} {
+		if _, err := New([]Rule{bad}, nil); err == nil {
+			t.Errorf("rule %+v accepted", bad)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+	m := newModerator(t, nil)
+
+	// A phone number split across chunks is still redacted.
+	f := m.Filter()
+	var shown strings.Builder
+	for _, chunk := range []string{"Call me on 415 5", "55 0100 any time. ", strings.Repeat("Good luck! ", 10)} {
+		out, blocked := f.Write(chunk)
+		if blocked {
+			t.Fatal("blocked")
+		}
+		shown.WriteString(out)
+	}
+	out, _ := f.Flush()
+	shown.WriteString(out)
+	want := "Call me on [redacted] any time. " + strings.Repeat("Good luck! ", 10)
+	if shown.String() != want {
+		t.Fatalf("shown %q", shown.String())
+	}
+	if v := f.Verdict(); v.Action != ActionRedact || v.Text != want {
+		t.Fatalf("verdict %+v", v)
+	}
+
+	// A blocked answer stops before the offending text.
+	f = m.Filter()
+	shown.Reset()
+	out, _ = f.Write(strings.Repeat("Fine. ", 20))
+	shown.WriteString(out)
+	out, blocked := f.Write("They might kill y")
+	shown.WriteString(out)
+	if !blocked {
+		out, blocked = f.Write("ou.")
+		shown.WriteString(out)
+	}
+	if !blocked || strings.Contains(shown.String(), "kill") {
+		t.Fatalf("expected block, shown %q", shown.String())
+	}
+	if v := f.Verdict(); !v.Blocked() || !strings.Contains(v.Private, "kill you") || v.Text != shown.String() {
+		t.Fatalf("verdict %+v", v)
+	}
+}
+
+func TestExternal(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req struct{ Input, Direction string }
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case strings.Contains(req.Input, "awful"):
+			w.Write([]byte(`{"flagged":true,"action":"block","categories":["harassment"]}`))
+		case strings.Contains(req.Input, "fail"):
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"flagged":false}`))
+		}
+	}))
+	defer srv.Close()
+	m := newModerator(t, NewExternal(srv.URL, "key", time.Second))
+	ctx := context.Background()
+
+	if v := m.Check(ctx, Input, "you are awful"); !v.Blocked() || v.Findings[0].Category != "harassment" {
+		t.Fatalf("external block: %+v", v)
+	}
+	// A failing service leaves the rules to decide.
+	if v := m.Check(ctx, Input, "fail, darn"); v.Action != ActionRedact {
+		t.Fatalf("fail open: %+v", v)
+	}
+	if v := m.Check(ctx, Input, "hello"); v.Action != "" {
+		t.Fatalf("clean: %+v", v)
+	}
+	// Answers already shown can only be flagged.
+	if fs := m.Review(ctx, "awful answer"); len(fs) != 1 || fs[0].Action != ActionFlag {
+		t.Fatalf("review: %+v", fs)
+	}
+}
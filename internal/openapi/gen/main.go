@@ -0,0 +1,418 @@
+// Command gen generates a Go client from the OpenAPI document. It emits one
+// type per component schema and one method per operation with a JSON
+// success response; other operations (redirects, WebSockets, plain text)
+// are skipped. Run it through "go generate ./api".
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"matchmaker/internal/openapi"
+)
+
+func main() {
+	spec := flag.String("spec", "openapi.json", "OpenAPI document")
+	pkg := flag.String("package", "apiclient", "package name of the generated code")
+	out := flag.String("out", "client.gen.go", "output file")
+	flag.Parse()
+
+	data, err := os.ReadFile(*spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	doc, err := openapi.Parse(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := Generate(doc, *pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Generate returns the formatted client source for doc.
+func Generate(doc *openapi.Document, pkg string) ([]byte, error) {
+	g := &generator{doc: doc}
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := g.schemaType(name, doc.Components.Schemas[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	g.printf("%s", clientBase)
+
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		item := doc.Paths[p]
+		for _, m := range openapi.Methods {
+			if op := (*item)[m]; op != nil {
+				if err := g.operation(p, m, op); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	var file bytes.Buffer
+	fmt.Fprintf(&file, "// Code generated by internal/openapi/gen from api/openapi.json; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&file, "// Package %s is a Go client for the Matchmaker HTTP API.\n", pkg)
+	fmt.Fprintf(&file, "package %s\n\nimport (\n", pkg)
+	for _, imp := range []string{"bytes", "context", "encoding/json", "fmt", "io", "net/http", "net/url", "strings", "time"} {
+		if imp != "time" || bytes.Contains(g.buf.Bytes(), []byte("time.Time")) {
+			fmt.Fprintf(&file, "%q\n", imp)
+		}
+	}
+	fmt.Fprintf(&file, ")\n\n")
+	file.Write(g.buf.Bytes())
+
+	src, err := format.Source(file.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, file.Bytes())
+	}
+	return src, nil
+}
+
+type generator struct {
+	doc *openapi.Document
+	buf bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) comment(text string) {
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		g.printf("// %s\n", line)
+	}
+}
+
+func (g *generator) schemaType(name string, s *openapi.Schema) error {
+	if s.Description != "" {
+		g.comment(name + ": " + s.Description)
+	} else {
+		g.comment(name + " is the " + name + " schema.")
+	}
+	switch {
+	case s.Type.Primary() == "object" && len(s.Properties) > 0:
+		g.printf("type %s struct {\n", name)
+		props := make([]string, 0, len(s.Properties))
+		for p := range s.Properties {
+			props = append(props, p)
+		}
+		sort.Strings(props)
+		for _, p := range props {
+			ps := s.Properties[p]
+			typ, err := g.goType(ps)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", name, p, err)
+			}
+			tag := p
+			if !contains(s.Required, p) {
+				tag += ",omitempty"
+			}
+			if ps.Description != "" {
+				g.comment(ps.Description)
+			}
+			g.printf("%s %s `json:%q`\n", goName(p), typ, tag)
+		}
+		g.printf("}\n\n")
+	case s.Type.Primary() == "string" && len(s.Enum) > 0:
+		g.printf("type %s string\n\n", name)
+		g.printf("const (\n")
+		for _, e := range s.Enum {
+			v := fmt.Sprint(e)
+			g.printf("%s%s %s = %q\n", name, goName(v), name, v)
+		}
+		g.printf(")\n\n")
+	default:
+		typ, err := g.goType(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		g.printf("type %s = %s\n\n", name, typ)
+	}
+	return nil
+}
+
+// goType returns the Go type of a property or inline schema.
+func (g *generator) goType(s *openapi.Schema) (string, error) {
+	if s.Ref != "" {
+		name, ok := openapi.RefName(s.Ref)
+		if !ok {
+			return "", fmt.Errorf("unsupported reference %q", s.Ref)
+		}
+		return name, nil
+	}
+	var typ string
+	switch s.Type.Primary() {
+	case "string":
+		typ = "string"
+		if s.Format == "date-time" {
+			typ = "time.Time"
+		}
+	case "integer":
+		typ = "int64"
+	case "number":
+		typ = "float64"
+	case "boolean":
+		typ = "bool"
+	case "array":
+		if s.Items == nil {
+			return "[]json.RawMessage", nil
+		}
+		item, err := g.goType(s.Items)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	case "object":
+		if s.AdditionalProperties != nil {
+			val, err := g.goType(s.AdditionalProperties)
+			if err != nil {
+				return "", err
+			}
+			return "map[string]" + val, nil
+		}
+		return "map[string]interface{}", nil
+	default:
+		return "json.RawMessage", nil
+	}
+	if s.Type.Has("null") {
+		typ = "*" + typ
+	}
+	return typ, nil
+}
+
+func (g *generator) operation(path, method string, op *openapi.Operation) error {
+	if op.OperationID == "" {
+		return fmt.Errorf("%s %s: missing operationId", strings.ToUpper(method), path)
+	}
+	var result string
+	for _, status := range []string{"200", "201"} {
+		r := g.doc.Response(op, status)
+		if r == nil {
+			continue
+		}
+		if mt := r.Content["application/json"]; mt != nil && mt.Schema != nil {
+			typ, err := g.goType(mt.Schema)
+			if err != nil {
+				return err
+			}
+			result = typ
+			break
+		}
+	}
+	if result == "" && g.doc.Response(op, "204") == nil {
+		return nil
+	}
+	name := goName(op.OperationID)
+
+	args := []string{"ctx context.Context"}
+	pathExpr := fmt.Sprintf("%q", path)
+	var query []openapi.Parameter
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			arg := lowerFirst(goName(p.Name))
+			args = append(args, arg+" string")
+			pathExpr = fmt.Sprintf("strings.ReplaceAll(%s, %q, url.PathEscape(%s))", pathExpr, "{"+p.Name+"}", arg)
+		case "query":
+			query = append(query, p)
+		}
+	}
+	if len(query) > 0 {
+		g.printf("// %sParams holds the query parameters of %s.\n", name, name)
+		g.printf("type %sParams struct {\n", name)
+		for _, p := range query {
+			g.printf("%s string\n", goName(p.Name))
+		}
+		g.printf("}\n\n")
+		args = append(args, "params "+name+"Params")
+	}
+	bodyExpr := "nil"
+	if op.RequestBody != nil {
+		if mt := op.RequestBody.Content["application/json"]; mt != nil && mt.Schema != nil {
+			typ, err := g.goType(mt.Schema)
+			if err != nil {
+				return err
+			}
+			args = append(args, "body "+typ)
+			bodyExpr = "body"
+		}
+	}
+
+	g.printf("// %s calls %s %s.", name, strings.ToUpper(method), path)
+	if op.Summary != "" {
+		g.printf(" %s", op.Summary)
+	}
+	g.printf("\n")
+	if result == "" {
+		g.printf("func (c *Client) %s(%s) error {\n", name, strings.Join(args, ", "))
+	} else {
+		g.printf("func (c *Client) %s(%s) (*%s, error) {\n", name, strings.Join(args, ", "), result)
+	}
+	g.printf("q := url.Values{}\n")
+	for _, p := range query {
+		g.printf("if params.%s != \"\" {\nq.Set(%q, params.%s)\n}\n", goName(p.Name), p.Name, goName(p.Name))
+	}
+	if result == "" {
+		g.printf("return c.do(ctx, %q, %s, q, %s, nil)\n}\n\n", strings.ToUpper(method), pathExpr, bodyExpr)
+		return nil
+	}
+	g.printf("var out %s\n", result)
+	g.printf("if err := c.do(ctx, %q, %s, q, %s, &out); err != nil {\nreturn nil, err\n}\n", strings.ToUpper(method), pathExpr, bodyExpr)
+	g.printf("return &out, nil\n}\n\n")
+	return nil
+}
+
+var initialisms = map[string]string{"id": "ID", "url": "URL", "uri": "URI", "dob": "DOB", "tob": "TOB", "json": "JSON", "api": "API"}
+
+// goName converts a JSON name or identifier to an exported Go name.
+func goName(s string) string {
+	var words []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			words = append(words, string(cur))
+			cur = nil
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]):
+			flush()
+			cur = append(cur, r)
+		default:
+			cur = append(cur, r)
+		}
+	}
+	flush()
+	var b strings.Builder
+	for _, w := range words {
+		if up, ok := initialisms[strings.ToLower(w)]; ok {
+			b.WriteString(up)
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	return b.String()
+}
+
+func lowerFirst(s string) string {
+	if strings.ToUpper(s) == s {
+		return strings.ToLower(s)
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+const clientBase = `// Client calls the Matchmaker API.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Token, when set, is sent as a bearer token.
+	Token string
+}
+
+// NewClient returns a Client for the API at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), HTTPClient: http.DefaultClient}
+}
+
+// APIError is an error response from the API.
+type APIError struct {
+	StatusCode int
+	Body       Error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("status %d: %s: %s", e.StatusCode, e.Body.Code, e.Body.Error)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(data, &apiErr.Body) != nil || apiErr.Body.Code == "" {
+			apiErr.Body.Error = strings.TrimSpace(string(data))
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+`
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"matchmaker/api"
+	"matchmaker/internal/openapi"
+)
+
+// TestGeneratedClientUpToDate fails when api/openapi.json changed without
+// running "go generate ./api".
+func TestGeneratedClientUpToDate(t *testing.T) {
+	doc, err := openapi.Parse(api.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Generate(doc, "apiclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("../../apiclient/client.gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("internal/apiclient/client.gen.go is stale; run go generate ./api")
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for in, want := range map[string]string{
+		"photoURL":          "PhotoURL",
+		"requestId":         "RequestID",
+		"dob":               "DOB",
+		"upstream_error":    "UpstreamError",
+		"createAnalysis":    "CreateAnalysis",
+		"getOpenAPI":        "GetOpenAPI",
+		"validation_failed": "ValidationFailed",
+	} {
+		if got := goName(in); got != want {
+			t.Errorf("goName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLowerFirst(t *testing.T) {
+	for in, want := range map[string]string{"ID": "id", "PersonA": "personA", "URL": "url"} {
+		if got := lowerFirst(in); got != want {
+			t.Errorf("lowerFirst(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
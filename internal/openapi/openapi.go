@@ -0,0 +1,52 @@
+package openapi
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/api"
+)
+
+// Load parses the embedded OpenAPI document.
+func Load() (*Document, error) {
+	return Parse(api.OpenAPI)
+}
+
+// Handler serves the OpenAPI document at GET /openapi.json.
+func Handler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", api.OpenAPI)
+}
+
+// AsyncAPIHandler serves the AsyncAPI document of the chat protocol at
+// GET /asyncapi.yaml.
+func AsyncAPIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml", api.AsyncAPI)
+}
+
+// Undocumented returns the routes, as "METHOD /path", that the document does
+// not describe. Catch-all proxy routes are skipped.
+func (d *Document) Undocumented(routes gin.RoutesInfo) []string {
+	var out []string
+	for _, r := range routes {
+		if strings.Contains(r.Path, "*") {
+			continue
+		}
+		if d.Operation(r.Method, r.Path) == nil {
+			out = append(out, r.Method+" "+r.Path)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
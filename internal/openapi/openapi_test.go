@@ -0,0 +1,119 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/httputil"
+	"matchmaker/internal/i18n"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestLoad(t *testing.T) {
+	doc, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Operation("POST", "/api/v1/analysis") == nil {
+		t.Fatal("createAnalysis not found")
+	}
+	// The profile accepts the locales i18n supports.
+	var locales []string
+	for _, l := range doc.Components.Schemas["ProfileUpdate"].Properties["locale"].Enum {
+		locales = append(locales, l.(string))
+	}
+	if got, want := strings.Join(locales, ","), strings.Join(i18n.Supported(), ","); got != want {
+		t.Fatalf("ProfileUpdate.locale enum is %s, want %s", got, want)
+	}
+	if _, err := Parse([]byte(`{"openapi":"3.1.0","paths":{"/x":{"get":{"responses":{"200":{"description":"","content":{"application/json":{"schema":{"$ref":"#/components/schemas/Missing"}}}}}}}}}`)); err == nil {
+		t.Fatal("expected unresolved reference error")
+	}
+}
+
+func TestValidator(t *testing.T) {
+	doc, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(doc.Validator())
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	r.POST("/api/v1/analysis", ok)
+	r.GET("/api/v1/auth/google/callback", ok)
+	r.Any("/api/v1/users/*path", ok)
+
+	cases := []struct {
+		name, method, path, body string
+		status                   int
+		code                     httputil.Code
+		fields                   []string
+	}{
+		{"valid", "POST", "/api/v1/analysis", `{"personA":{"dob":"1990-01-01","tob":"12:00:00","lat":1,"lon":2},"personB":{"dob":"1992-02-02","tob":"06:30:00"}}`, 204, "", nil},
+		{"missing fields", "POST", "/api/v1/analysis", `{"personA":{"tob":"12:00:00","lat":"north"}}`, 400, httputil.CodeValidationFailed, []string{"personB", "personA.dob", "personA.lat"}},
+		{"out of range", "POST", "/api/v1/analysis", `{"personA":{"dob":"x","tob":"y","lat":91},"personB":{"dob":"x","tob":"y"}}`, 400, httputil.CodeValidationFailed, []string{"personA.lat"}},
+		{"malformed", "POST", "/api/v1/analysis", `{`, 400, httputil.CodeInvalidRequest, nil},
+		{"empty", "POST", "/api/v1/analysis", ``, 400, httputil.CodeInvalidRequest, nil},
+		{"missing query", "GET", "/api/v1/auth/google/callback", ``, 400, httputil.CodeValidationFailed, []string{"code"}},
+		{"query present", "GET", "/api/v1/auth/google/callback?code=abc", ``, 204, "", nil},
+		{"undocumented", "PUT", "/api/v1/users/anything", `{`, 204, "", nil},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		r.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Fatalf("%s: expected %d got %d: %s", tc.name, tc.status, w.Code, w.Body)
+		}
+		if tc.code == "" {
+			continue
+		}
+		var e httputil.Error
+		json.Unmarshal(w.Body.Bytes(), &e)
+		if e.Code != tc.code {
+			t.Fatalf("%s: unexpected code %s", tc.name, w.Body)
+		}
+		var got []string
+		for _, d := range e.Details {
+			got = append(got, d.Field)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.fields, ",") {
+			t.Fatalf("%s: expected fields %v got %v", tc.name, tc.fields, got)
+		}
+	}
+}
+
+func TestValidatorKeepsBody(t *testing.T) {
+	doc, _ := Load()
+	r := gin.New()
+	r.Use(doc.Validator())
+	r.POST("/internal/v1/users", func(c *gin.Context) {
+		var req struct{ Email string }
+		if err := c.ShouldBindJSON(&req); err != nil || req.Email != "a@b.com" {
+			t.Errorf("body not restored: %v %+v", err, req)
+		}
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/internal/v1/users", strings.NewReader(`{"email":"a@b.com"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+}
+
+func TestUndocumented(t *testing.T) {
+	doc, _ := Load()
+	r := gin.New()
+	r.GET("/api/v1/users/me", func(*gin.Context) {})
+	r.GET("/api/v1/secret", func(*gin.Context) {})
+	r.Any("/api/v1/auth/*proxyPath", func(*gin.Context) {})
+	if got := doc.Undocumented(r.Routes()); len(got) != 1 || got[0] != "GET /api/v1/secret" {
+		t.Fatalf("unexpected undocumented routes %v", got)
+	}
+}
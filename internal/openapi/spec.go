@@ -0,0 +1,224 @@
+// Package openapi loads the OpenAPI document in package api, serves it, and
+// validates requests and the router against it.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Document is the subset of an OpenAPI 3.1 document used by the validator
+// and the client generator.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components struct {
+		Schemas   map[string]*Schema   `json:"schemas"`
+		Responses map[string]*Response `json:"responses"`
+	} `json:"components"`
+}
+
+// PathItem holds the operations of one path, keyed by lower-case method.
+type PathItem map[string]*Operation
+
+// Operation is one method on one path.
+type Operation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary"`
+	Parameters  []Parameter            `json:"parameters"`
+	RequestBody *RequestBody           `json:"requestBody"`
+	Responses   map[string]*Response   `json:"responses"`
+	Security    *[]map[string][]string `json:"security"`
+}
+
+// Parameter is a path, query or header parameter.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody describes an operation's body.
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response describes one response of an operation.
+type Response struct {
+	Ref         string                `json:"$ref"`
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// MediaType holds the schema of one content type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON Schema used in the document.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 Types              `json:"type"`
+	Format               string             `json:"format"`
+	Description          string             `json:"description"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	Items                *Schema            `json:"items"`
+	AdditionalProperties *Schema            `json:"additionalProperties"`
+	Enum                 []interface{}      `json:"enum"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+}
+
+// Types is a JSON Schema "type", which OpenAPI 3.1 allows to be a list such
+// as ["string", "null"].
+type Types []string
+
+// UnmarshalJSON accepts a single type name or a list.
+func (t *Types) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = Types{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// Has reports whether t includes name.
+func (t Types) Has(name string) bool {
+	for _, v := range t {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Primary returns the first non-null type, or "".
+func (t Types) Primary() string {
+	for _, v := range t {
+		if v != "null" {
+			return v
+		}
+	}
+	return ""
+}
+
+const schemaRefPrefix = "#/components/schemas/"
+
+// Parse decodes an OpenAPI document and checks that its references resolve.
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse openapi document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q", doc.OpenAPI)
+	}
+	var problems []string
+	var check func(where string, s *Schema)
+	check = func(where string, s *Schema) {
+		if s == nil {
+			return
+		}
+		if s.Ref != "" {
+			if _, err := doc.Resolve(s); err != nil {
+				problems = append(problems, where+": "+err.Error())
+			}
+		}
+		for name, p := range s.Properties {
+			check(where+"."+name, p)
+		}
+		check(where+"[]", s.Items)
+		check(where+"{}", s.AdditionalProperties)
+	}
+	for name, s := range doc.Components.Schemas {
+		check(name, s)
+	}
+	for path, item := range doc.Paths {
+		for method, op := range *item {
+			where := strings.ToUpper(method) + " " + path
+			for _, p := range op.Parameters {
+				check(where+" "+p.Name, p.Schema)
+			}
+			if op.RequestBody != nil {
+				for _, mt := range op.RequestBody.Content {
+					check(where+" body", mt.Schema)
+				}
+			}
+			for status, resp := range op.Responses {
+				r, err := doc.response(resp)
+				if err != nil {
+					problems = append(problems, where+" "+status+": "+err.Error())
+					continue
+				}
+				for _, mt := range r.Content {
+					check(where+" "+status, mt.Schema)
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid openapi document: %s", strings.Join(problems, "; "))
+	}
+	return &doc, nil
+}
+
+// Resolve follows s's $ref to a component schema.
+func (d *Document) Resolve(s *Schema) (*Schema, error) {
+	for s != nil && s.Ref != "" {
+		name, ok := RefName(s.Ref)
+		if !ok {
+			return nil, fmt.Errorf("unsupported reference %q", s.Ref)
+		}
+		target, ok := d.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown schema %q", name)
+		}
+		s = target
+	}
+	return s, nil
+}
+
+// Response follows r's $ref to a component response.
+func (d *Document) response(r *Response) (*Response, error) {
+	if r.Ref == "" {
+		return r, nil
+	}
+	name := strings.TrimPrefix(r.Ref, "#/components/responses/")
+	target, ok := d.Components.Responses[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown response %q", r.Ref)
+	}
+	return target, nil
+}
+
+// Response returns the resolved response of op for status.
+func (d *Document) Response(op *Operation, status string) *Response {
+	r, ok := op.Responses[status]
+	if !ok {
+		return nil
+	}
+	r, _ = d.response(r)
+	return r
+}
+
+// RefName returns the component name of a schema reference.
+func RefName(ref string) (string, bool) {
+	if !strings.HasPrefix(ref, schemaRefPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(ref, schemaRefPrefix), true
+}
+
+// Methods lists HTTP methods in the order operations are reported.
+var Methods = []string{"get", "put", "post", "patch", "delete", "head", "options"}
@@ -0,0 +1,276 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/httputil"
+)
+
+// maxBody bounds the request bodies read by the validator.
+const maxBody = 1 << 20
+
+// Operation returns the documented operation for a Gin route, or nil. Gin
+// parameters (":id") match OpenAPI templates ("{id}"); catch-all routes are
+// never documented.
+func (d *Document) Operation(method, route string) *Operation {
+	item, ok := d.Paths[specPath(route)]
+	if !ok {
+		return nil
+	}
+	return (*item)[strings.ToLower(method)]
+}
+
+// specPath converts a Gin route to an OpenAPI path template.
+func specPath(route string) string {
+	parts := strings.Split(route, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") {
+			parts[i] = "{" + p[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// Validator returns middleware that checks the query parameters and JSON body
+// of requests to documented routes against the document, answering
+// invalid requests with a validation_failed error listing every problem.
+// Undocumented routes, such as proxied catch-alls, pass through.
+func (d *Document) Validator() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op := d.Operation(c.Request.Method, c.FullPath())
+		if op == nil {
+			c.Next()
+			return
+		}
+		var details []httputil.FieldError
+		for _, p := range op.Parameters {
+			if p.In == "query" {
+				details = append(details, d.checkParam(p, c.Request.URL.Query())...)
+			}
+		}
+		if op.RequestBody != nil {
+			if mt := op.RequestBody.Content["application/json"]; mt != nil {
+				fieldErrs, err := d.checkBody(c, op.RequestBody.Required, mt.Schema)
+				if err != nil {
+					c.Abort()
+					httputil.WriteError(c, err)
+					return
+				}
+				details = append(details, fieldErrs...)
+			}
+		}
+		if len(details) > 0 {
+			e := httputil.New(httputil.CodeValidationFailed, "invalid request")
+			e.Details = details
+			c.Abort()
+			httputil.WriteError(c, e)
+			return
+		}
+		c.Next()
+	}
+}
+
+func (d *Document) checkParam(p Parameter, q url.Values) []httputil.FieldError {
+	vals, present := q[p.Name]
+	if !present || len(vals) == 0 || vals[0] == "" {
+		if p.Required {
+			return []httputil.FieldError{{Field: p.Name, Code: "required", Message: "is required"}}
+		}
+		return nil
+	}
+	if p.Schema == nil {
+		return nil
+	}
+	s, err := d.Resolve(p.Schema)
+	if err != nil {
+		return nil
+	}
+	var v interface{} = vals[0]
+	switch s.Type.Primary() {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(vals[0], 64)
+		if err != nil {
+			return []httputil.FieldError{{Field: p.Name, Code: "invalid_type", Message: "must be a number"}}
+		}
+		v = n
+	case "boolean":
+		b, err := strconv.ParseBool(vals[0])
+		if err != nil {
+			return []httputil.FieldError{{Field: p.Name, Code: "invalid_type", Message: "must be a boolean"}}
+		}
+		v = b
+	}
+	return d.ValidateValue(s, v, p.Name)
+}
+
+// checkBody validates the JSON body of c and restores it for the handler.
+func (d *Document) checkBody(c *gin.Context, required bool, s *Schema) ([]httputil.FieldError, *httputil.Error) {
+	var data []byte
+	if c.Request.Body != nil {
+		var err error
+		data, err = io.ReadAll(io.LimitReader(c.Request.Body, maxBody))
+		c.Request.Body.Close()
+		if err != nil {
+			return nil, httputil.New(httputil.CodeInvalidRequest, "unreadable request body")
+		}
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+	if len(bytes.TrimSpace(data)) == 0 {
+		if required {
+			return nil, httputil.New(httputil.CodeInvalidRequest, "request body is required")
+		}
+		return nil, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, httputil.New(httputil.CodeInvalidRequest, "malformed JSON body")
+	}
+	return d.ValidateValue(s, v, ""), nil
+}
+
+// ValidateValue checks a decoded JSON value against s and returns one
+// FieldError per problem. path names the value in the errors.
+func (d *Document) ValidateValue(s *Schema, v interface{}, path string) []httputil.FieldError {
+	s, err := d.Resolve(s)
+	if err != nil || s == nil {
+		return nil
+	}
+	fail := func(code, msg string) []httputil.FieldError {
+		return []httputil.FieldError{{Field: path, Code: code, Message: msg}}
+	}
+	if v == nil {
+		if len(s.Type) == 0 || s.Type.Has("null") {
+			return nil
+		}
+		return fail("invalid_type", "must not be null")
+	}
+	if t := s.Type.Primary(); t != "" && !hasType(v, t) {
+		return fail("invalid_type", "must be "+article(t))
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		return fail("invalid", "must be one of "+enumList(s.Enum))
+	}
+
+	switch v := v.(type) {
+	case string:
+		if s.MinLength != nil && len([]rune(v)) < *s.MinLength {
+			if v == "" {
+				return fail("required", "is required")
+			}
+			return fail("invalid", fmt.Sprintf("must be at least %d characters", *s.MinLength))
+		}
+		switch s.Format {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				return fail("invalid_format", "must be an RFC 3339 date-time")
+			}
+		case "date":
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				return fail("invalid_format", "must be a date (YYYY-MM-DD)")
+			}
+		case "uri":
+			if u, err := url.Parse(v); err != nil || u.Scheme == "" {
+				return fail("invalid_format", "must be an absolute URI")
+			}
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fail("invalid", "must be at least "+formatNumber(*s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fail("invalid", "must be at most "+formatNumber(*s.Maximum))
+		}
+	case []interface{}:
+		var out []httputil.FieldError
+		for i, item := range v {
+			out = append(out, d.ValidateValue(s.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return out
+	case map[string]interface{}:
+		var out []httputil.FieldError
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				out = append(out, httputil.FieldError{Field: join(path, name), Code: "required", Message: "is required"})
+			}
+		}
+		for _, name := range sortedKeys(v) {
+			if ps, ok := s.Properties[name]; ok {
+				out = append(out, d.ValidateValue(ps, v[name], join(path, name))...)
+			} else if s.AdditionalProperties != nil {
+				out = append(out, d.ValidateValue(s.AdditionalProperties, v[name], join(path, name))...)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func hasType(v interface{}, t string) bool {
+	switch t {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		n, ok := v.(float64)
+		return ok && n == float64(int64(n))
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	}
+	return true
+}
+
+func article(t string) string {
+	switch t {
+	case "integer", "object", "array":
+		return "an " + t
+	}
+	return "a " + t
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []interface{}) string {
+	parts := make([]string, len(enum))
+	for i, e := range enum {
+		parts[i] = fmt.Sprint(e)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,102 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+	s, err := New(Default(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, ok := s.Version(DefaultVersion)
+	if !ok {
+		t.Fatal("default template missing")
+	}
+
+	general, err := s.Render(tmpl, Data{Locale: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(general, "You are "+DefaultPersona+". Answer in Hindi (locale hi)") || strings.Contains(general, "analysis") {
+		t.Fatalf("general prompt:\n%s", general)
+	}
+
+	got, err := s.Render(tmpl, Data{Persona: "a kind astrologer", Analysis: &Analysis{
+		Score: 78, Points: "6", MaxPoints: "14",
+		Breakdown: []Koota{{Name: "gana", Points: "6", Max: "6"}, {Name: "nadi", Points: "0", Max: "8"}},
+		Reports:   []Report{{Person: "Person A", Text: `{"moon":1}`}, {Person: "Person B"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"You are a kind astrologer. Answer in English (locale en) ",
+		"Overall score: 78% (6 of 14 Ashtakoota points).\nKoota breakdown:\n- gana: 6 of 6\n- nadi: 0 of 8\n",
+		"Person A's report:\n{\"moon\":1}\nPerson B's report is unavailable.",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("prompt missing %q:\n%s", want, got)
+		}
+	}
+	legacy, _ := s.Render(tmpl, Data{Analysis: &Analysis{Score: 40}})
+	if !strings.Contains(legacy, "Overall score: 40%. No per-koota breakdown") {
+		t.Errorf("legacy analysis prompt:\n%s", legacy)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	t.Parallel()
+	s, err := New([]Template{
+		{Version: "a", Weight: 3, Text: "A"},
+		{Version: "b", Weight: 1, Text: "B"},
+		{Version: "old", Text: "retired"},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for id := uint(1); id <= 4000; id++ {
+		v := s.Assign(id).Version
+		if s.Assign(id).Version != v {
+			t.Fatalf("user %d reassigned", id)
+		}
+		counts[v]++
+	}
+	if counts["old"] != 0 || counts["a"] < 2700 || counts["a"] > 3300 {
+		t.Fatalf("unexpected split %v", counts)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "prompts.yaml")
+	os.WriteFile(path, []byte("templates:\n  - version: v2\n    weight: 1\n    persona: a poet\n    text: 'You are {{.Persona}} ({{.Locale}}).'\n"), 0o600)
+	templates, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(templates, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Render(s.Assign(1), Data{Locale: "fr"}); got != "You are a poet (fr)." {
+		t.Fatalf("got %q", got)
+	}
+	for _, bad := range [][]Template{
+		nil,
+		{{Version: "a", Text: "x"}},
+		{{Version: "a", Weight: 1, Text: "{{.Nope"}},
+		{{Version: "a", Weight: 1}, {Version: "a", Weight: 1}},
+		{{Weight: 1}},
+		{{Version: "a", Weight: -1}, {Version: "b", Weight: 2}},
+	} {
+		if _, err := New(bad, ""); err == nil {
+			t.Errorf("templates %+v accepted", bad)
+		}
+	}
+}
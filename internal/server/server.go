@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"matchmaker/internal/config"
+	"matchmaker/internal/health"
+	"matchmaker/internal/logging"
+)
+
+// background tracks goroutines that must finish before the process exits,
+// such as cache write-backs and open chat sessions.
+var background tracker
+
+// tracker counts work in flight. Unlike a sync.WaitGroup, work may start
+// while another goroutine waits for it to finish, and a wait can be given up
+// without leaving a goroutine behind.
+type tracker struct {
+	mu sync.Mutex
+	n  int
+	// idle is closed when n drops to zero.
+	idle chan struct{}
+}
+
+func (t *tracker) add() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.n == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.n++
+}
+
+func (t *tracker) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.n--
+	if t.n == 0 {
+		close(t.idle)
+	}
+}
+
+// wait returns a channel that is closed once no work is in flight.
+func (t *tracker) wait() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.n == 0 {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+	return t.idle
+}
+
+// Go runs fn in a goroutine that Run waits for during shutdown.
+func Go(fn func()) {
+	background.add()
+	go func() {
+		defer background.done()
+		fn()
+	}()
+}
+
+// Track marks the start of work that Run should wait for during shutdown and
+// returns the function that marks its end.
+func Track() (done func()) {
+	background.add()
+	var once sync.Once
+	return func() { once.Do(background.done) }
+}
+
+// Wait blocks until all tracked work has finished or ctx is done.
+func Wait(ctx context.Context) error {
+	select {
+	case <-background.wait():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run serves h with the configured timeouts until SIGINT or SIGTERM. On a
+// signal it marks the process as not ready and keeps serving for
+// cfg.DrainDelay, so that load balancers stop routing to it first. It then
+// calls onShutdown hooks (e.g. to close hijacked WebSocket connections),
+// stops accepting connections, and waits up to cfg.ShutdownTimeout for
+// in-flight requests and tracked background work to finish.
+func Run(h http.Handler, cfg *config.Server, onShutdown ...func()) error {
+	srv := &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           h,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	for _, fn := range onShutdown {
+		srv.RegisterOnShutdown(fn)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		logging.Log.WithField("addr", cfg.Addr()).Info("server listening")
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+	stop()
+
+	logging.Log.WithField("timeout", cfg.ShutdownTimeout.String()).Info("shutting down")
+	health.SetDraining()
+	if cfg.DrainDelay > 0 {
+		logging.Log.WithField("delay", cfg.DrainDelay.String()).Info("waiting for load balancers to stop routing")
+		select {
+		case <-time.After(cfg.DrainDelay):
+		case err := <-errCh:
+			return err
+		}
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil {
+		logging.Log.WithError(err).Warn("http drain incomplete")
+	}
+	if werr := Wait(shutdownCtx); werr != nil {
+		logging.Log.WithError(werr).Warn("background work did not finish before deadline")
+		if err == nil {
+			err = werr
+		}
+	}
+	logging.Log.Info("shutdown complete")
+	return err
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"matchmaker/internal/config"
+	"matchmaker/internal/health"
+	"matchmaker/internal/logging"
+)
+
+func TestWait(t *testing.T) {
+	release := make(chan struct{})
+	Go(func() { <-release })
+	done := Track()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := Wait(ctx); err == nil {
+		t.Fatal("expected deadline error while work is in flight")
+	}
+
+	close(release)
+	done()
+	done() // calling done twice must not panic
+	if err := Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitWhileWorkStarts(t *testing.T) {
+	// Work may start while Wait is blocked, as chat sessions do during
+	// shutdown, and giving up on Wait must not leave a goroutine behind.
+	release := make(chan struct{})
+	Go(func() { <-release })
+	waited := make(chan error, 1)
+	go func() { waited <- Wait(context.Background()) }()
+	done := Track()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	before := runtime.NumGoroutine()
+	if err := Wait(ctx); err == nil {
+		t.Fatal("expected deadline error while work is in flight")
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Wait left %d goroutines behind", after-before)
+	}
+	close(release)
+	done()
+	if err := <-waited; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunDrainDelay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logging.Init()
+	health.Reset()
+	defer health.Reset()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	r := gin.New()
+	r.GET("/readyz", health.Readiness)
+	cfg := &config.Server{Port: port, ShutdownTimeout: time.Second, DrainDelay: 300 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() { done <- Run(r, cfg) }()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/readyz", port)
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	ready := func() int {
+		resp, err := client.Get(url)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for deadline := time.Now().Add(5 * time.Second); ready() != http.StatusOK; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start")
+		}
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+
+	// The server keeps answering, as not ready, until the delay is over.
+	for deadline := time.Now().Add(time.Second); ready() != http.StatusServiceUnavailable; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("readiness did not fail while draining")
+		}
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("server stopped before the drain delay: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+	if ready() != 0 {
+		t.Fatal("server still listening after shutdown")
+	}
+}
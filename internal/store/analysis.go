@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"matchmaker/internal/models"
+)
+
+// MongoAnalysisStore stores analyses in the "analyses" collection.
+type MongoAnalysisStore struct {
+	coll *mongo.Collection
+}
+
+// NewMongoAnalysisStore stores analyses in db.analyses.
+func NewMongoAnalysisStore(db *mongo.Database) *MongoAnalysisStore {
+	return &MongoAnalysisStore{coll: db.Collection("analyses")}
+}
+
+// EnsureIndexes creates the index used to list a user's analyses.
+func (s *MongoAnalysisStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}},
+	})
+	return err
+}
+
+// Create implements AnalysisStore.
+func (s *MongoAnalysisStore) Create(ctx context.Context, a *models.Analysis) error {
+	_, err := s.coll.InsertOne(ctx, a)
+	return err
+}
+
+// Get implements AnalysisStore.
+func (s *MongoAnalysisStore) Get(ctx context.Context, id string) (*models.Analysis, error) {
+	var a models.Analysis
+	err := s.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&a)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListByUser implements AnalysisStore.
+func (s *MongoAnalysisStore) ListByUser(ctx context.Context, userID uint, offset, limit int) ([]models.Analysis, int64, error) {
+	filter := bson.M{"userId": userID}
+	total, err := s.coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cur, err := s.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	out := []models.Analysis{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+// Delete implements AnalysisStore.
+func (s *MongoAnalysisStore) Delete(ctx context.Context, id string) error {
+	res, err := s.coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
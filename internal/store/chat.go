@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"matchmaker/internal/models"
+)
+
+// RedisChatHistory stores conversations as JSON under
+// chat_context:<user id>, or chat_context:<user id>:<analysis id> for
+// conversations about an analysis.
+type RedisChatHistory struct {
+	client *redis.Client
+}
+
+// NewRedisChatHistory returns a ChatHistoryStore backed by client.
+func NewRedisChatHistory(client *redis.Client) *RedisChatHistory {
+	return &RedisChatHistory{client: client}
+}
+
+func chatKey(userID uint, analysisID string) string {
+	if analysisID == "" {
+		return fmt.Sprintf("chat_context:%d", userID)
+	}
+	return fmt.Sprintf("chat_context:%d:%s", userID, analysisID)
+}
+
+// Get implements ChatHistoryStore. Conversations stored as plain
+// transcripts by earlier versions are returned as the summary.
+func (s *RedisChatHistory) Get(ctx context.Context, userID uint, analysisID string) (models.ChatMemory, error) {
+	var m models.ChatMemory
+	val, err := s.client.Get(ctx, chatKey(userID, analysisID)).Result()
+	if err == redis.Nil {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	if !strings.HasPrefix(val, "{") {
+		m.Summary = val
+		return m, nil
+	}
+	err = json.Unmarshal([]byte(val), &m)
+	return m, err
+}
+
+// Set implements ChatHistoryStore.
+func (s *RedisChatHistory) Set(ctx context.Context, userID uint, analysisID string, memory models.ChatMemory, ttl time.Duration) error {
+	b, err := json.Marshal(memory)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, chatKey(userID, analysisID), b, ttl).Err()
+}
+
+// Delete implements ChatHistoryStore.
+func (s *RedisChatHistory) Delete(ctx context.Context, userID uint, analysisID string) error {
+	return s.client.Del(ctx, chatKey(userID, analysisID)).Err()
+}
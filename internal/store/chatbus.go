@@ -0,0 +1,422 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Retention of conversation logs, which only serve clients catching up
+// after a reconnect.
+const (
+	chatEventMaxLen = 1000
+	chatEventTTL    = 24 * time.Hour
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// it is dropped.
+const subscriberBuffer = 256
+
+// busSub is a local subscriber of a conversation: to its events or to its
+// signals.
+type busSub struct {
+	events  chan ChatEvent
+	signals chan []byte
+}
+
+// pumpEvents delivers to out the events numbered after after: the retained
+// ones read with events, then those received on live. Events missed on live
+// are read with events too. out is closed when ctx is done or live is
+// closed.
+func pumpEvents(ctx context.Context, after uint64, live <-chan ChatEvent, events func(from, to uint64) ([]ChatEvent, error), out chan<- ChatEvent) {
+	defer close(out)
+	next := after + 1
+	deliver := func(evs []ChatEvent) bool {
+		for _, ev := range evs {
+			if ev.Seq < next {
+				continue
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return false
+			}
+			next = ev.Seq + 1
+		}
+		return true
+	}
+	retained, err := events(next, 0)
+	if err != nil || !deliver(retained) {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-live:
+			if !ok {
+				return
+			}
+			if ev.Seq > next {
+				missed, err := events(next, ev.Seq-1)
+				if err != nil || !deliver(missed) {
+					return
+				}
+			}
+			if !deliver([]ChatEvent{ev}) {
+				return
+			}
+		}
+	}
+}
+
+// publishScript numbers an event, logs it and publishes it, atomically so
+// that events are logged in order.
+var publishScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[2])
+redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[2], '0-' .. seq, 'd', ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+redis.call('PUBLISH', KEYS[3], seq .. ':' .. ARGV[1])
+return seq
+`)
+
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var acquireScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return 1
+`)
+
+var renewSlotScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[2]) then
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+	return redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return 0
+`)
+
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisChatBus is a ChatBus shared by all replicas using the same Redis.
+// The events of a conversation are numbered by chat_seq:<key>, logged in
+// the stream chat_events:<key> and published on chat_live:<key>; signals
+// are published on chat_signal:<key>. Each replica subscribes once to the
+// channels its clients follow.
+type RedisChatBus struct {
+	client *redis.Client
+
+	mu      sync.Mutex
+	ps      *redis.PubSub
+	subs    map[string]map[*busSub]struct{}
+	pending map[string][]chan struct{}
+}
+
+// NewRedisChatBus returns a ChatBus backed by client.
+func NewRedisChatBus(client *redis.Client) *RedisChatBus {
+	return &RedisChatBus{
+		client:  client,
+		subs:    map[string]map[*busSub]struct{}{},
+		pending: map[string][]chan struct{}{},
+	}
+}
+
+// Close stops the subscriptions of the bus.
+func (b *RedisChatBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ps == nil {
+		return nil
+	}
+	return b.ps.Close()
+}
+
+// Publish implements ChatBus.
+func (b *RedisChatBus) Publish(ctx context.Context, key string, data []byte) (uint64, error) {
+	keys := []string{"chat_events:" + key, "chat_seq:" + key, "chat_live:" + key}
+	return publishScript.Run(ctx, b.client, keys, data, chatEventMaxLen, chatEventTTL.Milliseconds()).Uint64()
+}
+
+// Last implements ChatBus.
+func (b *RedisChatBus) Last(ctx context.Context, key string) (uint64, error) {
+	seq, err := b.client.Get(ctx, "chat_seq:"+key).Uint64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// Subscribe implements ChatBus.
+func (b *RedisChatBus) Subscribe(ctx context.Context, key string, after uint64) (<-chan ChatEvent, error) {
+	channel := "chat_live:" + key
+	s := &busSub{events: make(chan ChatEvent, subscriberBuffer)}
+	if err := b.subscribe(ctx, channel, s); err != nil {
+		return nil, err
+	}
+	out := make(chan ChatEvent)
+	go func() {
+		defer b.unsubscribe(channel, s)
+		pumpEvents(ctx, after, s.events, func(from, to uint64) ([]ChatEvent, error) {
+			return b.events(ctx, key, from, to)
+		}, out)
+	}()
+	return out, nil
+}
+
+// events reads the logged events of key numbered from from to to, or to
+// the last one when to is 0.
+func (b *RedisChatBus) events(ctx context.Context, key string, from, to uint64) ([]ChatEvent, error) {
+	end := "+"
+	if to > 0 {
+		end = fmt.Sprintf("0-%d", to)
+	}
+	msgs, err := b.client.XRange(ctx, "chat_events:"+key, fmt.Sprintf("0-%d", from), end).Result()
+	if err != nil {
+		return nil, err
+	}
+	evs := make([]ChatEvent, 0, len(msgs))
+	for _, m := range msgs {
+		_, seq, _ := strings.Cut(m.ID, "-")
+		n, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed chat event id %q", m.ID)
+		}
+		data, _ := m.Values["d"].(string)
+		evs = append(evs, ChatEvent{Seq: n, Data: []byte(data)})
+	}
+	return evs, nil
+}
+
+// Signal implements ChatBus.
+func (b *RedisChatBus) Signal(ctx context.Context, key string, data []byte) error {
+	return b.client.Publish(ctx, "chat_signal:"+key, data).Err()
+}
+
+// Signals implements ChatBus.
+func (b *RedisChatBus) Signals(ctx context.Context, key string) (<-chan []byte, error) {
+	channel := "chat_signal:" + key
+	s := &busSub{signals: make(chan []byte, subscriberBuffer)}
+	if err := b.subscribe(ctx, channel, s); err != nil {
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		b.unsubscribe(channel, s)
+	}()
+	return s.signals, nil
+}
+
+// Lock implements ChatBus. The lock is renewed every third of ttl until it
+// is released.
+func (b *RedisChatBus) Lock(ctx context.Context, name string, ttl time.Duration) (func(), error) {
+	key := "chat_lock:" + name
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := b.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLocked
+	}
+	return keepRenewed(ttl, func() {
+		renewScript.Run(context.Background(), b.client, []string{key}, token, ttl.Milliseconds())
+	}, func() {
+		unlockScript.Run(context.Background(), b.client, []string{key}, token)
+	}), nil
+}
+
+// Acquire implements ChatBus. The slots called name are the members of the
+// sorted set chat_slots:<name>, scored by their expiry; a slot is renewed
+// every third of ttl until it is released.
+func (b *RedisChatBus) Acquire(ctx context.Context, name string, limit int, ttl time.Duration) (func(), error) {
+	key := "chat_slots:" + name
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	expiry := func() int64 { return time.Now().Add(ttl).UnixMilli() }
+	ok, err := acquireScript.Run(ctx, b.client, []string{key}, time.Now().UnixMilli(), limit, expiry(), token, ttl.Milliseconds()).Bool()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLimit
+	}
+	return keepRenewed(ttl, func() {
+		renewSlotScript.Run(context.Background(), b.client, []string{key}, expiry(), token, ttl.Milliseconds())
+	}, func() {
+		b.client.ZRem(context.Background(), key, token)
+	}), nil
+}
+
+// keepRenewed calls renew every third of ttl until the returned function is
+// called, which calls release once.
+func keepRenewed(ttl time.Duration, renew, release func()) func() {
+	stop := make(chan struct{})
+	go func() {
+		t := time.NewTicker(ttl / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				renew()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			release()
+		})
+	}
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// subscribe adds s to the local subscribers of channel, subscribing the
+// replica to it first if needed. It returns once Redis confirmed the
+// subscription, so that no later message is missed.
+func (b *RedisChatBus) subscribe(ctx context.Context, channel string, s *busSub) error {
+	b.mu.Lock()
+	if b.ps == nil {
+		b.ps = b.client.Subscribe(context.Background())
+		go b.dispatch(b.ps.ChannelWithSubscriptions())
+	}
+	var err error
+	confirmed := make(chan struct{})
+	switch {
+	case b.subs[channel] == nil:
+		b.subs[channel] = map[*busSub]struct{}{}
+		b.pending[channel] = append(b.pending[channel], confirmed)
+		err = b.ps.Subscribe(ctx, channel)
+	case b.pending[channel] != nil:
+		b.pending[channel] = append(b.pending[channel], confirmed)
+	default:
+		close(confirmed)
+	}
+	b.subs[channel][s] = struct{}{}
+	b.mu.Unlock()
+	if err == nil {
+		select {
+		case <-confirmed:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if err != nil {
+		b.unsubscribe(channel, s)
+	}
+	return err
+}
+
+// unsubscribe removes s from the subscribers of channel, unsubscribing the
+// replica from it when s was the last one.
+func (b *RedisChatBus) unsubscribe(channel string, s *busSub) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[channel][s]; !ok {
+		return
+	}
+	delete(b.subs[channel], s)
+	if s.signals != nil {
+		close(s.signals)
+	}
+	if len(b.subs[channel]) == 0 {
+		delete(b.subs, channel)
+		b.ps.Unsubscribe(context.Background(), channel)
+	}
+}
+
+// dispatch hands the messages received by the replica to the local
+// subscribers of their channel.
+func (b *RedisChatBus) dispatch(ch <-chan interface{}) {
+	for m := range ch {
+		if sub, ok := m.(*redis.Subscription); ok {
+			if sub.Kind == "subscribe" {
+				b.mu.Lock()
+				for _, confirmed := range b.pending[sub.Channel] {
+					close(confirmed)
+				}
+				delete(b.pending, sub.Channel)
+				b.mu.Unlock()
+			}
+			continue
+		}
+		msg, ok := m.(*redis.Message)
+		if !ok {
+			continue
+		}
+		var ev ChatEvent
+		if strings.HasPrefix(msg.Channel, "chat_live:") {
+			seq, data, _ := strings.Cut(msg.Payload, ":")
+			n, err := strconv.ParseUint(seq, 10, 64)
+			if err != nil {
+				continue
+			}
+			ev = ChatEvent{Seq: n, Data: []byte(data)}
+		}
+		b.mu.Lock()
+		subs := b.subs[msg.Channel]
+		for s := range subs {
+			deliver(subs, s, ev, []byte(msg.Payload))
+		}
+		if subs != nil && len(subs) == 0 {
+			delete(b.subs, msg.Channel)
+			b.ps.Unsubscribe(context.Background(), msg.Channel)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// deliver hands ev, or signal, to s without blocking. Signals are dropped
+// when s is not keeping up; an event subscriber that falls behind is
+// removed from subs and its channel closed.
+func deliver(subs map[*busSub]struct{}, s *busSub, ev ChatEvent, signal []byte) {
+	if s.signals != nil {
+		select {
+		case s.signals <- signal:
+		default:
+		}
+		return
+	}
+	select {
+	case s.events <- ev:
+	default:
+		delete(subs, s)
+		close(s.events)
+	}
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"matchmaker/internal/models"
+)
+
+// RedisAnalysisJobStore stores jobs as JSON under analysis_job:<id>, so
+// that every match replica sees them, and forgets them ttl after their
+// last update.
+type RedisAnalysisJobStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisAnalysisJobStore returns an AnalysisJobStore backed by client.
+func NewRedisAnalysisJobStore(client *redis.Client, ttl time.Duration) *RedisAnalysisJobStore {
+	return &RedisAnalysisJobStore{client: client, ttl: ttl}
+}
+
+func jobKey(id string) string {
+	return "analysis_job:" + id
+}
+
+// Put implements AnalysisJobStore.
+func (s *RedisAnalysisJobStore) Put(ctx context.Context, j *models.AnalysisJob) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, jobKey(j.ID), b, s.ttl).Err()
+}
+
+// Get implements AnalysisJobStore.
+func (s *RedisAnalysisJobStore) Get(ctx context.Context, id string) (*models.AnalysisJob, error) {
+	b, err := s.client.Get(ctx, jobKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var j models.AnalysisJob
+	if err := json.Unmarshal(b, &j); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// Redis keys of the analysis job queue: the list of queued jobs, the list
+// of jobs popped but not acknowledged, and the lease on each of those.
+const (
+	analysisJobQueueKey      = "analysis_jobs"
+	analysisJobProcessingKey = "analysis_jobs:processing"
+)
+
+func jobLeaseKey(id string) string {
+	return "analysis_job_lease:" + id
+}
+
+// recoverJobScript queues again the popped job ARGV[1] if nobody holds its
+// lease and it was not acknowledged meanwhile. It is pushed to the end
+// workers take jobs from, as it has waited the longest.
+var recoverJobScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[3]) == 1 then
+	return 0
+end
+if redis.call("LREM", KEYS[2], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call("RPUSH", KEYS[1], ARGV[1])
+return 1
+`)
+
+// RedisAnalysisJobQueue queues jobs in a Redis list shared by every match
+// replica. Pop moves each job to a processing list, where it stays until it
+// is acknowledged, and leases it under analysis_job_lease:<id>.
+type RedisAnalysisJobQueue struct {
+	client *redis.Client
+	lease  time.Duration
+	// grace is how long Recover waits before queueing a job it found
+	// without a lease, since Pop leases a job only after taking it.
+	grace time.Duration
+}
+
+// NewRedisAnalysisJobQueue returns an AnalysisJobQueue backed by client.
+func NewRedisAnalysisJobQueue(client *redis.Client) *RedisAnalysisJobQueue {
+	return &RedisAnalysisJobQueue{client: client, lease: AnalysisJobLease, grace: time.Second}
+}
+
+// Push implements AnalysisJobQueue.
+func (q *RedisAnalysisJobQueue) Push(ctx context.Context, id string) error {
+	return q.client.LPush(ctx, analysisJobQueueKey, id).Err()
+}
+
+// Pop implements AnalysisJobQueue.
+func (q *RedisAnalysisJobQueue) Pop(ctx context.Context, timeout time.Duration) (string, error) {
+	id, err := q.client.BLMove(ctx, analysisJobQueueKey, analysisJobProcessingKey, "RIGHT", "LEFT", timeout).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// Should this fail, the job is recovered once Recover finds it.
+	return id, q.Extend(ctx, id)
+}
+
+// Extend implements AnalysisJobQueue.
+func (q *RedisAnalysisJobQueue) Extend(ctx context.Context, id string) error {
+	return q.client.Set(ctx, jobLeaseKey(id), 1, q.lease).Err()
+}
+
+// Ack implements AnalysisJobQueue.
+func (q *RedisAnalysisJobQueue) Ack(ctx context.Context, id string) error {
+	_, err := q.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.LRem(ctx, analysisJobProcessingKey, 1, id)
+		p.Del(ctx, jobLeaseKey(id))
+		return nil
+	})
+	return err
+}
+
+// Recover implements AnalysisJobQueue.
+func (q *RedisAnalysisJobQueue) Recover(ctx context.Context) (int, error) {
+	ids, err := q.client.LRange(ctx, analysisJobProcessingKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	var stale []string
+	for _, id := range ids {
+		n, err := q.client.Exists(ctx, jobLeaseKey(id)).Result()
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			stale = append(stale, id)
+		}
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-time.After(q.grace):
+	}
+	recovered := 0
+	for _, id := range stale {
+		keys := []string{analysisJobQueueKey, analysisJobProcessingKey, jobLeaseKey(id)}
+		n, err := recoverJobScript.Run(ctx, q.client, keys, id).Int()
+		if err != nil {
+			return recovered, err
+		}
+		recovered += n
+	}
+	return recovered, nil
+}
+
+// RedisAnalysisWebhookStore stores webhooks as JSON under
+// analysis_webhook:<userID>.
+type RedisAnalysisWebhookStore struct {
+	client *redis.Client
+}
+
+// NewRedisAnalysisWebhookStore returns an AnalysisWebhookStore backed by
+// client.
+func NewRedisAnalysisWebhookStore(client *redis.Client) *RedisAnalysisWebhookStore {
+	return &RedisAnalysisWebhookStore{client: client}
+}
+
+func webhookKey(userID uint) string {
+	return "analysis_webhook:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// Put implements AnalysisWebhookStore.
+func (s *RedisAnalysisWebhookStore) Put(ctx context.Context, w *models.AnalysisWebhook) error {
+	b, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, webhookKey(w.UserID), b, 0).Err()
+}
+
+// Get implements AnalysisWebhookStore.
+func (s *RedisAnalysisWebhookStore) Get(ctx context.Context, userID uint) (*models.AnalysisWebhook, error) {
+	b, err := s.client.Get(ctx, webhookKey(userID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	w := models.AnalysisWebhook{UserID: userID}
+	if err := json.Unmarshal(b, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// Delete implements AnalysisWebhookStore.
+func (s *RedisAnalysisWebhookStore) Delete(ctx context.Context, userID uint) error {
+	return s.client.Del(ctx, webhookKey(userID)).Err()
+}
@@ -0,0 +1,765 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"matchmaker/internal/models"
+)
+
+// MemoryReportStore is an in-memory ReportStore for tests and local runs.
+type MemoryReportStore struct {
+	mu      sync.RWMutex
+	reports map[string][]byte
+}
+
+// NewMemoryReportStore returns an empty MemoryReportStore.
+func NewMemoryReportStore() *MemoryReportStore {
+	return &MemoryReportStore{reports: map[string][]byte{}}
+}
+
+// Get implements ReportStore.
+func (s *MemoryReportStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.reports[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r, nil
+}
+
+// Put implements ReportStore.
+func (s *MemoryReportStore) Put(ctx context.Context, key string, report []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports[key] = append([]byte(nil), report...)
+	return nil
+}
+
+// Len returns the number of cached reports.
+func (s *MemoryReportStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.reports)
+}
+
+// MemoryUserRepository is an in-memory UserRepository for tests.
+type MemoryUserRepository struct {
+	mu     sync.Mutex
+	nextID uint
+	users  map[uint]models.User
+}
+
+// NewMemoryUserRepository returns an empty MemoryUserRepository.
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{nextID: 1, users: map[uint]models.User{}}
+}
+
+// FindOrCreateByEmail implements UserRepository.
+func (r *MemoryUserRepository) FindOrCreateByEmail(ctx context.Context, email string) (*models.User, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Email == email {
+			return &u, false, nil
+		}
+	}
+	u := models.User{Email: email}
+	u.ID = r.nextID
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = u.CreatedAt
+	r.nextID++
+	r.users[u.ID] = u
+	return &u, true, nil
+}
+
+// Get implements UserRepository.
+func (r *MemoryUserRepository) Get(ctx context.Context, id uint) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &u, nil
+}
+
+// GetProfile implements UserRepository.
+func (r *MemoryUserRepository) GetProfile(ctx context.Context, id uint) (*models.User, error) {
+	u, err := r.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	u.BirthDetail = models.BirthDetail{}
+	return u, nil
+}
+
+// Save implements UserRepository.
+func (r *MemoryUserRepository) Save(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	updated := *user
+	updated.BirthDetail = existing.BirthDetail
+	updated.UpdatedAt = time.Now()
+	r.users[user.ID] = updated
+	return nil
+}
+
+// Plan returns the name of the user's chat plan or ErrNotFound.
+func (r *MemoryUserRepository) Plan(ctx context.Context, id uint) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[id]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return u.Plan, nil
+}
+
+// MemoryChatHistory is an in-memory ChatHistoryStore for tests. TTLs are
+// ignored.
+type MemoryChatHistory struct {
+	mu      sync.Mutex
+	history map[string]models.ChatMemory
+}
+
+// NewMemoryChatHistory returns an empty MemoryChatHistory.
+func NewMemoryChatHistory() *MemoryChatHistory {
+	return &MemoryChatHistory{history: map[string]models.ChatMemory{}}
+}
+
+// Get implements ChatHistoryStore.
+func (s *MemoryChatHistory) Get(ctx context.Context, userID uint, analysisID string) (models.ChatMemory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.history[chatKey(userID, analysisID)]
+	m.Messages = append([]models.ChatMessage(nil), m.Messages...)
+	return m, nil
+}
+
+// Set implements ChatHistoryStore.
+func (s *MemoryChatHistory) Set(ctx context.Context, userID uint, analysisID string, memory models.ChatMemory, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	memory.Messages = append([]models.ChatMessage(nil), memory.Messages...)
+	s.history[chatKey(userID, analysisID)] = memory
+	return nil
+}
+
+// Delete implements ChatHistoryStore.
+func (s *MemoryChatHistory) Delete(ctx context.Context, userID uint, analysisID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.history, chatKey(userID, analysisID))
+	return nil
+}
+
+// MemoryChatTranscripts is an in-memory ChatTranscriptStore for tests and
+// for chat services run without MongoDB.
+type MemoryChatTranscripts struct {
+	mu       sync.Mutex
+	sessions map[string]models.ChatSession
+	messages map[string][]models.TranscriptMessage
+}
+
+// NewMemoryChatTranscripts returns an empty MemoryChatTranscripts.
+func NewMemoryChatTranscripts() *MemoryChatTranscripts {
+	return &MemoryChatTranscripts{sessions: map[string]models.ChatSession{}, messages: map[string][]models.TranscriptMessage{}}
+}
+
+// Append implements ChatTranscriptStore.
+func (s *MemoryChatTranscripts) Append(ctx context.Context, sess models.ChatSession, msgs []models.TranscriptMessage) (*models.ChatSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	cur, ok := s.find(sess.UserID, sess.AnalysisID)
+	if !ok {
+		cur = sess
+		cur.MessageCount = 0
+		cur.CreatedAt = now
+	}
+	for _, m := range msgs {
+		cur.MessageCount++
+		m.SessionID, m.Seq = cur.ID, cur.MessageCount
+		s.messages[cur.ID] = append(s.messages[cur.ID], m)
+	}
+	cur.UpdatedAt = now
+	s.sessions[cur.ID] = cur
+	return &cur, nil
+}
+
+func (s *MemoryChatTranscripts) find(userID uint, analysisID string) (models.ChatSession, bool) {
+	for _, sess := range s.sessions {
+		if sess.UserID == userID && sess.AnalysisID == analysisID {
+			return sess, true
+		}
+	}
+	return models.ChatSession{}, false
+}
+
+// FindSession implements ChatTranscriptStore.
+func (s *MemoryChatTranscripts) FindSession(ctx context.Context, userID uint, analysisID string) (*models.ChatSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.find(userID, analysisID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &sess, nil
+}
+
+// GetSession implements ChatTranscriptStore.
+func (s *MemoryChatTranscripts) GetSession(ctx context.Context, id string) (*models.ChatSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &sess, nil
+}
+
+// ListSessions implements ChatTranscriptStore.
+func (s *MemoryChatTranscripts) ListSessions(ctx context.Context, userID uint, offset, limit int) ([]models.ChatSession, int64, error) {
+	s.mu.Lock()
+	var mine []models.ChatSession
+	for _, sess := range s.sessions {
+		if sess.UserID == userID {
+			mine = append(mine, sess)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(mine, func(i, j int) bool { return mine[i].UpdatedAt.After(mine[j].UpdatedAt) })
+	return page(mine, offset, limit), int64(len(mine)), nil
+}
+
+// Messages implements ChatTranscriptStore.
+func (s *MemoryChatTranscripts) Messages(ctx context.Context, sessionID string, offset, limit int) ([]models.TranscriptMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit <= 0 {
+		limit = len(s.messages[sessionID])
+	}
+	return page(s.messages[sessionID], offset, limit), nil
+}
+
+// DeleteSession implements ChatTranscriptStore.
+func (s *MemoryChatTranscripts) DeleteSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.sessions, id)
+	delete(s.messages, id)
+	return nil
+}
+
+// page returns a copy of up to limit items of all, skipping the first
+// offset.
+func page[T any](all []T, offset, limit int) []T {
+	out := []T{}
+	if offset >= len(all) {
+		return out
+	}
+	all = all[offset:]
+	if limit < len(all) {
+		all = all[:limit]
+	}
+	return append(out, all...)
+}
+
+// MemoryAnalysisStore is an in-memory AnalysisStore for tests and for match
+// services run without MongoDB.
+type MemoryAnalysisStore struct {
+	mu       sync.Mutex
+	analyses map[string]models.Analysis
+}
+
+// NewMemoryAnalysisStore returns an empty MemoryAnalysisStore.
+func NewMemoryAnalysisStore() *MemoryAnalysisStore {
+	return &MemoryAnalysisStore{analyses: map[string]models.Analysis{}}
+}
+
+// Create implements AnalysisStore.
+func (s *MemoryAnalysisStore) Create(ctx context.Context, a *models.Analysis) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.analyses[a.ID] = *a
+	return nil
+}
+
+// Get implements AnalysisStore.
+func (s *MemoryAnalysisStore) Get(ctx context.Context, id string) (*models.Analysis, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.analyses[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &a, nil
+}
+
+// ListByUser implements AnalysisStore.
+func (s *MemoryAnalysisStore) ListByUser(ctx context.Context, userID uint, offset, limit int) ([]models.Analysis, int64, error) {
+	s.mu.Lock()
+	var mine []models.Analysis
+	for _, a := range s.analyses {
+		if a.UserID == userID {
+			mine = append(mine, a)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(mine, func(i, j int) bool { return mine[i].CreatedAt.After(mine[j].CreatedAt) })
+	return page(mine, offset, limit), int64(len(mine)), nil
+}
+
+// Delete implements AnalysisStore.
+func (s *MemoryAnalysisStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.analyses[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.analyses, id)
+	return nil
+}
+
+// MemoryAnalysisJobStore is an in-memory AnalysisJobStore for tests and
+// for match services run without Redis. Jobs are never forgotten.
+type MemoryAnalysisJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]models.AnalysisJob
+}
+
+// NewMemoryAnalysisJobStore returns an empty MemoryAnalysisJobStore.
+func NewMemoryAnalysisJobStore() *MemoryAnalysisJobStore {
+	return &MemoryAnalysisJobStore{jobs: map[string]models.AnalysisJob{}}
+}
+
+// Put implements AnalysisJobStore.
+func (s *MemoryAnalysisJobStore) Put(ctx context.Context, j *models.AnalysisJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[j.ID] = *j
+	return nil
+}
+
+// Get implements AnalysisJobStore.
+func (s *MemoryAnalysisJobStore) Get(ctx context.Context, id string) (*models.AnalysisJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &j, nil
+}
+
+// MemoryAnalysisJobQueue is an AnalysisJobQueue for a single process, for
+// tests and for match services run without Redis. Its jobs die with the
+// process, so popped jobs need no lease.
+type MemoryAnalysisJobQueue struct {
+	mu    sync.Mutex
+	ids   []string
+	ready chan struct{}
+}
+
+// NewMemoryAnalysisJobQueue returns an empty MemoryAnalysisJobQueue.
+func NewMemoryAnalysisJobQueue() *MemoryAnalysisJobQueue {
+	return &MemoryAnalysisJobQueue{ready: make(chan struct{}, 1)}
+}
+
+// Push implements AnalysisJobQueue.
+func (q *MemoryAnalysisJobQueue) Push(ctx context.Context, id string) error {
+	q.mu.Lock()
+	q.ids = append(q.ids, id)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pop implements AnalysisJobQueue.
+func (q *MemoryAnalysisJobQueue) Pop(ctx context.Context, timeout time.Duration) (string, error) {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	for {
+		q.mu.Lock()
+		if len(q.ids) > 0 {
+			id := q.ids[0]
+			q.ids = q.ids[1:]
+			more := len(q.ids) > 0
+			q.mu.Unlock()
+			if more {
+				// Wake the next worker for the rest.
+				select {
+				case q.ready <- struct{}{}:
+				default:
+				}
+			}
+			return id, nil
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.ready:
+		case <-t.C:
+			return "", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// Extend implements AnalysisJobQueue.
+func (q *MemoryAnalysisJobQueue) Extend(ctx context.Context, id string) error {
+	return nil
+}
+
+// Ack implements AnalysisJobQueue.
+func (q *MemoryAnalysisJobQueue) Ack(ctx context.Context, id string) error {
+	return nil
+}
+
+// Recover implements AnalysisJobQueue.
+func (q *MemoryAnalysisJobQueue) Recover(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+// MemoryAnalysisWebhookStore is an in-memory AnalysisWebhookStore for tests
+// and for match services run without Redis.
+type MemoryAnalysisWebhookStore struct {
+	mu       sync.Mutex
+	webhooks map[uint]models.AnalysisWebhook
+}
+
+// NewMemoryAnalysisWebhookStore returns an empty MemoryAnalysisWebhookStore.
+func NewMemoryAnalysisWebhookStore() *MemoryAnalysisWebhookStore {
+	return &MemoryAnalysisWebhookStore{webhooks: map[uint]models.AnalysisWebhook{}}
+}
+
+// Put implements AnalysisWebhookStore.
+func (s *MemoryAnalysisWebhookStore) Put(ctx context.Context, w *models.AnalysisWebhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks[w.UserID] = *w
+	return nil
+}
+
+// Get implements AnalysisWebhookStore.
+func (s *MemoryAnalysisWebhookStore) Get(ctx context.Context, userID uint) (*models.AnalysisWebhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.webhooks[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &w, nil
+}
+
+// Delete implements AnalysisWebhookStore.
+func (s *MemoryAnalysisWebhookStore) Delete(ctx context.Context, userID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.webhooks, userID)
+	return nil
+}
+
+// MemoryChatBus is a ChatBus for a single process, for tests and local
+// runs.
+type MemoryChatBus struct {
+	mu      sync.Mutex
+	logs    map[string][]ChatEvent
+	last    map[string]uint64
+	subs    map[string]map[*busSub]struct{}
+	signals map[string]map[*busSub]struct{}
+	locks   map[string]*sync.Once
+	slots   map[string]int
+}
+
+// NewMemoryChatBus returns an empty MemoryChatBus.
+func NewMemoryChatBus() *MemoryChatBus {
+	return &MemoryChatBus{
+		logs:    map[string][]ChatEvent{},
+		last:    map[string]uint64{},
+		subs:    map[string]map[*busSub]struct{}{},
+		signals: map[string]map[*busSub]struct{}{},
+		locks:   map[string]*sync.Once{},
+		slots:   map[string]int{},
+	}
+}
+
+// Publish implements ChatBus.
+func (b *MemoryChatBus) Publish(_ context.Context, key string, data []byte) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.last[key]++
+	ev := ChatEvent{Seq: b.last[key], Data: append([]byte(nil), data...)}
+	log := append(b.logs[key], ev)
+	if len(log) > chatEventMaxLen {
+		log = log[len(log)-chatEventMaxLen:]
+	}
+	b.logs[key] = log
+	for s := range b.subs[key] {
+		deliver(b.subs[key], s, ev, nil)
+	}
+	return ev.Seq, nil
+}
+
+// Last implements ChatBus.
+func (b *MemoryChatBus) Last(_ context.Context, key string) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last[key], nil
+}
+
+// Subscribe implements ChatBus.
+func (b *MemoryChatBus) Subscribe(ctx context.Context, key string, after uint64) (<-chan ChatEvent, error) {
+	s := &busSub{events: make(chan ChatEvent, subscriberBuffer)}
+	b.mu.Lock()
+	if b.subs[key] == nil {
+		b.subs[key] = map[*busSub]struct{}{}
+	}
+	b.subs[key][s] = struct{}{}
+	b.mu.Unlock()
+	out := make(chan ChatEvent)
+	go func() {
+		defer func() {
+			b.mu.Lock()
+			delete(b.subs[key], s)
+			b.mu.Unlock()
+		}()
+		pumpEvents(ctx, after, s.events, func(from, to uint64) ([]ChatEvent, error) {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			var evs []ChatEvent
+			for _, ev := range b.logs[key] {
+				if ev.Seq >= from && (to == 0 || ev.Seq <= to) {
+					evs = append(evs, ev)
+				}
+			}
+			return evs, nil
+		}, out)
+	}()
+	return out, nil
+}
+
+// Signal implements ChatBus.
+func (b *MemoryChatBus) Signal(_ context.Context, key string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.signals[key] {
+		deliver(b.signals[key], s, ChatEvent{}, append([]byte(nil), data...))
+	}
+	return nil
+}
+
+// Signals implements ChatBus.
+func (b *MemoryChatBus) Signals(ctx context.Context, key string) (<-chan []byte, error) {
+	s := &busSub{signals: make(chan []byte, subscriberBuffer)}
+	b.mu.Lock()
+	if b.signals[key] == nil {
+		b.signals[key] = map[*busSub]struct{}{}
+	}
+	b.signals[key][s] = struct{}{}
+	b.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.signals[key], s)
+		close(s.signals)
+		b.mu.Unlock()
+	}()
+	return s.signals, nil
+}
+
+// Lock implements ChatBus. Locks do not expire.
+func (b *MemoryChatBus) Lock(_ context.Context, name string, _ time.Duration) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.locks[name] != nil {
+		return nil, ErrLocked
+	}
+	once := &sync.Once{}
+	b.locks[name] = once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.locks, name)
+			b.mu.Unlock()
+		})
+	}, nil
+}
+
+// Acquire implements ChatBus. Slots do not expire.
+func (b *MemoryChatBus) Acquire(_ context.Context, name string, limit int, _ time.Duration) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.slots[name] >= limit {
+		return nil, ErrLimit
+	}
+	b.slots[name]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			if b.slots[name]--; b.slots[name] == 0 {
+				delete(b.slots, name)
+			}
+			b.mu.Unlock()
+		})
+	}, nil
+}
+
+// MemoryUsageCounters is in-memory UsageCounters for tests and local runs.
+// TTLs are ignored.
+type MemoryUsageCounters struct {
+	mu       sync.Mutex
+	counters map[UsageKey]models.Usage
+	dirty    map[UsageKey]bool
+}
+
+// NewMemoryUsageCounters returns empty MemoryUsageCounters.
+func NewMemoryUsageCounters() *MemoryUsageCounters {
+	return &MemoryUsageCounters{counters: map[UsageKey]models.Usage{}, dirty: map[UsageKey]bool{}}
+}
+
+// Get implements UsageCounters.
+func (c *MemoryUsageCounters) Get(ctx context.Context, k UsageKey) (models.Usage, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.counters[k]
+	return u, ok, nil
+}
+
+// Seed implements UsageCounters.
+func (c *MemoryUsageCounters) Seed(ctx context.Context, k UsageKey, u models.Usage, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.counters[k]; !ok {
+		c.counters[k] = u
+	}
+	return nil
+}
+
+// Add implements UsageCounters.
+func (c *MemoryUsageCounters) Add(ctx context.Context, k UsageKey, u models.Usage, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counters[k] = c.counters[k].Add(u)
+	c.dirty[k] = true
+	return nil
+}
+
+// Dirty implements UsageCounters.
+func (c *MemoryUsageCounters) Dirty(ctx context.Context, n int) ([]UsageKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []UsageKey
+	for k := range c.dirty {
+		if len(keys) == n {
+			break
+		}
+		keys = append(keys, k)
+		delete(c.dirty, k)
+	}
+	return keys, nil
+}
+
+// MemoryUsageStore is an in-memory UsageStore for tests and local runs.
+type MemoryUsageStore struct {
+	mu      sync.Mutex
+	records map[UsageKey]models.Usage
+}
+
+// NewMemoryUsageStore returns an empty MemoryUsageStore.
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{records: map[UsageKey]models.Usage{}}
+}
+
+// Get implements UsageStore.
+func (s *MemoryUsageStore) Get(ctx context.Context, k UsageKey) (models.Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[k], nil
+}
+
+// Put implements UsageStore.
+func (s *MemoryUsageStore) Put(ctx context.Context, k UsageKey, u models.Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[k] = u
+	return nil
+}
+
+// MemoryModerationStore is an in-memory ModerationStore for tests and for
+// chat services run without MongoDB.
+type MemoryModerationStore struct {
+	mu     sync.Mutex
+	events map[string]models.ModerationEvent
+}
+
+// NewMemoryModerationStore returns an empty MemoryModerationStore.
+func NewMemoryModerationStore() *MemoryModerationStore {
+	return &MemoryModerationStore{events: map[string]models.ModerationEvent{}}
+}
+
+// Record implements ModerationStore.
+func (s *MemoryModerationStore) Record(ctx context.Context, ev *models.ModerationEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := *ev
+	e.Findings = append([]models.ModerationFinding(nil), ev.Findings...)
+	s.events[ev.ID] = e
+	return nil
+}
+
+// Get implements ModerationStore.
+func (s *MemoryModerationStore) Get(ctx context.Context, id string) (*models.ModerationEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ev, ok := s.events[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &ev, nil
+}
+
+// List implements ModerationStore.
+func (s *MemoryModerationStore) List(ctx context.Context, f ModerationFilter, offset, limit int) ([]models.ModerationEvent, int64, error) {
+	s.mu.Lock()
+	var out []models.ModerationEvent
+	for _, ev := range s.events {
+		if (f.Status == "" || ev.Status == f.Status) && (f.UserID == 0 || ev.UserID == f.UserID) {
+			out = append(out, ev)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return page(out, offset, limit), int64(len(out)), nil
+}
+
+// Review implements ModerationStore.
+func (s *MemoryModerationStore) Review(ctx context.Context, id, status string, review models.ModerationReview) (*models.ModerationEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ev, ok := s.events[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if ev.Status != models.ModerationPending {
+		return nil, ErrReviewed
+	}
+	ev.Status, ev.Review = status, &review
+	s.events[id] = ev
+	return &ev, nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"matchmaker/internal/models"
+)
+
+// MongoModerationStore stores moderation events in the
+// "moderation_events" collection.
+type MongoModerationStore struct {
+	events *mongo.Collection
+}
+
+// NewMongoModerationStore stores moderation events in db.
+func NewMongoModerationStore(db *mongo.Database) *MongoModerationStore {
+	return &MongoModerationStore{events: db.Collection("moderation_events")}
+}
+
+// EnsureIndexes creates the indexes that list events by status and by
+// user, newest first.
+func (s *MongoModerationStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.events.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	return err
+}
+
+// Record implements ModerationStore.
+func (s *MongoModerationStore) Record(ctx context.Context, ev *models.ModerationEvent) error {
+	_, err := s.events.InsertOne(ctx, ev)
+	return err
+}
+
+// Get implements ModerationStore.
+func (s *MongoModerationStore) Get(ctx context.Context, id string) (*models.ModerationEvent, error) {
+	var ev models.ModerationEvent
+	err := s.events.FindOne(ctx, bson.M{"_id": id}).Decode(&ev)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// List implements ModerationStore.
+func (s *MongoModerationStore) List(ctx context.Context, f ModerationFilter, offset, limit int) ([]models.ModerationEvent, int64, error) {
+	filter := bson.M{}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+	if f.UserID != 0 {
+		filter["userId"] = f.UserID
+	}
+	total, err := s.events.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cur, err := s.events.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	out := []models.ModerationEvent{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+// Review implements ModerationStore. Only pending events match the update,
+// so concurrent reviews of an event cannot both succeed.
+func (s *MongoModerationStore) Review(ctx context.Context, id, status string, review models.ModerationReview) (*models.ModerationEvent, error) {
+	var ev models.ModerationEvent
+	err := s.events.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.ModerationPending},
+		bson.M{"$set": bson.M{"status": status, "review": review}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&ev)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := s.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrReviewed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
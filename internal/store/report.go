@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RedisReportStore is the L1 report cache.
+type RedisReportStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisReportStore caches reports in Redis for ttl.
+func NewRedisReportStore(client *redis.Client, ttl time.Duration) *RedisReportStore {
+	return &RedisReportStore{client: client, ttl: ttl}
+}
+
+// Get implements ReportStore.
+func (s *RedisReportStore) Get(ctx context.Context, key string) ([]byte, error) {
+	val, err := s.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	return val, err
+}
+
+// Put implements ReportStore.
+func (s *RedisReportStore) Put(ctx context.Context, key string, report []byte) error {
+	return s.client.Set(ctx, key, report, s.ttl).Err()
+}
+
+// MongoReportStore is the L2 report cache, stored in the "reports" collection.
+type MongoReportStore struct {
+	coll *mongo.Collection
+}
+
+// NewMongoReportStore stores reports in db.reports.
+func NewMongoReportStore(db *mongo.Database) *MongoReportStore {
+	return &MongoReportStore{coll: db.Collection("reports")}
+}
+
+// Get implements ReportStore.
+func (s *MongoReportStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var doc struct {
+		Report json.RawMessage `bson:"report"`
+	}
+	err := s.coll.FindOne(ctx, bson.M{"_id": key}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Report, nil
+}
+
+// Put implements ReportStore.
+func (s *MongoReportStore) Put(ctx context.Context, key string, report []byte) error {
+	_, err := s.coll.UpdateOne(ctx,
+		bson.M{"_id": key},
+		bson.M{"$set": bson.M{"report": report, "createdAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"matchmaker/internal/models"
+)
+
+// ErrNotFound is returned when a key or record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrLocked is returned by ChatBus.Lock when someone else holds the lock.
+var ErrLocked = errors.New("locked")
+
+// ErrLimit is returned by ChatBus.Acquire when every slot is taken.
+var ErrLimit = errors.New("limit reached")
+
+// ErrReviewed is returned by ModerationStore.Review when the event is not
+// pending review.
+var ErrReviewed = errors.New("already reviewed")
+
+// ReportStore is one cache level for astrology reports, keyed by report key.
+type ReportStore interface {
+	// Get returns the cached report or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, report []byte) error
+}
+
+// UserRepository persists user profiles.
+type UserRepository interface {
+	// FindOrCreateByEmail returns the user with email, creating it if needed.
+	// created reports whether a new user was inserted.
+	FindOrCreateByEmail(ctx context.Context, email string) (user *models.User, created bool, err error)
+	// Get returns the user with its birth details or ErrNotFound.
+	Get(ctx context.Context, id uint) (*models.User, error)
+	// GetProfile returns the user without its birth details or ErrNotFound.
+	GetProfile(ctx context.Context, id uint) (*models.User, error)
+	// Save updates the user's profile fields, leaving birth details untouched.
+	Save(ctx context.Context, user *models.User) error
+}
+
+// ChatHistoryStore keeps the running conversations of each user: one about
+// each analysis they discuss, and one, under analysisID "", not tied to any.
+type ChatHistoryStore interface {
+	// Get returns the stored conversation, or an empty one when there is
+	// none.
+	Get(ctx context.Context, userID uint, analysisID string) (models.ChatMemory, error)
+	Set(ctx context.Context, userID uint, analysisID string, memory models.ChatMemory, ttl time.Duration) error
+	// Delete forgets the conversation; forgetting one that is not stored is
+	// not an error.
+	Delete(ctx context.Context, userID uint, analysisID string) error
+}
+
+// ChatTranscriptStore keeps the full transcripts of the conversations
+// remembered by ChatHistoryStore, one session per conversation.
+type ChatTranscriptStore interface {
+	// Append adds msgs to the session of s.UserID about s.AnalysisID,
+	// creating it with s's ID and title on first use, numbers them and
+	// returns the updated session.
+	Append(ctx context.Context, s models.ChatSession, msgs []models.TranscriptMessage) (*models.ChatSession, error)
+	// FindSession returns the user's session about analysisID or
+	// ErrNotFound.
+	FindSession(ctx context.Context, userID uint, analysisID string) (*models.ChatSession, error)
+	// GetSession returns the session or ErrNotFound.
+	GetSession(ctx context.Context, id string) (*models.ChatSession, error)
+	// ListSessions returns up to limit of the user's sessions, most recently
+	// active first, skipping the first offset, and the total number the
+	// user has.
+	ListSessions(ctx context.Context, userID uint, offset, limit int) ([]models.ChatSession, int64, error)
+	// Messages returns up to limit messages of the session in order,
+	// skipping the first offset. A limit of 0 returns all of them.
+	Messages(ctx context.Context, sessionID string, offset, limit int) ([]models.TranscriptMessage, error)
+	// DeleteSession removes the session and its messages, or returns
+	// ErrNotFound.
+	DeleteSession(ctx context.Context, id string) error
+}
+
+// ChatEvent is one event of a conversation's log. Seq numbers the events
+// of a conversation from 1.
+type ChatEvent struct {
+	Seq  uint64
+	Data []byte
+}
+
+// ChatBus connects the chat replicas serving the sockets of a conversation,
+// so that any of them can follow an answer generated by another.
+type ChatBus interface {
+	// Publish appends data to the log of conversation key, delivers it to
+	// the subscribers of key and returns its sequence number.
+	Publish(ctx context.Context, key string, data []byte) (uint64, error)
+	// Last returns the sequence number of the latest event of key, or 0.
+	Last(ctx context.Context, key string) (uint64, error)
+	// Subscribe delivers the events of key numbered after after: first
+	// those still retained, then new ones as they are published. The
+	// channel is closed when ctx is done or when the subscriber falls too
+	// far behind.
+	Subscribe(ctx context.Context, key string, after uint64) (<-chan ChatEvent, error)
+	// Signal delivers data to the current Signals subscribers of key.
+	// Signals are not logged.
+	Signal(ctx context.Context, key string, data []byte) error
+	// Signals delivers the signals of key until ctx is done.
+	Signals(ctx context.Context, key string) (<-chan []byte, error)
+	// Lock takes the lock called name, keeping it until unlock is called,
+	// or for ttl should its holder die. It returns ErrLocked when the lock
+	// is held.
+	Lock(ctx context.Context, name string, ttl time.Duration) (unlock func(), err error)
+	// Acquire takes one of the limit slots called name, keeping it until
+	// release is called, or for ttl should its holder die. It returns
+	// ErrLimit when every slot is taken.
+	Acquire(ctx context.Context, name string, limit int, ttl time.Duration) (release func(), err error)
+}
+
+// ModerationFilter selects moderation events. Zero fields match any event.
+type ModerationFilter struct {
+	Status string
+	UserID uint
+}
+
+// ModerationStore keeps the audit log of moderation events and their
+// reviews. Events are never changed except to record their review.
+type ModerationStore interface {
+	Record(ctx context.Context, ev *models.ModerationEvent) error
+	// Get returns the event or ErrNotFound.
+	Get(ctx context.Context, id string) (*models.ModerationEvent, error)
+	// List returns up to limit of the events matching filter, newest first,
+	// skipping the first offset, and the total number matching.
+	List(ctx context.Context, filter ModerationFilter, offset, limit int) ([]models.ModerationEvent, int64, error)
+	// Review sets the status of a pending event to status and records
+	// review, returning the updated event, ErrNotFound, or ErrReviewed when
+	// the event is not pending.
+	Review(ctx context.Context, id, status string, review models.ModerationReview) (*models.ModerationEvent, error)
+}
+
+// AnalysisStore persists compatibility analyses.
+type AnalysisStore interface {
+	Create(ctx context.Context, a *models.Analysis) error
+	// Get returns the analysis or ErrNotFound.
+	Get(ctx context.Context, id string) (*models.Analysis, error)
+	// ListByUser returns up to limit of the user's analyses, newest first,
+	// skipping the first offset, and the total number the user has.
+	ListByUser(ctx context.Context, userID uint, offset, limit int) ([]models.Analysis, int64, error)
+	// Delete removes the analysis or returns ErrNotFound.
+	Delete(ctx context.Context, id string) error
+}
+
+// AnalysisJobStore keeps analysis jobs while they run and for a while
+// after.
+type AnalysisJobStore interface {
+	// Put creates or replaces the job.
+	Put(ctx context.Context, j *models.AnalysisJob) error
+	// Get returns the job or ErrNotFound.
+	Get(ctx context.Context, id string) (*models.AnalysisJob, error)
+}
+
+// AnalysisJobQueue hands queued analysis jobs, by ID, to the workers of the
+// match service. Each job is handed to one worker, which holds a lease on it
+// until it acknowledges the job; jobs whose lease runs out, such as those of
+// a worker that crashed, are queued again by Recover.
+type AnalysisJobQueue interface {
+	// Push queues the job with id.
+	Push(ctx context.Context, id string) error
+	// Pop waits up to timeout for a job and returns its ID, leased to the
+	// caller for AnalysisJobLease, or "" when none was queued in time.
+	Pop(ctx context.Context, timeout time.Duration) (string, error)
+	// Extend renews the lease on the popped job with id.
+	Extend(ctx context.Context, id string) error
+	// Ack removes the popped job with id for good.
+	Ack(ctx context.Context, id string) error
+	// Recover queues again the popped jobs whose lease has run out and
+	// returns how many it queued.
+	Recover(ctx context.Context) (int, error)
+}
+
+// AnalysisJobLease is how long a worker holds a job it popped without
+// extending the lease.
+const AnalysisJobLease = 30 * time.Second
+
+// AnalysisWebhookStore keeps the webhook each user has registered for
+// their analysis jobs.
+type AnalysisWebhookStore interface {
+	// Put creates or replaces the webhook of w.UserID.
+	Put(ctx context.Context, w *models.AnalysisWebhook) error
+	// Get returns the webhook of userID or ErrNotFound.
+	Get(ctx context.Context, userID uint) (*models.AnalysisWebhook, error)
+	// Delete removes the webhook of userID, if any.
+	Delete(ctx context.Context, userID uint) error
+}
@@ -0,0 +1,709 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"matchmaker/internal/models"
+)
+
+func newRedis(t *testing.T) *redis.Client {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	return redis.NewClient(&redis.Options{Addr: mr.Addr()})
+}
+
+// testReportStore exercises the ReportStore contract.
+func testReportStore(t *testing.T, s ReportStore) {
+	ctx := context.Background()
+	if _, err := s.Get(ctx, "k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := s.Put(ctx, "k", []byte(`{"a":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(ctx, "k")
+	if err != nil || string(got) != `{"a":1}` {
+		t.Fatalf("got %s, %v", got, err)
+	}
+}
+
+func TestReportStores(t *testing.T) {
+	t.Parallel()
+	t.Run("memory", func(t *testing.T) { testReportStore(t, NewMemoryReportStore()) })
+	t.Run("redis", func(t *testing.T) { testReportStore(t, NewRedisReportStore(newRedis(t), time.Hour)) })
+}
+
+func TestMongoReportStore(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("get and put", func(mt *mtest.T) {
+		s := NewMongoReportStore(mt.DB)
+		ns := "astrology.reports"
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: "k"}, {Key: "report", Value: []byte(`{"a":1}`)}}),
+		)
+		testReportStore(mt.T, s)
+	})
+}
+
+func TestChatHistory(t *testing.T) {
+	t.Parallel()
+	rdb := newRedis(t)
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	hi := models.ChatMemory{Messages: []models.ChatMessage{
+		{Role: "user", Content: "hi", At: at},
+		{Role: "assistant", Content: "hello", Tokens: 2, At: at},
+	}}
+	nadi := models.ChatMemory{Summary: "They asked about Nadi.", Messages: []models.ChatMessage{{Role: "user", Content: "nadi?", At: at}}}
+	for name, s := range map[string]ChatHistoryStore{
+		"memory": NewMemoryChatHistory(),
+		"redis":  NewRedisChatHistory(rdb),
+	} {
+		ctx := context.Background()
+		if v, err := s.Get(ctx, 1, ""); err != nil || v.Summary != "" || len(v.Messages) != 0 {
+			t.Fatalf("%s: expected empty history, got %+v %v", name, v, err)
+		}
+		if err := s.Set(ctx, 1, "", hi, time.Minute); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := s.Set(ctx, 1, "a1", nadi, time.Minute); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if v, _ := s.Get(ctx, 1, ""); !reflect.DeepEqual(v, hi) {
+			t.Fatalf("%s: unexpected history %+v", name, v)
+		}
+		if v, _ := s.Get(ctx, 1, "a1"); !reflect.DeepEqual(v, nadi) {
+			t.Fatalf("%s: unexpected analysis history %+v", name, v)
+		}
+	}
+
+	for name, s := range map[string]ChatHistoryStore{
+		"memory": NewMemoryChatHistory(),
+		"redis":  NewRedisChatHistory(rdb),
+	} {
+		ctx := context.Background()
+		s.Set(ctx, 3, "", hi, time.Minute)
+		if err := s.Delete(ctx, 3, ""); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if v, _ := s.Get(ctx, 3, ""); len(v.Messages) != 0 {
+			t.Fatalf("%s: history not deleted: %+v", name, v)
+		}
+	}
+
+	// Transcripts stored by earlier versions become the summary.
+	rdb.Set(context.Background(), "chat_context:2", "User: hi\nAI: hello\n", time.Minute)
+	if v, err := NewRedisChatHistory(rdb).Get(context.Background(), 2, ""); err != nil || v.Summary != "User: hi\nAI: hello\n" {
+		t.Fatalf("legacy history not read: %+v %v", v, err)
+	}
+}
+
+// nextEvent returns the next event of events, failing after a second.
+func nextEvent(t *testing.T, events <-chan ChatEvent) ChatEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return ChatEvent{}
+}
+
+func TestChatBus(t *testing.T) {
+	t.Parallel()
+	for name, b := range map[string]ChatBus{
+		"memory": NewMemoryChatBus(),
+		"redis":  NewRedisChatBus(newRedis(t)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			for i, data := range []string{"a", "b"} {
+				if seq, err := b.Publish(ctx, "1:", []byte(data)); err != nil || seq != uint64(i+1) {
+					t.Fatalf("unexpected publish %d %v", seq, err)
+				}
+			}
+			if last, err := b.Last(ctx, "1:"); err != nil || last != 2 {
+				t.Fatalf("unexpected last %d %v", last, err)
+			}
+
+			// A subscriber resuming after 1 gets the retained event, then
+			// live ones; other conversations are not delivered.
+			events, err := b.Subscribe(ctx, "1:", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev := nextEvent(t, events); ev.Seq != 2 || string(ev.Data) != "b" {
+				t.Fatalf("unexpected replayed event %+v", ev)
+			}
+			b.Publish(ctx, "1:a1", []byte("other"))
+			b.Publish(ctx, "1:", []byte("c"))
+			if ev := nextEvent(t, events); ev.Seq != 3 || string(ev.Data) != "c" {
+				t.Fatalf("unexpected live event %+v", ev)
+			}
+
+			sigCtx, stop := context.WithCancel(ctx)
+			signals, err := b.Signals(sigCtx, "1:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.Signal(ctx, "1:", []byte("cancel"))
+			select {
+			case s := <-signals:
+				if string(s) != "cancel" {
+					t.Fatalf("unexpected signal %q", s)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no signal")
+			}
+			stop()
+			for range signals {
+			}
+
+			unlock, err := b.Lock(ctx, "1:", time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := b.Lock(ctx, "1:", time.Minute); !errors.Is(err, ErrLocked) {
+				t.Fatalf("expected ErrLocked, got %v", err)
+			}
+			unlock()
+			unlock()
+			again, err := b.Lock(ctx, "1:", time.Minute)
+			if err != nil {
+				t.Fatalf("lock not released: %v", err)
+			}
+			again()
+
+			var releases []func()
+			for i := 0; i < 2; i++ {
+				release, err := b.Acquire(ctx, "conns:1", 2, time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+				releases = append(releases, release)
+			}
+			if _, err := b.Acquire(ctx, "conns:1", 2, time.Minute); !errors.Is(err, ErrLimit) {
+				t.Fatalf("expected ErrLimit, got %v", err)
+			}
+			releases[0]()
+			releases[0]()
+			release, err := b.Acquire(ctx, "conns:1", 2, time.Minute)
+			if err != nil {
+				t.Fatalf("slot not released: %v", err)
+			}
+			release()
+			releases[1]()
+
+			cancel()
+			for range events {
+			}
+		})
+	}
+}
+
+func TestMemoryChatTranscripts(t *testing.T) {
+	t.Parallel()
+	s := NewMemoryChatTranscripts()
+	ctx := context.Background()
+	msg := func(role, content string) models.TranscriptMessage {
+		return models.TranscriptMessage{Role: role, Content: content}
+	}
+	first, err := s.Append(ctx, models.ChatSession{ID: "s1", UserID: 1, Title: "hi"}, []models.TranscriptMessage{msg("user", "hi"), msg("assistant", "hello")})
+	if err != nil || first.ID != "s1" || first.MessageCount != 2 {
+		t.Fatalf("append: %+v %v", first, err)
+	}
+	// Later appends keep the session's ID and title.
+	next, _ := s.Append(ctx, models.ChatSession{ID: "ignored", UserID: 1, Title: "other"}, []models.TranscriptMessage{msg("user", "again")})
+	if next.ID != "s1" || next.Title != "hi" || next.MessageCount != 3 {
+		t.Fatalf("second append: %+v", next)
+	}
+	time.Sleep(time.Millisecond)
+	s.Append(ctx, models.ChatSession{ID: "s2", UserID: 1, AnalysisID: "a1"}, []models.TranscriptMessage{msg("user", "nadi?")})
+
+	if sess, err := s.FindSession(ctx, 1, "a1"); err != nil || sess.ID != "s2" {
+		t.Fatalf("find: %+v %v", sess, err)
+	}
+	if _, err := s.FindSession(ctx, 2, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	items, total, _ := s.ListSessions(ctx, 1, 0, 10)
+	if total != 2 || len(items) != 2 || items[0].ID != "s2" {
+		t.Fatalf("list: %+v %d", items, total)
+	}
+	msgs, _ := s.Messages(ctx, "s1", 1, 5)
+	if len(msgs) != 2 || msgs[0].Seq != 2 || msgs[1].Content != "again" {
+		t.Fatalf("messages: %+v", msgs)
+	}
+	if err := s.DeleteSession(ctx, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteSession(ctx, "s1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if msgs, _ := s.Messages(ctx, "s1", 0, 0); len(msgs) != 0 {
+		t.Fatalf("messages not deleted: %+v", msgs)
+	}
+}
+
+func TestMongoChatTranscripts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("append", func(mt *mtest.T) {
+		s := NewMongoChatTranscripts(mt.DB)
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "_id", Value: "s1"}, {Key: "userId", Value: 1}, {Key: "messageCount", Value: 5}}}},
+			mtest.CreateSuccessResponse(),
+		)
+		sess, err := s.Append(context.Background(), models.ChatSession{ID: "s1", UserID: 1}, []models.TranscriptMessage{{Role: "user"}, {Role: "assistant"}})
+		if err != nil || sess.ID != "s1" || sess.MessageCount != 5 {
+			mt.Fatalf("append: %+v %v", sess, err)
+		}
+		insert := mt.GetStartedEvent()
+		for insert != nil && insert.CommandName != "insert" {
+			insert = mt.GetStartedEvent()
+		}
+		if insert == nil {
+			mt.Fatal("messages not inserted")
+		}
+		docs := insert.Command.Lookup("documents").Array()
+		if seq, _ := docs.Index(0).Value().Document().Lookup("seq").AsInt64OK(); seq != 4 {
+			mt.Fatalf("expected first seq 4, got %d", seq)
+		}
+	})
+	mt.Run("messages and delete", func(mt *mtest.T) {
+		s := NewMongoChatTranscripts(mt.DB)
+		ns := "astrology.chat_messages"
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+			bson.D{{Key: "sessionId", Value: "s1"}, {Key: "seq", Value: int64(1)}, {Key: "role", Value: "user"}, {Key: "content", Value: "hi"}}))
+		msgs, err := s.Messages(context.Background(), "s1", 0, 0)
+		if err != nil || len(msgs) != 1 || msgs[0].Content != "hi" {
+			mt.Fatalf("messages: %+v %v", msgs, err)
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}})
+		if err := s.DeleteSession(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+			mt.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestMemoryModerationStore(t *testing.T) {
+	t.Parallel()
+	s := NewMemoryModerationStore()
+	ctx := context.Background()
+	now := time.Now()
+	s.Record(ctx, &models.ModerationEvent{ID: "e1", UserID: 1, Status: models.ModerationPending, CreatedAt: now})
+	s.Record(ctx, &models.ModerationEvent{ID: "e2", UserID: 2, Status: models.ModerationLogged, CreatedAt: now.Add(time.Second)})
+	s.Record(ctx, &models.ModerationEvent{ID: "e3", UserID: 1, Status: models.ModerationPending, CreatedAt: now.Add(2 * time.Second)})
+
+	items, total, _ := s.List(ctx, ModerationFilter{Status: models.ModerationPending}, 0, 10)
+	if total != 2 || len(items) != 2 || items[0].ID != "e3" {
+		t.Fatalf("list pending: %+v %d", items, total)
+	}
+	if items, total, _ := s.List(ctx, ModerationFilter{UserID: 2}, 0, 10); total != 1 || items[0].ID != "e2" {
+		t.Fatalf("list by user: %+v %d", items, total)
+	}
+	review := models.ModerationReview{ModeratorID: 9, Note: "ok", At: now}
+	ev, err := s.Review(ctx, "e1", models.ModerationDismissed, review)
+	if err != nil || ev.Status != models.ModerationDismissed || ev.Review == nil || ev.Review.ModeratorID != 9 {
+		t.Fatalf("review: %+v %v", ev, err)
+	}
+	if _, err := s.Review(ctx, "e1", models.ModerationUpheld, review); !errors.Is(err, ErrReviewed) {
+		t.Fatalf("expected ErrReviewed, got %v", err)
+	}
+	if _, err := s.Review(ctx, "e2", models.ModerationUpheld, review); !errors.Is(err, ErrReviewed) {
+		t.Fatalf("logged events are not reviewable, got %v", err)
+	}
+	if _, err := s.Review(ctx, "missing", models.ModerationUpheld, review); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMongoModerationStore(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	review := models.ModerationReview{ModeratorID: 9}
+	mt.Run("review", func(mt *mtest.T) {
+		s := NewMongoModerationStore(mt.DB)
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "_id", Value: "e1"}, {Key: "status", Value: "upheld"}}}})
+		ev, err := s.Review(context.Background(), "e1", models.ModerationUpheld, review)
+		if err != nil || ev.ID != "e1" || ev.Status != models.ModerationUpheld {
+			mt.Fatalf("review: %+v %v", ev, err)
+		}
+	})
+	mt.Run("already reviewed", func(mt *mtest.T) {
+		s := NewMongoModerationStore(mt.DB)
+		ns := "astrology.moderation_events"
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: "e1"}, {Key: "status", Value: "dismissed"}}),
+		)
+		if _, err := s.Review(context.Background(), "e1", models.ModerationUpheld, review); !errors.Is(err, ErrReviewed) {
+			mt.Fatalf("expected ErrReviewed, got %v", err)
+		}
+	})
+	mt.Run("missing", func(mt *mtest.T) {
+		s := NewMongoModerationStore(mt.DB)
+		ns := "astrology.moderation_events"
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+		)
+		if _, err := s.Review(context.Background(), "e1", models.ModerationUpheld, review); !errors.Is(err, ErrNotFound) {
+			mt.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func newGormRepo(t *testing.T) *GormUserRepository {
+	dsn := fmt.Sprintf("file:%d?mode=memory&cache=shared", time.Now().UnixNano())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.BirthDetail{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return NewGormUserRepository(db)
+}
+
+func TestUserRepositories(t *testing.T) {
+	t.Parallel()
+	for name, repo := range map[string]UserRepository{
+		"memory": NewMemoryUserRepository(),
+		"gorm":   newGormRepo(t),
+	} {
+		ctx := context.Background()
+		u, created, err := repo.FindOrCreateByEmail(ctx, "a@b.com")
+		if err != nil || !created || u.ID == 0 {
+			t.Fatalf("%s: create: %+v %v %v", name, u, created, err)
+		}
+		again, created, err := repo.FindOrCreateByEmail(ctx, "a@b.com")
+		if err != nil || created || again.ID != u.ID {
+			t.Fatalf("%s: find: %+v %v %v", name, again, created, err)
+		}
+		u.Location = "LA"
+		if err := repo.Save(ctx, u); err != nil {
+			t.Fatalf("%s: save: %v", name, err)
+		}
+		got, err := repo.Get(ctx, u.ID)
+		if err != nil || got.Location != "LA" {
+			t.Fatalf("%s: get: %+v %v", name, got, err)
+		}
+		if _, err := repo.Get(ctx, 999); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: expected ErrNotFound, got %v", name, err)
+		}
+		if _, err := repo.GetProfile(ctx, 999); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: expected ErrNotFound, got %v", name, err)
+		}
+	}
+
+	// Only Get loads birth details.
+	repo := newGormRepo(t)
+	ctx := context.Background()
+	u, _, _ := repo.FindOrCreateByEmail(ctx, "a@b.com")
+	dob := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := repo.db.Create(&models.BirthDetail{UserID: u.ID, DOB: dob, TOB: "12:00:00"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repo.Get(ctx, u.ID); err != nil || !got.BirthDetail.DOB.Equal(dob) {
+		t.Fatalf("get: %+v %v", got, err)
+	}
+	if got, err := repo.GetProfile(ctx, u.ID); err != nil || got.BirthDetail.ID != 0 || got.Email != "a@b.com" {
+		t.Fatalf("get profile: %+v %v", got, err)
+	}
+}
+
+// testUsageCounters exercises the UsageCounters contract.
+func testUsageCounters(t *testing.T, c UsageCounters) {
+	ctx := context.Background()
+	k := UsageKey{UserID: 7, Period: "2026-10"}
+	if _, ok, err := c.Get(ctx, k); ok || err != nil {
+		t.Fatalf("unseeded counter: %v %v", ok, err)
+	}
+	if err := c.Seed(ctx, k, models.Usage{Messages: 2, PromptTokens: 20}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Seed(ctx, k, models.Usage{Messages: 9}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(ctx, k, models.Usage{Messages: 1, PromptTokens: 5, CompletionTokens: 7}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	u, ok, err := c.Get(ctx, k)
+	if want := (models.Usage{Messages: 3, PromptTokens: 25, CompletionTokens: 7}); !ok || err != nil || u != want {
+		t.Fatalf("got %+v %v %v, want %+v", u, ok, err, want)
+	}
+	dirty, err := c.Dirty(ctx, 10)
+	if err != nil || len(dirty) != 1 || dirty[0] != k {
+		t.Fatalf("dirty: %v %v", dirty, err)
+	}
+	if dirty, err := c.Dirty(ctx, 10); err != nil || len(dirty) != 0 {
+		t.Fatalf("dirty twice: %v %v", dirty, err)
+	}
+}
+
+func TestUsageCounters(t *testing.T) {
+	t.Parallel()
+	t.Run("memory", func(t *testing.T) { testUsageCounters(t, NewMemoryUsageCounters()) })
+	t.Run("redis", func(t *testing.T) { testUsageCounters(t, NewRedisUsageCounters(newRedis(t))) })
+}
+
+func TestUsageStores(t *testing.T) {
+	t.Parallel()
+	repo := newGormRepo(t)
+	if err := repo.db.AutoMigrate(&models.UsageRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]UsageStore{
+		"memory": NewMemoryUsageStore(),
+		"gorm":   NewGormUsageStore(repo.db),
+	} {
+		ctx := context.Background()
+		k := UsageKey{UserID: 1, Period: "2026-10-19"}
+		if u, err := s.Get(ctx, k); err != nil || u != (models.Usage{}) {
+			t.Fatalf("%s: missing record: %+v %v", name, u, err)
+		}
+		for _, u := range []models.Usage{{Messages: 1, PromptTokens: 10}, {Messages: 2, PromptTokens: 30, CompletionTokens: 4}} {
+			if err := s.Put(ctx, k, u); err != nil {
+				t.Fatalf("%s: put: %v", name, err)
+			}
+		}
+		if u, err := s.Get(ctx, k); err != nil || u != (models.Usage{Messages: 2, PromptTokens: 30, CompletionTokens: 4}) {
+			t.Fatalf("%s: get: %+v %v", name, u, err)
+		}
+	}
+}
+
+func TestUserPlan(t *testing.T) {
+	t.Parallel()
+	repo := newGormRepo(t)
+	ctx := context.Background()
+	u, _, err := repo.FindOrCreateByEmail(ctx, "a@b.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan, err := repo.Plan(ctx, u.ID); err != nil || plan != "free" {
+		t.Fatalf("default plan: %q %v", plan, err)
+	}
+	if _, err := repo.Plan(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemoryAnalysisStore(t *testing.T) {
+	t.Parallel()
+	s := NewMemoryAnalysisStore()
+	ctx := context.Background()
+	base := time.Now()
+	for i, uid := range []uint{1, 1, 2, 1} {
+		a := &models.Analysis{ID: fmt.Sprint(i), UserID: uid, CreatedAt: base.Add(time.Duration(i) * time.Minute)}
+		if err := s.Create(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page, total, err := s.ListByUser(ctx, 1, 1, 1)
+	if err != nil || total != 3 || len(page) != 1 || page[0].ID != "1" {
+		t.Fatalf("list: %+v %d %v", page, total, err)
+	}
+	if page, _, _ := s.ListByUser(ctx, 1, 5, 10); len(page) != 0 {
+		t.Fatalf("offset past end: %+v", page)
+	}
+	if err := s.Delete(ctx, "0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "0"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := s.Delete(ctx, "0"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestAnalysisJobStores(t *testing.T) {
+	t.Parallel()
+	for name, s := range map[string]AnalysisJobStore{
+		"memory": NewMemoryAnalysisJobStore(),
+		"redis":  NewRedisAnalysisJobStore(newRedis(t), time.Hour),
+	} {
+		ctx := context.Background()
+		if _, err := s.Get(ctx, "j1"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: expected ErrNotFound, got %v", name, err)
+		}
+		at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		j := &models.AnalysisJob{ID: "j1", UserID: 1, Kind: models.JobBatch, Status: models.JobQueued, Request: []byte(`{"a":1}`), CreatedAt: at, UpdatedAt: at}
+		if err := s.Put(ctx, j); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		j.Status, j.Result = models.JobSucceeded, []byte(`{"b":2}`)
+		if err := s.Put(ctx, j); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, err := s.Get(ctx, "j1"); err != nil || !reflect.DeepEqual(got, j) || !got.Done() {
+			t.Fatalf("%s: got %+v %v", name, got, err)
+		}
+	}
+}
+
+func TestAnalysisJobQueues(t *testing.T) {
+	t.Parallel()
+	for name, q := range map[string]AnalysisJobQueue{
+		"memory": NewMemoryAnalysisJobQueue(),
+		"redis":  NewRedisAnalysisJobQueue(newRedis(t)),
+	} {
+		ctx := context.Background()
+		if id, err := q.Pop(ctx, 10*time.Millisecond); err != nil || id != "" {
+			t.Fatalf("%s: empty queue gave %q %v", name, id, err)
+		}
+		for _, id := range []string{"j1", "j2"} {
+			if err := q.Push(ctx, id); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		for _, want := range []string{"j1", "j2"} {
+			if id, err := q.Pop(ctx, time.Second); err != nil || id != want {
+				t.Fatalf("%s: popped %q %v, want %s", name, id, err, want)
+			}
+			if err := q.Ack(ctx, want); err != nil {
+				t.Fatalf("%s: ack: %v", name, err)
+			}
+		}
+
+		// A waiting worker gets a job pushed while it waits.
+		popped := make(chan string)
+		go func() {
+			id, _ := q.Pop(ctx, 5*time.Second)
+			popped <- id
+		}()
+		time.Sleep(20 * time.Millisecond)
+		q.Push(ctx, "j3")
+		if id := <-popped; id != "j3" {
+			t.Fatalf("%s: waiting pop got %q", name, id)
+		}
+	}
+}
+
+func TestRedisAnalysisJobQueueRecover(t *testing.T) {
+	t.Parallel()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	q := NewRedisAnalysisJobQueue(client)
+	q.grace = time.Millisecond
+	ctx := context.Background()
+	for _, id := range []string{"done", "crashed", "running"} {
+		q.Push(ctx, id)
+		if got, err := q.Pop(ctx, time.Second); err != nil || got != id {
+			t.Fatalf("popped %q %v, want %s", got, err, id)
+		}
+	}
+	if err := q.Ack(ctx, "done"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Leased jobs stay with their worker.
+	if n, err := q.Recover(ctx); err != nil || n != 0 {
+		t.Fatalf("recovered %d %v while leased", n, err)
+	}
+	mr.FastForward(AnalysisJobLease / 2)
+	q.Extend(ctx, "running")
+	mr.FastForward(AnalysisJobLease / 2)
+	if n, err := q.Recover(ctx); err != nil || n != 1 {
+		t.Fatalf("recovered %d %v, want 1", n, err)
+	}
+	if id, err := q.Pop(ctx, time.Second); err != nil || id != "crashed" {
+		t.Fatalf("popped %q %v after recovery", id, err)
+	}
+	q.Ack(ctx, "crashed")
+	q.Ack(ctx, "running")
+	if n, _ := client.LLen(ctx, analysisJobProcessingKey).Result(); n != 0 {
+		t.Fatalf("%d jobs left in processing", n)
+	}
+}
+
+func TestAnalysisWebhookStores(t *testing.T) {
+	t.Parallel()
+	for name, s := range map[string]AnalysisWebhookStore{
+		"memory": NewMemoryAnalysisWebhookStore(),
+		"redis":  NewRedisAnalysisWebhookStore(newRedis(t)),
+	} {
+		ctx := context.Background()
+		if _, err := s.Get(ctx, 1); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: expected ErrNotFound, got %v", name, err)
+		}
+		w := &models.AnalysisWebhook{UserID: 1, URL: "https://example.com/hook", Secret: "s3cret", CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+		if err := s.Put(ctx, w); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, err := s.Get(ctx, 1); err != nil || !reflect.DeepEqual(got, w) {
+			t.Fatalf("%s: got %+v %v", name, got, err)
+		}
+		if _, err := s.Get(ctx, 2); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: webhook of another user: %v", name, err)
+		}
+		if err := s.Delete(ctx, 1); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := s.Get(ctx, 1); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: deleted webhook: %v", name, err)
+		}
+	}
+}
+
+func TestMongoAnalysisStore(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ns := "astrology.analyses"
+	mt.Run("create get delete", func(mt *mtest.T) {
+		s := NewMongoAnalysisStore(mt.DB)
+		ctx := context.Background()
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		if err := s.Create(ctx, &models.Analysis{ID: "a1", UserID: 1, Score: 80}); err != nil {
+			mt.Fatal(err)
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: "a1"}, {Key: "userId", Value: 1}, {Key: "score", Value: 80}}))
+		a, err := s.Get(ctx, "a1")
+		if err != nil || a.UserID != 1 || a.Score != 80 {
+			mt.Fatalf("get: %+v %v", a, err)
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch))
+		if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			mt.Fatalf("expected ErrNotFound, got %v", err)
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}})
+		if err := s.Delete(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			mt.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+	mt.Run("list", func(mt *mtest.T) {
+		s := NewMongoAnalysisStore(mt.DB)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: 2}}),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "_id", Value: "a2"}, {Key: "userId", Value: 1}}),
+		)
+		items, total, err := s.ListByUser(context.Background(), 1, 0, 1)
+		if err != nil || total != 2 || len(items) != 1 || items[0].ID != "a2" {
+			mt.Fatalf("list: %+v %d %v", items, total, err)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"matchmaker/internal/models"
+)
+
+// MongoChatTranscripts stores chat sessions in the "chat_sessions"
+// collection and their messages in "chat_messages".
+type MongoChatTranscripts struct {
+	sessions *mongo.Collection
+	messages *mongo.Collection
+}
+
+// NewMongoChatTranscripts stores transcripts in db.
+func NewMongoChatTranscripts(db *mongo.Database) *MongoChatTranscripts {
+	return &MongoChatTranscripts{sessions: db.Collection("chat_sessions"), messages: db.Collection("chat_messages")}
+}
+
+// EnsureIndexes creates the indexes that keep one session per conversation
+// and list sessions and messages in order.
+func (s *MongoChatTranscripts) EnsureIndexes(ctx context.Context) error {
+	if _, err := s.sessions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "analysisId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "updatedAt", Value: -1}}},
+	}); err != nil {
+		return err
+	}
+	_, err := s.messages.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "sessionId", Value: 1}, {Key: "seq", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// Append implements ChatTranscriptStore. The session's message count is
+// incremented first, reserving the sequence numbers of msgs.
+func (s *MongoChatTranscripts) Append(ctx context.Context, sess models.ChatSession, msgs []models.TranscriptMessage) (*models.ChatSession, error) {
+	now := time.Now().UTC()
+	filter := bson.M{"userId": sess.UserID, "analysisId": sess.AnalysisID}
+	update := bson.M{
+		"$setOnInsert": bson.M{"_id": sess.ID, "title": sess.Title, "createdAt": now},
+		"$set":         bson.M{"updatedAt": now},
+		"$inc":         bson.M{"messageCount": len(msgs)},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var cur models.ChatSession
+	err := s.sessions.FindOneAndUpdate(ctx, filter, update, opts).Decode(&cur)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another writer created the session first; it matches now.
+		err = s.sessions.FindOneAndUpdate(ctx, filter, update, opts).Decode(&cur)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return &cur, nil
+	}
+	docs := make([]interface{}, len(msgs))
+	first := cur.MessageCount - int64(len(msgs)) + 1
+	for i, m := range msgs {
+		m.SessionID, m.Seq = cur.ID, first+int64(i)
+		docs[i] = m
+	}
+	if _, err := s.messages.InsertMany(ctx, docs); err != nil {
+		return nil, err
+	}
+	return &cur, nil
+}
+
+func (s *MongoChatTranscripts) findSession(ctx context.Context, filter bson.M) (*models.ChatSession, error) {
+	var sess models.ChatSession
+	err := s.sessions.FindOne(ctx, filter).Decode(&sess)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// FindSession implements ChatTranscriptStore.
+func (s *MongoChatTranscripts) FindSession(ctx context.Context, userID uint, analysisID string) (*models.ChatSession, error) {
+	return s.findSession(ctx, bson.M{"userId": userID, "analysisId": analysisID})
+}
+
+// GetSession implements ChatTranscriptStore.
+func (s *MongoChatTranscripts) GetSession(ctx context.Context, id string) (*models.ChatSession, error) {
+	return s.findSession(ctx, bson.M{"_id": id})
+}
+
+// ListSessions implements ChatTranscriptStore.
+func (s *MongoChatTranscripts) ListSessions(ctx context.Context, userID uint, offset, limit int) ([]models.ChatSession, int64, error) {
+	filter := bson.M{"userId": userID}
+	total, err := s.sessions.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cur, err := s.sessions.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	out := []models.ChatSession{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+// Messages implements ChatTranscriptStore.
+func (s *MongoChatTranscripts) Messages(ctx context.Context, sessionID string, offset, limit int) ([]models.TranscriptMessage, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "seq", Value: 1}}).
+		SetSkip(int64(offset))
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cur, err := s.messages.Find(ctx, bson.M{"sessionId": sessionID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := []models.TranscriptMessage{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteSession implements ChatTranscriptStore.
+func (s *MongoChatTranscripts) DeleteSession(ctx context.Context, id string) error {
+	res, err := s.sessions.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = s.messages.DeleteMany(ctx, bson.M{"sessionId": id})
+	return err
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"matchmaker/internal/models"
+)
+
+// UsageKey names the usage counter of a user in a period.
+type UsageKey struct {
+	UserID uint
+	Period string
+}
+
+func (k UsageKey) String() string {
+	return fmt.Sprintf("%d:%s", k.UserID, k.Period)
+}
+
+func parseUsageKey(s string) (UsageKey, error) {
+	id, period, ok := strings.Cut(s, ":")
+	if !ok {
+		return UsageKey{}, fmt.Errorf("malformed usage key %q", s)
+	}
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return UsageKey{}, fmt.Errorf("malformed usage key %q", s)
+	}
+	return UsageKey{UserID: uint(n), Period: period}, nil
+}
+
+// UsageCounters counts usage as it happens, ahead of UsageStore.
+type UsageCounters interface {
+	// Get returns the usage counted for k. ok is false when k is not
+	// counted yet, or any more, and must be seeded from UsageStore.
+	Get(ctx context.Context, k UsageKey) (u models.Usage, ok bool, err error)
+	// Seed starts counting k from u, unless it is already counted.
+	Seed(ctx context.Context, k UsageKey, u models.Usage, ttl time.Duration) error
+	// Add adds u to the usage of k, keeps it for ttl and marks it dirty.
+	Add(ctx context.Context, k UsageKey, u models.Usage, ttl time.Duration) error
+	// Dirty returns up to n of the counters changed since they were last
+	// returned by Dirty.
+	Dirty(ctx context.Context, n int) ([]UsageKey, error)
+}
+
+// UsageStore persists usage records.
+type UsageStore interface {
+	// Get returns the recorded usage of k, or zero usage when there is
+	// none.
+	Get(ctx context.Context, k UsageKey) (models.Usage, error)
+	// Put saves the usage of k.
+	Put(ctx context.Context, k UsageKey, u models.Usage) error
+}
+
+// usageDirtyKey is the set of usage counters not yet persisted.
+const usageDirtyKey = "usage:dirty"
+
+// RedisUsageCounters keeps counters in hashes under usage:<user id>:<period>.
+type RedisUsageCounters struct {
+	client *redis.Client
+}
+
+// NewRedisUsageCounters returns UsageCounters backed by client.
+func NewRedisUsageCounters(client *redis.Client) *RedisUsageCounters {
+	return &RedisUsageCounters{client: client}
+}
+
+func usageKey(k UsageKey) string {
+	return "usage:" + k.String()
+}
+
+// seedScript sets a counter unless it exists.
+var seedScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then return 0 end
+redis.call("HSET", KEYS[1], "messages", ARGV[1], "prompt", ARGV[2], "completion", ARGV[3])
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return 1
+`)
+
+// addScript increments a counter and marks it dirty, atomically so a flush
+// never misses an increment.
+var addScript = redis.NewScript(`
+redis.call("HINCRBY", KEYS[1], "messages", ARGV[1])
+redis.call("HINCRBY", KEYS[1], "prompt", ARGV[2])
+redis.call("HINCRBY", KEYS[1], "completion", ARGV[3])
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+redis.call("SADD", KEYS[2], ARGV[5])
+return 1
+`)
+
+// Get implements UsageCounters.
+func (c *RedisUsageCounters) Get(ctx context.Context, k UsageKey) (models.Usage, bool, error) {
+	vals, err := c.client.HGetAll(ctx, usageKey(k)).Result()
+	if err != nil || len(vals) == 0 {
+		return models.Usage{}, false, err
+	}
+	var u models.Usage
+	for field, dst := range map[string]*int64{"messages": &u.Messages, "prompt": &u.PromptTokens, "completion": &u.CompletionTokens} {
+		if v, ok := vals[field]; ok {
+			if *dst, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return models.Usage{}, false, fmt.Errorf("usage counter %s: %w", k, err)
+			}
+		}
+	}
+	return u, true, nil
+}
+
+// Seed implements UsageCounters.
+func (c *RedisUsageCounters) Seed(ctx context.Context, k UsageKey, u models.Usage, ttl time.Duration) error {
+	return seedScript.Run(ctx, c.client, []string{usageKey(k)}, u.Messages, u.PromptTokens, u.CompletionTokens, ttl.Milliseconds()).Err()
+}
+
+// Add implements UsageCounters.
+func (c *RedisUsageCounters) Add(ctx context.Context, k UsageKey, u models.Usage, ttl time.Duration) error {
+	keys := []string{usageKey(k), usageDirtyKey}
+	return addScript.Run(ctx, c.client, keys, u.Messages, u.PromptTokens, u.CompletionTokens, ttl.Milliseconds(), k.String()).Err()
+}
+
+// Dirty implements UsageCounters.
+func (c *RedisUsageCounters) Dirty(ctx context.Context, n int) ([]UsageKey, error) {
+	members, err := c.client.SPopN(ctx, usageDirtyKey, int64(n)).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]UsageKey, 0, len(members))
+	for _, m := range members {
+		k, err := parseUsageKey(m)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// GormUsageStore stores usage records in a SQL database through GORM.
+type GormUsageStore struct {
+	db *gorm.DB
+}
+
+// NewGormUsageStore returns a UsageStore backed by db.
+func NewGormUsageStore(db *gorm.DB) *GormUsageStore {
+	return &GormUsageStore{db: db}
+}
+
+// Get implements UsageStore.
+func (s *GormUsageStore) Get(ctx context.Context, k UsageKey) (models.Usage, error) {
+	var rec models.UsageRecord
+	err := s.db.WithContext(ctx).Where("user_id = ? AND period = ?", k.UserID, k.Period).First(&rec).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Usage{}, nil
+	}
+	return rec.Usage, err
+}
+
+// Put implements UsageStore.
+func (s *GormUsageStore) Put(ctx context.Context, k UsageKey, u models.Usage) error {
+	rec := models.UsageRecord{UserID: k.UserID, Period: k.Period, Usage: u}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "period"}},
+		DoUpdates: clause.AssignmentColumns([]string{"messages", "prompt_tokens", "completion_tokens", "updated_at"}),
+	}).Create(&rec).Error
+}
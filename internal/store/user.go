@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"matchmaker/internal/models"
+)
+
+// GormUserRepository stores users in a SQL database through GORM.
+type GormUserRepository struct {
+	db *gorm.DB
+}
+
+// NewGormUserRepository returns a UserRepository backed by db.
+func NewGormUserRepository(db *gorm.DB) *GormUserRepository {
+	return &GormUserRepository{db: db}
+}
+
+// FindOrCreateByEmail implements UserRepository.
+func (r *GormUserRepository) FindOrCreateByEmail(ctx context.Context, email string) (*models.User, bool, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	if err == nil {
+		return &user, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+	user = models.User{Email: email}
+	if err := r.db.WithContext(ctx).Create(&user).Error; err != nil {
+		return nil, false, err
+	}
+	return &user, true, nil
+}
+
+// Get implements UserRepository.
+func (r *GormUserRepository) Get(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Preload("BirthDetail").First(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetProfile implements UserRepository.
+func (r *GormUserRepository) GetProfile(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).First(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Save implements UserRepository.
+func (r *GormUserRepository) Save(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(user).Error
+}
+
+// Plan returns the name of the user's chat plan or ErrNotFound.
+func (r *GormUserRepository) Plan(ctx context.Context, id uint) (string, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Select("id", "plan").First(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrNotFound
+	}
+	return user.Plan, err
+}